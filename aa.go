@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultAAWindow is the default number of A/A sample pairs kept per provider.
+const defaultAAWindow = 1000
+
+var aaDuration = newHistogramVec(
+	"provider_aa_duration_seconds",
+	"Duration of the A/A sampled provider calls by arm (a - the served call, b - its duplicate).",
+	defaultDurationBuckets,
+	"provider", "arm",
+)
+
+// AATester duplicates a sample of provider calls and compares the latencies of both calls.
+// Both calls go to the same provider at the same time, so upstream changes affect them equally,
+// while diverging distributions point to client-side problems, like an exhausted connection pool.
+type AATester struct {
+	sampleRatio float64
+	window      int
+	random      func() float64
+
+	samples map[Provider]*aaSamples
+	m       sync.Mutex
+}
+
+// aaSamples is a ring buffer of the latency pairs of one provider.
+type aaSamples struct {
+	a, b []time.Duration
+	next int
+}
+
+// AAReport compares the latencies of the A/A sampled calls of a provider.
+type AAReport struct {
+	Provider Provider         `json:"provider"`
+	Samples  int              `json:"samples"`
+	A        LatencyQuantiles `json:"a"`
+	B        LatencyQuantiles `json:"b"`
+	Ratio    LatencyQuantiles `json:"ratio"`
+}
+
+// LatencyQuantiles are latency distribution quantiles, in milliseconds (or B/A ratios in AAReport.Ratio).
+type LatencyQuantiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// NewAATester returns a tester duplicating `sampleRatio` of the calls and keeping the last `window` pairs per provider.
+func NewAATester(sampleRatio float64, window int) *AATester {
+	if window <= 0 {
+		window = defaultAAWindow
+	}
+	return &AATester{
+		sampleRatio: sampleRatio,
+		window:      window,
+		random:      rand.Float64,
+		samples:     make(map[Provider]*aaSamples),
+	}
+}
+
+// sample tells whether a call should be duplicated.
+func (t *AATester) sample() bool {
+	return t.random() < t.sampleRatio
+}
+
+// Record adds a pair of successful call durations, replacing the oldest one when the window is full.
+func (t *AATester) Record(p Provider, a, b time.Duration) {
+	aaDuration.Observe(a.Seconds(), string(p), "a")
+	aaDuration.Observe(b.Seconds(), string(p), "b")
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	s, ok := t.samples[p]
+	if !ok {
+		s = &aaSamples{}
+		t.samples[p] = s
+	}
+	if len(s.a) < t.window {
+		s.a = append(s.a, a)
+		s.b = append(s.b, b)
+		return
+	}
+	s.a[s.next], s.b[s.next] = a, b
+	s.next = (s.next + 1) % t.window
+}
+
+// Report returns the comparison for all sampled providers, ordered by provider.
+func (t *AATester) Report() []AAReport {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	reports := make([]AAReport, 0, len(t.samples))
+	for p, s := range t.samples {
+		a, b := latencyQuantiles(s.a), latencyQuantiles(s.b)
+		reports = append(reports, AAReport{
+			Provider: p,
+			Samples:  len(s.a),
+			A:        a,
+			B:        b,
+			Ratio: LatencyQuantiles{
+				P50: ratio(b.P50, a.P50),
+				P90: ratio(b.P90, a.P90),
+				P99: ratio(b.P99, a.P99),
+			},
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Provider < reports[j].Provider
+	})
+
+	return reports
+}
+
+// latencyQuantiles returns the nearest-rank quantiles of the durations.
+func latencyQuantiles(durations []time.Duration) LatencyQuantiles {
+	if len(durations) == 0 {
+		return LatencyQuantiles{}
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	at := func(q float64) float64 {
+		idx := int(q*float64(len(sorted))+0.5) - 1
+		idx = max(0, min(idx, len(sorted)-1))
+		return float64(sorted[idx]) / float64(time.Millisecond)
+	}
+
+	return LatencyQuantiles{P50: at(0.5), P90: at(0.9), P99: at(0.99)}
+}
+
+func ratio(x, y float64) float64 {
+	if y == 0 {
+		return 0
+	}
+	return x / y
+}
+
+// aaClient is a Client decorator duplicating a sample of the calls for the AATester.
+// It wraps the provider client directly, so the duplicates don't affect the metrics, the cache or the circuit breakers.
+type aaClient struct {
+	client   Client
+	provider Provider
+	tester   *AATester
+	fetches  *fetchGroup
+}
+
+// GetContent implements Client.
+func (c *aaClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	// Bots aren't part of the experiments.
+	if meta.Device.Class == DeviceBot || !c.tester.sample() {
+		return c.client.GetContent(ctx, meta, count)
+	}
+
+	// The duplicate must not be cancelled when the served call returns and the request finishes,
+	// but it must not outlive the request deadline either.
+	dupCtx := context.WithoutCancel(ctx)
+	cancel := context.CancelFunc(func() {})
+	if deadline, ok := ctx.Deadline(); ok {
+		dupCtx, cancel = context.WithDeadline(dupCtx, deadline)
+	}
+	dup := make(chan time.Duration, 1)
+	c.fetches.add()
+	go func() {
+		defer c.fetches.done()
+		defer cancel()
+		start := time.Now()
+		if _, err := c.client.GetContent(dupCtx, meta, count); err != nil {
+			close(dup)
+			return
+		}
+		dup <- time.Since(start)
+	}()
+
+	start := time.Now()
+	items, err := c.client.GetContent(ctx, meta, count)
+	if err != nil {
+		return nil, err
+	}
+	a := time.Since(start)
+	go func() {
+		if b, ok := <-dup; ok {
+			c.tester.Record(c.provider, a, b)
+		}
+	}()
+
+	return items, nil
+}
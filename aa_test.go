@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAATesting(t *testing.T) {
+	p1 := &mockContentProvider{source: Provider1}
+	clients := map[Provider]Client{Provider1: p1}
+	service, err := NewService([]ContentConfig{{Type: Provider1}}, clients, defaultTimeout, WithAATesting(1, 2))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 1, 0); err != nil {
+			t.Fatalf("getting content: %v", err)
+		}
+	}
+
+	// The pairs are recorded in the background.
+	deadline := time.Now().Add(time.Second)
+	var report []AAReport
+	for time.Now().Before(deadline) {
+		if report = service.AAReport(); len(report) == 1 && report[0].Samples == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(report) != 1 || report[0].Provider != Provider1 || report[0].Samples != 2 {
+		t.Errorf("got report %+v, want 2 samples (the window size) for provider 1", report)
+	}
+	// The duplicates may still run after the responses are served.
+	if err := service.Drain(context.Background()); err != nil {
+		t.Fatalf("draining: %v", err)
+	}
+	if p1.calls != 6 {
+		t.Errorf("got %d provider calls, want 6 (every call duplicated)", p1.calls)
+	}
+}
+
+func TestLatencyQuantiles(t *testing.T) {
+	for name, tc := range map[string]struct {
+		durations []time.Duration
+		want      LatencyQuantiles
+	}{
+		"empty": {},
+		"single": {
+			durations: []time.Duration{time.Millisecond},
+			want:      LatencyQuantiles{P50: 1, P90: 1, P99: 1},
+		},
+		"unordered": {
+			durations: []time.Duration{10 * time.Millisecond, 1 * time.Millisecond, 5 * time.Millisecond, 2 * time.Millisecond},
+			want:      LatencyQuantiles{P50: 2, P90: 10, P99: 10},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := latencyQuantiles(tc.durations); got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
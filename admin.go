@@ -0,0 +1,532 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// snapshotVersion is the version of the snapshot file format.
+const snapshotVersion = 1
+
+// Snapshot is the cache snapshot file format.
+type Snapshot struct {
+	Version int          `json:"version"`
+	Created time.Time    `json:"created"`
+	Entries []CacheEntry `json:"entries"`
+}
+
+// AdminHandler handles the operational HTTP API.
+// It is meant to be served on a separate, non-public address.
+type AdminHandler struct {
+	service     *Service
+	cache       Cache
+	idempotency *IdempotencyGuard
+	mux         *http.ServeMux
+	// mirror is set when traffic mirroring is enabled.
+	mirror *Mirror
+	// logLevels is set when the log level can be changed at runtime.
+	logLevels *LogLevelController
+	// experiments is set when the experiments can be managed at runtime.
+	experiments *Experiments
+}
+
+// CacheReport describes the cache utilization and effectiveness.
+type CacheReport struct {
+	Providers []CacheCounters   `json:"providers"`
+	Memory    *MemoryCacheStats `json:"memory,omitempty"`
+}
+
+// NewAdminHandler returns an admin handler. The cache may be nil when caching is disabled.
+func NewAdminHandler(service *Service, cache Cache) *AdminHandler {
+	h := &AdminHandler{
+		service:     service,
+		cache:       cache,
+		idempotency: NewIdempotencyGuard(idempotencySize, idempotencyWindow),
+		mux:         http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/admin/cache", h.handleCache)
+	h.mux.Handle("/admin/snapshot", h.idempotency.Wrap(http.HandlerFunc(h.handleSnapshot)))
+	h.mux.HandleFunc("/admin/memory", h.handleMemory)
+	h.mux.HandleFunc("/admin/breakers", h.handleBreakers)
+	h.mux.HandleFunc("/admin/providers", h.handleProviders)
+	h.mux.Handle("/admin/providers/disable", h.idempotency.Wrap(h.providerSwitchHandler(true)))
+	h.mux.Handle("/admin/providers/enable", h.idempotency.Wrap(h.providerSwitchHandler(false)))
+	h.mux.Handle("/admin/providers/reset-breaker", h.idempotency.Wrap(http.HandlerFunc(h.handleResetBreaker)))
+	h.mux.HandleFunc("/admin/config", h.handleConfig)
+	h.mux.HandleFunc("/admin/state", h.handleState)
+	h.mux.HandleFunc("/admin/config/versions", h.handleConfigVersions)
+	h.mux.HandleFunc("/admin/config/staged", h.handleStageConfig)
+	h.mux.Handle("/admin/config/apply", h.idempotency.Wrap(h.configSwitchHandler((*ConfigHistory).Apply)))
+	h.mux.Handle("/admin/config/rollback", h.idempotency.Wrap(h.configSwitchHandler((*ConfigHistory).Rollback)))
+	h.mux.HandleFunc("/admin/errors", h.handleErrors)
+	h.mux.HandleFunc("/admin/aa", h.handleAA)
+	h.mux.HandleFunc("/admin/mirror", h.handleMirror)
+	h.mux.HandleFunc("/admin/loglevel", h.handleLogLevel)
+	h.mux.HandleFunc("/admin/experiments", h.handleExperiments)
+	h.mux.Handle("/admin/experiments/stop", h.idempotency.Wrap(http.HandlerFunc(h.handleStopExperiment)))
+	h.mux.Handle("/admin/warm", h.idempotency.Wrap(http.HandlerFunc(h.handleWarm)))
+	h.mux.Handle("/admin/cache/purge", h.idempotency.Wrap(http.HandlerFunc(h.handleCachePurge)))
+	h.mux.Handle("/admin/ui/", http.StripPrefix("/admin/ui/", http.FileServerFS(adminUI)))
+	h.mux.Handle("/admin/ui", http.RedirectHandler("/admin/ui/", http.StatusMovedPermanently))
+	h.mux.Handle("/metrics", defaultMetrics)
+
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mux.ServeHTTP(w, req)
+}
+
+// handleCache reports the cache statistics.
+func (h *AdminHandler) handleCache(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+
+	report := CacheReport{Providers: []CacheCounters{}}
+	if h.service != nil {
+		report.Providers = append(report.Providers, h.service.CacheCounters()...)
+	}
+	if mc := memoryTier(h.cache); mc != nil {
+		stats := mc.Stats()
+		report.Memory = &stats
+	}
+
+	h.writeJSON(w, report)
+}
+
+// handleSnapshot exports the cache contents on "GET" and imports them on "POST".
+func (h *AdminHandler) handleSnapshot(w http.ResponseWriter, req *http.Request) {
+	snapshotter, ok := h.cache.(Snapshotter)
+	if !ok {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "cache snapshots are not supported by the configured cache")
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		entries, err := snapshotter.Snapshot(req.Context())
+		if err != nil {
+			writeServerErr(w, req, err)
+			return
+		}
+		h.writeJSON(w, Snapshot{
+			Version: snapshotVersion,
+			Created: time.Now(),
+			Entries: entries,
+		})
+	case http.MethodPost:
+		var snapshot Snapshot
+		if err := json.NewDecoder(req.Body).Decode(&snapshot); err != nil {
+			writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("invalid snapshot: %v", err))
+			return
+		}
+		if snapshot.Version != snapshotVersion {
+			writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("unsupported snapshot version %d", snapshot.Version))
+			return
+		}
+		if err := snapshotter.Restore(req.Context(), snapshot.Entries); err != nil {
+			writeServerErr(w, req, err)
+			return
+		}
+		slog.InfoContext(req.Context(), "imported cache snapshot", "entries", len(snapshot.Entries), "created", snapshot.Created)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, req)
+	}
+}
+
+// handleMemory reports the heap and cache memory pressure.
+func (h *AdminHandler) handleMemory(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+
+	h.writeJSON(w, newMemoryReport(memoryTier(h.cache)))
+}
+
+// handleBreakers reports the provider circuit breaker states.
+func (h *AdminHandler) handleBreakers(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+
+	statuses := map[Provider]CircuitStatus{}
+	if h.service != nil {
+		statuses = h.service.CircuitStatuses()
+	}
+
+	h.writeJSON(w, statuses)
+}
+
+// handleProviders reports the provider statuses.
+func (h *AdminHandler) handleProviders(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	if h.service == nil {
+		h.writeJSON(w, []ProviderStatus{})
+		return
+	}
+
+	statuses := h.service.ProviderStatuses()
+	p := Provider(req.URL.Query().Get("provider"))
+	if p == "" {
+		h.writeJSON(w, statuses)
+		return
+	}
+	for _, status := range statuses {
+		if status.Provider == p {
+			h.writeJSON(w, status)
+			return
+		}
+	}
+	writeError(w, req, http.StatusNotFound, ErrorCodeNotFound, fmt.Sprintf("unknown provider '%s'", p))
+}
+
+// handleResetBreaker closes the circuit breaker of the provider given in the `provider` parameter.
+func (h *AdminHandler) handleResetBreaker(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	if h.service == nil {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "no service configured")
+		return
+	}
+
+	p := Provider(req.URL.Query().Get("provider"))
+	if err := h.service.ResetCircuitBreaker(p); err != nil {
+		writeError(w, req, http.StatusNotFound, ErrorCodeNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// providerSwitchHandler returns a handler disabling or enabling the provider given in the `provider` parameter.
+func (h *AdminHandler) providerSwitchHandler(disable bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		if h.service == nil {
+			writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "no service configured")
+			return
+		}
+
+		p := Provider(req.URL.Query().Get("provider"))
+		if err := h.service.SetProviderDisabled(p, disable); err != nil {
+			writeError(w, req, http.StatusNotFound, ErrorCodeNotFound, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleConfig reports the items configuration.
+func (h *AdminHandler) handleConfig(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	if h.service == nil {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "no service configured")
+		return
+	}
+
+	h.writeJSON(w, h.service.Config())
+}
+
+// handleConfigVersions reports the active, previous and staged config versions.
+func (h *AdminHandler) handleConfigVersions(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	if h.service == nil {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "no service configured")
+		return
+	}
+
+	h.writeJSON(w, h.service.ConfigHistory().Versions())
+}
+
+// handleStageConfig validates the config and stages it as a new version, to be applied later.
+func (h *AdminHandler) handleStageConfig(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	if h.service == nil {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "no service configured")
+		return
+	}
+
+	var cfg FileConfig
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("invalid config: %v", err))
+		return
+	}
+	version, err := h.service.ConfigHistory().Stage(&cfg)
+	if err != nil {
+		writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("invalid config: %v", err))
+		return
+	}
+	slog.InfoContext(req.Context(), "staged config version", "version", version.Version)
+
+	h.writeJSON(w, version)
+}
+
+// configSwitchHandler returns a handler switching the active config version with the given method.
+func (h *AdminHandler) configSwitchHandler(switchVersion func(*ConfigHistory) (*ConfigVersion, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		if h.service == nil {
+			writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "no service configured")
+			return
+		}
+
+		version, err := switchVersion(h.service.ConfigHistory())
+		switch {
+		case errors.Is(err, ErrNoStagedConfig), errors.Is(err, ErrNoPreviousConfig):
+			writeError(w, req, http.StatusConflict, ErrorCodeConflict, err.Error())
+			return
+		case err != nil:
+			writeServerErr(w, req, err)
+			return
+		}
+
+		h.writeJSON(w, version)
+	})
+}
+
+// handleState reports the runtime state on "GET", and reconciles the service to the desired state on "PUT".
+func (h *AdminHandler) handleState(w http.ResponseWriter, req *http.Request) {
+	if h.service == nil {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "no service configured")
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		h.writeJSON(w, h.service.State())
+	case http.MethodPut:
+		var state RuntimeState
+		dec := json.NewDecoder(req.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&state); err != nil {
+			writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("invalid state: %v", err))
+			return
+		}
+		if err := h.service.ApplyState(state); err != nil {
+			writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("invalid state: %v", err))
+			return
+		}
+		slog.InfoContext(req.Context(), "applied runtime state", "providers", len(state.Providers), "blocked_items", len(state.BlockedItems))
+		h.writeJSON(w, h.service.State())
+	default:
+		writeMethodNotAllowed(w, req)
+	}
+}
+
+// handleErrors reports the recent provider errors.
+func (h *AdminHandler) handleErrors(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	if h.service == nil {
+		h.writeJSON(w, []ProviderError{})
+		return
+	}
+
+	h.writeJSON(w, h.service.RecentErrors())
+}
+
+// handleWarm makes the requests given in the body, so the provider responses get cached, and reports their results.
+func (h *AdminHandler) handleWarm(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	if h.service == nil || h.cache == nil {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "no cache configured")
+		return
+	}
+
+	var reqs []WarmRequest
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&reqs); err != nil {
+		writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("invalid requests: %v", err))
+		return
+	}
+	if err := validateWarmRequests(reqs); err != nil {
+		writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("invalid requests: %v", err))
+		return
+	}
+
+	results := h.service.Warm(req.Context(), reqs)
+	slog.InfoContext(req.Context(), "warmed the cache", "requests", len(reqs))
+	h.writeJSON(w, results)
+}
+
+// handleMirror reports the most recent differences between our and the mirrored responses.
+func (h *AdminHandler) handleMirror(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	if h.mirror == nil {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "traffic mirroring is disabled")
+		return
+	}
+
+	h.writeJSON(w, h.mirror.Diffs())
+}
+
+// handleExperiments lists the experiments on "GET", and creates or updates the one given with the `name` parameter on "PUT".
+func (h *AdminHandler) handleExperiments(w http.ResponseWriter, req *http.Request) {
+	if h.experiments == nil {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "experiments are disabled")
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		h.writeJSON(w, h.experiments.List())
+	case http.MethodPut:
+		var spec ExperimentSpec
+		dec := json.NewDecoder(req.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&spec); err != nil {
+			writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("invalid experiment: %v", err))
+			return
+		}
+		e, err := h.experiments.Put(req.URL.Query().Get("name"), spec)
+		if errors.Is(err, ErrInvalidExperiment) {
+			writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeServerErr(w, req, err)
+			return
+		}
+		slog.InfoContext(req.Context(), "experiment updated", "experiment", e.Name, "version", e.Version, "pending", e.Pending != nil)
+		h.writeJSON(w, e)
+	default:
+		writeMethodNotAllowed(w, req)
+	}
+}
+
+// handleStopExperiment stops the experiment given with the `name` parameter.
+func (h *AdminHandler) handleStopExperiment(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	if h.experiments == nil {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "experiments are disabled")
+		return
+	}
+
+	e, err := h.experiments.Stop(req.URL.Query().Get("name"))
+	if errors.Is(err, ErrUnknownExperiment) {
+		writeError(w, req, http.StatusNotFound, ErrorCodeNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeServerErr(w, req, err)
+		return
+	}
+	slog.InfoContext(req.Context(), "experiment stopped", "experiment", e.Name)
+	h.writeJSON(w, e)
+}
+
+// handleLogLevel reports the logging settings on "GET", changes them temporarily on "PUT" and restores the defaults on "DELETE".
+func (h *AdminHandler) handleLogLevel(w http.ResponseWriter, req *http.Request) {
+	if h.logLevels == nil {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "changing the log level is disabled")
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var change LogLevelChange
+		dec := json.NewDecoder(req.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&change); err != nil {
+			writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("invalid log level change: %v", err))
+			return
+		}
+		if err := h.logLevels.Set(req.Context(), change); err != nil {
+			writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, fmt.Sprintf("invalid log level change: %v", err))
+			return
+		}
+	case http.MethodDelete:
+		h.logLevels.Reset(req.Context())
+	default:
+		writeMethodNotAllowed(w, req)
+		return
+	}
+
+	h.writeJSON(w, h.logLevels.State())
+}
+
+// handleAA reports the A/A latency comparison of the providers.
+func (h *AdminHandler) handleAA(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	if h.service == nil || h.service.AAReport() == nil {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "A/A testing is disabled")
+		return
+	}
+
+	h.writeJSON(w, h.service.AAReport())
+}
+
+// handleCachePurge drops all the cache entries.
+func (h *AdminHandler) handleCachePurge(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	purger, ok := h.cache.(Purger)
+	if !ok {
+		writeError(w, req, http.StatusNotImplemented, ErrorCodeNotImplemented, "purging is not supported by the configured cache")
+		return
+	}
+
+	if err := purger.Purge(req.Context()); err != nil {
+		writeServerErr(w, req, err)
+		return
+	}
+	slog.InfoContext(req.Context(), "purged the cache")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("encoding admin response to http writer", "error", err)
+	}
+}
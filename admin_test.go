@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotExportImport(t *testing.T) {
+	ctx := context.Background()
+
+	source := NewMemoryCache(0)
+	_ = source.Set(ctx, "a", []byte(`[{"id":"1"}]`), time.Minute)
+	_ = source.Set(ctx, "b", []byte(`[{"id":"2"}]`), time.Minute)
+	sourceSrv := httptest.NewServer(NewAdminHandler(nil, source))
+	defer sourceSrv.Close()
+
+	target := NewMemoryCache(0)
+	targetSrv := httptest.NewServer(NewAdminHandler(nil, target))
+	defer targetSrv.Close()
+
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := runSnapshotCommand([]string{"export", "-admin-url", sourceSrv.URL, "-file", file}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if err := runSnapshotCommand([]string{"import", "-admin-url", targetSrv.URL, "-file", file}); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	for key, want := range map[string]string{"a": `[{"id":"1"}]`, "b": `[{"id":"2"}]`} {
+		v, ok, _ := target.Get(ctx, key)
+		if !ok || string(v) != want {
+			t.Errorf("key '%s': got %q, %v, want %q", key, v, ok, want)
+		}
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	noCacheSrv := httptest.NewServer(NewAdminHandler(nil, nil))
+	defer noCacheSrv.Close()
+
+	resp, err := http.Get(noCacheSrv.URL + "/admin/snapshot")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("got status %d without cache, want %d", resp.StatusCode, http.StatusNotImplemented)
+	}
+
+	srv := httptest.NewServer(NewAdminHandler(nil, NewMemoryCache(0)))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(file, []byte(`{"version":99}`), 0o600); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	if err := runSnapshotCommand([]string{"import", "-admin-url", srv.URL, "-file", file}); err == nil {
+		t.Error("expected error for unsupported snapshot version")
+	}
+}
+
+func TestAdminProviderActions(t *testing.T) {
+	p1 := &mockContentProvider{source: Provider1}
+	p2 := &mockContentProvider{source: Provider2}
+	clients := map[Provider]Client{Provider1: p1, Provider2: p2}
+	configs := []ContentConfig{{Type: Provider1, Fallback: &Provider2}}
+	service, err := NewService(configs, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	cache := NewMemoryCache(0)
+	_ = cache.Set(context.Background(), "a", []byte("1"), time.Minute)
+
+	srv := httptest.NewServer(NewAdminHandler(service, cache))
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		"disable":          {method: http.MethodPost, path: "/admin/providers/disable?provider=1", wantStatus: http.StatusNoContent},
+		"disable unknown":  {method: http.MethodPost, path: "/admin/providers/disable?provider=9", wantStatus: http.StatusNotFound},
+		"disable with get": {method: http.MethodGet, path: "/admin/providers/disable?provider=1", wantStatus: http.StatusMethodNotAllowed},
+		"purge":            {method: http.MethodPost, path: "/admin/cache/purge", wantStatus: http.StatusNoContent},
+		"providers":        {method: http.MethodGet, path: "/admin/providers", wantStatus: http.StatusOK},
+		"one provider":     {method: http.MethodGet, path: "/admin/providers?provider=2", wantStatus: http.StatusOK},
+		"unknown provider": {method: http.MethodGet, path: "/admin/providers?provider=9", wantStatus: http.StatusNotFound},
+		"reset no breaker": {method: http.MethodPost, path: "/admin/providers/reset-breaker?provider=1", wantStatus: http.StatusNotFound},
+		"config":           {method: http.MethodGet, path: "/admin/config", wantStatus: http.StatusOK},
+		"errors":           {method: http.MethodGet, path: "/admin/errors", wantStatus: http.StatusOK},
+		"ui":               {method: http.MethodGet, path: "/admin/ui/", wantStatus: http.StatusOK},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, srv.URL+tc.path, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+
+	if cache.Len() != 0 {
+		t.Errorf("got %d cache entries after purge, want 0", cache.Len())
+	}
+
+	items, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 2, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	for _, item := range items {
+		if item.Source != string(Provider2) {
+			t.Errorf("got item from provider %s, want only the fallback", item.Source)
+		}
+	}
+	if p1.calls != 0 {
+		t.Errorf("got %d calls to the disabled provider, want 0", p1.calls)
+	}
+}
+
+func TestErrorLog(t *testing.T) {
+	l := NewErrorLog(2)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		l.Record(Provider1, start.Add(time.Duration(i)*time.Second), errors.New(strconv.Itoa(i)))
+	}
+
+	recent := l.Recent()
+	if len(recent) != 2 || recent[0].Error != "2" || recent[1].Error != "1" {
+		t.Errorf("got %+v, want the 2 newest errors, the newest first", recent)
+	}
+}
+
+func TestAdminState(t *testing.T) {
+	p1 := &mockContentProvider{source: Provider1, itemID: "blocked"}
+	p2 := &mockContentProvider{source: Provider2}
+	p3 := &mockContentProvider{source: Provider3}
+	clients := map[Provider]Client{Provider1: p1, Provider2: p2, Provider3: p3}
+	configs := []ContentConfig{{Type: Provider1, Fallback: &Provider3}, {Type: Provider2, Fallback: &Provider3}}
+	service, err := NewService(configs, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(NewAdminHandler(service, nil))
+	defer srv.Close()
+
+	put := func(body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/admin/state", strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := put(`{"providers": {"2": {"disabled": true}}, "blocked_items": ["blocked"]}`); status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	items, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 2, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	for _, item := range items {
+		if item.Source != string(Provider3) {
+			t.Errorf("got item from provider %s, want only the fallback", item.Source)
+		}
+	}
+
+	for name, body := range map[string]string{
+		"unknown provider": `{"providers": {"9": {"disabled": true}}}`,
+		"unknown field":    `{"weights": {"1": 2}}`,
+		"empty item ID":    `{"blocked_items": [""]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if status := put(body); status != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", status, http.StatusBadRequest)
+			}
+		})
+	}
+
+	// Invalid states must not change anything, and a new state replaces the previous one.
+	state := service.State()
+	if !state.Providers[Provider2].Disabled || len(state.BlockedItems) != 1 {
+		t.Errorf("got state %+v after invalid updates, want the previous one", state)
+	}
+	if status := put(`{}`); status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	if state := service.State(); len(state.Providers) != 0 || len(state.BlockedItems) != 0 {
+		t.Errorf("got state %+v, want the empty one", state)
+	}
+}
+
+func TestAdminWarm(t *testing.T) {
+	p1 := &mockContentProvider{source: Provider1}
+	clients := map[Provider]Client{Provider1: p1}
+	cache := NewMemoryCache(0)
+	service, err := NewService([]ContentConfig{{Type: Provider1}}, clients, defaultTimeout, WithCache(cache, CacheSettings{TTL: time.Minute}))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(NewAdminHandler(service, cache))
+	defer srv.Close()
+
+	post := func(body string) *http.Response {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/admin/warm", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		return resp
+	}
+
+	resp := post(`[{"count": 2}, {"count": 1, "offset": 1}]`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	var results []WarmResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(results) != 2 || results[0].Status != "ok" || results[0].Items != 2 || results[1].Items != 1 {
+		t.Errorf("got results %+v, want both requests warmed", results)
+	}
+
+	// Both requests need 2 items from the provider, so the second one is served from the cache.
+	if _, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 2, 0); err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if p1.calls != 1 {
+		t.Errorf("got %d provider calls, want 1", p1.calls)
+	}
+
+	for name, body := range map[string]string{
+		"empty list":    `[]`,
+		"zero count":    `[{"count": 0}]`,
+		"unknown field": `[{"count": 1, "variant": "a"}]`,
+		"too many":      "[" + strings.Repeat(`{"count": 1},`, maxWarmRequests) + `{"count": 1}]`,
+		"invalid json":  `[{`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := post(body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	var level slog.LevelVar
+	h := NewAdminHandler(nil, nil)
+	h.logLevels = NewLogLevelController(&level, time.Minute)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	do := func(method, body string) (int, LogLevelState) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+"/admin/loglevel", strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		defer resp.Body.Close()
+		var state LogLevelState
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+		}
+		return resp.StatusCode, state
+	}
+
+	for name, body := range map[string]string{
+		"unknown level":  `{"level": "verbose"}`,
+		"too long":       `{"level": "debug", "duration": "48h"}`,
+		"empty provider": `{"level": "debug", "providers": [""]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if status, _ := do(http.MethodPut, body); status != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", status, http.StatusBadRequest)
+			}
+		})
+	}
+
+	status, state := do(http.MethodPut, `{"level": "debug", "providers": ["2"]}`)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	if state.Level != slog.LevelDebug || level.Level() != slog.LevelDebug || state.RevertsAt == nil {
+		t.Errorf("got state %+v and level %v, want debug until the revert", state, level.Level())
+	}
+	if !providerDebugEnabled(Provider2) || providerDebugEnabled(Provider1) {
+		t.Error("got debug logging for the wrong providers")
+	}
+	if _, state := do(http.MethodDelete, ""); state.Level != slog.LevelInfo || state.RevertsAt != nil || providerDebugEnabled(Provider2) {
+		t.Errorf("got state %+v after the reset, want the defaults", state)
+	}
+
+	// The change is reverted after the duration.
+	if status, _ := do(http.MethodPut, `{"level": "warn", "duration": "50ms"}`); status != http.StatusOK {
+		t.Fatalf("got status %d, want %d", status, http.StatusOK)
+	}
+	deadline := time.Now().Add(time.Second)
+	for level.Level() != slog.LevelInfo && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, state := do(http.MethodGet, ""); state.Level != slog.LevelInfo || state.RevertsAt != nil {
+		t.Errorf("got state %+v, want the change reverted", state)
+	}
+}
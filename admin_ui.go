@@ -0,0 +1,12 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed admin_ui
+var adminUIFiles embed.FS
+
+// adminUI is the single-page admin UI, served at /admin/ui/. It uses only the admin API.
+var adminUI, _ = fs.Sub(adminUIFiles, "admin_ui")
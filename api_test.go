@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/m-zajac/another-go-challange/client/contenttest"
 )
 
 var (
@@ -70,6 +76,26 @@ func TestResponseCount(t *testing.T) {
 	}
 }
 
+// contentSequence returns the ordering contract of the configs.
+func contentSequence(configs []ContentConfig) []contenttest.Slot {
+	slots := make([]contenttest.Slot, len(configs))
+	for i, c := range configs {
+		slots[i].Provider = string(c.Type)
+		if c.Fallback != nil {
+			slots[i].Fallback = string(*c.Fallback)
+		}
+	}
+	return slots
+}
+
+func contentSources(content []*ContentItem) []string {
+	sources := make([]string, len(content))
+	for i, item := range content {
+		sources[i] = item.Source
+	}
+	return sources
+}
+
 func TestResponseOrder(t *testing.T) {
 	status, content := runDefaultServiceRequest(t, SimpleContentRequest)
 
@@ -80,14 +106,7 @@ func TestResponseOrder(t *testing.T) {
 		t.Fatalf("got %d items back, want 5", len(content))
 	}
 
-	for i, item := range content {
-		if Provider(item.Source) != DefaultConfig[i%len(DefaultConfig)].Type {
-			t.Errorf(
-				"position %d: Got Provider %v instead of Provider %v",
-				i, item.Source, DefaultConfig[i%len(DefaultConfig)].Type,
-			)
-		}
-	}
+	contenttest.VerifyOrder(t, contentSequence(DefaultConfig), 5, 0, contentSources(content))
 }
 
 func TestOffsetResponseOrder(t *testing.T) {
@@ -100,15 +119,23 @@ func TestOffsetResponseOrder(t *testing.T) {
 		t.Fatalf("got %d items back, want 5", len(content))
 	}
 
-	for j, item := range content {
-		i := j + 5
-		if Provider(item.Source) != DefaultConfig[i%len(DefaultConfig)].Type {
-			t.Errorf(
-				"position %d: Got Provider %v instead of Provider %v",
-				i, item.Source, DefaultConfig[i%len(DefaultConfig)].Type,
-			)
-		}
+	contenttest.VerifyOrder(t, contentSequence(DefaultConfig), 5, 5, contentSources(content))
+}
+
+func TestPaginationOrder(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
 	}
+
+	contenttest.VerifyPagination(t, contentSequence(DefaultConfig), 3, 4, func(count, offset int) ([]string, error) {
+		r, _ := http.NewRequest("GET", fmt.Sprintf("/?offset=%d&count=%d", offset, count), nil)
+		status, content := runRequest(t, service, r)
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("got response status %d", status)
+		}
+		return contentSources(content), nil
+	})
 }
 
 func TestRequestValidation(t *testing.T) {
@@ -432,6 +459,175 @@ func TestProviderReturnsLessData(t *testing.T) {
 	}
 }
 
+func TestFallbackSurplus(t *testing.T) {
+	for name, tc := range map[string]struct {
+		configs []ContentConfig
+		// maxResults limits the items of provider 2.
+		maxResults int
+		// surplus enables the fallback surplus.
+		surplus    bool
+		count      int
+		wantCalls  int
+		wantSource []string
+	}{
+		"fallback served from the surplus": {
+			configs:    []ContentConfig{{Type: Provider1, Fallback: &Provider2}, {Type: Provider2}},
+			surplus:    true,
+			count:      4,
+			wantCalls:  1,
+			wantSource: []string{"2", "2", "2", "2"},
+		},
+		"fallback not fetched as a primary": {
+			configs:    []ContentConfig{{Type: Provider1, Fallback: &Provider2}},
+			surplus:    true,
+			count:      2,
+			wantCalls:  1,
+			wantSource: []string{"2", "2"},
+		},
+		"not enough surplus": {
+			configs:    []ContentConfig{{Type: Provider1, Fallback: &Provider2}, {Type: Provider2}},
+			maxResults: 3,
+			surplus:    true,
+			count:      4,
+			wantCalls:  2,
+			wantSource: []string{"2", "2", "2", "2"},
+		},
+		"surplus disabled": {
+			configs:    []ContentConfig{{Type: Provider1, Fallback: &Provider2}, {Type: Provider2}},
+			count:      4,
+			wantCalls:  2,
+			wantSource: []string{"2", "2", "2", "2"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p2 := &mockContentProvider{source: Provider2, maxResults: tc.maxResults}
+			clients := map[Provider]Client{
+				Provider1: &mockContentProvider{source: Provider1, shouldFail: true},
+				Provider2: p2,
+			}
+			var opts []ServiceOption
+			if tc.surplus {
+				opts = append(opts, WithFallbackSurplus())
+			}
+			service, err := NewService(tc.configs, clients, defaultTimeout, opts...)
+			if err != nil {
+				t.Fatalf("creating a service: %v", err)
+			}
+
+			items, err := service.GetContent(context.Background(), RequestMeta{}, tc.count, 0)
+			if err != nil {
+				t.Fatalf("getting content: %v", err)
+			}
+			var sources []string
+			ids := map[string]bool{}
+			for _, item := range items {
+				sources = append(sources, item.Source)
+				if ids[item.ID] {
+					t.Errorf("got item %s twice", item.ID)
+				}
+				ids[item.ID] = true
+			}
+			if !reflect.DeepEqual(sources, tc.wantSource) {
+				t.Errorf("got items from %v, want from %v", sources, tc.wantSource)
+			}
+			if p2.calls != tc.wantCalls {
+				t.Errorf("got %d provider 2 calls, want %d", p2.calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+// countsClient records the counts it's asked for.
+type countsClient struct {
+	Client
+	m      sync.Mutex
+	counts []int
+}
+
+func (c *countsClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	c.m.Lock()
+	c.counts = append(c.counts, count)
+	c.m.Unlock()
+	return c.Client.GetContent(ctx, meta, count)
+}
+
+func TestHealthyRequestCounts(t *testing.T) {
+	// Without failures, the providers are asked only for their own positions, even when they are fallbacks.
+	p1 := &countsClient{Client: &mockContentProvider{source: Provider1}}
+	p2 := &countsClient{Client: &mockContentProvider{source: Provider2}}
+	p3 := &countsClient{Client: &mockContentProvider{source: Provider3}}
+	service, err := NewService(DefaultConfig, map[Provider]Client{Provider1: p1, Provider2: p2, Provider3: p3}, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	if _, err := service.GetContent(context.Background(), RequestMeta{}, 8, 0); err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+
+	got := map[Provider][]int{Provider1: p1.counts, Provider2: p2.counts, Provider3: p3.counts}
+	want := map[Provider][]int{Provider1: {5}, Provider2: {2}, Provider3: {1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got counts %v, want %v", got, want)
+	}
+}
+
+func TestParallelFallbacks(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	for name, tc := range map[string]struct {
+		configs    []ContentConfig
+		wantSource []string
+		wantFailed []int
+	}{
+		"fallback fetched while a slow provider is awaited": {
+			configs:    []ContentConfig{{Type: Provider1}, {Type: Provider2, Fallback: &Provider3}},
+			wantSource: []string{"1", "3"},
+		},
+		"failed position without a fallback cuts the response": {
+			configs:    []ContentConfig{{Type: Provider2}, {Type: Provider1}, {Type: Provider2, Fallback: &Provider3}},
+			wantFailed: []int{0, 2},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clients := map[Provider]Client{
+				Provider1: &mockContentProvider{source: Provider1, responseDelay: delay},
+				Provider2: &mockContentProvider{source: Provider2, shouldFail: true},
+				Provider3: &mockContentProvider{source: Provider3, responseDelay: delay},
+			}
+			service, err := NewService(tc.configs, clients, defaultTimeout)
+			if err != nil {
+				t.Fatalf("creating a service: %v", err)
+			}
+
+			start := time.Now()
+			result, err := service.GetContentResult(context.Background(), RequestMeta{}, len(tc.configs), 0)
+			if err != nil {
+				t.Fatalf("getting content: %v", err)
+			}
+			// The slow primary and fallback providers are called at the same time.
+			if elapsed := time.Since(start); elapsed >= 2*delay {
+				t.Errorf("got the response after %v, want less than %v", elapsed, 2*delay)
+			}
+			var sources []string
+			for _, item := range result.Items {
+				sources = append(sources, item.Source)
+			}
+			if !reflect.DeepEqual(sources, tc.wantSource) {
+				t.Errorf("got items from %v, want from %v", sources, tc.wantSource)
+			}
+			var failed []int
+			for _, f := range result.Failures {
+				failed = append(failed, f.Position)
+				if f.Provider != Provider2 {
+					t.Errorf("got position %d failed by provider %s, want by the primary provider 2", f.Position, f.Provider)
+				}
+			}
+			if !reflect.DeepEqual(failed, tc.wantFailed) {
+				t.Errorf("got failed positions %v, want %v", failed, tc.wantFailed)
+			}
+		})
+	}
+}
+
 func TestResponseTimeout(t *testing.T) {
 	clients := map[Provider]Client{
 		Provider1: &mockContentProvider{source: Provider1, responseDelay: 1 * time.Second},
@@ -459,10 +655,152 @@ func TestResponseTimeout(t *testing.T) {
 
 	select {
 	case <-done:
-		if status != http.StatusInternalServerError {
+		if status != http.StatusGatewayTimeout {
 			t.Fatalf("got unexpected response status %d", status)
 		}
 	case <-time.After(3 * timeout):
 		t.Fatal("request still processing")
 	}
 }
+
+func TestProviderCallsCancelled(t *testing.T) {
+	client := &blockingClient{returned: make(chan error, 1)}
+	clients := map[Provider]Client{Provider1: client}
+	configs := []ContentConfig{{Type: Provider1}}
+	service, err := NewService(configs, clients, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+
+	if _, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 1, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want deadline exceeded", err)
+	}
+
+	select {
+	case err := <-client.returned:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("provider call ended with %v, want deadline exceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("provider call wasn't cancelled")
+	}
+}
+
+func TestServiceDrain(t *testing.T) {
+	client := &gatedClient{release: make(chan struct{})}
+	clients := map[Provider]Client{Provider1: client}
+	service, err := NewService([]ContentConfig{{Type: Provider1}}, clients, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+
+	// The request times out, but the provider call is still running.
+	if _, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 1, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want deadline exceeded", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := service.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got drain error %v with a running provider call, want deadline exceeded", err)
+	}
+
+	close(client.release)
+	if err := service.Drain(context.Background()); err != nil {
+		t.Errorf("got drain error %v, want nil", err)
+	}
+}
+
+func TestValidationErrorsBody(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/?count=0&offset=abc")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got response status %d", resp.StatusCode)
+	}
+	var body ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if body.Code != ErrorCodeInvalidParams {
+		t.Errorf("got code %q, want %q", body.Code, ErrorCodeInvalidParams)
+	}
+	want := ValidationErrors{
+		{Param: "count", Message: "must be positive"},
+		{Param: "offset", Message: "must be an integer"},
+	}
+	if !reflect.DeepEqual(body.Details, want) {
+		t.Errorf("got errors %+v, want %+v", body.Details, want)
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service, limits: RequestLimits{MaxCount: 10, MaxItems: 15}})
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		query      string
+		wantStatus int
+		wantErrs   ValidationErrors
+	}{
+		"within limits": {query: "count=10&offset=5", wantStatus: http.StatusOK},
+		"count over the limit": {
+			query:      "count=11",
+			wantStatus: http.StatusBadRequest,
+			wantErrs:   ValidationErrors{{Param: "count", Message: "must not be greater than 10"}},
+		},
+		"items over the limit": {
+			query:      "count=10&offset=6",
+			wantStatus: http.StatusBadRequest,
+			wantErrs:   ValidationErrors{{Param: "offset", Message: "count + offset must not be greater than 15"}},
+		},
+		"huge offset": {
+			query:      "count=1&offset=9223372036854775807",
+			wantStatus: http.StatusBadRequest,
+			wantErrs:   ValidationErrors{{Param: "offset", Message: "count + offset must not be greater than 15"}},
+		},
+		"huge count": {
+			query:      "count=1000000",
+			wantStatus: http.StatusBadRequest,
+			wantErrs: ValidationErrors{
+				{Param: "count", Message: "must not be greater than 10"},
+				{Param: "offset", Message: "count + offset must not be greater than 15"},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/?" + tc.query)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantErrs == nil {
+				return
+			}
+			var body ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if !reflect.DeepEqual(body.Details, tc.wantErrs) {
+				t.Errorf("got errors %+v, want %+v", body.Details, tc.wantErrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+var apiKeyRequests = newCounterVec(
+	"api_key_requests_total",
+	"Number of requests with an API key by its name (empty for unknown keys) and result (ok, unauthorized, forbidden, rate_limited).",
+	"key", "result",
+)
+
+// APIKey is a key allowed to use the API.
+type APIKey struct {
+	// Name identifies the key in the logs and metrics, so the key itself is never exposed.
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	// Disabled keys are rejected with 403, e.g. while a client is suspended.
+	Disabled bool `json:"disabled,omitempty"`
+	// RateLimit is the number of requests per second allowed with the key. Zero uses the default limit.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	// Burst is the number of requests allowed at once above the rate limit. Zero uses the default burst.
+	Burst int `json:"burst,omitempty"`
+}
+
+// LoadAPIKeys reads the keys from a JSON file with a list of keys.
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading API keys: %w", err)
+	}
+	defer f.Close()
+
+	var keys []APIKey
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&keys); err != nil {
+		return nil, fmt.Errorf("decoding API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// ParseAPIKeys parses the keys from a comma-separated list of `name:key` pairs, as given in the API_KEYS variable.
+func ParseAPIKeys(s string) ([]APIKey, error) {
+	var keys []APIKey
+	for i, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(pair, ":")
+		if !ok {
+			// The pair isn't included in the error, as it may be a key.
+			return nil, fmt.Errorf("invalid API key #%d, must be in the form name:key", i+1)
+		}
+		keys = append(keys, APIKey{Name: name, Key: key})
+	}
+
+	return keys, nil
+}
+
+// APIKeys authenticates the requests with the configured keys, and limits their rate per key. It's an Authenticator.
+type APIKeys struct {
+	keys map[[sha256.Size]byte]*apiKeyEntry
+	now  func() time.Time
+}
+
+type apiKeyEntry struct {
+	APIKey
+	limiter *rateLimiter
+}
+
+// NewAPIKeys returns the authenticator of the keys. The default rate limit and burst apply to the keys without their own;
+// a zero rate means no limit.
+func NewAPIKeys(keys []APIKey, defaultRate float64, defaultBurst int) (*APIKeys, error) {
+	a := &APIKeys{
+		keys: make(map[[sha256.Size]byte]*apiKeyEntry, len(keys)),
+		now:  time.Now,
+	}
+	names := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		switch {
+		case k.Name == "":
+			return nil, errors.New("API key name must not be empty")
+		case names[k.Name]:
+			return nil, fmt.Errorf("API key '%s' is defined more than once", k.Name)
+		case k.Key == "":
+			return nil, fmt.Errorf("API key '%s' must not be empty", k.Name)
+		case k.RateLimit < 0 || k.Burst < 0:
+			return nil, fmt.Errorf("API key '%s': rate limit and burst must not be negative", k.Name)
+		}
+		names[k.Name] = true
+
+		hash := sha256.Sum256([]byte(k.Key))
+		if _, ok := a.keys[hash]; ok {
+			return nil, fmt.Errorf("API key '%s' has the same key as another one", k.Name)
+		}
+		if k.RateLimit == 0 {
+			k.RateLimit = defaultRate
+		}
+		if k.Burst == 0 {
+			k.Burst = defaultBurst
+		}
+		entry := &apiKeyEntry{APIKey: k}
+		if k.RateLimit > 0 {
+			entry.limiter = newRateLimiter(k.RateLimit, max(k.Burst, 1))
+		}
+		a.keys[hash] = entry
+	}
+
+	return a, nil
+}
+
+// Method implements Authenticator.
+func (a *APIKeys) Method() string {
+	return "api_key"
+}
+
+// Authenticate implements Authenticator. Unknown keys are rejected with 401, disabled ones with 403,
+// and the requests over the key's rate limit with 429.
+func (a *APIKeys) Authenticate(req *http.Request) (*Principal, error) {
+	key := requestAPIKey(req)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	// Looking the keys up by their hashes keeps the lookup time independent of how much of the key matches.
+	entry, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		apiKeyRequests.Inc("", "unauthorized")
+		return nil, unauthorized(`Bearer realm="content", error="invalid_token"`, "invalid API key")
+	}
+	if entry.Disabled {
+		apiKeyRequests.Inc(entry.Name, "forbidden")
+		return nil, &AuthError{Status: http.StatusForbidden, Message: "API key disabled"}
+	}
+	if entry.limiter != nil {
+		if ok, wait := entry.limiter.allow(a.now()); !ok {
+			apiKeyRequests.Inc(entry.Name, "rate_limited")
+			return nil, &AuthError{
+				Status:  http.StatusTooManyRequests,
+				Message: "rate limit exceeded",
+				Header:  http.Header{"Retry-After": {strconv.Itoa(int(math.Ceil(wait.Seconds())))}},
+			}
+		}
+	}
+
+	apiKeyRequests.Inc(entry.Name, "ok")
+	return &Principal{Name: entry.Name, Method: a.Method()}, nil
+}
+
+// Wrap returns a handler serving only the requests with a valid key, within the key's rate limit.
+// Requests without a key, or with an unknown one, get 401, with a disabled key 403, and over the rate limit 429.
+func (a *APIKeys) Wrap(next http.Handler) http.Handler {
+	return AuthChain{a}.Wrap(next)
+}
+
+// requestAPIKey returns the key from the `Authorization: Bearer` or the `X-API-Key` header.
+func requestAPIKey(req *http.Request) string {
+	if req.Header.Get("Authorization") != "" {
+		return bearerToken(req)
+	}
+
+	return req.Header.Get(apiKeyHeader)
+}
+
+// apiKeyNameFromContext returns the name of the request's client - the API key name, or the principal of another
+// authentication method - or an empty string when the request wasn't authenticated.
+func apiKeyNameFromContext(ctx context.Context) string {
+	if p := principalFromContext(ctx); p != nil {
+		return p.Name
+	}
+	return ""
+}
+
+// rateLimiter is a token bucket, refilled at `rate` tokens per second up to `burst` tokens.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	m      sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// allow takes a token if there is one. Otherwise, it returns how long until the next token.
+func (l *rateLimiter) allow(now time.Time) (bool, time.Duration) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	}
+	l.tokens--
+
+	return true, 0
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ClientCertAuthenticator authenticates the requests with the TLS client certificates (mTLS). The certificate is verified
+// against the client CAs by the TLS handshake (see TLSSettings.ClientCAFile), and its subject's common name must be
+// one of the allowed ones. The common name is the principal.
+type ClientCertAuthenticator struct {
+	subjects map[string]bool
+}
+
+// NewClientCertAuthenticator returns the authenticator of the certificates with the subject common names.
+func NewClientCertAuthenticator(subjects []string) (*ClientCertAuthenticator, error) {
+	if len(subjects) == 0 {
+		return nil, errors.New("at least one client certificate subject must be allowed")
+	}
+	a := &ClientCertAuthenticator{subjects: make(map[string]bool, len(subjects))}
+	for _, s := range subjects {
+		a.subjects[s] = true
+	}
+	return a, nil
+}
+
+// Method implements Authenticator.
+func (a *ClientCertAuthenticator) Method() string {
+	return "client_cert"
+}
+
+// Authenticate implements Authenticator. Verified certificates of the subjects that aren't allowed are rejected with 403.
+func (a *ClientCertAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	// The verified chains are empty for the certificates that weren't verified, or when there's no TLS at all.
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+	subject := req.TLS.VerifiedChains[0][0].Subject.CommonName
+	if !a.subjects[subject] {
+		return nil, &AuthError{Status: http.StatusForbidden, Message: "client certificate subject not allowed"}
+	}
+
+	return &Principal{Name: subject, Method: a.Method()}, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var authRequests = newCounterVec(
+	"auth_requests_total",
+	"Number of authenticated requests by the method (api_key, jwt, hmac, client_cert, or empty when none matched) and result (ok, unauthorized, forbidden, rate_limited).",
+	"method", "result",
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request has no credentials of its method,
+// so the next authenticator of the chain is tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal is the authenticated client of a request.
+type Principal struct {
+	// Name identifies the client in the logs, metrics and policies, e.g. the API key name or the JWT subject.
+	Name string
+	// Method is the authentication method, e.g. "api_key".
+	Method string
+}
+
+// Authenticator authenticates requests with one method. It returns ErrNoCredentials when the request has no credentials
+// of the method, and an *AuthError when they are invalid, or the client isn't allowed to make the request.
+type Authenticator interface {
+	// Method names the authentication method in the metrics.
+	Method() string
+	Authenticate(req *http.Request) (*Principal, error)
+}
+
+// AuthError is an authentication failure, written as the error response.
+type AuthError struct {
+	// Status is 401 for invalid credentials, which let the next authenticators try, or a final status like 403 or 429.
+	Status  int
+	Message string
+	// Header is added to the response, e.g. WWW-Authenticate or Retry-After.
+	Header http.Header
+}
+
+// Error implements error.
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+// unauthorized returns the 401 error with the WWW-Authenticate challenge.
+func unauthorized(challenge, message string) *AuthError {
+	return &AuthError{Status: http.StatusUnauthorized, Message: message, Header: http.Header{"Www-Authenticate": {challenge}}}
+}
+
+// AuthChain authenticates requests with the first of its authenticators that finds its credentials in the request.
+// Invalid credentials of one method let the next ones try (e.g. a bearer token that isn't an API key may be a JWT),
+// and the first such error is returned when none succeeds.
+type AuthChain []Authenticator
+
+// Wrap returns a handler serving only the authenticated requests. The principal's name is in the request context.
+func (c AuthChain) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		principal, err := c.Authenticate(req)
+		if err != nil {
+			var authErr *AuthError
+			if !errors.As(err, &authErr) {
+				writeServerErr(w, req, err)
+				return
+			}
+			for name, values := range authErr.Header {
+				w.Header()[name] = values
+			}
+			writeError(w, req, authErr.Status, authErrorCode(authErr.Status), authErr.Message)
+			return
+		}
+
+		next.ServeHTTP(w, req.WithContext(withPrincipal(req.Context(), principal)))
+	})
+}
+
+// Authenticate runs the chain on the request.
+func (c AuthChain) Authenticate(req *http.Request) (*Principal, error) {
+	var firstErr error
+	for _, a := range c {
+		principal, err := a.Authenticate(req)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		var authErr *AuthError
+		switch {
+		case err == nil:
+			authRequests.Inc(a.Method(), "ok")
+			return principal, nil
+		case errors.As(err, &authErr) && authErr.Status == http.StatusUnauthorized:
+			authRequests.Inc(a.Method(), authResult(authErr.Status))
+			if firstErr == nil {
+				firstErr = err
+			}
+		case errors.As(err, &authErr):
+			authRequests.Inc(a.Method(), authResult(authErr.Status))
+			return nil, err
+		default:
+			return nil, fmt.Errorf("%s authentication: %w", a.Method(), err)
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	authRequests.Inc("", "unauthorized")
+	return nil, unauthorized(`Bearer realm="content"`, "authentication required")
+}
+
+func authErrorCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrorCodeForbidden
+	case http.StatusTooManyRequests:
+		return ErrorCodeRateLimited
+	default:
+		return ErrorCodeInvalidRequest
+	}
+}
+
+func authResult(status int) string {
+	switch status {
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	default:
+		return "unauthorized"
+	}
+}
+
+// bearerToken returns the token of the `Authorization: Bearer` header, if any.
+func bearerToken(req *http.Request) string {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type principalKey struct{}
+
+// withPrincipal returns the context with the client the request was authenticated as.
+func withPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// principalFromContext returns the request's client, or nil when the request wasn't authenticated.
+func principalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAuthChain(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	jwtSecret := "0123456789abcdef0123456789abcdef"
+
+	apiKeys, err := NewAPIKeys([]APIKey{{Name: "web", Key: "key-web"}, {Name: "old", Key: "key-old", Disabled: true}}, 0, 0)
+	if err != nil {
+		t.Fatalf("creating API keys: %v", err)
+	}
+	jwtAuth, err := NewJWTAuthenticator(jwtSecret, "issuer", "content")
+	if err != nil {
+		t.Fatalf("creating JWT authenticator: %v", err)
+	}
+	jwtAuth.now = func() time.Time { return now }
+	hmacAuth, err := NewHMACAuthenticator(map[string]string{"billing": "hmac-secret"}, time.Minute)
+	if err != nil {
+		t.Fatalf("creating HMAC authenticator: %v", err)
+	}
+	hmacAuth.now = func() time.Time { return now }
+	certAuth, err := NewClientCertAuthenticator([]string{"partner"})
+	if err != nil {
+		t.Fatalf("creating client certificate authenticator: %v", err)
+	}
+	chain := AuthChain{certAuth, hmacAuth, jwtAuth, apiKeys}
+
+	var gotPrincipal *Principal
+	handler := chain.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotPrincipal = principalFromContext(req.Context())
+	}))
+
+	token := func(alg string, claims map[string]any) string {
+		header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+		payload, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		mac := hmac.New(sha256.New, []byte(jwtSecret))
+		mac.Write([]byte(signed))
+		return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	validClaims := map[string]any{"sub": "mobile", "iss": "issuer", "aud": []string{"content"}, "exp": now.Add(time.Minute).Unix()}
+	withClaim := func(name string, value any) map[string]any {
+		claims := map[string]any{}
+		for k, v := range validClaims {
+			claims[k] = v
+		}
+		claims[name] = value
+		return claims
+	}
+	signed := func(id, secret string, ts time.Time, uri string) http.Header {
+		timestamp := strconv.FormatInt(ts.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(HMACStringToSign(timestamp, http.MethodGet, uri)))
+		return http.Header{
+			hmacKeyIDHeader:     {id},
+			hmacTimestampHeader: {timestamp},
+			hmacSignatureHeader: {hex.EncodeToString(mac.Sum(nil))},
+		}
+	}
+	cert := func(subject string) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: subject}}}}}
+	}
+
+	for name, tc := range map[string]struct {
+		header     http.Header
+		tls        *tls.ConnectionState
+		wantStatus int
+		wantName   string
+		wantMethod string
+	}{
+		"no credentials":    {wantStatus: http.StatusUnauthorized},
+		"api key":           {header: http.Header{"X-Api-Key": {"key-web"}}, wantStatus: http.StatusOK, wantName: "web", wantMethod: "api_key"},
+		"api key as bearer": {header: http.Header{"Authorization": {"Bearer key-web"}}, wantStatus: http.StatusOK, wantName: "web", wantMethod: "api_key"},
+		"disabled api key":  {header: http.Header{"X-Api-Key": {"key-old"}}, wantStatus: http.StatusForbidden},
+		"jwt": {
+			header:     http.Header{"Authorization": {"Bearer " + token("HS256", validClaims)}},
+			wantStatus: http.StatusOK, wantName: "mobile", wantMethod: "jwt",
+		},
+		"jwt with a single audience": {
+			header:     http.Header{"Authorization": {"Bearer " + token("HS256", withClaim("aud", "content"))}},
+			wantStatus: http.StatusOK, wantName: "mobile", wantMethod: "jwt",
+		},
+		"expired jwt": {
+			header:     http.Header{"Authorization": {"Bearer " + token("HS256", withClaim("exp", now.Add(-time.Hour).Unix()))}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		"jwt of another issuer": {
+			header:     http.Header{"Authorization": {"Bearer " + token("HS256", withClaim("iss", "other"))}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		"jwt for another audience": {
+			header:     http.Header{"Authorization": {"Bearer " + token("HS256", withClaim("aud", "admin"))}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		"unsigned jwt": {
+			header:     http.Header{"Authorization": {"Bearer " + token("none", validClaims)}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		"hmac": {
+			header:     signed("billing", "hmac-secret", now, "/?count=3"),
+			wantStatus: http.StatusOK, wantName: "billing", wantMethod: "hmac",
+		},
+		"hmac of another uri":      {header: signed("billing", "hmac-secret", now, "/?count=30"), wantStatus: http.StatusUnauthorized},
+		"hmac with a wrong secret": {header: signed("billing", "other", now, "/?count=3"), wantStatus: http.StatusUnauthorized},
+		"hmac with an unknown key": {header: signed("other", "hmac-secret", now, "/?count=3"), wantStatus: http.StatusUnauthorized},
+		"replayed hmac":            {header: signed("billing", "hmac-secret", now.Add(-time.Hour), "/?count=3"), wantStatus: http.StatusUnauthorized},
+		"client certificate":       {tls: cert("partner"), wantStatus: http.StatusOK, wantName: "partner", wantMethod: "client_cert"},
+		"client certificate of another subject": {
+			tls: cert("stranger"), header: http.Header{"X-Api-Key": {"key-web"}}, wantStatus: http.StatusForbidden,
+		},
+		"unverified client certificate falls through": {
+			tls: &tls.ConnectionState{}, header: http.Header{"X-Api-Key": {"key-web"}},
+			wantStatus: http.StatusOK, wantName: "web", wantMethod: "api_key",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			gotPrincipal = nil
+			req := httptest.NewRequest(http.MethodGet, "/?count=3", nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v[0])
+			}
+			req.TLS = tc.tls
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tc.wantStatus, w.Body)
+			}
+			if tc.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("got no WWW-Authenticate header")
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			if gotPrincipal == nil || gotPrincipal.Name != tc.wantName || gotPrincipal.Method != tc.wantMethod {
+				t.Errorf("got principal %+v, want %s authenticated with %s", gotPrincipal, tc.wantName, tc.wantMethod)
+			}
+		})
+	}
+}
+
+func TestParseHMACKeys(t *testing.T) {
+	keys, err := ParseHMACKeys("a:secret-a, b:secret:b")
+	if err != nil {
+		t.Fatalf("parsing keys: %v", err)
+	}
+	if len(keys) != 2 || keys["a"] != "secret-a" || keys["b"] != "secret:b" {
+		t.Errorf("got keys %v", keys)
+	}
+	for _, s := range []string{"only-a-secret", "a:1,a:2"} {
+		if _, err := ParseHMACKeys(s); err == nil {
+			t.Errorf("got no error for %q", s)
+		}
+	}
+	if _, err := NewJWTAuthenticator("short", "", ""); err == nil {
+		t.Error("got no error for a short JWT secret")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	hmacKeyIDHeader     = "X-Auth-Key-ID"
+	hmacTimestampHeader = "X-Auth-Timestamp"
+	hmacSignatureHeader = "X-Auth-Signature"
+)
+
+// HMACAuthenticator authenticates the requests signed with a shared secret, for server-to-server clients.
+// The request sends the key ID, the Unix timestamp, and the hex encoded HMAC-SHA256 of the string to sign
+// (see HMACStringToSign) in the X-Auth-Key-ID, X-Auth-Timestamp and X-Auth-Signature headers.
+// The key ID is the principal.
+type HMACAuthenticator struct {
+	secrets map[string][]byte
+	// maxSkew is how far the request's timestamp may be from the server's clock, so the captured requests can't be replayed later.
+	maxSkew time.Duration
+	now     func() time.Time
+}
+
+// NewHMACAuthenticator returns the authenticator of the requests signed with the secrets, by key ID.
+func NewHMACAuthenticator(secrets map[string]string, maxSkew time.Duration) (*HMACAuthenticator, error) {
+	if maxSkew <= 0 {
+		return nil, errors.New("HMAC maximum clock skew must be positive")
+	}
+	a := &HMACAuthenticator{secrets: make(map[string][]byte, len(secrets)), maxSkew: maxSkew, now: time.Now}
+	for id, secret := range secrets {
+		if id == "" || secret == "" {
+			return nil, errors.New("HMAC key ID and secret must not be empty")
+		}
+		a.secrets[id] = []byte(secret)
+	}
+	return a, nil
+}
+
+// ParseHMACKeys parses the secrets from a comma-separated list of `id:secret` pairs, as given in the HMAC_KEYS variable.
+func ParseHMACKeys(s string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for i, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok {
+			// The pair isn't included in the error, as it has the secret.
+			return nil, fmt.Errorf("invalid HMAC key #%d, must be in the form id:secret", i+1)
+		}
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("HMAC key '%s' is defined more than once", id)
+		}
+		keys[id] = secret
+	}
+
+	return keys, nil
+}
+
+// HMACStringToSign returns the string the clients sign: the timestamp, the method and the request URI (the path with the query),
+// separated by new lines.
+func HMACStringToSign(timestamp, method, requestURI string) string {
+	return timestamp + "\n" + method + "\n" + requestURI
+}
+
+// Method implements Authenticator.
+func (a *HMACAuthenticator) Method() string {
+	return "hmac"
+}
+
+// Authenticate implements Authenticator.
+func (a *HMACAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	id := req.Header.Get(hmacKeyIDHeader)
+	if id == "" {
+		return nil, ErrNoCredentials
+	}
+	invalid := func(msg string) error {
+		return unauthorized(`HMAC-SHA256 realm="content"`, msg)
+	}
+	secret, ok := a.secrets[id]
+	if !ok {
+		return nil, invalid("unknown HMAC key")
+	}
+	timestamp := req.Header.Get(hmacTimestampHeader)
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, invalid("invalid request timestamp")
+	}
+	if skew := a.now().Sub(time.Unix(secs, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return nil, invalid("request timestamp out of the allowed range")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(HMACStringToSign(timestamp, req.Method, req.URL.RequestURI())))
+	signature, err := hex.DecodeString(req.Header.Get(hmacSignatureHeader))
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, invalid("invalid request signature")
+	}
+
+	return &Principal{Name: id, Method: a.Method()}, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// JWTAuthenticator authenticates the requests with the HS256 signed JSON Web Tokens sent as `Authorization: Bearer`.
+// The token's subject (`sub`) is the principal.
+type JWTAuthenticator struct {
+	secret []byte
+	// issuer and audience, when set, must match the token's `iss` and `aud` claims.
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// jwtLeeway is the clock difference tolerated when checking the token's expiry and not-before times.
+const jwtLeeway = 30 * time.Second
+
+type jwtClaims struct {
+	Subject   string           `json:"sub"`
+	Issuer    string           `json:"iss"`
+	Audience  jwtAudienceClaim `json:"aud"`
+	ExpiresAt *json.Number     `json:"exp"`
+	NotBefore *json.Number     `json:"nbf"`
+}
+
+// jwtAudienceClaim is the `aud` claim, which is a string or a list of them.
+type jwtAudienceClaim []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *jwtAudienceClaim) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = jwtAudienceClaim{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// NewJWTAuthenticator returns the authenticator of the tokens signed with the secret. The issuer and audience are optional.
+func NewJWTAuthenticator(secret, issuer, audience string) (*JWTAuthenticator, error) {
+	// RFC 7518 requires HS256 keys of at least the hash size.
+	if len(secret) < sha256.Size {
+		return nil, errors.New("JWT secret must be at least 32 bytes long")
+	}
+	return &JWTAuthenticator{secret: []byte(secret), issuer: issuer, audience: audience, now: time.Now}, nil
+}
+
+// Method implements Authenticator.
+func (a *JWTAuthenticator) Method() string {
+	return "jwt"
+}
+
+// Authenticate implements Authenticator. Bearer tokens that aren't JWTs, like API keys, are left to the other authenticators.
+func (a *JWTAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	parts := strings.Split(bearerToken(req), ".")
+	if len(parts) != 3 {
+		return nil, ErrNoCredentials
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg == "" {
+		return nil, ErrNoCredentials
+	}
+
+	invalid := func(msg string) error {
+		return unauthorized(`Bearer realm="content", error="invalid_token"`, msg)
+	}
+	// Only the configured algorithm is accepted, so a token can't pick a weaker one, e.g. "none".
+	if header.Alg != "HS256" {
+		return nil, invalid("unsupported token algorithm")
+	}
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, invalid("invalid token signature")
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, invalid("invalid token claims")
+	}
+	now := a.now()
+	if exp, ok := jwtTime(claims.ExpiresAt); !ok || now.After(exp.Add(jwtLeeway)) {
+		return nil, invalid("token expired")
+	}
+	if nbf, ok := jwtTime(claims.NotBefore); ok && now.Add(jwtLeeway).Before(nbf) {
+		return nil, invalid("token not valid yet")
+	}
+	switch {
+	case claims.Subject == "":
+		return nil, invalid("token has no subject")
+	case a.issuer != "" && claims.Issuer != a.issuer:
+		return nil, invalid("token issued by another issuer")
+	case a.audience != "" && !slices.Contains(claims.Audience, a.audience):
+		return nil, invalid("token issued for another audience")
+	}
+
+	return &Principal{Name: claims.Subject, Method: a.Method()}, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// jwtTime converts a NumericDate claim, the seconds since the epoch.
+func jwtTime(n *json.Number) (time.Time, bool) {
+	if n == nil {
+		return time.Time{}, false
+	}
+	secs, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))), true
+}
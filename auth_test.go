@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	keys, err := NewAPIKeys([]APIKey{
+		{Name: "partner", Key: "partner-secret"},
+		{Name: "suspended", Key: "suspended-secret", Disabled: true},
+		{Name: "limited", Key: "limited-secret", RateLimit: 1, Burst: 2},
+	}, 0, 10)
+	if err != nil {
+		t.Fatalf("creating API keys: %v", err)
+	}
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+	var gotName string
+	srv := httptest.NewServer(keys.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotName = apiKeyNameFromContext(req.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	defer srv.Close()
+
+	do := func(headers map[string]string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for name, tc := range map[string]struct {
+		headers    map[string]string
+		wantStatus int
+		wantName   string
+	}{
+		"bearer token":            {headers: map[string]string{"Authorization": "Bearer partner-secret"}, wantStatus: http.StatusNoContent, wantName: "partner"},
+		"api key header":          {headers: map[string]string{"X-API-Key": "partner-secret"}, wantStatus: http.StatusNoContent, wantName: "partner"},
+		"no key":                  {wantStatus: http.StatusUnauthorized},
+		"unknown key":             {headers: map[string]string{"X-API-Key": "guess"}, wantStatus: http.StatusUnauthorized},
+		"other auth scheme":       {headers: map[string]string{"Authorization": "Basic cGFydG5lcg==", "X-API-Key": "partner-secret"}, wantStatus: http.StatusUnauthorized},
+		"disabled key":            {headers: map[string]string{"X-API-Key": "suspended-secret"}, wantStatus: http.StatusForbidden},
+		"key prefix":              {headers: map[string]string{"X-API-Key": "partner"}, wantStatus: http.StatusUnauthorized},
+		"case-insensitive scheme": {headers: map[string]string{"Authorization": "bearer partner-secret"}, wantStatus: http.StatusNoContent, wantName: "partner"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			gotName = ""
+			resp := do(tc.headers)
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("got no WWW-Authenticate header with 401")
+			}
+			if gotName != tc.wantName {
+				t.Errorf("got key name %q in the context, want %q", gotName, tc.wantName)
+			}
+		})
+	}
+
+	// The burst is allowed at once, then the requests are limited to the rate.
+	limited := map[string]string{"X-API-Key": "limited-secret"}
+	for i, want := range []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests} {
+		resp := do(limited)
+		if resp.StatusCode != want {
+			t.Errorf("request %d: got status %d, want %d", i, resp.StatusCode, want)
+		}
+		if want == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != "1" {
+			t.Errorf("got Retry-After %q, want 1", resp.Header.Get("Retry-After"))
+		}
+	}
+	now = now.Add(time.Second)
+	if resp := do(limited); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("got status %d after a second, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	if resp := do(map[string]string{"X-API-Key": "partner-secret"}); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("got status %d for a key without a limit, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "a", "key": "secret-a", "rate_limit": 5}]`), 0o600); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	keys, err := LoadAPIKeys(path)
+	if err != nil {
+		t.Fatalf("loading keys: %v", err)
+	}
+	envKeys, err := ParseAPIKeys("b:secret-b, c:secret:c")
+	if err != nil {
+		t.Fatalf("parsing keys: %v", err)
+	}
+	all := append(keys, envKeys...)
+	want := []APIKey{{Name: "a", Key: "secret-a", RateLimit: 5}, {Name: "b", Key: "secret-b"}, {Name: "c", Key: "secret:c"}}
+	if len(all) != len(want) {
+		t.Fatalf("got keys %+v, want %+v", all, want)
+	}
+	for i := range want {
+		if all[i] != want[i] {
+			t.Errorf("got key %+v, want %+v", all[i], want[i])
+		}
+	}
+
+	for name, keys := range map[string][]APIKey{
+		"no name":        {{Key: "secret"}},
+		"no key":         {{Name: "a"}},
+		"duplicate name": {{Name: "a", Key: "1"}, {Name: "a", Key: "2"}},
+		"duplicate key":  {{Name: "a", Key: "1"}, {Name: "b", Key: "1"}},
+		"negative rate":  {{Name: "a", Key: "1", RateLimit: -1}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewAPIKeys(keys, 0, 0); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+	if _, err := ParseAPIKeys("only-a-key"); err == nil {
+		t.Error("expected error for a key without a name")
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// minBootstrapTimeout and maxBootstrapTimeout bound the provider timeouts of a bootstrapped config.
+	minBootstrapTimeout = 500 * time.Millisecond
+	maxBootstrapTimeout = 5 * time.Second
+)
+
+// BootstrapProvider is a provider endpoint to probe, a line of the bootstrap providers file.
+type BootstrapProvider struct {
+	Name            Provider
+	URL             string
+	CapabilitiesURL string
+}
+
+// ProbeResult is the outcome of probing a provider endpoint.
+type ProbeResult struct {
+	BootstrapProvider
+	// Latency is the slowest successful probe.
+	Latency      time.Duration
+	Capabilities *Capabilities
+	Err          error
+}
+
+// parseBootstrapProviders reads the providers file. Every line is `<url>` or `<name> <url> [<capabilities url>]`;
+// empty lines and lines starting with # are skipped. The providers without a name are named after the URL host.
+func parseBootstrapProviders(r io.Reader) ([]BootstrapProvider, error) {
+	var providers []BootstrapProvider
+	names := make(map[Provider]bool)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var p BootstrapProvider
+		switch len(fields) {
+		case 1:
+			u, err := url.Parse(fields[0])
+			if err != nil || u.Hostname() == "" {
+				return nil, fmt.Errorf("line %d: invalid url '%s'", line, fields[0])
+			}
+			p = BootstrapProvider{Name: Provider(u.Hostname()), URL: fields[0]}
+			for i := 2; names[p.Name]; i++ {
+				p.Name = Provider(fmt.Sprintf("%s-%d", u.Hostname(), i))
+			}
+		case 2, 3:
+			p = BootstrapProvider{Name: Provider(fields[0]), URL: fields[1]}
+			if len(fields) == 3 {
+				p.CapabilitiesURL = fields[2]
+			}
+		default:
+			return nil, fmt.Errorf("line %d: want `<url>` or `<name> <url> [<capabilities url>]`", line)
+		}
+		if names[p.Name] || p.Name == ProviderStatic {
+			return nil, fmt.Errorf("line %d: provider '%s' is given twice or is built in", line, p.Name)
+		}
+		names[p.Name] = true
+		providers = append(providers, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(providers) == 0 {
+		return nil, errors.New("no providers given")
+	}
+
+	return providers, nil
+}
+
+// probeProvider calls the provider endpoint `probes` times for one item, and fetches its capabilities when it has the endpoint.
+func probeProvider(ctx context.Context, p BootstrapProvider, probes int, timeout time.Duration) ProbeResult {
+	result := ProbeResult{BootstrapProvider: p}
+	client, err := NewHTTPProviderClient(p.Name, p.URL, timeout, nil)
+	if err == nil && p.CapabilitiesURL != "" {
+		err = client.SetCapabilitiesURL(p.CapabilitiesURL)
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	for range probes {
+		start := time.Now()
+		if _, err := client.GetContent(ctx, RequestMeta{}, 1); err != nil {
+			result.Err = err
+			return result
+		}
+		result.Latency = max(result.Latency, time.Since(start))
+	}
+	if caps, err := client.Capabilities(ctx); err == nil {
+		result.Capabilities = &caps
+	} else if !errors.Is(err, ErrCapabilitiesUnknown) {
+		result.Err = fmt.Errorf("discovering capabilities: %w", err)
+	}
+
+	return result
+}
+
+// bootstrapConfig returns a starter configuration for the providers that responded.
+// Every provider gets an item of weight 1, with the fastest other provider as the fallback (or the static provider,
+// when there is no other), and a timeout of 3 times its slowest probe. The content timeout fits a call and its fallback.
+func bootstrapConfig(results []ProbeResult) (*FileConfig, error) {
+	var ok []ProbeResult
+	for _, r := range results {
+		if r.Err == nil {
+			ok = append(ok, r)
+		}
+	}
+	if len(ok) == 0 {
+		return nil, errors.New("none of the providers responded")
+	}
+	slices.SortStableFunc(ok, func(a, b ProbeResult) int { return cmp.Compare(a.Latency, b.Latency) })
+
+	cfg := &FileConfig{Providers: make(map[Provider]ProviderConfig, len(ok))}
+	var slowest time.Duration
+	for _, r := range ok {
+		timeout := min(max((3*r.Latency).Round(100*time.Millisecond), minBootstrapTimeout), maxBootstrapTimeout)
+		slowest = max(slowest, timeout)
+		params, err := json.Marshal(httpProviderParams{URL: r.URL, Timeout: Duration(timeout), CapabilitiesURL: r.CapabilitiesURL})
+		if err != nil {
+			return nil, err
+		}
+		cfg.Providers[r.Name] = ProviderConfig{Client: &ClientConfig{Type: "http", Params: params}}
+
+		fallback := ProviderStatic
+		for _, f := range ok {
+			if f.Name != r.Name {
+				fallback = f.Name
+				break
+			}
+		}
+		cfg.Items = append(cfg.Items, ItemConfig{Provider: r.Name, Fallback: fallback, Weight: 1})
+	}
+	cfg.Timeout = Duration(2 * slowest)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("the bootstrapped config is invalid: %w", err)
+	}
+	return cfg, nil
+}
+
+func runBootstrapCommand(args []string) error {
+	fs := flag.NewFlagSet("bootstrap", flag.ContinueOnError)
+	providersPath := fs.String("providers", "", "path to the file with the provider endpoints, one `<url>` or `<name> <url> [<capabilities url>]` per line")
+	probes := fs.Int("probes", 3, "number of calls made to every provider for measuring its latency")
+	timeout := fs.Duration("timeout", maxBootstrapTimeout, "timeout of one probe")
+	output := fs.String("output", "", "path of the written config file; defaults to stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *providersPath == "" || *probes <= 0 {
+		return errors.New("usage: bootstrap -providers urls.txt [-probes n] [-timeout d] [-output config.json]")
+	}
+
+	f, err := os.Open(*providersPath)
+	if err != nil {
+		return fmt.Errorf("opening providers file: %w", err)
+	}
+	providers, err := parseBootstrapProviders(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("parsing providers file: %w", err)
+	}
+
+	results := make([]ProbeResult, len(providers))
+	done := make(chan struct{})
+	for i, p := range providers {
+		go func() {
+			results[i] = probeProvider(context.Background(), p, *probes, *timeout)
+			done <- struct{}{}
+		}()
+	}
+	for range providers {
+		<-done
+	}
+	writeProbeReport(os.Stderr, results)
+
+	cfg, err := bootstrapConfig(results)
+	if err != nil {
+		return err
+	}
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("creating config file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(cfg)
+}
+
+// writeProbeReport writes the probe results as a table.
+func writeProbeReport(w io.Writer, results []ProbeResult) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tLATENCY\tCAPABILITIES\tERROR")
+	for _, r := range results {
+		latency, caps, errMsg := "-", "-", ""
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		} else {
+			latency = r.Latency.Round(time.Millisecond).String()
+		}
+		if r.Capabilities != nil {
+			data, _ := json.Marshal(r.Capabilities)
+			caps = string(data)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Name, latency, caps, errMsg)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBootstrapProviders(t *testing.T) {
+	for name, tc := range map[string]struct {
+		content   string
+		wantNames string
+		wantErr   bool
+	}{
+		"names and urls": {
+			content:   "# partners\npartner https://partner.example.com/items https://partner.example.com/capabilities\n\nhttps://news.example.com/items\nhttps://news.example.com/v2/items\n",
+			wantNames: "partner,news.example.com,news.example.com-2",
+		},
+		"repeated name":  {content: "a https://a.example.com\na https://b.example.com", wantErr: true},
+		"static name":    {content: "static https://a.example.com", wantErr: true},
+		"invalid url":    {content: "/items", wantErr: true},
+		"too many parts": {content: "a https://a.example.com https://a.example.com/caps extra", wantErr: true},
+		"empty":          {content: "# nothing yet\n", wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			providers, err := parseBootstrapProviders(strings.NewReader(tc.content))
+			if tc.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsing: %v", err)
+			}
+			names := make([]string, len(providers))
+			for i, p := range providers {
+				names[i] = string(p.Name)
+			}
+			if got := strings.Join(names, ","); got != tc.wantNames {
+				t.Errorf("got providers %s, want %s", got, tc.wantNames)
+			}
+		})
+	}
+}
+
+func TestBootstrapConfig(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/slow":
+			time.Sleep(250 * time.Millisecond)
+		case "/failing":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		case "/capabilities":
+			_, _ = w.Write([]byte(`{"max_count": 20}`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"id": "1"}]`))
+	}))
+	defer api.Close()
+
+	var results []ProbeResult
+	for _, p := range []BootstrapProvider{
+		{Name: "slow", URL: api.URL + "/slow"},
+		{Name: "fast", URL: api.URL + "/fast", CapabilitiesURL: api.URL + "/capabilities"},
+		{Name: "failing", URL: api.URL + "/failing"},
+	} {
+		results = append(results, probeProvider(context.Background(), p, 2, time.Second))
+	}
+	if results[1].Capabilities == nil || results[1].Capabilities.MaxCount != 20 {
+		t.Errorf("got capabilities %+v, want the discovered ones", results[1].Capabilities)
+	}
+	if results[2].Err == nil {
+		t.Error("the failing provider has no error")
+	}
+
+	cfg, err := bootstrapConfig(results)
+	if err != nil {
+		t.Fatalf("bootstrapping config: %v", err)
+	}
+	want := []ItemConfig{{Provider: "fast", Fallback: "slow", Weight: 1}, {Provider: "slow", Fallback: "fast", Weight: 1}}
+	if len(cfg.Items) != len(want) || cfg.Items[0] != want[0] || cfg.Items[1] != want[1] {
+		t.Errorf("got items %+v, want %+v", cfg.Items, want)
+	}
+	if _, ok := cfg.Providers["failing"]; ok {
+		t.Error("the failing provider is configured")
+	}
+	var params httpProviderParams
+	if err := json.Unmarshal(cfg.Providers["slow"].Client.Params, &params); err != nil {
+		t.Fatalf("decoding client params: %v", err)
+	}
+	if timeout := time.Duration(params.Timeout); timeout < 750*time.Millisecond || timeout > maxBootstrapTimeout {
+		t.Errorf("got slow provider timeout %v, want 3 times its latency", timeout)
+	}
+	if time.Duration(cfg.Timeout) != 2*time.Duration(params.Timeout) {
+		t.Errorf("got timeout %v, want twice the slowest provider timeout %v", time.Duration(cfg.Timeout), time.Duration(params.Timeout))
+	}
+
+	cfg, err = bootstrapConfig(results[1:2])
+	if err != nil {
+		t.Fatalf("bootstrapping config: %v", err)
+	}
+	if cfg.Items[0].Fallback != ProviderStatic {
+		t.Errorf("got fallback %q for the only provider, want the static provider", cfg.Items[0].Fallback)
+	}
+	if _, err := bootstrapConfig(results[2:]); err == nil {
+		t.Error("expected an error without responding providers")
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"cmp"
+	"container/list"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var botRequests = newCounterVec(
+	"bot_requests_total",
+	"Number of content requests from bots by result (cached, fetched, rejected).",
+	"result",
+)
+
+// botPages serves bots the same non-personalized pages, cached for the TTL, so crawler storms don't reach the providers.
+type botPages struct {
+	ttl   time.Duration
+	now   func() time.Time
+	pages map[string]*botPage
+	m     sync.Mutex
+}
+
+// botPage is a cached page. The result is set before done is closed.
+type botPage struct {
+	done    chan struct{}
+	result  *ContentResult
+	err     error
+	expires time.Time
+}
+
+func newBotPages(ttl time.Duration) *botPages {
+	return &botPages{
+		ttl:   ttl,
+		now:   time.Now,
+		pages: make(map[string]*botPage),
+	}
+}
+
+// get returns the cached page, or gets it with fetch. Concurrent requests for the same page wait for one fetch.
+// Only complete pages are cached.
+func (b *botPages) get(ctx context.Context, count, offset int, fetch func(context.Context) (*ContentResult, error)) (*ContentResult, error) {
+	key := strconv.Itoa(count) + "|" + strconv.Itoa(offset)
+
+	b.m.Lock()
+	page, ok := b.pages[key]
+	if ok && (page.expires.IsZero() || b.now().Before(page.expires)) {
+		b.m.Unlock()
+		select {
+		case <-page.done:
+			botRequests.Inc("cached")
+			return page.result, page.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	page = &botPage{done: make(chan struct{})}
+	b.pages[key] = page
+	b.removeExpired()
+	b.m.Unlock()
+
+	// The waiting requests share the fetch, so it doesn't depend on the first request being cancelled.
+	page.result, page.err = fetch(context.WithoutCancel(ctx))
+	botRequests.Inc("fetched")
+
+	b.m.Lock()
+	if page.err == nil && len(page.result.Failures) == 0 {
+		page.expires = b.now().Add(b.ttl)
+	} else {
+		delete(b.pages, key)
+	}
+	b.m.Unlock()
+	close(page.done)
+
+	return page.result, page.err
+}
+
+// removeExpired drops the expired pages. It must be called with the lock held.
+func (b *botPages) removeExpired() {
+	now := b.now()
+	for key, page := range b.pages {
+		if !page.expires.IsZero() && !now.Before(page.expires) {
+			delete(b.pages, key)
+		}
+	}
+}
+
+// purge drops all the cached pages, e.g., when the blocked items change.
+func (b *botPages) purge() {
+	b.m.Lock()
+	defer b.m.Unlock()
+	for key, page := range b.pages {
+		if !page.expires.IsZero() {
+			delete(b.pages, key)
+		}
+	}
+}
+
+// crawlerDomains are the domains of the well-known crawlers, whose IPs can be verified with reverse DNS.
+var crawlerDomains = []struct {
+	pattern *regexp.Regexp
+	domains []string
+}{
+	{regexp.MustCompile(`(?i)googlebot|google-inspectiontool|adsbot-google`), []string{".googlebot.com", ".google.com"}},
+	{regexp.MustCompile(`(?i)bingbot|adidxbot`), []string{".search.msn.com"}},
+	{regexp.MustCompile(`(?i)applebot`), []string{".applebot.apple.com"}},
+	{regexp.MustCompile(`(?i)yandex`), []string{".yandex.ru", ".yandex.net", ".yandex.com"}},
+	{regexp.MustCompile(`(?i)baiduspider`), []string{".crawl.baidu.com", ".crawl.baidu.jp"}},
+}
+
+// BotVerifier verifies that the requests claiming to be from well-known crawlers come from their networks:
+// the reverse DNS name of the IP must be in the crawler's domain, and resolve back to the IP.
+type BotVerifier struct {
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	ttl        time.Duration
+	now        func() time.Time
+
+	// verified are the remembered results, in the order of the verifications, so the oldest is dropped first.
+	verified map[string]*list.Element
+	order    *list.List
+	m        sync.Mutex
+}
+
+type botVerification struct {
+	key     string
+	ok      bool
+	expires time.Time
+}
+
+const (
+	// maxBotVerifications limits the number of remembered verification results.
+	maxBotVerifications = 10000
+	// botLookupErrorTTL is how long the failed verifications are remembered when the DNS lookups failed,
+	// shorter than the TTL so a resolver hiccup doesn't lock the crawlers out.
+	botLookupErrorTTL = 10 * time.Second
+)
+
+// NewBotVerifier returns a verifier using the DNS resolver, remembering the results for the TTL.
+func NewBotVerifier(ttl time.Duration) *BotVerifier {
+	return &BotVerifier{
+		lookupAddr: net.DefaultResolver.LookupAddr,
+		lookupHost: net.DefaultResolver.LookupHost,
+		ttl:        ttl,
+		now:        time.Now,
+		verified:   make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Verify tells if the request with the user agent can come from the IP.
+// User agents of crawlers that can't be verified (and of non-crawlers) always pass.
+func (v *BotVerifier) Verify(ctx context.Context, ip, userAgent string) bool {
+	var domains []string
+	for _, c := range crawlerDomains {
+		if c.pattern.MatchString(userAgent) {
+			domains = c.domains
+			break
+		}
+	}
+	if domains == nil {
+		return true
+	}
+
+	key := ip + "|" + strings.Join(domains, ",")
+	now := v.now()
+	v.m.Lock()
+	if el, ok := v.verified[key]; ok && now.Before(el.Value.(*botVerification).expires) {
+		v.m.Unlock()
+		return el.Value.(*botVerification).ok
+	}
+	v.m.Unlock()
+
+	ttl := v.ttl
+	ok, err := v.verify(ctx, ip, domains)
+	if err != nil {
+		slog.WarnContext(ctx, "crawler verification lookup failed", "ip", ip, "error", err)
+		ttl = min(ttl, botLookupErrorTTL)
+	}
+
+	v.m.Lock()
+	defer v.m.Unlock()
+	if el, ok := v.verified[key]; ok {
+		v.order.Remove(el)
+		delete(v.verified, key)
+	}
+	if len(v.verified) >= maxBotVerifications {
+		oldest := v.order.Front()
+		v.order.Remove(oldest)
+		delete(v.verified, oldest.Value.(*botVerification).key)
+	}
+	v.verified[key] = v.order.PushBack(&botVerification{key: key, ok: ok, expires: now.Add(ttl)})
+
+	return ok
+}
+
+// verify looks the IP up. The error is set when a lookup failed for another reason than a missing DNS record,
+// so the result isn't certain.
+func (v *BotVerifier) verify(ctx context.Context, ip string, domains []string) (bool, error) {
+	names, err := v.lookupAddr(ctx, ip)
+	if err != nil {
+		return false, lookupError(err)
+	}
+	var lookupErr error
+	for _, name := range names {
+		name = strings.TrimSuffix(name, ".")
+		if !hasAnySuffix(name, domains) {
+			continue
+		}
+		addrs, err := v.lookupHost(ctx, name)
+		if err != nil {
+			lookupErr = cmp.Or(lookupErr, lookupError(err))
+			continue
+		}
+		for _, addr := range addrs {
+			if addr == ip {
+				return true, nil
+			}
+		}
+	}
+
+	return false, lookupErr
+}
+
+// lookupError returns the error of a failed DNS lookup, or nil when the record doesn't exist.
+func lookupError(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil
+	}
+	return err
+}
+
+func hasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// withBotVerification rejects the requests of crawlers that fail the verification with 403.
+func withBotVerification(next http.Handler, v *BotVerifier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ua := req.UserAgent()
+		if classifyDevice(DeviceHints{UserAgent: ua}) == DeviceBot && !v.Verify(req.Context(), clientIP(req), ua) {
+			botRequests.Inc("rejected")
+			writeError(w, req, http.StatusForbidden, ErrorCodeForbidden, "crawler verification failed")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
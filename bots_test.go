@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBotPages(t *testing.T) {
+	provider := &mockContentProvider{source: Provider1, responseDelay: 10 * time.Millisecond}
+	recorder := &metaRecordingClient{}
+	clients := map[Provider]Client{Provider1: provider, Provider2: recorder}
+	service, err := NewService([]ContentConfig{{Type: Provider1}, {Type: Provider2}}, clients, defaultTimeout, WithBotPages(time.Minute))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	bot := func(ip string) RequestMeta {
+		return RequestMeta{IP: ip, Locale: "en", Variant: "b", Device: DeviceHints{UserAgent: "Googlebot", Class: DeviceBot}}
+	}
+
+	// A crawler storm: concurrent requests share one fetch, and the later ones are served from the cache.
+	var wg sync.WaitGroup
+	results := make([][]*ContentItem, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = service.GetContent(context.Background(), bot("10.0.0.1"), 2, 0)
+		}()
+	}
+	wg.Wait()
+	items, err := service.GetContent(context.Background(), bot("10.0.0.2"), 2, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	for _, r := range append(results, items) {
+		if len(r) != 2 || r[0].ID != items[0].ID {
+			t.Errorf("got items %+v, want the same page for all bots", r)
+		}
+	}
+	if provider.calls != 1 {
+		t.Errorf("got %d provider calls, want 1", provider.calls)
+	}
+	if want := (RequestMeta{Device: DeviceHints{Class: DeviceBot}}); recorder.meta != want {
+		t.Errorf("provider got %+v, want non-personalized metadata", recorder.meta)
+	}
+
+	// Other users aren't served the bot pages, and blocking items drops the cached pages.
+	if _, err := service.GetContent(context.Background(), RequestMeta{IP: "10.0.0.3", Device: DeviceHints{Class: DeviceDesktop}}, 2, 0); err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if err := service.ApplyState(RuntimeState{BlockedItems: []string{items[0].ID}}); err != nil {
+		t.Fatalf("applying state: %v", err)
+	}
+	if _, err := service.GetContent(context.Background(), bot("10.0.0.1"), 2, 0); err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if provider.calls != 3 {
+		t.Errorf("got %d provider calls, want 3", provider.calls)
+	}
+}
+
+func TestBotVerifier(t *testing.T) {
+	reverse := map[string][]string{
+		"66.249.66.1":  {"crawl-66-249-66-1.googlebot.com."},
+		"203.0.113.5":  {"crawl-203-0-113-5.googlebot.com."},
+		"198.51.100.9": {"host.example.com."},
+	}
+	forward := map[string][]string{
+		"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"},
+		"crawl-203-0-113-5.googlebot.com": {"192.0.2.1"},
+	}
+	v := NewBotVerifier(time.Minute)
+	var resolverDown atomic.Bool
+	v.lookupAddr = func(_ context.Context, addr string) ([]string, error) {
+		if resolverDown.Load() {
+			return nil, &net.DNSError{Err: "i/o timeout", Name: addr, IsTimeout: true}
+		}
+		if names, ok := reverse[addr]; ok {
+			return names, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	v.lookupHost = func(_ context.Context, host string) ([]string, error) {
+		if addrs, ok := forward[host]; ok {
+			return addrs, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	srv := httptest.NewServer(withBotVerification(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), v))
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		ip        string
+		userAgent string
+		want      bool
+	}{
+		"googlebot":        {ip: "66.249.66.1", userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1)", want: true},
+		"fake googlebot":   {ip: "198.51.100.9", userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1)"},
+		"no reverse name":  {ip: "192.0.2.7", userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1)"},
+		"forward mismatch": {ip: "203.0.113.5", userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1)"},
+		"unverifiable bot": {ip: "192.0.2.7", userAgent: "SomeBot/1.0", want: true},
+		"not a bot":        {ip: "192.0.2.7", userAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0", want: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := v.Verify(context.Background(), tc.ip, tc.userAgent); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// A failed lookup is remembered only briefly, so the crawler is verified again when the resolver is back.
+	const googlebot = "Mozilla/5.0 (compatible; Googlebot/2.1)"
+	now := time.Now()
+	v.now = func() time.Time { return now }
+	resolverDown.Store(true)
+	if v.Verify(context.Background(), "66.249.66.2", googlebot) {
+		t.Error("got a crawler verified while the resolver is down")
+	}
+	resolverDown.Store(false)
+	reverse["66.249.66.2"] = []string{"crawl-66-249-66-2.googlebot.com."}
+	forward["crawl-66-249-66-2.googlebot.com"] = []string{"66.249.66.2"}
+	now = now.Add(botLookupErrorTTL + time.Second)
+	if !v.Verify(context.Background(), "66.249.66.2", googlebot) {
+		t.Error("got the crawler rejected after the resolver is back")
+	}
+
+	// The oldest results are dropped one at a time.
+	for i := range maxBotVerifications {
+		v.Verify(context.Background(), "10.0."+strconv.Itoa(i/256)+"."+strconv.Itoa(i%256), googlebot)
+	}
+	if len(v.verified) != maxBotVerifications || v.order.Len() != maxBotVerifications {
+		t.Errorf("got %d remembered results, want %d", len(v.verified), maxBotVerifications)
+	}
+	if _, ok := v.verified["10.0.0.0|.googlebot.com,.google.com"]; !ok {
+		t.Error("got the first of the last results dropped")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; bingbot/2.0)")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("got status %d for a fake crawler, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
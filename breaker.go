@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for provider calls skipped because the provider's circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+var (
+	circuitState = newGaugeVec(
+		"circuit_breaker_state",
+		"Provider circuit breaker state: 0 - closed, 1 - open, 2 - half-open.",
+		"provider",
+	)
+	circuitRejections = newCounterVec(
+		"circuit_breaker_rejections_total",
+		"Number of provider calls skipped because of an open circuit breaker.",
+		"provider",
+	)
+)
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+// Circuit breaker states.
+const (
+	// CircuitClosed lets all calls through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all calls until the cooldown passes.
+	CircuitOpen
+	// CircuitHalfOpen lets a single trial call through, to check if the provider recovered.
+	CircuitHalfOpen
+)
+
+// String implements fmt.Stringer.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s CircuitState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// CircuitBreakerSettings configure the provider circuit breakers.
+type CircuitBreakerSettings struct {
+	// Failures is the number of consecutive failures opening the circuit. Zero disables the breaker.
+	Failures int
+	// Cooldown is how long the circuit stays open before a trial call is allowed.
+	Cooldown time.Duration
+	// Providers override the settings for individual providers.
+	Providers map[Provider]ProviderCircuitBreakerSettings
+}
+
+// ProviderCircuitBreakerSettings override the circuit breaker settings for one provider.
+type ProviderCircuitBreakerSettings struct {
+	Disabled bool     `json:"disabled,omitempty"`
+	Failures int      `json:"failures,omitempty"`
+	Cooldown Duration `json:"cooldown,omitempty"`
+}
+
+// forProvider returns the effective settings for the provider. Zero failures means the breaker is disabled.
+func (s CircuitBreakerSettings) forProvider(p Provider) (failures int, cooldown time.Duration) {
+	failures, cooldown = s.Failures, s.Cooldown
+	ps, ok := s.Providers[p]
+	if !ok {
+		return failures, cooldown
+	}
+	if ps.Disabled {
+		return 0, 0
+	}
+	if ps.Failures > 0 {
+		failures = ps.Failures
+	}
+	if ps.Cooldown > 0 {
+		cooldown = time.Duration(ps.Cooldown)
+	}
+
+	return failures, cooldown
+}
+
+// CircuitBreaker stops calling a provider after consecutive failures, for a cooldown period.
+type CircuitBreaker struct {
+	provider Provider
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+	// shared is the state shared with the other replicas, if any.
+	shared BreakerStateStore
+
+	state            CircuitState
+	consecutiveFails int
+	openedAt         time.Time
+	trialInFlight    bool
+	m                sync.Mutex
+}
+
+// CircuitStatus describes the current state of a circuit breaker.
+type CircuitStatus struct {
+	State            CircuitState `json:"state"`
+	ConsecutiveFails int          `json:"consecutive_failures"`
+	OpenedAt         time.Time    `json:"opened_at,omitzero"`
+}
+
+// NewCircuitBreaker returns a breaker opening after `failures` consecutive failures for `cooldown`.
+func NewCircuitBreaker(provider Provider, failures int, cooldown time.Duration) *CircuitBreaker {
+	circuitState.Set(float64(CircuitClosed), string(provider))
+	return &CircuitBreaker{
+		provider: provider,
+		failures: failures,
+		cooldown: cooldown,
+		now:      time.Now,
+	}
+}
+
+// Allow checks if a call can be made now. Every allowed call must be followed by Record.
+func (b *CircuitBreaker) Allow() bool {
+	allowed, trial := b.allow()
+	if !trial || b.shared == nil || b.claimTrial() {
+		return allowed
+	}
+
+	// Another replica makes the trial call, so the circuit stays open for another cooldown here,
+	// unless the other replica's result is synced before.
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.state == CircuitHalfOpen {
+		b.trialInFlight = false
+		b.setState(CircuitOpen)
+		b.openedAt = b.now()
+	}
+	return false
+}
+
+// allow checks if a call can be made now, and if it's the trial call of a half-open circuit.
+func (b *CircuitBreaker) allow() (allowed, trial bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false, false
+		}
+		b.setState(CircuitHalfOpen)
+		b.trialInFlight = true
+		return true, true
+	case CircuitHalfOpen:
+		if b.trialInFlight {
+			return false, false
+		}
+		b.trialInFlight = true
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// Record stores the result of an allowed call.
+func (b *CircuitBreaker) Record(err error) {
+	opened, closed := b.record(err)
+	if b.shared == nil {
+		return
+	}
+	switch {
+	case !opened.IsZero():
+		b.sharedOpen(opened)
+	case !closed.IsZero():
+		b.sharedClose(closed)
+	}
+}
+
+// record stores the result of an allowed call, and returns the time the circuit was opened or closed by it, if any.
+func (b *CircuitBreaker) record(err error) (opened, closed time.Time) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.state == CircuitHalfOpen {
+		b.trialInFlight = false
+	}
+	if err == nil {
+		b.consecutiveFails = 0
+		if b.state != CircuitClosed {
+			slog.Info("circuit breaker closed", "provider", b.provider)
+			b.setState(CircuitClosed)
+			closed = b.now()
+		}
+		return opened, closed
+	}
+
+	b.consecutiveFails++
+	if b.state == CircuitHalfOpen || b.consecutiveFails >= b.failures {
+		if b.state != CircuitOpen {
+			slog.Warn("circuit breaker opened", "provider", b.provider, "consecutive_failures", b.consecutiveFails, "cooldown", b.cooldown)
+			opened = b.now()
+		}
+		b.setState(CircuitOpen)
+		b.openedAt = b.now()
+	}
+
+	return opened, closed
+}
+
+// Status returns the current breaker status.
+func (b *CircuitBreaker) Status() CircuitStatus {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	status := CircuitStatus{
+		State:            b.state,
+		ConsecutiveFails: b.consecutiveFails,
+	}
+	if b.state != CircuitClosed {
+		status.OpenedAt = b.openedAt
+	}
+
+	return status
+}
+
+// Reset closes the breaker, e.g. when an operator knows the provider recovered before the cooldown passed.
+// With the shared state, the breaker is closed on the other replicas too.
+func (b *CircuitBreaker) Reset() {
+	b.m.Lock()
+	b.consecutiveFails = 0
+	b.trialInFlight = false
+	b.setState(CircuitClosed)
+	b.m.Unlock()
+
+	if b.shared != nil {
+		b.sharedClose(b.now())
+	}
+}
+
+func (b *CircuitBreaker) setState(state CircuitState) {
+	b.state = state
+	circuitState.Set(float64(state), string(b.provider))
+}
+
+// breakerClient is a Client decorator skipping calls to providers with an open circuit breaker.
+type breakerClient struct {
+	client  Client
+	breaker *CircuitBreaker
+}
+
+// GetContent implements Client.
+func (c *breakerClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	if !c.breaker.Allow() {
+		circuitRejections.Inc(string(c.breaker.provider))
+		return nil, ErrCircuitOpen
+	}
+
+	items, err := c.client.GetContent(ctx, meta, count)
+	c.breaker.Record(err)
+
+	return items, err
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// sharedBreakerTimeout bounds the calls to the shared state, which are made on the calls path when a circuit
+	// opens, closes, or its cooldown passes.
+	sharedBreakerTimeout = 200 * time.Millisecond
+	// sharedBreakerClosedTTL is how long the replicas remember that a circuit was closed. It must be longer than
+	// the cooldowns, so the replicas still waiting for a trial learn that it succeeded elsewhere.
+	sharedBreakerClosedTTL = time.Hour
+)
+
+var sharedBreakerErrors = newCounterVec(
+	"circuit_breaker_shared_state_errors_total",
+	"Number of failed reads and writes of the circuit breaker state shared by the replicas. The breakers work locally meanwhile.",
+)
+
+// BreakerStateStore shares the circuit breaker states among the replicas of the service, so a provider failing for
+// one of them is skipped by all, and only one replica makes the trial call after the cooldown.
+type BreakerStateStore interface {
+	// Load returns when the provider's circuit was opened, zero if it isn't open, and when it was last closed.
+	Load(ctx context.Context, p Provider) (openedAt, closedAt time.Time, err error)
+	// Open stores that the provider's circuit was opened at the time, for the cooldown.
+	Open(ctx context.Context, p Provider, at time.Time, cooldown time.Duration) error
+	// Close stores that the provider's circuit was closed at the time.
+	Close(ctx context.Context, p Provider, at time.Time) error
+	// ClaimTrial returns true for the only replica making the trial call of the provider in the cooldown.
+	ClaimTrial(ctx context.Context, p Provider, cooldown time.Duration) (bool, error)
+}
+
+// RedisBreakerStore is a BreakerStateStore in Redis. The state of a provider is kept in three keys:
+// the time the circuit was opened (expiring after the cooldown), the time it was closed, and the trial claim.
+type RedisBreakerStore struct {
+	redis *RedisCache
+}
+
+// NewRedisBreakerStore returns a store using the Redis server. The keys get the ":breaker:" suffix of the prefix.
+func NewRedisBreakerStore(cfg RedisConfig) *RedisBreakerStore {
+	cfg.KeyPrefix += "breaker:"
+	return &RedisBreakerStore{redis: NewRedisCache(cfg)}
+}
+
+func (s *RedisBreakerStore) key(p Provider, suffix string) string {
+	return s.redis.keyPrefix + string(p) + suffix
+}
+
+// Load implements BreakerStateStore.
+func (s *RedisBreakerStore) Load(ctx context.Context, p Provider) (time.Time, time.Time, error) {
+	reply, err := s.redis.do(ctx, "MGET", s.key(p, ":opened"), s.key(p, ":closed"))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("unexpected redis MGET reply %v", reply)
+	}
+	var times [2]time.Time
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		b, _ := v.([]byte)
+		ms, err := strconv.ParseInt(string(b), 10, 64)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid breaker state %q", b)
+		}
+		times[i] = time.UnixMilli(ms)
+	}
+
+	return times[0], times[1], nil
+}
+
+// Open implements BreakerStateStore.
+func (s *RedisBreakerStore) Open(ctx context.Context, p Provider, at time.Time, cooldown time.Duration) error {
+	_, err := s.redis.do(ctx, "SET", s.key(p, ":opened"), strconv.FormatInt(at.UnixMilli(), 10), "PX", strconv.FormatInt(max(cooldown.Milliseconds(), 1), 10))
+	return err
+}
+
+// Close implements BreakerStateStore.
+func (s *RedisBreakerStore) Close(ctx context.Context, p Provider, at time.Time) error {
+	if _, err := s.redis.do(ctx, "DEL", s.key(p, ":opened"), s.key(p, ":trial")); err != nil {
+		return err
+	}
+	_, err := s.redis.do(ctx, "SET", s.key(p, ":closed"), strconv.FormatInt(at.UnixMilli(), 10), "PX", strconv.FormatInt(sharedBreakerClosedTTL.Milliseconds(), 10))
+	return err
+}
+
+// ClaimTrial implements BreakerStateStore.
+func (s *RedisBreakerStore) ClaimTrial(ctx context.Context, p Provider, cooldown time.Duration) (bool, error) {
+	reply, err := s.redis.do(ctx, "SET", s.key(p, ":trial"), "1", "NX", "PX", strconv.FormatInt(max(cooldown.Milliseconds(), 1), 10))
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// sharedOpen publishes that the breaker opened. It's called without the breaker lock.
+func (b *CircuitBreaker) sharedOpen(at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedBreakerTimeout)
+	defer cancel()
+	if err := b.shared.Open(ctx, b.provider, at, b.cooldown); err != nil {
+		sharedBreakerErrors.Inc()
+		slog.Warn("sharing the opened circuit breaker failed", "provider", b.provider, "error", err)
+	}
+}
+
+// sharedClose publishes that the breaker closed. It's called without the breaker lock.
+func (b *CircuitBreaker) sharedClose(at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedBreakerTimeout)
+	defer cancel()
+	if err := b.shared.Close(ctx, b.provider, at); err != nil {
+		sharedBreakerErrors.Inc()
+		slog.Warn("sharing the closed circuit breaker failed", "provider", b.provider, "error", err)
+	}
+}
+
+// claimTrial tells whether this replica makes the trial call. When the shared state can't be reached,
+// the breaker works locally, and makes the trial itself.
+func (b *CircuitBreaker) claimTrial() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), sharedBreakerTimeout)
+	defer cancel()
+	claimed, err := b.shared.ClaimTrial(ctx, b.provider, b.cooldown)
+	if err != nil {
+		sharedBreakerErrors.Inc()
+		slog.Warn("claiming the circuit breaker trial failed", "provider", b.provider, "error", err)
+		return true
+	}
+	return claimed
+}
+
+// syncShared adopts the state of the breaker shared by the other replicas: the circuit opened by another replica
+// is opened here too, and the circuit closed by another replica's trial call is closed here too.
+func (b *CircuitBreaker) syncShared(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, sharedBreakerTimeout)
+	defer cancel()
+	openedAt, closedAt, err := b.shared.Load(ctx, b.provider)
+	if err != nil {
+		sharedBreakerErrors.Inc()
+		slog.Debug("loading the shared circuit breaker state failed", "provider", b.provider, "error", err)
+		return
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	switch {
+	case b.state == CircuitClosed && !openedAt.IsZero() && closedAt.Before(openedAt):
+		slog.Warn("circuit breaker opened by another replica", "provider", b.provider, "cooldown", b.cooldown)
+		b.setState(CircuitOpen)
+		b.openedAt = openedAt
+	case b.state == CircuitOpen && closedAt.After(b.openedAt) && closedAt.After(openedAt):
+		slog.Info("circuit breaker closed by another replica", "provider", b.provider)
+		b.consecutiveFails = 0
+		b.setState(CircuitClosed)
+	case b.state == CircuitOpen && openedAt.After(b.openedAt):
+		// Another replica's trial failed, so the cooldown starts again.
+		b.openedAt = openedAt
+	}
+}
+
+// RunBreakerSync keeps the circuit breakers in sync with the state shared by the replicas (see WithSharedBreakerState),
+// until the context is done. It does nothing without the shared state.
+func (s *Service) RunBreakerSync(ctx context.Context) {
+	if s.sharedBreakers == nil || len(s.breakers) == 0 || s.breakerSyncInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.breakerSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var wg sync.WaitGroup
+			for _, b := range s.breakers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					b.syncShared(ctx)
+				}()
+			}
+			wg.Wait()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSharedCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.UnixMilli(time.Now().UnixMilli())
+	store := NewRedisBreakerStore(RedisConfig{Addr: newFakeRedis(t).addr, KeyPrefix: "test:"})
+	replicas := make([]*CircuitBreaker, 2)
+	for i := range replicas {
+		replicas[i] = NewCircuitBreaker(Provider1, 1, time.Minute)
+		replicas[i].now = func() time.Time { return now }
+		replicas[i].shared = store
+	}
+	a, b := replicas[0], replicas[1]
+
+	a.Allow()
+	a.Record(errors.New("test error"))
+	b.syncShared(ctx)
+	if got := b.Status(); got.State != CircuitOpen || !got.OpenedAt.Equal(now) {
+		t.Fatalf("got status %+v after the other replica opened the circuit, want open at %s", got, now)
+	}
+
+	now = now.Add(time.Minute)
+	if !a.Allow() {
+		t.Fatal("first replica didn't allow a trial call after cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("second replica allowed a trial call claimed by the other replica")
+	}
+	if got := b.Status().State; got != CircuitOpen {
+		t.Fatalf("got state %s after the trial claimed by the other replica, want %s", got, CircuitOpen)
+	}
+
+	now = now.Add(time.Second)
+	a.Record(nil)
+	b.syncShared(ctx)
+	if got := b.Status(); got.State != CircuitClosed || got.ConsecutiveFails != 0 {
+		t.Errorf("got status %+v after the other replica's successful trial, want closed", got)
+	}
+}
+
+func TestSharedCircuitBreakerUnavailable(t *testing.T) {
+	now := time.Now()
+	b := NewCircuitBreaker(Provider1, 1, time.Minute)
+	b.now = func() time.Time { return now }
+	b.shared = NewRedisBreakerStore(RedisConfig{Addr: "127.0.0.1:1"})
+
+	b.Allow()
+	b.Record(errors.New("test error"))
+	b.syncShared(context.Background())
+	if got := b.Status().State; got != CircuitOpen {
+		t.Fatalf("got state %s after failure, want %s", got, CircuitOpen)
+	}
+
+	now = now.Add(time.Minute)
+	if !b.Allow() {
+		t.Fatal("breaker without the shared state didn't allow a trial call after cooldown")
+	}
+	b.Record(nil)
+	if got := b.Status().State; got != CircuitClosed {
+		t.Errorf("got state %s after successful trial, want %s", got, CircuitClosed)
+	}
+}
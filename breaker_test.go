@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewCircuitBreaker(Provider1, 2, time.Minute)
+	b.now = func() time.Time { return now }
+	testErr := errors.New("test error")
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("call %d: rejected by closed breaker", i)
+		}
+		b.Record(testErr)
+	}
+	if got := b.Status().State; got != CircuitOpen {
+		t.Fatalf("got state %s after failures, want %s", got, CircuitOpen)
+	}
+	if b.Allow() {
+		t.Error("open breaker allowed a call during cooldown")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.Allow() {
+		t.Fatal("breaker didn't allow a trial call after cooldown")
+	}
+	if b.Allow() {
+		t.Error("half-open breaker allowed a second concurrent call")
+	}
+	b.Record(testErr)
+	if got := b.Status().State; got != CircuitOpen {
+		t.Fatalf("got state %s after failed trial, want %s", got, CircuitOpen)
+	}
+
+	now = now.Add(time.Minute)
+	if !b.Allow() {
+		t.Fatal("breaker didn't allow a trial call after cooldown")
+	}
+	b.Record(nil)
+	if got := b.Status(); got.State != CircuitClosed || got.ConsecutiveFails != 0 {
+		t.Errorf("got status %+v after successful trial, want closed", got)
+	}
+}
+
+func TestServiceCircuitBreaker(t *testing.T) {
+	p1 := &mockContentProvider{source: Provider1, shouldFail: true}
+	p2 := &mockContentProvider{source: Provider2}
+	clients := map[Provider]Client{Provider1: p1, Provider2: p2}
+	configs := []ContentConfig{{Type: Provider1, Fallback: &Provider2}}
+
+	service, err := NewService(configs, clients, defaultTimeout, WithCircuitBreakers(CircuitBreakerSettings{
+		Failures: 2,
+		Cooldown: time.Minute,
+	}))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		items, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 1, 0)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if len(items) != 1 || items[0].Source != string(Provider2) {
+			t.Fatalf("request %d: got %v, want an item from the fallback", i, items)
+		}
+	}
+
+	if p1.calls != 2 {
+		t.Errorf("got %d calls to the failing provider, want 2", p1.calls)
+	}
+	if p2.calls != 5 {
+		t.Errorf("got %d calls to the fallback provider, want 5", p2.calls)
+	}
+	if got := service.CircuitStatuses()[Provider1].State; got != CircuitOpen {
+		t.Errorf("got breaker state %s, want %s", got, CircuitOpen)
+	}
+
+	if err := service.ResetCircuitBreaker(Provider1); err != nil {
+		t.Fatalf("resetting the breaker: %v", err)
+	}
+	if _, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 1, 0); err != nil {
+		t.Fatalf("request after reset: %v", err)
+	}
+	if p1.calls != 3 {
+		t.Errorf("got %d calls to the failing provider after the reset, want 3", p1.calls)
+	}
+}
+
+func TestCircuitBreakerSettings(t *testing.T) {
+	settings := CircuitBreakerSettings{
+		Failures: 5,
+		Cooldown: time.Minute,
+		Providers: map[Provider]ProviderCircuitBreakerSettings{
+			Provider1: {Disabled: true},
+			Provider2: {Failures: 2, Cooldown: Duration(time.Second)},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		provider     Provider
+		wantFailures int
+		wantCooldown time.Duration
+	}{
+		"disabled":   {provider: Provider1, wantFailures: 0, wantCooldown: 0},
+		"overridden": {provider: Provider2, wantFailures: 2, wantCooldown: time.Second},
+		"default":    {provider: Provider3, wantFailures: 5, wantCooldown: time.Minute},
+	} {
+		t.Run(name, func(t *testing.T) {
+			failures, cooldown := settings.forProvider(tc.provider)
+			if failures != tc.wantFailures || cooldown != tc.wantCooldown {
+				t.Errorf("got %d, %v, want %d, %v", failures, cooldown, tc.wantFailures, tc.wantCooldown)
+			}
+		})
+	}
+}
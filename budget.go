@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// defaultItemSize is the item size estimate until items are observed.
+	defaultItemSize = 1 << 10
+	// itemOverhead is the memory used for an item apart from its strings: the struct, the channel message and the encoding buffers.
+	itemOverhead = 256
+	// itemCopies is how many copies of an item a request holds at most: the provider response, the rendered item and the encoded JSON.
+	itemCopies = 3
+	// itemSizeSmoothing is the weight of a new observation in the moving average of the item size.
+	itemSizeSmoothing = 0.05
+)
+
+var (
+	errRequestTooLarge = errors.New("the request would use more memory than allowed for a single request")
+	errMemoryExhausted = errors.New("the memory for requests is exhausted, try again later")
+)
+
+var (
+	memoryRejections = newCounterVec(
+		"request_memory_rejections_total",
+		"Number of content requests rejected by the memory budget by reason (too_large, exhausted).",
+		"reason",
+	)
+	memoryInFlight = newGaugeVec(
+		"request_memory_in_flight_bytes",
+		"Estimated memory used by the content requests in progress.",
+	)
+)
+
+// ItemSizeStats keeps a moving average of the size of the items returned by the providers.
+type ItemSizeStats struct {
+	m   sync.Mutex
+	avg float64
+}
+
+// Observe adds the sizes of the items to the average.
+func (s *ItemSizeStats) Observe(items []*ContentItem) {
+	if len(items) == 0 {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, item := range items {
+		size := float64(itemSize(item))
+		if s.avg == 0 {
+			s.avg = size
+			continue
+		}
+		s.avg += itemSizeSmoothing * (size - s.avg)
+	}
+}
+
+// Average returns the average item size in bytes.
+func (s *ItemSizeStats) Average() int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.avg == 0 {
+		return defaultItemSize
+	}
+	return int64(s.avg)
+}
+
+// itemSize estimates the memory used by the item.
+func itemSize(item *ContentItem) int {
+	size := itemOverhead + len(item.ID) + len(item.Title) + len(item.Source) + len(item.Summary) + len(item.Link)
+	for _, m := range item.Media {
+		size += len(m)
+	}
+
+	return size
+}
+
+// MemoryBudget rejects the content requests that would use too much memory, estimated from the number of items
+// they fetch and the average item size.
+type MemoryBudget struct {
+	// perRequest is the maximum estimate of a single request. Zero means no limit.
+	perRequest int64
+	// total is the maximum sum of the estimates of the requests in progress. Zero means no limit.
+	total int64
+	sizes *ItemSizeStats
+
+	inFlight atomic.Int64
+}
+
+// NewMemoryBudget returns a budget with the limits in bytes, where zero means no limit.
+func NewMemoryBudget(perRequest, total int64, sizes *ItemSizeStats) *MemoryBudget {
+	return &MemoryBudget{perRequest: perRequest, total: total, sizes: sizes}
+}
+
+// estimate returns the memory a request for the items is expected to use.
+func (b *MemoryBudget) estimate(count, offset int) int64 {
+	return int64(count+offset) * itemCopies * b.sizes.Average()
+}
+
+// acquire reserves the memory for a request, or returns errRequestTooLarge or errMemoryExhausted.
+// The returned function releases the memory when the request is done. A nil budget allows everything.
+func (b *MemoryBudget) acquire(count, offset int) (func(), error) {
+	if b == nil {
+		return func() {}, nil
+	}
+
+	est := b.estimate(count, offset)
+	if b.perRequest > 0 && est > b.perRequest {
+		memoryRejections.Inc("too_large")
+		return nil, errRequestTooLarge
+	}
+	if used := b.inFlight.Add(est); b.total > 0 && used > b.total {
+		b.inFlight.Add(-est)
+		memoryRejections.Inc("exhausted")
+		return nil, errMemoryExhausted
+	}
+	memoryInFlight.Add(float64(est))
+
+	return func() {
+		b.inFlight.Add(-est)
+		memoryInFlight.Add(-float64(est))
+	}, nil
+}
+
+// writeMemoryErr responds with 413 to a request too large for the budget, and with 429 when the budget is exhausted.
+func writeMemoryErr(w http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, errMemoryExhausted) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, req, http.StatusTooManyRequests, ErrorCodeOverloaded, err.Error())
+		return
+	}
+	writeError(w, req, http.StatusRequestEntityTooLarge, ErrorCodeRequestTooLarge, err.Error()+"; request fewer items")
+}
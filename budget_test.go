@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestItemSizeStats(t *testing.T) {
+	var s ItemSizeStats
+	if got := s.Average(); got != defaultItemSize {
+		t.Errorf("got %d before any items, want the default %d", got, defaultItemSize)
+	}
+
+	s.Observe([]*ContentItem{{Summary: strings.Repeat("a", 744)}})
+	if got := s.Average(); got != 1000 {
+		t.Errorf("got %d, want the size of the first item", got)
+	}
+	for range 200 {
+		s.Observe([]*ContentItem{{Summary: strings.Repeat("a", 1744)}})
+	}
+	if got := s.Average(); got < 1990 || got > 2000 {
+		t.Errorf("got %d, want the average moving to the size of the recent items", got)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	// The default item size is 1KiB, so a request for 10 items is estimated at 30KiB.
+	budget := NewMemoryBudget(40<<10, 50<<10, &ItemSizeStats{})
+	srv := httptest.NewServer(&Handler{service: service, memory: budget})
+	defer srv.Close()
+
+	get := func(query string) *http.Response {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/?" + query)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for name, tc := range map[string]struct {
+		query      string
+		wantStatus int
+	}{
+		"within budget":         {query: "count=10", wantStatus: http.StatusOK},
+		"too many items":        {query: "count=20", wantStatus: http.StatusRequestEntityTooLarge},
+		"too large with offset": {query: "count=5&offset=10", wantStatus: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if resp := get(tc.query); resp.StatusCode != tc.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+
+	// The aliased GraphQL fields are estimated together.
+	body := `{"query": "{ a: content(count: 8) { id } b: content(count: 8) { id } }"}`
+	resp, err := http.Post(srv.URL+"/graphql", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d for the aliased GraphQL fields, want %d", resp.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+
+	// While another request holds most of the budget, the requests that don't fit wait their turn.
+	release, err := budget.acquire(10, 0)
+	if err != nil {
+		t.Fatalf("acquiring: %v", err)
+	}
+	if resp := get("count=10"); resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("got status %d, want %d with Retry-After", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if resp := get("count=5"); resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d for a request fitting the rest of the budget, want %d", resp.StatusCode, http.StatusOK)
+	}
+	release()
+	if resp := get("count=10"); resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d after the release, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrProviderBusy is returned instead of calling a provider that already has the maximum number of calls in flight.
+var ErrProviderBusy = errors.New("provider has too many calls in flight")
+
+var (
+	bulkheadInFlight = newGaugeVec(
+		"provider_calls_in_flight",
+		"Number of provider calls in flight, for the providers with a concurrency limit.",
+		"provider",
+	)
+	bulkheadRejections = newCounterVec(
+		"provider_bulkhead_rejections_total",
+		"Number of provider calls rejected, because the provider had the maximum number of calls in flight.",
+		"provider",
+	)
+)
+
+// bulkheadClient limits the number of concurrent calls to a provider, so a popular (or slow) provider can't
+// take all the goroutines and connections under load spikes, starving the other providers.
+// The calls over the limit fail immediately with ErrProviderBusy, so the fallbacks are used instead of queueing.
+type bulkheadClient struct {
+	client   Client
+	provider Provider
+	slots    chan struct{}
+}
+
+func newBulkheadClient(c Client, p Provider, limit int) *bulkheadClient {
+	return &bulkheadClient{client: c, provider: p, slots: make(chan struct{}, limit)}
+}
+
+// GetContent implements Client.
+func (c *bulkheadClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		bulkheadRejections.Inc(string(c.provider))
+		return nil, ErrProviderBusy
+	}
+	bulkheadInFlight.Add(1, string(c.provider))
+	defer func() {
+		<-c.slots
+		bulkheadInFlight.Add(-1, string(c.provider))
+	}()
+
+	return c.client.GetContent(ctx, meta, count)
+}
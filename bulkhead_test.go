@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkheads(t *testing.T) {
+	p2 := Provider2
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1, responseDelay: 100 * time.Millisecond},
+		Provider2: &mockContentProvider{source: Provider2},
+		Provider3: &mockContentProvider{source: Provider3, responseDelay: 100 * time.Millisecond},
+	}
+	configs := []ContentConfig{{Type: Provider1, Fallback: &p2}}
+	service, err := NewService(configs, clients, defaultTimeout, WithConcurrencyLimits(map[Provider]int{Provider1: 1}))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+
+	// The first request takes the only slot, so the second one gets the fallback.
+	var wg sync.WaitGroup
+	var first []*ContentItem
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		first, _ = service.GetContent(context.Background(), RequestMeta{IP: "10.0.0.1"}, 1, 0)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	second, err := service.GetContent(context.Background(), RequestMeta{IP: "10.0.0.2"}, 1, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	wg.Wait()
+	if len(first) != 1 || first[0].Source != string(Provider1) {
+		t.Errorf("got first items %+v, want an item of provider 1", first)
+	}
+	if len(second) != 1 || second[0].Source != string(Provider2) {
+		t.Errorf("got second items %+v, want the fallback item", second)
+	}
+
+	// The slot is released when the call finishes.
+	third, err := service.GetContent(context.Background(), RequestMeta{IP: "10.0.0.3"}, 1, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if len(third) != 1 || third[0].Source != string(Provider1) {
+		t.Errorf("got third items %+v, want an item of provider 1", third)
+	}
+
+	// Only the calls over the limit fail.
+	limited := newBulkheadClient(clients[Provider3], Provider3, 2)
+	errs := make(chan error, 3)
+	for range 3 {
+		go func() {
+			_, err := limited.GetContent(context.Background(), RequestMeta{}, 1)
+			errs <- err
+		}()
+	}
+	busy := 0
+	for range 3 {
+		if err := <-errs; errors.Is(err, ErrProviderBusy) {
+			busy++
+		}
+	}
+	if busy != 1 {
+		t.Errorf("got %d busy errors for 3 calls with the limit of 2, want 1", busy)
+	}
+	if reason := failureReason(ErrProviderBusy); reason != "provider busy" {
+		t.Errorf("got failure reason %q", reason)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Cache is a key-value store with per-entry expiration.
+type Cache interface {
+	// Get returns the value stored under the key. The bool result is false when there is no (fresh) value.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value under the key for the given ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// MemoryCache is an in-process Cache with a size limit.
+// When the limit is reached, the least recently used entries are evicted.
+type MemoryCache struct {
+	maxEntries int
+	maxBytes   int64
+	now        func() time.Time
+
+	entries map[string]*list.Element
+	lru     *list.List
+	bytes   int64
+	m       sync.Mutex
+}
+
+// MemoryCacheStats describes the memory cache utilization.
+type MemoryCacheStats struct {
+	Entries    int   `json:"entries"`
+	Bytes      int64 `json:"bytes"`
+	MaxEntries int   `json:"max_entries,omitempty"`
+	MaxBytes   int64 `json:"max_bytes,omitempty"`
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache returns an in-memory cache holding at most `maxEntries` entries.
+// Zero or negative `maxEntries` means there is no limit.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get implements Cache.
+func (c *MemoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*memoryCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.removeElement(el)
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(el)
+
+	return entry.value, true, nil
+}
+
+// Set implements Cache.
+func (c *MemoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	expires := c.now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*memoryCacheEntry)
+		c.bytes += int64(len(value) - len(entry.value))
+		entry.value = value
+		entry.expires = expires
+		c.lru.MoveToFront(el)
+	} else {
+		c.entries[key] = c.lru.PushFront(&memoryCacheEntry{
+			key:     key,
+			value:   value,
+			expires: expires,
+		})
+		c.bytes += entrySize(key, value)
+	}
+	c.evict()
+
+	return nil
+}
+
+// SetMaxBytes limits the approximate memory used by the cached keys and values.
+// Zero or negative value means there is no limit.
+func (c *MemoryCache) SetMaxBytes(n int64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.maxBytes = n
+	c.evict()
+}
+
+// Stats returns the current cache utilization.
+func (c *MemoryCache) Stats() MemoryCacheStats {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return MemoryCacheStats{
+		Entries:    c.lru.Len(),
+		Bytes:      c.bytes,
+		MaxEntries: c.maxEntries,
+		MaxBytes:   c.maxBytes,
+	}
+}
+
+// evict removes the least recently used entries until the cache fits its limits.
+func (c *MemoryCache) evict() {
+	for c.lru.Len() > 0 {
+		overEntries := c.maxEntries > 0 && c.lru.Len() > c.maxEntries
+		overBytes := c.maxBytes > 0 && c.bytes > c.maxBytes
+		if !overEntries && !overBytes {
+			return
+		}
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// Len returns the number of entries currently stored, including the expired ones that were not evicted yet.
+func (c *MemoryCache) Len() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.lru.Len()
+}
+
+func (c *MemoryCache) removeElement(el *list.Element) {
+	entry := el.Value.(*memoryCacheEntry)
+	c.lru.Remove(el)
+	delete(c.entries, entry.key)
+	c.bytes -= entrySize(entry.key, entry.value)
+}
+
+// entrySize returns the approximate memory used by a cache entry.
+func entrySize(key string, value []byte) int64 {
+	const overhead = 128 // List element, map entry and struct fields.
+	return int64(len(key)+len(value)) + overhead
+}
+
+// LayeredCache combines a small, fast local cache with a shared one.
+// Reads check the hot tier first, then the shared tier (refilling the hot tier on hit).
+// Writes go through to both tiers.
+type LayeredCache struct {
+	Hot       Cache
+	HotTTL    time.Duration
+	Shared    Cache
+	SharedTTL time.Duration
+}
+
+// Get implements Cache.
+// Errors from the shared tier are logged and treated as a cache miss, so an unavailable shared cache doesn't break the app.
+func (c *LayeredCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if v, ok, err := c.Hot.Get(ctx, key); err == nil && ok {
+		return v, true, nil
+	}
+
+	v, ok, err := c.Shared.Get(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "shared cache get failed", "key", key, "error", err)
+		return nil, false, nil
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	if err := c.Hot.Set(ctx, key, v, c.HotTTL); err != nil {
+		slog.WarnContext(ctx, "hot cache set failed", "key", key, "error", err)
+	}
+
+	return v, true, nil
+}
+
+// Set implements Cache.
+// Each tier stores the value for its configured TTL, capped by `ttl`.
+func (c *LayeredCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := c.Hot.Set(ctx, key, value, minTTL(ttl, c.HotTTL)); err != nil {
+		return fmt.Errorf("hot cache: %w", err)
+	}
+	if err := c.Shared.Set(ctx, key, value, minTTL(ttl, c.SharedTTL)); err != nil {
+		slog.WarnContext(ctx, "shared cache set failed", "key", key, "error", err)
+	}
+
+	return nil
+}
+
+// minTTL returns the lower of two TTLs, where zero means "not configured".
+func minTTL(a, b time.Duration) time.Duration {
+	switch {
+	case a <= 0:
+		return b
+	case b <= 0:
+		return a
+	case a < b:
+		return a
+	default:
+		return b
+	}
+}
+
+// CacheEntry is a single cache entry, used for exporting and importing cache contents.
+type CacheEntry struct {
+	Key     string    `json:"key"`
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// Snapshotter is implemented by caches that can export and import their contents.
+type Snapshotter interface {
+	// Snapshot returns all fresh entries.
+	Snapshot(ctx context.Context) ([]CacheEntry, error)
+	// Restore stores the given entries. Expired entries are skipped.
+	Restore(ctx context.Context, entries []CacheEntry) error
+}
+
+// Snapshot implements Snapshotter.
+func (c *MemoryCache) Snapshot(_ context.Context) ([]CacheEntry, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	now := c.now()
+	entries := make([]CacheEntry, 0, c.lru.Len())
+	// Iterate from the least recently used, so restoring the entries in order keeps the LRU order.
+	for el := c.lru.Back(); el != nil; el = el.Prev() {
+		entry := el.Value.(*memoryCacheEntry)
+		if !now.Before(entry.expires) {
+			continue
+		}
+		entries = append(entries, CacheEntry{
+			Key:     entry.key,
+			Value:   entry.value,
+			Expires: entry.expires,
+		})
+	}
+
+	return entries, nil
+}
+
+// Restore implements Snapshotter.
+func (c *MemoryCache) Restore(ctx context.Context, entries []CacheEntry) error {
+	return restoreEntries(ctx, c, c.now(), entries)
+}
+
+// Snapshot implements Snapshotter. Only the hot tier is exported, as the shared tier is shared between instances anyway.
+func (c *LayeredCache) Snapshot(ctx context.Context) ([]CacheEntry, error) {
+	s, ok := c.Hot.(Snapshotter)
+	if !ok {
+		return nil, errors.New("hot cache tier doesn't support snapshots")
+	}
+	return s.Snapshot(ctx)
+}
+
+// Restore implements Snapshotter. Entries are written to both tiers.
+func (c *LayeredCache) Restore(ctx context.Context, entries []CacheEntry) error {
+	return restoreEntries(ctx, c, time.Now(), entries)
+}
+
+func restoreEntries(ctx context.Context, c Cache, now time.Time, entries []CacheEntry) error {
+	for _, e := range entries {
+		ttl := e.Expires.Sub(now)
+		if ttl <= 0 {
+			continue
+		}
+		if err := c.Set(ctx, e.Key, e.Value, ttl); err != nil {
+			return fmt.Errorf("restoring entry '%s': %w", e.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// Purger is implemented by caches that can drop all their entries.
+type Purger interface {
+	Purge(ctx context.Context) error
+}
+
+// Purge implements Purger.
+func (c *MemoryCache) Purge(_ context.Context) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+
+	return nil
+}
+
+// Purge implements Purger. Both tiers are purged, as far as they support it.
+func (c *LayeredCache) Purge(ctx context.Context) error {
+	for _, tier := range []Cache{c.Hot, c.Shared} {
+		if p, ok := tier.(Purger); ok {
+			if err := p.Purge(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// memoryTier returns the in-memory tier of the cache, or nil if there is none.
+func memoryTier(c Cache) *MemoryCache {
+	switch c := c.(type) {
+	case *MemoryCache:
+		return c
+	case *LayeredCache:
+		return memoryTier(c.Hot)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// saveCacheSnapshot writes the cache contents to the file, in the admin API snapshot format, for loadCacheSnapshot
+// on the next start. The file is written atomically, so a crash doesn't leave a partial file. It returns the number
+// of the saved entries.
+func saveCacheSnapshot(ctx context.Context, cache Cache, path string) (int, error) {
+	snapshotter, ok := cache.(Snapshotter)
+	if !ok {
+		return 0, errors.New("cache snapshots are not supported by the configured cache")
+	}
+	entries, err := snapshotter.Snapshot(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("exporting cache: %w", err)
+	}
+	data, err := json.Marshal(Snapshot{Version: snapshotVersion, Created: time.Now(), Entries: entries})
+	if err != nil {
+		return 0, fmt.Errorf("encoding cache snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("saving cache snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("saving cache snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("saving cache snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("saving cache snapshot: %w", err)
+	}
+
+	return len(entries), nil
+}
+
+// loadCacheSnapshot restores the cache contents saved by saveCacheSnapshot. The entries that expired in the meantime
+// are skipped, and a missing file isn't an error - there is nothing to restore on the first start.
+// It returns the number of the entries in the file.
+func loadCacheSnapshot(ctx context.Context, cache Cache, path string) (int, error) {
+	snapshotter, ok := cache.(Snapshotter)
+	if !ok {
+		return 0, errors.New("cache snapshots are not supported by the configured cache")
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading cache snapshot: %w", err)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return 0, fmt.Errorf("decoding cache snapshot: %w", err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return 0, fmt.Errorf("unsupported cache snapshot version %d", snapshot.Version)
+	}
+	if err := snapshotter.Restore(ctx, snapshot.Entries); err != nil {
+		return 0, fmt.Errorf("restoring cache snapshot: %w", err)
+	}
+
+	return len(snapshot.Entries), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheSnapshotFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	if n, err := loadCacheSnapshot(ctx, NewMemoryCache(10), path); err != nil || n != 0 {
+		t.Fatalf("got %d entries, error %v for a missing file, want none", n, err)
+	}
+
+	old := NewMemoryCache(10)
+	_ = old.Set(ctx, "a", []byte("1"), time.Minute)
+	_ = old.Set(ctx, "b", []byte("2"), time.Minute)
+	if n, err := saveCacheSnapshot(ctx, old, path); err != nil || n != 2 {
+		t.Fatalf("got %d saved entries, error %v, want 2", n, err)
+	}
+
+	restored := NewMemoryCache(10)
+	if n, err := loadCacheSnapshot(ctx, restored, path); err != nil || n != 2 {
+		t.Fatalf("got %d loaded entries, error %v, want 2", n, err)
+	}
+	for key, want := range map[string]string{"a": "1", "b": "2"} {
+		if v, ok, _ := restored.Get(ctx, key); !ok || string(v) != want {
+			t.Errorf("got %q (found %v) for key %s, want %q", v, ok, key, want)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"invalid json":        "{",
+		"unsupported version": `{"version": 99, "entries": []}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			bad := filepath.Join(t.TempDir(), "cache.json")
+			if err := os.WriteFile(bad, []byte(content), 0o600); err != nil {
+				t.Fatalf("writing file: %v", err)
+			}
+			if _, err := loadCacheSnapshot(ctx, NewMemoryCache(10), bad); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRedisDialTimeout = time.Second
+	defaultRedisIOTimeout   = time.Second
+	defaultRedisPoolSize    = 10
+)
+
+// RedisCache is a Cache backed by a Redis server.
+// It speaks the RESP protocol directly and keeps a small pool of idle connections.
+type RedisCache struct {
+	addr      string
+	password  string
+	db        int
+	keyPrefix string
+
+	dialTimeout time.Duration
+	ioTimeout   time.Duration
+
+	idle chan *redisConn
+}
+
+// RedisConfig configures a RedisCache.
+type RedisConfig struct {
+	Addr      string
+	Password  string
+	DB        int
+	KeyPrefix string
+}
+
+// ParseRedisURL parses the connection settings from a URL in the form `redis://[:password@]host[:port][/db]`.
+// The port defaults to 6379.
+func ParseRedisURL(raw string) (RedisConfig, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return RedisConfig{}, fmt.Errorf("invalid redis url: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return RedisConfig{}, fmt.Errorf("invalid redis url: unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return RedisConfig{}, errors.New("invalid redis url: missing host")
+	}
+
+	cfg := RedisConfig{Addr: u.Host}
+	if u.Port() == "" {
+		cfg.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		// The password may be given as the user name, without a colon.
+		cfg.Password, _ = u.User.Password()
+		if cfg.Password == "" {
+			cfg.Password = u.User.Username()
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if cfg.DB, err = strconv.Atoi(db); err != nil || cfg.DB < 0 {
+			return RedisConfig{}, fmt.Errorf("invalid redis url: invalid database %q", db)
+		}
+	}
+
+	return cfg, nil
+}
+
+// NewRedisCache returns a cache using the Redis server at `cfg.Addr`.
+// Connections are established lazily.
+func NewRedisCache(cfg RedisConfig) *RedisCache {
+	return &RedisCache{
+		addr:        cfg.Addr,
+		password:    cfg.Password,
+		db:          cfg.DB,
+		keyPrefix:   cfg.KeyPrefix,
+		dialTimeout: defaultRedisDialTimeout,
+		ioTimeout:   defaultRedisIOTimeout,
+		idle:        make(chan *redisConn, defaultRedisPoolSize),
+	}
+}
+
+// Get implements Cache.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", c.keyPrefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	v, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected redis reply type %T", reply)
+	}
+
+	return v, true, nil
+}
+
+// Set implements Cache.
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		return nil
+	}
+	_, err := c.do(ctx, "SET", c.keyPrefix+key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// Purge implements Purger. It deletes all keys with the cache key prefix.
+func (c *RedisCache) Purge(ctx context.Context) error {
+	cursor := "0"
+	for {
+		reply, err := c.do(ctx, "SCAN", cursor, "MATCH", c.keyPrefix+"*", "COUNT", "100")
+		if err != nil {
+			return err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return fmt.Errorf("unexpected redis SCAN reply %v", reply)
+		}
+		next, _ := parts[0].([]byte)
+		keys, _ := parts[1].([]interface{})
+
+		if len(keys) > 0 {
+			args := []string{"DEL"}
+			for _, k := range keys {
+				kb, _ := k.([]byte)
+				args = append(args, string(kb))
+			}
+			if _, err := c.do(ctx, args...); err != nil {
+				return err
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// Close closes all idle connections.
+func (c *RedisCache) Close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and returns its reply.
+// The reply is one of: nil, string (status), int64, []byte (bulk string), []interface{} (array).
+func (c *RedisCache) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := c.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(ctx, c.ioTimeout, args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// Protocol or network error - the connection state is unknown, so don't reuse it.
+		conn.Close()
+		return nil, err
+	}
+	c.putConn(conn)
+
+	return reply, err
+}
+
+func (c *RedisCache) getConn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: c.dialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to redis: %w", err)
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+
+	if c.password != "" {
+		if _, err := conn.do(ctx, c.ioTimeout, "AUTH", c.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis auth: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.do(ctx, c.ioTimeout, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis select db: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *RedisCache) putConn(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// redisError is an error reply returned by the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *redisConn) do(ctx context.Context, timeout time.Duration, args ...string) (interface{}, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, fmt.Errorf("writing redis command: %w", err)
+	}
+
+	return readRESP(c.r)
+}
+
+// readRESP reads one reply in the RESP2 format.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading redis reply: %w", err)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("invalid redis reply line %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis bulk length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("reading redis bulk string: %w", err)
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis array length %q", payload)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		vs := make([]interface{}, n)
+		for i := range vs {
+			if vs[i], err = readRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return vs, nil
+	default:
+		return nil, fmt.Errorf("unknown redis reply type %q", kind)
+	}
+}
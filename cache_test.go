@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewMemoryCache(2)
+	c.now = func() time.Time { return now }
+
+	_ = c.Set(ctx, "a", []byte("1"), time.Minute)
+	_ = c.Set(ctx, "b", []byte("2"), time.Second)
+
+	if v, ok, _ := c.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Fatalf("got %q, %v for 'a', want '1'", v, ok)
+	}
+
+	// "b" is the least recently used entry now, so it should be evicted.
+	_ = c.Set(ctx, "c", []byte("3"), time.Minute)
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("'b' should be evicted")
+	}
+	if c.Len() != 2 {
+		t.Errorf("got %d entries, want 2", c.Len())
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Error("'a' should be expired")
+	}
+}
+
+func TestLayeredCache(t *testing.T) {
+	ctx := context.Background()
+	hot := NewMemoryCache(0)
+	shared := NewMemoryCache(0)
+	c := &LayeredCache{
+		Hot:       hot,
+		HotTTL:    time.Second,
+		Shared:    shared,
+		SharedTTL: time.Minute,
+	}
+
+	if err := c.Set(ctx, "a", []byte("1"), time.Hour); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if _, ok, _ := shared.Get(ctx, "a"); !ok {
+		t.Fatal("value not written through to the shared tier")
+	}
+
+	// Simulate a different instance: empty hot tier, shared tier populated.
+	c.Hot = NewMemoryCache(0)
+	if v, ok, _ := c.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Fatalf("got %q, %v, want '1'", v, ok)
+	}
+	if _, ok, _ := c.Hot.Get(ctx, "a"); !ok {
+		t.Error("hot tier should be refilled on shared hit")
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	srv := newFakeRedis(t)
+	c := NewRedisCache(RedisConfig{Addr: srv.addr, KeyPrefix: "test:"})
+	defer c.Close()
+	ctx := context.Background()
+
+	if _, ok, err := c.Get(ctx, "a"); err != nil || ok {
+		t.Fatalf("got %v, %v for missing key", ok, err)
+	}
+	if err := c.Set(ctx, "a", []byte("some\r\nvalue"), time.Minute); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	v, ok, err := c.Get(ctx, "a")
+	if err != nil || !ok || string(v) != "some\r\nvalue" {
+		t.Fatalf("got %q, %v, %v", v, ok, err)
+	}
+	srv.m.Lock()
+	defer srv.m.Unlock()
+	if _, ok := srv.data["test:a"]; !ok {
+		t.Error("key prefix not applied")
+	}
+}
+
+func TestParseRedisURL(t *testing.T) {
+	for name, tc := range map[string]struct {
+		url     string
+		want    RedisConfig
+		wantErr bool
+	}{
+		"host only":          {url: "redis://cache", want: RedisConfig{Addr: "cache:6379"}},
+		"port and db":        {url: "redis://cache:6380/2", want: RedisConfig{Addr: "cache:6380", DB: 2}},
+		"password":           {url: "redis://:secret@cache:6380", want: RedisConfig{Addr: "cache:6380", Password: "secret"}},
+		"password only user": {url: "redis://secret@cache", want: RedisConfig{Addr: "cache:6379", Password: "secret"}},
+		"other scheme":       {url: "http://cache:6379", wantErr: true},
+		"no host":            {url: "redis:///1", wantErr: true},
+		"invalid db":         {url: "redis://cache/one", wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseRedisURL(tc.url)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRedisConfigFromEnv(t *testing.T) {
+	env := map[string]string{"REDIS_URL": "redis://:from-url@cache:6380/1", "REDIS_PASSWORD": "secret"}
+	cfg, err := redisConfigFromFlags(func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	if cfg.Addr != "cache:6380" || cfg.DB != 1 || cfg.Password != "secret" {
+		t.Errorf("got %+v, want the settings from the environment", cfg)
+	}
+}
+
+func TestServiceCache(t *testing.T) {
+	p1 := &mockContentProvider{source: Provider1}
+	clients := map[Provider]Client{Provider1: p1}
+	configs := []ContentConfig{{Type: Provider1}}
+
+	service, err := NewService(configs, clients, defaultTimeout, WithCache(NewMemoryCache(0), CacheSettings{TTL: time.Minute}))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+
+	var first []*ContentItem
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "/?count=3", nil)
+		status, content := runRequest(t, service, req)
+		if status != http.StatusOK {
+			t.Fatalf("got response status %d", status)
+		}
+		if first == nil {
+			first = content
+		}
+		if content[0].ID != first[0].ID {
+			t.Errorf("request %d: got item %s, want cached item %s", i, content[0].ID, first[0].ID)
+		}
+	}
+
+	if p1.calls != 1 {
+		t.Errorf("got %d provider calls, want 1", p1.calls)
+	}
+}
+
+// fakeRedis is a minimal Redis server supporting the commands of the cache, the breaker state and the rate budgets.
+type fakeRedis struct {
+	addr string
+	data map[string]string
+	m    sync.Mutex
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	srv := &fakeRedis{addr: l.Addr().String(), data: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+
+	return srv
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		v, err := readRESP(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, a := range v.([]interface{}) {
+			args = append(args, string(a.([]byte)))
+		}
+
+		s.m.Lock()
+		switch strings.ToUpper(args[0]) {
+		case "GET":
+			if v, ok := s.data[args[1]]; ok {
+				conn.Write([]byte("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"))
+			} else {
+				conn.Write([]byte("$-1\r\n"))
+			}
+		case "SET":
+			// The expiry options are ignored, NX is supported.
+			if _, ok := s.data[args[1]]; ok && slices.Contains(args[3:], "NX") {
+				conn.Write([]byte("$-1\r\n"))
+				break
+			}
+			s.data[args[1]] = args[2]
+			conn.Write([]byte("+OK\r\n"))
+		case "MGET":
+			reply := "*" + strconv.Itoa(len(args)-1) + "\r\n"
+			for _, key := range args[1:] {
+				if v, ok := s.data[key]; ok {
+					reply += "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+				} else {
+					reply += "$-1\r\n"
+				}
+			}
+			conn.Write([]byte(reply))
+		case "DEL":
+			n := 0
+			for _, key := range args[1:] {
+				if _, ok := s.data[key]; ok {
+					delete(s.data, key)
+					n++
+				}
+			}
+			conn.Write([]byte(":" + strconv.Itoa(n) + "\r\n"))
+		case "INCR":
+			n, _ := strconv.Atoi(s.data[args[1]])
+			s.data[args[1]] = strconv.Itoa(n + 1)
+			conn.Write([]byte(":" + strconv.Itoa(n+1) + "\r\n"))
+		case "PEXPIRE":
+			// The expiry is ignored.
+			conn.Write([]byte(":1\r\n"))
+		default:
+			conn.Write([]byte("-ERR unknown command\r\n"))
+		}
+		s.m.Unlock()
+	}
+}
+
+func TestMemoryCacheMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(0)
+	value := make([]byte, 1000)
+	for _, key := range []string{"a", "b", "c"} {
+		_ = c.Set(ctx, key, value, time.Minute)
+	}
+
+	c.SetMaxBytes(2 * entrySize("a", value))
+
+	stats := c.Stats()
+	if stats.Entries != 2 {
+		t.Fatalf("got %d entries, want 2", stats.Entries)
+	}
+	if stats.Bytes > stats.MaxBytes {
+		t.Errorf("cache uses %d bytes, limit is %d", stats.Bytes, stats.MaxBytes)
+	}
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Error("'a' should be evicted")
+	}
+}
+
+func TestServiceCacheSettings(t *testing.T) {
+	// The coalescing client wraps the cached one, which must not hide it.
+	for name, coalesce := range map[string]bool{"plain": false, "coalescing": true} {
+		t.Run(name, func(t *testing.T) {
+			p1 := &mockContentProvider{source: Provider1}
+			p2 := &mockContentProvider{source: Provider2}
+			p3 := &mockContentProvider{source: Provider3}
+			clients := map[Provider]Client{Provider1: p1, Provider2: p2, Provider3: p3}
+			configs := []ContentConfig{{Type: Provider1}, {Type: Provider2}, {Type: Provider3}}
+			perUser := true
+			settings := CacheSettings{
+				TTL: time.Minute,
+				Providers: map[Provider]ProviderCacheSettings{
+					Provider2: {Disabled: true},
+					Provider3: {PerUser: &perUser},
+				},
+			}
+
+			opts := []ServiceOption{WithCache(NewMemoryCache(0), settings)}
+			if coalesce {
+				opts = append(opts, WithCallCoalescing())
+			}
+			service, err := NewService(configs, clients, defaultTimeout, opts...)
+			if err != nil {
+				t.Fatalf("creating a service: %v", err)
+			}
+
+			for _, userIP := range []string{"10.0.0.1", "10.0.0.1", "10.0.0.2"} {
+				if _, err := service.GetContent(context.Background(), RequestMeta{IP: userIP}, 3, 0); err != nil {
+					t.Fatalf("getting content: %v", err)
+				}
+			}
+
+			for name, tc := range map[string]struct {
+				provider  *mockContentProvider
+				wantCalls int
+			}{
+				"cached":          {provider: p1, wantCalls: 1},
+				"disabled":        {provider: p2, wantCalls: 3},
+				"cached per user": {provider: p3, wantCalls: 2},
+			} {
+				if tc.provider.calls != tc.wantCalls {
+					t.Errorf("%s: got %d provider calls, want %d", name, tc.provider.calls, tc.wantCalls)
+				}
+			}
+
+			want := []CacheCounters{
+				{Provider: Provider1, Hits: 2, Misses: 1},
+				{Provider: Provider3, Hits: 1, Misses: 2},
+			}
+			if got := service.CacheCounters(); !reflect.DeepEqual(got, want) {
+				t.Errorf("got counters %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCachedClientPersonalization(t *testing.T) {
+	base := RequestMeta{IP: "10.0.0.1", Locale: "en-US", Variant: "a", Device: DeviceHints{UserAgent: "browser 1", Class: "desktop"}}
+	for name, tc := range map[string]struct {
+		meta      func(m RequestMeta) RequestMeta
+		wantCalls int
+	}{
+		"same request":   {meta: func(m RequestMeta) RequestMeta { return m }, wantCalls: 1},
+		"other user":     {meta: func(m RequestMeta) RequestMeta { m.IP = "10.0.0.2"; return m }, wantCalls: 1},
+		"other agent":    {meta: func(m RequestMeta) RequestMeta { m.Device.UserAgent = "browser 2"; return m }, wantCalls: 1},
+		"other locale":   {meta: func(m RequestMeta) RequestMeta { m.Locale = "de-DE"; return m }, wantCalls: 2},
+		"other variant":  {meta: func(m RequestMeta) RequestMeta { m.Variant = "b"; return m }, wantCalls: 2},
+		"other device":   {meta: func(m RequestMeta) RequestMeta { m.Device.Class = "mobile"; return m }, wantCalls: 2},
+		"mobile hint":    {meta: func(m RequestMeta) RequestMeta { m.Device.Mobile = true; return m }, wantCalls: 2},
+		"other platform": {meta: func(m RequestMeta) RequestMeta { m.Device.Platform = "Android"; return m }, wantCalls: 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			upstream := &mockContentProvider{source: Provider1}
+			client := &cachedClient{client: upstream, provider: Provider1, cache: NewMemoryCache(0), ttl: time.Minute}
+			for _, meta := range []RequestMeta{base, tc.meta(base)} {
+				if _, err := client.GetContent(context.Background(), meta, 2); err != nil {
+					t.Fatalf("getting content: %v", err)
+				}
+			}
+			if upstream.calls != tc.wantCalls {
+				t.Errorf("got %d upstream calls, want %d", upstream.calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCachedClientRefetchExpired(t *testing.T) {
+	ctx := context.Background()
+	cached := []*ContentItem{
+		{ID: "fresh", Expiry: time.Now().Add(time.Hour)},
+		{ID: "expired", Expiry: time.Now().Add(-time.Second)},
+		{ID: "no expiry"},
+	}
+	data, _ := json.Marshal(cached)
+
+	for name, tc := range map[string]struct {
+		refetch    bool
+		upstream   Client
+		wantIDs    []string
+		wantCached string
+	}{
+		"disabled": {
+			upstream: &countingClient{},
+			wantIDs:  []string{"fresh", "expired", "no expiry"},
+		},
+		"enabled": {
+			refetch:    true,
+			upstream:   &countingClient{},
+			wantIDs:    []string{"fresh", "0", "no expiry"},
+			wantCached: "0",
+		},
+		"refetch failed": {
+			refetch:  true,
+			upstream: &mockContentProvider{shouldFail: true},
+			wantIDs:  []string{"fresh", "expired", "no expiry"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cache := NewMemoryCache(0)
+			key := "content:1:3"
+			_ = cache.Set(ctx, key, data, time.Minute)
+			client := &cachedClient{client: tc.upstream, provider: Provider1, cache: cache, ttl: time.Minute, refetchExpired: tc.refetch}
+
+			items, err := client.GetContent(ctx, RequestMeta{IP: "127.0.0.1"}, 3)
+			if err != nil {
+				t.Fatalf("getting content: %v", err)
+			}
+			var ids []string
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.wantIDs) {
+				t.Errorf("got items %v, want %v", ids, tc.wantIDs)
+			}
+
+			if tc.wantCached != "" {
+				v, _, _ := cache.Get(ctx, key)
+				var stored []*ContentItem
+				_ = json.Unmarshal(v, &stored)
+				if len(stored) != 3 || stored[1].ID != tc.wantCached {
+					t.Errorf("got cached items %s, want the refetched item stored", v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrProviderRateLimited is returned instead of calling a provider over the rate limit it reported.
+var ErrProviderRateLimited = errors.New("provider rate limit exceeded")
+
+// ErrCapabilitiesUnknown is returned by the CapabilityReporter clients that can't tell the capabilities of their provider,
+// like the clients without a capabilities endpoint configured.
+var ErrCapabilitiesUnknown = errors.New("provider capabilities are unknown")
+
+var capabilityRateLimited = newCounterVec(
+	"provider_rate_limited_total",
+	"Number of provider calls skipped, because they were over the rate limit reported by the provider.",
+	"provider",
+)
+
+// Capabilities describe what a provider supports.
+type Capabilities struct {
+	// MaxCount is the largest count of one call; zero means no limit.
+	MaxCount int `json:"max_count,omitempty"`
+	// Streaming tells whether the provider can stream the items.
+	Streaming bool `json:"streaming"`
+	// Locale tells whether the provider localizes the items with the user locale.
+	Locale bool `json:"locale"`
+	// RateLimit is the number of calls per second the provider allows; zero means no limit.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	// RateBurst is the number of calls allowed at once above the rate limit; zero means 1.
+	RateBurst int `json:"rate_burst,omitempty"`
+}
+
+// CapabilityReporter is implemented by the clients that can tell the capabilities of their provider.
+// The capabilities are fetched once, when the service is created (with WithCapabilityDiscovery).
+type CapabilityReporter interface {
+	Capabilities(ctx context.Context) (Capabilities, error)
+}
+
+// discoverCapabilities fetches the capabilities of the providers with CapabilityReporter clients, concurrently, within the timeout.
+// The providers that fail to report them are left out, and are used as configured.
+func discoverCapabilities(clients map[Provider]Client, timeout time.Duration) map[Provider]Capabilities {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var (
+		wg           sync.WaitGroup
+		m            sync.Mutex
+		capabilities = make(map[Provider]Capabilities)
+	)
+	for p, c := range clients {
+		reporter, ok := c.(CapabilityReporter)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			caps, err := reporter.Capabilities(ctx)
+			switch {
+			case errors.Is(err, ErrCapabilitiesUnknown):
+				return
+			case err != nil:
+				slog.Warn("discovering provider capabilities failed, using the configuration only", "provider", p, "error", err)
+				return
+			}
+			slog.Info("discovered provider capabilities", "provider", p, "max_count", caps.MaxCount, "streaming", caps.Streaming,
+				"locale", caps.Locale, "rate_limit", caps.RateLimit)
+			m.Lock()
+			capabilities[p] = caps
+			m.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return capabilities
+}
+
+// Capabilities returns the capabilities of the provider, and whether the provider reported them.
+func (s *Service) Capabilities(p Provider) (Capabilities, bool) {
+	caps, ok := s.capabilities[p]
+	return caps, ok
+}
+
+// maxCountClient splits the calls for more items than the provider's max count into several calls, made one after another.
+type maxCountClient struct {
+	client   Client
+	maxCount int
+}
+
+// GetContent implements Client. When a call returns fewer items than asked for, the items collected so far are returned.
+func (c *maxCountClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	if count <= c.maxCount {
+		return c.client.GetContent(ctx, meta, count)
+	}
+
+	var items []*ContentItem
+	for len(items) < count {
+		n := min(count-len(items), c.maxCount)
+		batch, err := c.client.GetContent(ctx, meta, n)
+		if err != nil {
+			if len(items) > 0 {
+				// The rest of the positions are left to the fallbacks.
+				return items, nil
+			}
+			return nil, err
+		}
+		items = append(items, batch...)
+		if len(batch) < n {
+			break
+		}
+	}
+
+	return items, nil
+}
+
+// rateLimitedClient skips the calls over the provider's rate limit, so the fallbacks are used instead of overloading it.
+// With the shared budget, the rate limit holds for all the replicas together.
+type rateLimitedClient struct {
+	client   Client
+	provider Provider
+	limiter  *rateLimiter
+	// shared is the budget shared with the other replicas, nil for the per-instance limit.
+	shared RateBudgetStore
+	rate   float64
+}
+
+// GetContent implements Client.
+func (c *rateLimitedClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	ok := false
+	if c.shared != nil {
+		ok = c.allowShared(ctx)
+	} else {
+		ok, _ = c.limiter.allow(time.Now())
+	}
+	if !ok {
+		capabilityRateLimited.Inc(string(c.provider))
+		return nil, ErrProviderRateLimited
+	}
+	return c.client.GetContent(ctx, meta, count)
+}
+
+// noLocaleClient drops the user locale from the calls to a provider that doesn't localize the items,
+// so the calls of the users with different locales can be coalesced.
+type noLocaleClient struct {
+	client Client
+}
+
+// GetContent implements Client.
+func (c *noLocaleClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	meta.Locale = ""
+	return c.client.GetContent(ctx, meta, count)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// capableClient reports the capabilities, and records the counts and locales of the calls.
+type capableClient struct {
+	caps Capabilities
+	err  error
+
+	m       sync.Mutex
+	counts  []int
+	locales []string
+}
+
+func (c *capableClient) Capabilities(ctx context.Context) (Capabilities, error) {
+	return c.caps, c.err
+}
+
+func (c *capableClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	c.m.Lock()
+	c.counts = append(c.counts, count)
+	c.locales = append(c.locales, meta.Locale)
+	c.m.Unlock()
+	return (&mockContentProvider{source: Provider1}).GetContent(ctx, meta, count)
+}
+
+func TestCapabilities(t *testing.T) {
+	p2 := Provider2
+	limited := &capableClient{caps: Capabilities{MaxCount: 2, RateLimit: 0.001}}
+	localized := &capableClient{caps: Capabilities{Locale: true}}
+	failing := &capableClient{err: errors.New("not available")}
+	clients := map[Provider]Client{Provider1: limited, Provider2: localized, Provider3: failing}
+	configs := []ContentConfig{{Type: Provider1, Fallback: &p2}}
+	service, err := NewService(configs, clients, defaultTimeout, WithCapabilityDiscovery(time.Second))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	if _, ok := service.Capabilities(Provider3); ok {
+		t.Error("got the capabilities of the provider that failed to report them")
+	}
+	for _, status := range service.ProviderStatuses() {
+		if status.Provider == Provider1 && (status.Capabilities == nil || status.Capabilities.MaxCount != 2) {
+			t.Errorf("got capabilities %+v in the provider status", status.Capabilities)
+		}
+	}
+
+	// The calls over the max count are split, and the locale isn't sent to the provider that doesn't localize.
+	meta := RequestMeta{IP: "10.0.0.1", Locale: "de"}
+	items, err := service.GetContent(context.Background(), meta, 5, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if len(items) != 5 {
+		t.Errorf("got %d items, want 5", len(items))
+	}
+	if want := []int{2, 2, 1}; !slices.Equal(limited.counts, want) {
+		t.Errorf("got calls for %v items, want %v", limited.counts, want)
+	}
+	for _, locale := range limited.locales {
+		if locale != "" {
+			t.Errorf("got locale %q for the provider without localization", locale)
+		}
+	}
+
+	// The burst (of 1 call, even when it is split) is used up, so the next call is over the rate limit, and the fallback is used.
+	items, err = service.GetContent(context.Background(), meta, 1, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if len(items) != 1 || len(localized.locales) != 1 || localized.locales[0] != "de" {
+		t.Errorf("got items %+v and fallback locales %v, want a fallback item fetched with the locale", items, localized.locales)
+	}
+	if reason := failureReason(ErrProviderRateLimited); reason != "provider rate limited" {
+		t.Errorf("got failure reason %q", reason)
+	}
+}
+
+func TestHTTPProviderCapabilities(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"max_count": 50, "streaming": true, "locale": true, "rate_limit": 10}`))
+	}))
+	defer api.Close()
+
+	client, err := NewHTTPProviderClient(Provider1, api.URL+"/items", 0, map[string]string{"X-Api-Key": "secret"})
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	if _, err := client.Capabilities(context.Background()); !errors.Is(err, ErrCapabilitiesUnknown) {
+		t.Errorf("got error %v without the capabilities url, want ErrCapabilitiesUnknown", err)
+	}
+	if err := client.SetCapabilitiesURL(api.URL + "/capabilities"); err != nil {
+		t.Fatalf("setting the capabilities url: %v", err)
+	}
+	caps, err := client.Capabilities(context.Background())
+	if err != nil {
+		t.Fatalf("getting capabilities: %v", err)
+	}
+	if want := (Capabilities{MaxCount: 50, Streaming: true, Locale: true, RateLimit: 10}); caps != want {
+		t.Errorf("got capabilities %+v, want %+v", caps, want)
+	}
+	if err := client.SetCapabilitiesURL("/capabilities"); err == nil {
+		t.Error("expected an error for a relative url")
+	}
+}
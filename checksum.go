@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// itemChecksum returns the hash of the item content, for the clients deduplicating items across pages or devices.
+// It covers the normalized title, summary, link and media, but not the ID, source or expiry, so the same content
+// has the same checksum even when the providers change the IDs or the item is served by another provider.
+func itemChecksum(item *ContentItem) string {
+	media := make([]string, len(item.Media))
+	for i, m := range item.Media {
+		media[i] = normalizeLink(m)
+	}
+	sort.Strings(media)
+
+	h := sha256.New()
+	for _, field := range append([]string{normalizeText(item.Title), normalizeText(item.Summary), normalizeLink(item.Link)}, media...) {
+		// The separator can't appear in the normalized fields, so the fields can't run into each other.
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// normalizeText lowercases the text and collapses the whitespace.
+func normalizeText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(s, "\x00", "")), " "))
+}
+
+// normalizeLink lowercases the scheme and the host of the URL, and drops the fragment and the trailing slash.
+// Links that aren't valid URLs are only trimmed.
+func normalizeLink(s string) string {
+	s = strings.TrimSpace(strings.ReplaceAll(s, "\x00", ""))
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return s
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+
+	return u.String()
+}
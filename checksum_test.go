@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestItemChecksum(t *testing.T) {
+	base := &ContentItem{
+		ID:      "1",
+		Title:   "Breaking news",
+		Source:  "1",
+		Summary: "Something happened.",
+		Link:    "https://example.com/news/1",
+		Media:   []string{"https://cdn.example.com/a.jpg", "https://cdn.example.com/b.jpg"},
+		Expiry:  time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	for name, tc := range map[string]struct {
+		item     ContentItem
+		wantSame bool
+	}{
+		"other id, source and expiry": {
+			item:     ContentItem{ID: "2", Title: base.Title, Source: "2", Summary: base.Summary, Link: base.Link, Media: base.Media},
+			wantSame: true,
+		},
+		"case and whitespace": {
+			item:     ContentItem{Title: " breaking  NEWS", Summary: "something\nhappened. ", Link: base.Link, Media: base.Media},
+			wantSame: true,
+		},
+		"link host case, fragment and trailing slash": {
+			item:     ContentItem{Title: base.Title, Summary: base.Summary, Link: "HTTPS://Example.com/news/1/#top", Media: base.Media},
+			wantSame: true,
+		},
+		"media order": {
+			item:     ContentItem{Title: base.Title, Summary: base.Summary, Link: base.Link, Media: []string{base.Media[1], base.Media[0]}},
+			wantSame: true,
+		},
+		"other title": {
+			item: ContentItem{Title: "Other news", Summary: base.Summary, Link: base.Link, Media: base.Media},
+		},
+		"other link path case": {
+			item: ContentItem{Title: base.Title, Summary: base.Summary, Link: "https://example.com/News/1", Media: base.Media},
+		},
+		"fields shifted": {
+			item: ContentItem{Title: base.Title + " " + base.Summary, Link: base.Link, Media: base.Media},
+		},
+		"no media": {
+			item: ContentItem{Title: base.Title, Summary: base.Summary, Link: base.Link},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if same := itemChecksum(&tc.item) == itemChecksum(base); same != tc.wantSame {
+				t.Errorf("got same checksum: %v, want %v", same, tc.wantSame)
+			}
+		})
+	}
+}
+
+func TestChecksumParam(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service, deltas: newDeltaStore(10, time.Minute)})
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		query        string
+		wantStatus   int
+		wantChecksum bool
+	}{
+		"default":    {query: "count=2", wantStatus: http.StatusOK},
+		"requested":  {query: "count=2&checksum=true", wantStatus: http.StatusOK, wantChecksum: true},
+		"not a bool": {query: "count=2&checksum=yes", wantStatus: http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/?" + tc.query)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+
+			var items []ItemView
+			if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			for _, item := range items {
+				if (item.Checksum != "") != tc.wantChecksum {
+					t.Errorf("got checksum %q, want one: %v", item.Checksum, tc.wantChecksum)
+				}
+			}
+		})
+	}
+}
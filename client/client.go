@@ -0,0 +1,344 @@
+// Package client is the Go SDK for the content service.
+//
+// The client can be given several endpoints (replicas of the service). Requests go to the healthiest,
+// fastest endpoint, and when it doesn't respond within the hedge delay, the same request is also sent
+// to the next one - the first successful response wins.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHedgeDelay      = 50 * time.Millisecond
+	defaultMaxAttempts     = 2
+	defaultFailureCooldown = 10 * time.Second
+	defaultMaxFailures     = 3
+
+	// latencyWeight is the weight of the newest sample in the endpoint latency moving average.
+	latencyWeight = 0.2
+)
+
+// ErrNoEndpoints is returned when the client has no endpoints configured.
+var ErrNoEndpoints = errors.New("no endpoints configured")
+
+// Item is one piece of content.
+type Item struct {
+	ID      string    `json:"id"`
+	Title   string    `json:"title"`
+	Source  string    `json:"source"`
+	Summary string    `json:"summary"`
+	Link    string    `json:"link"`
+	Media   []string  `json:"media,omitempty"`
+	Expiry  time.Time `json:"expiry"`
+}
+
+// StatusError is returned for unsuccessful responses.
+// Code and Message come from the JSON error body, when the service returned one; the code is stable, so it can be
+// compared with the service error codes (like "timeout" or "invalid_params").
+type StatusError struct {
+	Endpoint string
+	Status   int
+	Code     string
+	Message  string
+}
+
+// Error implements error.
+func (e *StatusError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s: unexpected status %d: %s: %s", e.Endpoint, e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s: unexpected status %d", e.Endpoint, e.Status)
+}
+
+// Client calls the content service.
+type Client struct {
+	httpClient      *http.Client
+	hedgeDelay      time.Duration
+	maxAttempts     int
+	maxFailures     int
+	failureCooldown time.Duration
+	apiKey          string
+	now             func() time.Time
+
+	endpoints []*endpoint
+}
+
+// Option configures the Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for the requests.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.httpClient = c
+	}
+}
+
+// WithHedging sets how long to wait for a response before sending the request to another endpoint,
+// and how many endpoints are tried at most for one call. One attempt disables hedging.
+func WithHedging(delay time.Duration, maxAttempts int) Option {
+	return func(cl *Client) {
+		cl.hedgeDelay = delay
+		cl.maxAttempts = maxAttempts
+	}
+}
+
+// WithHealthTracking sets after how many consecutive failures an endpoint is skipped, and for how long.
+func WithHealthTracking(maxFailures int, cooldown time.Duration) Option {
+	return func(cl *Client) {
+		cl.maxFailures = maxFailures
+		cl.failureCooldown = cooldown
+	}
+}
+
+// WithAPIKey sets the key sent with the requests, for services requiring API keys.
+func WithAPIKey(key string) Option {
+	return func(cl *Client) {
+		cl.apiKey = key
+	}
+}
+
+// New returns a client for the service endpoints, like "http://10.0.0.1:8080".
+func New(endpoints []string, opts ...Option) *Client {
+	c := &Client{
+		httpClient:      http.DefaultClient,
+		hedgeDelay:      defaultHedgeDelay,
+		maxAttempts:     defaultMaxAttempts,
+		maxFailures:     defaultMaxFailures,
+		failureCooldown: defaultFailureCooldown,
+		now:             time.Now,
+	}
+	for _, e := range endpoints {
+		c.endpoints = append(c.endpoints, &endpoint{url: e})
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// GetContent returns `count` items, starting from `offset`.
+func (c *Client) GetContent(ctx context.Context, count, offset int) ([]*Item, error) {
+	query := url.Values{}
+	query.Set("count", strconv.Itoa(count))
+	query.Set("offset", strconv.Itoa(offset))
+
+	var items []*Item
+	err := c.do(ctx, "/?"+query.Encode(), &items)
+	return items, err
+}
+
+// EndpointHealth describes the health of an endpoint, as seen by the client.
+type EndpointHealth struct {
+	URL                 string
+	Healthy             bool
+	ConsecutiveFailures int
+	Latency             time.Duration
+}
+
+// Health returns the health of the endpoints, in the order they are tried.
+func (c *Client) Health() []EndpointHealth {
+	now := c.now()
+	var health []EndpointHealth
+	for _, e := range c.orderedEndpoints() {
+		e.m.Lock()
+		health = append(health, EndpointHealth{
+			URL:                 e.url,
+			Healthy:             now.After(e.skipUntil),
+			ConsecutiveFailures: e.failures,
+			Latency:             e.latency,
+		})
+		e.m.Unlock()
+	}
+
+	return health
+}
+
+type result struct {
+	body []byte
+	err  error
+}
+
+// do sends the request to the endpoints, hedging it when the current endpoint is slow,
+// and decodes the first successful response into `out`.
+func (c *Client) do(ctx context.Context, path string, out interface{}) error {
+	endpoints := c.orderedEndpoints()
+	if len(endpoints) == 0 {
+		return ErrNoEndpoints
+	}
+	attempts := c.maxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > len(endpoints) {
+		attempts = len(endpoints)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Cancels the requests still in progress.
+
+	results := make(chan result, attempts)
+	hedge := time.NewTimer(c.hedgeDelay)
+	defer hedge.Stop()
+
+	sent, received := 0, 0
+	send := func() {
+		e := endpoints[sent]
+		sent++
+		go func() {
+			body, err := c.send(ctx, e, path)
+			results <- result{body: body, err: err}
+		}()
+	}
+	send()
+
+	var errs []error
+	for {
+		select {
+		case <-hedge.C:
+			if sent < attempts {
+				send()
+				hedge.Reset(c.hedgeDelay)
+			}
+		case r := <-results:
+			received++
+			if r.err == nil {
+				return json.Unmarshal(r.body, out)
+			}
+			errs = append(errs, r.err)
+			if sent < attempts {
+				// Don't wait for the hedge delay after a failure.
+				send()
+			} else if received == sent {
+				return errors.Join(errs...)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, e *endpoint, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	start := c.now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			// Requests cancelled because another endpoint responded first don't count as failures.
+			e.recordFailure(c.now(), c.maxFailures, c.failureCooldown)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body json.RawMessage
+	if resp.StatusCode == http.StatusOK {
+		err = json.NewDecoder(resp.Body).Decode(&body)
+	} else {
+		statusErr := &StatusError{Endpoint: e.url, Status: resp.StatusCode}
+		var errBody struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		// The body of a proxy in front of the service may not be JSON; the status is enough then.
+		if json.NewDecoder(resp.Body).Decode(&errBody) == nil {
+			statusErr.Code, statusErr.Message = errBody.Code, errBody.Message
+		}
+		err = statusErr
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			e.recordFailure(c.now(), c.maxFailures, c.failureCooldown)
+		}
+		return nil, err
+	}
+	e.recordSuccess(c.now().Sub(start))
+
+	return body, nil
+}
+
+// orderedEndpoints returns the endpoints to try: the healthy ones first, the fastest first.
+// Otherwise, the configured order is kept.
+func (c *Client) orderedEndpoints() []*endpoint {
+	now := c.now()
+	type candidate struct {
+		e       *endpoint
+		healthy bool
+		latency time.Duration
+	}
+	candidates := make([]candidate, len(c.endpoints))
+	for i, e := range c.endpoints {
+		e.m.Lock()
+		candidates[i] = candidate{e: e, healthy: now.After(e.skipUntil), latency: e.latency}
+		e.m.Unlock()
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch {
+		case a.healthy != b.healthy:
+			return a.healthy
+		case (a.latency == 0) != (b.latency == 0):
+			// Endpoints without a successful request yet go after the ones with a known latency.
+			return b.latency == 0
+		default:
+			return a.latency < b.latency
+		}
+	})
+
+	endpoints := make([]*endpoint, len(candidates))
+	for i, cand := range candidates {
+		endpoints[i] = cand.e
+	}
+
+	return endpoints
+}
+
+// endpoint is a service replica with its health statistics.
+type endpoint struct {
+	url string
+
+	failures  int
+	skipUntil time.Time
+	latency   time.Duration // Moving average of the successful requests latency.
+	m         sync.Mutex
+}
+
+func (e *endpoint) recordSuccess(latency time.Duration) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.failures = 0
+	e.skipUntil = time.Time{}
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(e.latency))
+	}
+}
+
+func (e *endpoint) recordFailure(now time.Time, maxFailures int, cooldown time.Duration) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.failures++
+	if maxFailures > 0 && e.failures >= maxFailures {
+		e.skipUntil = now.Add(cooldown)
+	}
+}
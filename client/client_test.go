@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newServer(t *testing.T, delay time.Duration, status int, source string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`[{"id":"1","source":"` + source + `"}]`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &calls
+}
+
+func TestHedging(t *testing.T) {
+	slow, slowCalls := newServer(t, time.Second, http.StatusOK, "slow")
+	fast, fastCalls := newServer(t, 0, http.StatusOK, "fast")
+
+	c := New([]string{slow.URL, fast.URL}, WithHedging(20*time.Millisecond, 2))
+	start := time.Now()
+	items, err := c.GetContent(context.Background(), 1, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if len(items) != 1 || items[0].Source != "fast" {
+		t.Errorf("got %v, want the item from the fast endpoint", items)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("request took %v, want it hedged", elapsed)
+	}
+	if slowCalls.Load() != 1 || fastCalls.Load() != 1 {
+		t.Errorf("got %d slow and %d fast calls, want 1 each", slowCalls.Load(), fastCalls.Load())
+	}
+
+	// The fast endpoint has a known latency now, so it's tried first.
+	if health := c.Health(); health[0].URL != fast.URL {
+		t.Errorf("got endpoints order %v, want the fast one first", health)
+	}
+}
+
+func TestHealthTracking(t *testing.T) {
+	failing, failingCalls := newServer(t, 0, http.StatusInternalServerError, "failing")
+	ok, _ := newServer(t, 0, http.StatusOK, "ok")
+
+	// Without hedging, the failing endpoint is tried alone until it's considered unhealthy.
+	c := New([]string{failing.URL, ok.URL}, WithHedging(time.Second, 1), WithHealthTracking(2, time.Minute))
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetContent(context.Background(), 1, 0); err == nil {
+			t.Fatalf("request %d: expected an error", i)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		items, err := c.GetContent(context.Background(), 1, 0)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if items[0].Source != "ok" {
+			t.Errorf("request %d: got item from %s, want ok", i, items[0].Source)
+		}
+	}
+
+	if got := failingCalls.Load(); got != 2 {
+		t.Errorf("got %d calls to the failing endpoint, want 2", got)
+	}
+	health := c.Health()
+	if health[1].URL != failing.URL || health[1].Healthy {
+		t.Errorf("got health %+v, want the failing endpoint last and unhealthy", health)
+	}
+}
+
+func TestAllEndpointsFail(t *testing.T) {
+	a, _ := newServer(t, 0, http.StatusInternalServerError, "a")
+	b, _ := newServer(t, 0, http.StatusBadGateway, "b")
+
+	c := New([]string{a.URL, b.URL})
+	if _, err := c.GetContent(context.Background(), 1, 0); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := New(nil).GetContent(context.Background(), 1, 0); err != ErrNoEndpoints {
+		t.Errorf("got error %v without endpoints, want %v", err, ErrNoEndpoints)
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	if _, err := New([]string{srv.URL}, WithAPIKey("secret")).GetContent(context.Background(), 1, 0); err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if got != "Bearer secret" {
+		t.Errorf("got Authorization %q, want the API key", got)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGatewayTimeout)
+		_, _ = w.Write([]byte(`{"code":"timeout","message":"the content couldn't be assembled in time","request_id":"abc"}`))
+	}))
+	defer srv.Close()
+
+	_, err := New([]string{srv.URL}).GetContent(context.Background(), 1, 0)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("got error %v, want a StatusError", err)
+	}
+	if statusErr.Status != http.StatusGatewayTimeout || statusErr.Code != "timeout" {
+		t.Errorf("got error %+v, want the timeout code", statusErr)
+	}
+}
@@ -0,0 +1,109 @@
+// Package contenttest verifies the ordering contract of the content service responses, for the teams extending
+// the mix strategies: the item at position i of the full list comes from the provider of the sequence at
+// i % len(sequence) (or from its fallback), a page starting at an offset is the same part of the full list,
+// and a response is cut at the first position that couldn't be filled, never leaving a gap.
+package contenttest
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// Slot is a position of the providers sequence: the provider of its items, and the optional fallback
+// used when the provider fails.
+type Slot struct {
+	Provider string
+	Fallback string
+}
+
+// Sequence returns the slots of the providers without fallbacks, like Sequence("1", "1", "2", "3").
+func Sequence(providers ...string) []Slot {
+	slots := make([]Slot, len(providers))
+	for i, p := range providers {
+		slots[i] = Slot{Provider: p}
+	}
+	return slots
+}
+
+// Expected returns the slots of the positions from offset to offset+count-1.
+func Expected(sequence []Slot, count, offset int) []Slot {
+	if len(sequence) == 0 {
+		return nil
+	}
+	slots := make([]Slot, count)
+	for i := range slots {
+		slots[i] = sequence[(offset+i)%len(sequence)]
+	}
+	return slots
+}
+
+// CheckOrder returns an error when the sources of a page (the count items from the offset) break the sequence:
+// a position with a source other than its provider or fallback, or more items than the count.
+// Fewer items are fine, the page is then cut at the first position that couldn't be filled.
+func CheckOrder(sequence []Slot, count, offset int, sources []string) error {
+	if len(sequence) == 0 {
+		return fmt.Errorf("the sequence is empty")
+	}
+	if len(sources) > count {
+		return fmt.Errorf("got %d items, want at most %d", len(sources), count)
+	}
+	for i, slot := range Expected(sequence, len(sources), offset) {
+		if s := sources[i]; s != slot.Provider && (slot.Fallback == "" || s != slot.Fallback) {
+			want := slot.Provider
+			if slot.Fallback != "" {
+				want += " or " + slot.Fallback
+			}
+			return fmt.Errorf("position %d (offset %d): got source %q, want %s", offset+i, offset, s, want)
+		}
+	}
+	return nil
+}
+
+// FetchFunc returns the sources of the items of a page.
+type FetchFunc func(count, offset int) ([]string, error)
+
+// CheckPagination fetches `pages` pages of `pageSize` items, and the same items in a single request, and returns
+// an error when the pages break the sequence or don't add up to the single request. The fetched items must come
+// from the providers without failures, since a fallback item on one page may be the provider's on another.
+func CheckPagination(sequence []Slot, pageSize, pages int, fetch FetchFunc) error {
+	all, err := fetch(pageSize*pages, 0)
+	if err != nil {
+		return fmt.Errorf("fetching all the pages at once: %w", err)
+	}
+	if err := CheckOrder(sequence, pageSize*pages, 0, all); err != nil {
+		return fmt.Errorf("all the pages at once: %w", err)
+	}
+
+	var paged []string
+	for page := range pages {
+		sources, err := fetch(pageSize, page*pageSize)
+		if err != nil {
+			return fmt.Errorf("fetching page %d: %w", page, err)
+		}
+		if err := CheckOrder(sequence, pageSize, page*pageSize, sources); err != nil {
+			return fmt.Errorf("page %d: %w", page, err)
+		}
+		paged = append(paged, sources...)
+	}
+	if !slices.Equal(paged, all) {
+		return fmt.Errorf("got pages %v, want the sources of a single request %v", paged, all)
+	}
+	return nil
+}
+
+// VerifyOrder reports a test error when the page breaks the sequence, like CheckOrder.
+func VerifyOrder(t testing.TB, sequence []Slot, count, offset int, sources []string) {
+	t.Helper()
+	if err := CheckOrder(sequence, count, offset, sources); err != nil {
+		t.Error(err)
+	}
+}
+
+// VerifyPagination reports a test error when the pages break the pagination invariants, like CheckPagination.
+func VerifyPagination(t testing.TB, sequence []Slot, pageSize, pages int, fetch FetchFunc) {
+	t.Helper()
+	if err := CheckPagination(sequence, pageSize, pages, fetch); err != nil {
+		t.Error(err)
+	}
+}
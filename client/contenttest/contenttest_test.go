@@ -0,0 +1,76 @@
+package contenttest
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckOrder(t *testing.T) {
+	sequence := []Slot{{Provider: "1", Fallback: "3"}, {Provider: "2"}, {Provider: "1"}}
+	for name, tc := range map[string]struct {
+		count   int
+		offset  int
+		sources []string
+		wantErr bool
+	}{
+		"full page":          {count: 4, sources: []string{"1", "2", "1", "1"}},
+		"fallback":           {count: 3, sources: []string{"3", "2", "1"}},
+		"offset":             {count: 3, offset: 2, sources: []string{"1", "1", "2"}},
+		"cut page":           {count: 3, sources: []string{"1"}},
+		"empty page":         {count: 3},
+		"wrong provider":     {count: 3, sources: []string{"1", "1", "1"}, wantErr: true},
+		"fallback elsewhere": {count: 3, sources: []string{"1", "3", "1"}, wantErr: true},
+		"wrong offset":       {count: 3, offset: 1, sources: []string{"1", "2", "1"}, wantErr: true},
+		"too many items":     {count: 1, sources: []string{"1", "2"}, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := CheckOrder(sequence, tc.count, tc.offset, tc.sources)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckPagination(t *testing.T) {
+	sequence := Sequence("1", "1", "2")
+	mix := func(count, offset int) ([]string, error) {
+		sources := make([]string, count)
+		for i, slot := range Expected(sequence, count, offset) {
+			sources[i] = slot.Provider
+		}
+		return sources, nil
+	}
+	for name, tc := range map[string]struct {
+		fetch   FetchFunc
+		wantErr bool
+	}{
+		"positional mix": {fetch: mix},
+		"ignoring the offset": {
+			fetch: func(count, _ int) ([]string, error) {
+				return mix(count, 0)
+			},
+			wantErr: true,
+		},
+		"cut pages": {
+			fetch: func(count, offset int) ([]string, error) {
+				sources, err := mix(count, offset)
+				return sources[:count-1], err
+			},
+			wantErr: true,
+		},
+		"failing": {
+			fetch: func(int, int) ([]string, error) {
+				return nil, errors.New("unavailable")
+			},
+			wantErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := CheckPagination(sequence, 2, 3, tc.fetch)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
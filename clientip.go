@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// withClientIP resolves the client IP of the requests, and stores it in the request context for clientIP.
+// The proxy headers (Forwarded, X-Forwarded-For and X-Real-IP) are used only when the request comes from a trusted proxy;
+// otherwise, anyone could claim any IP.
+func withClientIP(next http.Handler, trustedProxies ipNetworks) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip := resolveClientIP(req, trustedProxies)
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), clientIPKey{}, ip)))
+	})
+}
+
+// clientIP returns the IP address of the client making the request: the one resolved by withClientIP,
+// or the address of the connection's peer.
+func clientIP(req *http.Request) string {
+	if ip, ok := req.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteIP(req)
+}
+
+// remoteIP returns the IP address of the connection's peer, or "" when it isn't an IP address.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	if ip := parseHostIP(host); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// resolveClientIP returns the client IP of a request. The proxy chain is walked from the nearest hop,
+// while the hops are trusted proxies: the first hop that isn't one is the client.
+// The Forwarded header takes precedence over X-Forwarded-For, and X-Real-IP is used only without both of them.
+func resolveClientIP(req *http.Request, trustedProxies ipNetworks) string {
+	remote := remoteIP(req)
+	if ip := net.ParseIP(remote); ip == nil || !trustedProxies.contains(ip) {
+		return remote
+	}
+
+	hops := forwardedHops(req.Header.Values("Forwarded"))
+	if hops == nil {
+		hops = forwardedForHops(req.Header.Values("X-Forwarded-For"))
+	}
+	if hops == nil {
+		if ip := parseHostIP(strings.TrimSpace(req.Header.Get("X-Real-IP"))); ip != nil {
+			return ip.String()
+		}
+		return remote
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseHostIP(hops[i])
+		if ip == nil {
+			// An unknown or obfuscated hop: the client can't be told beyond it.
+			break
+		}
+		client = ip.String()
+		if !trustedProxies.contains(ip) {
+			break
+		}
+	}
+
+	return client
+}
+
+// forwardedForHops returns the addresses of the X-Forwarded-For headers, the farthest first, or nil without them.
+func forwardedForHops(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// forwardedHops returns the `for` addresses of the Forwarded headers (RFC 7239), the farthest first, or nil without them.
+// The addresses may have ports, and IPv6 ones are in brackets, like `for="[2001:db8::17]:4711"`.
+func forwardedHops(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					hop = strings.Trim(value, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseHostIP parses an IP address, optionally with a port, and with IPv6 addresses optionally in brackets.
+func parseHostIP(s string) net.IP {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		// The IPv6 zone isn't a part of the client address.
+		s = s[:i]
+	}
+	return net.ParseIP(s)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	var trusted ipNetworks
+	if err := trusted.Set("10.0.0.0/8,fd00::/8"); err != nil {
+		t.Fatalf("parsing networks: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		"ipv4":                      {remoteAddr: "203.0.113.7:4711", want: "203.0.113.7"},
+		"ipv6":                      {remoteAddr: "[2001:db8::17]:4711", want: "2001:db8::17"},
+		"ipv6 with zone":            {remoteAddr: "[fe80::1%eth0]:4711", want: "fe80::1"},
+		"without port":              {remoteAddr: "203.0.113.7", want: "203.0.113.7"},
+		"untrusted proxy":           {remoteAddr: "203.0.113.7:4711", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, want: "203.0.113.7"},
+		"x-forwarded-for":           {remoteAddr: "10.0.0.1:4711", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, want: "198.51.100.1"},
+		"spoofed x-forwarded-for":   {remoteAddr: "10.0.0.1:4711", headers: map[string][]string{"X-Forwarded-For": {"192.0.2.1, 198.51.100.1, 10.0.0.2"}}, want: "198.51.100.1"},
+		"x-forwarded-for headers":   {remoteAddr: "10.0.0.1:4711", headers: map[string][]string{"X-Forwarded-For": {"192.0.2.1", "198.51.100.1"}}, want: "198.51.100.1"},
+		"ipv6 x-forwarded-for":      {remoteAddr: "[fd00::1]:4711", headers: map[string][]string{"X-Forwarded-For": {"2001:db8::17"}}, want: "2001:db8::17"},
+		"only trusted hops":         {remoteAddr: "10.0.0.1:4711", headers: map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, want: "10.0.0.3"},
+		"invalid hop":               {remoteAddr: "10.0.0.1:4711", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1, garbage, 10.0.0.2"}}, want: "10.0.0.2"},
+		"forwarded":                 {remoteAddr: "10.0.0.1:4711", headers: map[string][]string{"Forwarded": {`for=192.0.2.60;proto=http;by=10.0.0.1`}}, want: "192.0.2.60"},
+		"forwarded ipv6 with port":  {remoteAddr: "10.0.0.1:4711", headers: map[string][]string{"Forwarded": {`for="[2001:db8:cafe::17]:4711", for=10.0.0.2`}}, want: "2001:db8:cafe::17"},
+		"forwarded before xff":      {remoteAddr: "10.0.0.1:4711", headers: map[string][]string{"Forwarded": {"for=192.0.2.60"}, "X-Forwarded-For": {"198.51.100.1"}}, want: "192.0.2.60"},
+		"obfuscated forwarded":      {remoteAddr: "10.0.0.1:4711", headers: map[string][]string{"Forwarded": {"for=_hidden, for=10.0.0.2"}}, want: "10.0.0.2"},
+		"x-real-ip":                 {remoteAddr: "10.0.0.1:4711", headers: map[string][]string{"X-Real-IP": {"198.51.100.1"}}, want: "198.51.100.1"},
+		"invalid x-real-ip":         {remoteAddr: "10.0.0.1:4711", headers: map[string][]string{"X-Real-IP": {"unknown"}}, want: "10.0.0.1"},
+		"trusted proxy without any": {remoteAddr: "10.0.0.1:4711", want: "10.0.0.1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for k, vs := range tc.headers {
+				for _, v := range vs {
+					req.Header.Add(k, v)
+				}
+			}
+
+			var got string
+			withClientIP(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				got = clientIP(req)
+			}), trusted).ServeHTTP(httptest.NewRecorder(), req)
+			if got != tc.want {
+				t.Errorf("got client IP %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var coalescedCalls = newCounterVec(
+	"provider_coalesced_calls_total",
+	"Number of provider calls that shared the result of an identical call in flight.",
+	"provider",
+)
+
+// coalescingClient is a Client decorator sharing one call among concurrent identical calls.
+// The calls are identical when they have the same count, user IP, locale and experiment variant;
+// the other metadata (like the trace context) is taken from the call that started first.
+type coalescingClient struct {
+	client   Client
+	provider Provider
+	// fetches tracks the shared calls, which can outlive their callers.
+	fetches *fetchGroup
+
+	calls map[string]*coalescedCall
+	m     sync.Mutex
+}
+
+// coalescedCall is a call in flight. The results are set before done is closed.
+type coalescedCall struct {
+	done  chan struct{}
+	items []*ContentItem
+	err   error
+}
+
+func newCoalescingClient(client Client, provider Provider, fetches *fetchGroup) *coalescingClient {
+	return &coalescingClient{
+		client:   client,
+		provider: provider,
+		fetches:  fetches,
+		calls:    make(map[string]*coalescedCall),
+	}
+}
+
+// GetContent implements Client. Every caller waits only until its own context is done.
+func (c *coalescingClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	key := strings.Join([]string{meta.IP, meta.personalization(), strconv.Itoa(count)}, "|")
+
+	c.m.Lock()
+	call, ok := c.calls[key]
+	if ok {
+		c.m.Unlock()
+		coalescedCalls.Inc(string(c.provider))
+	} else {
+		call = &coalescedCall{done: make(chan struct{})}
+		c.calls[key] = call
+		c.m.Unlock()
+		c.fetches.add()
+		go c.run(ctx, key, call, meta, count)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		return call.items, call.err
+	}
+}
+
+// run makes the shared call. It isn't cancelled with the first caller, only bounded by its deadline.
+func (c *coalescingClient) run(ctx context.Context, key string, call *coalescedCall, meta RequestMeta, count int) {
+	defer c.fetches.done()
+
+	callCtx := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithDeadline(callCtx, deadline)
+		defer cancel()
+	}
+
+	call.items, call.err = c.client.GetContent(callCtx, meta, count)
+
+	c.m.Lock()
+	delete(c.calls, key)
+	c.m.Unlock()
+	close(call.done)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCoalescingClient(t *testing.T) {
+	upstream := &mockContentProvider{source: Provider1, responseDelay: 50 * time.Millisecond}
+	client := newCoalescingClient(upstream, Provider1, &fetchGroup{})
+
+	var wg sync.WaitGroup
+	results := make([][]*ContentItem, 6)
+	for i := range results {
+		userIP := "127.0.0.1"
+		if i == len(results)-1 {
+			userIP = "127.0.0.2"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = client.GetContent(context.Background(), RequestMeta{IP: userIP}, 2)
+		}()
+	}
+	wg.Wait()
+
+	if upstream.calls != 2 {
+		t.Errorf("got %d upstream calls, want 2 (one per user IP)", upstream.calls)
+	}
+	for i, items := range results[:len(results)-1] {
+		if len(items) != 2 || items[0].ID != results[0][0].ID {
+			t.Errorf("call %d: got items %v, want the shared ones", i, items)
+		}
+	}
+
+	// The calls personalized differently aren't shared.
+	upstream.calls = 0
+	metas := []RequestMeta{{Locale: "en-US"}, {Locale: "de-DE"}, {Variant: "b"}, {Device: DeviceHints{Class: "mobile"}}}
+	for _, meta := range metas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = client.GetContent(context.Background(), meta, 2)
+		}()
+	}
+	wg.Wait()
+	if upstream.calls != len(metas) {
+		t.Errorf("got %d upstream calls, want %d (one per personalization)", upstream.calls, len(metas))
+	}
+
+	// A caller giving up doesn't cancel the call for the others.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.GetContent(ctx, RequestMeta{IP: "127.0.0.1"}, 1); err == nil {
+		t.Error("expected an error for the cancelled caller")
+	}
+	if items, err := client.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 1); err != nil || len(items) != 1 {
+		t.Errorf("got %d items, error %v, want the shared call result", len(items), err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+)
+
+// collector assembles the positions of a request from the provider responses as they arrive. The fallback of a position
+// is fetched as soon as its primary provider is known to fail, while the other providers are still awaited,
+// so a slow provider and a fallback fetch overlap instead of adding up.
+//
+// The result is the same as with the positions awaited in order: a position after the first one failed without
+// a fallback (the cut) keeps its primary response, even when its fallback was fetched before the cut was known.
+type collector struct {
+	s       *Service
+	ctx     context.Context
+	meta    RequestMeta
+	configs []ContentConfig
+
+	// responses are the final responses of the positions, nil until known.
+	responses []*configResponse
+	// primary are the responses of the positions' primary providers, nil until known.
+	primary []*configResponse
+	// cut is the first position failed without a fallback, or the number of positions when there is none (yet).
+	cut int
+
+	// positions are the positions of each primary provider, in order.
+	positions map[Provider][]int
+	// counts are the numbers of items asked from each primary provider; more than its positions include a surplus.
+	counts map[Provider]int
+	// received is the number of responses received from each primary provider.
+	received map[Provider]int
+	// finished marks the primary providers whose fetch ended.
+	finished map[Provider]bool
+	// failures are the first failed responses of the primary providers.
+	failures map[Provider]*configResponse
+	// surplus are the items of a primary provider beyond its own positions, which serve the fallbacks to it.
+	surplus map[Provider][]*configResponse
+	// waiting are the positions waiting for the surplus of a primary provider whose fetch didn't end yet.
+	waiting map[Provider][]int
+	// pending are the positions whose fallbacks are fetched with the next dispatch, by the fallback provider.
+	pending map[Provider][]int
+
+	fetches []*collectorFetch
+	// events receives the responses of all the fetches. It's buffered for all of them,
+	// so the fetches don't block when the request is abandoned.
+	events chan collectorEvent
+}
+
+// collectorFetch is a fetch of a primary provider, or of a fallback provider for the queued positions.
+type collectorFetch struct {
+	provider Provider
+	fallback bool
+	// queue are the positions the fallback fetch serves, in order.
+	queue []int
+}
+
+// collectorEvent is a response of the fetch, or the end of the fetch when ok is false.
+type collectorEvent struct {
+	fetch int
+	v     *configResponse
+	ok    bool
+}
+
+// newCollector starts the fetches of the primary providers. The fetch counts may include a surplus for the fallbacks
+// to the primary providers.
+func newCollector(ctx context.Context, s *Service, meta RequestMeta, configs []ContentConfig, fetchCounts map[Provider]int) *collector {
+	c := &collector{
+		s:         s,
+		ctx:       ctx,
+		meta:      meta,
+		configs:   configs,
+		responses: make([]*configResponse, len(configs)),
+		primary:   make([]*configResponse, len(configs)),
+		cut:       len(configs),
+		positions: make(map[Provider][]int),
+		counts:    fetchCounts,
+		received:  make(map[Provider]int),
+		finished:  make(map[Provider]bool),
+		failures:  make(map[Provider]*configResponse),
+		surplus:   make(map[Provider][]*configResponse),
+		waiting:   make(map[Provider][]int),
+		pending:   make(map[Provider][]int),
+	}
+	for i, cfg := range configs {
+		c.positions[cfg.Type] = append(c.positions[cfg.Type], i)
+	}
+	// Every fetch sends at most its count of responses, and the end. A position is served by at most one fallback fetch.
+	size := len(fetchCounts) + 2*len(configs)
+	for _, count := range fetchCounts {
+		size += count
+	}
+	c.events = make(chan collectorEvent, size)
+
+	for p, count := range fetchCounts {
+		c.start(&collectorFetch{provider: p}, s.getPromiseForProvider(ctx, p, meta, count, false))
+	}
+
+	return c
+}
+
+// start forwards the fetch's responses to the events.
+func (c *collector) start(f *collectorFetch, promise <-chan *configResponse) {
+	id := len(c.fetches)
+	c.fetches = append(c.fetches, f)
+	go func() {
+		for v := range promise {
+			c.events <- collectorEvent{fetch: id, v: v, ok: true}
+		}
+		c.events <- collectorEvent{fetch: id}
+	}()
+}
+
+// collect waits for the responses until all the positions are final. When `ready` isn't nil, it's called with the items
+// of the positions that are final, in order, until the first failed position. When the context is done, it returns
+// the context error, with the responses collected by then (the other positions fail with the context error).
+func (c *collector) collect(ready func(int, *ContentItem)) ([]*configResponse, error) {
+	next := 0
+	for !c.complete() {
+		select {
+		case <-c.ctx.Done():
+			c.finish()
+			for i, v := range c.responses {
+				if v == nil {
+					c.responses[i] = &configResponse{err: c.ctx.Err(), provider: c.configs[i].Type}
+				}
+			}
+			return c.responses, c.ctx.Err()
+		case e := <-c.events:
+			c.handle(e)
+			c.dispatch()
+		}
+		// The positions before the first failed one won't change, so they can be passed on.
+		for ; ready != nil && next < len(c.responses) && c.responses[next] != nil && c.responses[next].err == nil; next++ {
+			ready(next, c.responses[next].item)
+		}
+	}
+	c.finish()
+
+	return c.responses, nil
+}
+
+// complete tells whether all the positions are final.
+func (c *collector) complete() bool {
+	for i, v := range c.responses {
+		if v == nil && (c.primary[i] == nil || i <= c.cut) {
+			return false
+		}
+	}
+	return true
+}
+
+// finish sets the primary responses of the failed positions after the cut.
+func (c *collector) finish() {
+	for i := c.cut + 1; i < len(c.configs); i++ {
+		if v := c.primary[i]; v != nil && v.err != nil {
+			c.responses[i] = v
+		}
+	}
+}
+
+func (c *collector) handle(e collectorEvent) {
+	f := c.fetches[e.fetch]
+	if f.fallback {
+		c.handleFallback(f, e)
+		return
+	}
+
+	p := f.provider
+	switch {
+	case !e.ok:
+		c.finished[p] = true
+		if c.received[p] < len(c.positions[p]) && c.failures[p] == nil {
+			c.failures[p] = &configResponse{err: errNotEnoughItems, provider: p}
+		}
+		c.failRemaining(p)
+		// The surplus is final, the rest of the waiting positions is fetched from the provider again.
+		if waiting := c.waiting[p]; len(waiting) > 0 {
+			c.pending[p] = append(c.pending[p], waiting...)
+			delete(c.waiting, p)
+		}
+	case e.v.err != nil:
+		if c.failures[p] == nil {
+			c.failures[p] = e.v
+		}
+		c.failRemaining(p)
+	default:
+		k := c.received[p]
+		c.received[p]++
+		if k < len(c.positions[p]) {
+			c.setPrimary(c.positions[p][k], e.v)
+			return
+		}
+		if waiting := c.waiting[p]; len(waiting) > 0 {
+			c.responses[waiting[0]], c.waiting[p] = e.v, waiting[1:]
+			contentFallbackSurplus.Inc(string(p))
+			return
+		}
+		c.surplus[p] = append(c.surplus[p], e.v)
+	}
+}
+
+// failRemaining fails the provider's positions without a response.
+func (c *collector) failRemaining(p Provider) {
+	for _, i := range c.positions[p][min(c.received[p], len(c.positions[p])):] {
+		c.setPrimary(i, c.failures[p])
+	}
+	c.received[p] = max(c.received[p], len(c.positions[p]))
+}
+
+// setPrimary sets the primary response of the position, and starts its fallback when it failed.
+func (c *collector) setPrimary(i int, v *configResponse) {
+	c.primary[i] = v
+	cfg := c.configs[i]
+	switch {
+	case v.err == nil:
+		c.responses[i] = v
+	case cfg.Fallback == nil:
+		// The positions after this one won't be returned, so they don't need fallbacks.
+		c.responses[i] = v
+		c.cut = min(c.cut, i)
+	case i < c.cut:
+		c.startFallback(i, cfg)
+	}
+}
+
+// startFallback serves the position with the fallback provider's surplus, or queues it for a fallback fetch.
+func (c *collector) startFallback(i int, cfg ContentConfig) {
+	fallback := *cfg.Fallback
+	contentFallbacks.Inc(string(cfg.Type), string(fallback))
+	if surplus := c.surplus[fallback]; len(surplus) > 0 {
+		c.responses[i], c.surplus[fallback] = surplus[0], surplus[1:]
+		contentFallbackSurplus.Inc(string(fallback))
+		return
+	}
+	// The position waits only for a surplus that was asked for, so it isn't delayed by a fetch that won't serve it.
+	if c.counts[fallback] > len(c.positions[fallback]) && !c.finished[fallback] {
+		c.waiting[fallback] = append(c.waiting[fallback], i)
+		return
+	}
+	c.pending[fallback] = append(c.pending[fallback], i)
+}
+
+// dispatch fetches the fallbacks of the pending positions, one call per fallback provider.
+func (c *collector) dispatch() {
+	for p, queue := range c.pending {
+		c.start(&collectorFetch{provider: p, fallback: true, queue: queue}, c.s.getPromiseForProvider(c.ctx, p, c.meta, len(queue), true))
+	}
+	clear(c.pending)
+}
+
+func (c *collector) handleFallback(f *collectorFetch, e collectorEvent) {
+	if !e.ok {
+		for _, i := range f.queue {
+			c.responses[i] = &configResponse{err: errNotEnoughItems, provider: f.provider}
+		}
+		f.queue = nil
+		return
+	}
+	if len(f.queue) == 0 {
+		return
+	}
+	c.responses[f.queue[0]], f.queue = e.v, f.queue[1:]
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// command is a subcommand of the binary, e.g. for operating a running instance.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{
+		name:  "snapshot",
+		usage: "snapshot export|import [flags] - export or import the cache contents of a running instance",
+		run:   runSnapshotCommand,
+	},
+	{
+		name:  "diff",
+		usage: "diff -config-a a.json -config-b b.json -queries queries.json - preview how responses change between two configurations",
+		run:   runDiffCommand,
+	},
+	{
+		name:  "openapi",
+		usage: "openapi [-max-count n] [-max-items n] [-cursors] - print the OpenAPI document of the content API, e.g. for generating clients",
+		run:   runOpenAPICommand,
+	},
+	{
+		name:  "bootstrap",
+		usage: "bootstrap -providers urls.txt [-probes n] [-output config.json] - probe the provider endpoints and write a starter config file",
+		run:   runBootstrapCommand,
+	},
+	{
+		name:  "provider",
+		usage: "provider check -config provider.yaml [-count n] [-samples n] [-max-latency d] [-json] - dry-run a candidate provider and report whether it can be added to the config",
+		run:   runProviderCommand,
+	},
+}
+
+// runCommand runs the subcommand named by args[0].
+// It returns false if there is no such subcommand.
+func runCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return true, cmd.run(args[1:])
+		}
+	}
+
+	return false, nil
+}
+
+func runSnapshotCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+		return errors.New("usage: snapshot export|import [flags]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("snapshot "+action, flag.ContinueOnError)
+	adminURL := fs.String("admin-url", "http://127.0.0.1:8081", "base URL of the instance admin API")
+	file := fs.String("file", "", "snapshot file path; defaults to stdout for export and stdin for import")
+	timeout := fs.Duration("timeout", 30*time.Second, "request timeout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	url := strings.TrimSuffix(*adminURL, "/") + "/admin/snapshot"
+
+	if action == "export" {
+		out := io.Writer(os.Stdout)
+		if *file != "" {
+			f, err := os.Create(*file)
+			if err != nil {
+				return fmt.Errorf("creating snapshot file: %w", err)
+			}
+			defer f.Close()
+			out = f
+		}
+
+		resp, err := client.Get(url)
+		if err != nil {
+			return fmt.Errorf("requesting snapshot: %w", err)
+		}
+		defer resp.Body.Close()
+		if err := checkAdminResponse(resp); err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, resp.Body); err != nil {
+			return fmt.Errorf("writing snapshot: %w", err)
+		}
+		return nil
+	}
+
+	in := io.Reader(os.Stdin)
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return fmt.Errorf("opening snapshot file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	resp, err := client.Post(url, "application/json", in)
+	if err != nil {
+		return fmt.Errorf("uploading snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return checkAdminResponse(resp)
+}
+
+// checkAdminResponse returns an error with the response body if the admin API call was not successful.
+func checkAdminResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("admin API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func runOpenAPICommand(args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	maxCount := fs.Int("max-count", 100, "maximum 'count' parameter, like the server flag")
+	maxItems := fs.Int("max-items", 1000, "maximum 'count' + 'offset', like the server flag")
+	cursors := fs.Bool("cursors", false, "include the pagination cursors, enabled on the server with CURSOR_SECRET")
+	configPath := fs.String("config", "", "path to the configuration file, for marking its deprecations")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var deprecations []Deprecation
+	if *configPath != "" {
+		cfg, err := LoadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		deprecations = cfg.Deprecations
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(openAPISpec(RequestLimits{MaxCount: *maxCount, MaxItems: *maxItems}, *cursors, deprecations))
+}
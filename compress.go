@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Supported content encodings.
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// brotliLevel trades the compression ratio for speed; higher levels are too slow for dynamic responses.
+const brotliLevel = 4
+
+var (
+	gzipWriters   = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	brotliWriters = sync.Pool{New: func() any { return brotli.NewWriterLevel(io.Discard, brotliLevel) }}
+)
+
+// withCompression compresses the JSON (and XML) responses of at least minSize bytes with brotli or gzip, as accepted by the client.
+// Smaller responses, and the streamed responses flushed before reaching minSize, are sent as they are.
+func withCompression(next http.Handler, minSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+		if encoding == "" || req.Method == http.MethodHead {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		cw := &compressingWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+		defer cw.close()
+		next.ServeHTTP(cw, req)
+	})
+}
+
+// negotiateEncoding returns the supported encoding with the highest quality in the Accept-Encoding header,
+// preferring brotli on ties, or an empty string when none is accepted.
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		switch name {
+		case encodingBrotli, encodingGzip:
+		case "*":
+			name = encodingGzip
+		default:
+			continue
+		}
+		if q > bestQ || (q > 0 && q == bestQ && name == encodingBrotli) {
+			best, bestQ = name, q
+		}
+	}
+
+	return best
+}
+
+// compressingWriter buffers the response until it's known if it's worth compressing:
+// when the body reaches minSize, or when the handler finishes or flushes.
+type compressingWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	// enc is the compressor, nil when the response isn't compressed.
+	enc interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+// WriteHeader implements http.ResponseWriter. The final status is sent together with the encoding decision.
+func (w *compressingWriter) WriteHeader(code int) {
+	if code < 200 {
+		// Informational responses (like 103 Early Hints) don't have a body.
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+// Write implements http.ResponseWriter.
+func (w *compressingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf.Write(p)
+		if w.buf.Len() >= w.minSize {
+			if err := w.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher.
+func (w *compressingWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		_ = w.decide(false)
+	}
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *compressingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide sends the headers, compressing the response if `compress` is set and the response is compressible,
+// and writes the buffered body.
+func (w *compressingWriter) decide(compress bool) error {
+	w.decided = true
+	h := w.Header()
+	if compress && w.compressible() {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		// The compressed body differs from the uncompressed one, so its ETag can only be weak.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.enc = w.newEncoder()
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf.Bytes())
+	} else if w.buf.Len() > 0 {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf = bytes.Buffer{}
+
+	return err
+}
+
+// compressible tells if the response is a JSON body that isn't encoded already.
+func (w *compressingWriter) compressible() bool {
+	if w.status == http.StatusNoContent || w.status == http.StatusNotModified || w.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	return mediaType == "application/json" || mediaType == ndjsonContentType || strings.HasSuffix(mediaType, "+json") ||
+		mediaType == string(formatXML)
+}
+
+func (w *compressingWriter) newEncoder() interface {
+	io.WriteCloser
+	Flush() error
+} {
+	if w.encoding == encodingBrotli {
+		bw := brotliWriters.Get().(*brotli.Writer)
+		bw.Reset(w.ResponseWriter)
+		return bw
+	}
+	gw := gzipWriters.Get().(*gzip.Writer)
+	gw.Reset(w.ResponseWriter)
+	return gw
+}
+
+// close writes the rest of the response, and returns the compressor to its pool.
+func (w *compressingWriter) close() {
+	if !w.decided {
+		if w.status == 0 {
+			// The handler didn't write anything; the server sends 200 with an empty body.
+			return
+		}
+		_ = w.decide(false)
+	}
+	if w.enc == nil {
+		return
+	}
+
+	_ = w.enc.Close()
+	switch enc := w.enc.(type) {
+	case *brotli.Writer:
+		brotliWriters.Put(enc)
+	case *gzip.Writer:
+		gzipWriters.Put(enc)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                         "",
+		"identity":                 "",
+		"gzip":                     encodingGzip,
+		"gzip, deflate, br":        encodingBrotli,
+		"br;q=0.5, gzip":           encodingGzip,
+		"br;q=0, gzip;q=0":         "",
+		"*":                        encodingGzip,
+		"GZIP;q=0.8, deflate":      encodingGzip,
+		"br;q=invalid, gzip;q=0.1": encodingGzip,
+	} {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("%q: got %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	large := "[" + strings.Repeat(`{"id": "1"},`, 200) + `{"id": "2"}]`
+	srv := httptest.NewServer(withCompression(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body := large
+		switch req.URL.Path {
+		case "/small":
+			body = `[]`
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+		case "/not-modified":
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case "/stream":
+			w.Header().Set("Content-Type", ndjsonContentType)
+			for range 3 {
+				_, _ = io.WriteString(w, `{"id": "1"}`+"\n")
+				http.NewResponseController(w).Flush()
+			}
+			return
+		}
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Header().Set("ETag", `"abc"`)
+		_, _ = io.WriteString(w, body)
+	}), 1024))
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		"gzip":           {path: "/", acceptEncoding: "gzip", wantEncoding: encodingGzip},
+		"brotli":         {path: "/", acceptEncoding: "gzip, br", wantEncoding: encodingBrotli},
+		"not accepted":   {path: "/"},
+		"small response": {path: "/small", acceptEncoding: "gzip"},
+		"not json":       {path: "/text", acceptEncoding: "gzip"},
+		"not modified":   {path: "/not-modified", acceptEncoding: "gzip"},
+		"stream":         {path: "/stream", acceptEncoding: "gzip"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+tc.path, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.Header.Get("Content-Encoding"); got != tc.wantEncoding {
+				t.Fatalf("got encoding %q, want %q", got, tc.wantEncoding)
+			}
+			if resp.Header.Get("Vary") != "Accept-Encoding" {
+				t.Errorf("got Vary %q, want Accept-Encoding", resp.Header.Get("Vary"))
+			}
+			var body io.Reader = resp.Body
+			switch tc.wantEncoding {
+			case encodingGzip:
+				if body, err = gzip.NewReader(resp.Body); err != nil {
+					t.Fatalf("reading gzip: %v", err)
+				}
+			case encodingBrotli:
+				body = brotli.NewReader(resp.Body)
+			}
+			data, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("reading body: %v", err)
+			}
+
+			if tc.wantEncoding != "" {
+				if string(data) != large {
+					t.Errorf("got body %q after decompression, want the original one", data)
+				}
+				if etag := resp.Header.Get("ETag"); etag != `W/"abc"` {
+					t.Errorf("got ETag %s, want the weak one", etag)
+				}
+			}
+		})
+	}
+}
@@ -1,9 +1,27 @@
 package main
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
 // ContentConfig defines a provider and a fallback provider for a response content item.
 type ContentConfig struct {
 	Type     Provider
 	Fallback *Provider
+	// Weight is how many times the config appears in the repeated items sequence, interleaved with the others.
+	// Zero means 1.
+	Weight int
+	// Score orders the configs with the score ordering strategy: the higher scores come first.
+	Score float64
 }
 
 var (
@@ -29,3 +47,393 @@ var (
 		config1, config1, config2, config3, config4, config1, config1, config2,
 	}
 )
+
+// FileConfig is the configuration loaded from a file.
+type FileConfig struct {
+	// Timeout is the maximum time for collecting the content for one request.
+	Timeout Duration `json:"timeout"`
+	// EndpointTimeouts override the timeout for the requests to the endpoints.
+	EndpointTimeouts map[Endpoint]Duration `json:"endpoint_timeouts,omitempty"`
+	// Items define the providers and fallbacks for the response content items, in order.
+	// The list is repeated when a request needs more items.
+	Items []ItemConfig `json:"items"`
+	// DeviceItems optionally replace the items for the requests from the device class, like fewer, lighter items for mobile.
+	DeviceItems map[DeviceClass][]ItemConfig `json:"device_items,omitempty"`
+	// Feeds define named items sequences, served at /feeds/{name}, like for different surfaces of an app.
+	Feeds map[string][]ItemConfig `json:"feeds,omitempty"`
+	// FeedPriorities decide which feed keeps an item shown in several feeds of a deduplicated batch: the higher priority wins.
+	// The feeds without a priority have 0.
+	FeedPriorities map[string]int `json:"feed_priorities,omitempty"`
+	// Ordering is the strategy ordering the providers' positions in the items sequences: round_robin (the default),
+	// priority, shuffled or score. The requests can override it with the `ordering` parameter.
+	Ordering OrderingStrategy `json:"ordering,omitempty"`
+	// Providers hold optional per-provider settings.
+	Providers map[Provider]ProviderConfig `json:"providers,omitempty"`
+	// Deprecations mark the content API parameters and item fields that are going to be removed.
+	// They're read at startup.
+	Deprecations []Deprecation `json:"deprecations,omitempty"`
+}
+
+// ProviderConfig holds settings of one provider.
+type ProviderConfig struct {
+	Cache          ProviderCacheSettings          `json:"cache"`
+	CircuitBreaker ProviderCircuitBreakerSettings `json:"circuit_breaker"`
+	// AllowedCounts are the only counts the provider serves, in ascending order. Empty means any count.
+	AllowedCounts []int `json:"allowed_counts,omitempty"`
+	// MaxConcurrentCalls limits the number of the provider calls in flight. Zero means no limit.
+	MaxConcurrentCalls int `json:"max_concurrent_calls,omitempty"`
+	// SendUserIP tells what the provider gets as the user IP: never, anonymized or always (required).
+	// By default, the user IP is sent when it's known.
+	SendUserIP UserIPPolicy `json:"send_user_ip,omitempty"`
+	// InvalidItems tells what happens to the items failing the validation: drop (replaced with more items of the provider),
+	// fail (the call fails, and the fallback is used) or off (no validation). By default, the -invalid-items flag decides.
+	InvalidItems InvalidItemsPolicy `json:"invalid_items,omitempty"`
+	// ExpirySkew is the tolerance of the provider's clock skew: the items that expired less than the skew ago are still fresh.
+	ExpirySkew Duration `json:"expiry_skew,omitempty"`
+	// Sandbox labels the items of the provider as test data: the title gets the "[SANDBOX] " prefix and the source
+	// the "-sandbox" suffix. The provider is still called the usual way.
+	Sandbox bool `json:"sandbox,omitempty"`
+	// Client selects the client implementation of the provider. By default, the sample client is used.
+	Client *ClientConfig `json:"client,omitempty"`
+}
+
+// ClientConfig selects a client implementation registered with RegisterClientFactory, and holds its parameters.
+type ClientConfig struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// ItemConfig is the file representation of ContentConfig.
+type ItemConfig struct {
+	Provider Provider `json:"provider"`
+	Fallback Provider `json:"fallback,omitempty"`
+	Weight   int      `json:"weight,omitempty"`
+	Score    float64  `json:"score,omitempty"`
+}
+
+// Duration is a time.Duration represented in JSON as a string, like "1.5s".
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1.5s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+
+	return nil
+}
+
+// LoadConfig reads and validates the JSON or YAML (.yaml, .yml) configuration file.
+func LoadConfig(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("parsing config file '%s': %w", path, err)
+		}
+	}
+
+	var cfg FileConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file '%s': %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file '%s': %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks the configuration and fills in the defaults.
+func (c *FileConfig) Validate() error {
+	if c.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if c.Timeout == 0 {
+		c.Timeout = Duration(defaultTimeout)
+	}
+	for e, t := range c.EndpointTimeouts {
+		if t <= 0 {
+			return fmt.Errorf("endpoint '%s': timeout must be positive", e)
+		}
+	}
+	if len(c.Items) == 0 {
+		return errors.New("at least one item must be configured")
+	}
+	if err := validateItems(c.Items); err != nil {
+		return err
+	}
+	for class, items := range c.DeviceItems {
+		if len(items) == 0 {
+			return fmt.Errorf("device '%s': at least one item must be configured", class)
+		}
+		if err := validateItems(items); err != nil {
+			return fmt.Errorf("device '%s': %w", class, err)
+		}
+	}
+	for name, items := range c.Feeds {
+		if !validFeedName(name) {
+			return fmt.Errorf("feed '%s': the name must be non-empty and have only letters, digits, '-' and '_'", name)
+		}
+		if len(items) == 0 {
+			return fmt.Errorf("feed '%s': at least one item must be configured", name)
+		}
+		if err := validateItems(items); err != nil {
+			return fmt.Errorf("feed '%s': %w", name, err)
+		}
+	}
+	for name := range c.FeedPriorities {
+		if _, ok := c.Feeds[name]; !ok {
+			return fmt.Errorf("feed priorities: unknown feed '%s'", name)
+		}
+	}
+	if err := c.Ordering.validate(); err != nil {
+		return fmt.Errorf("ordering: %w", err)
+	}
+	if err := validateDeprecations(c.Deprecations); err != nil {
+		return err
+	}
+	for p, pc := range c.Providers {
+		if pc.Cache.TTL < 0 {
+			return fmt.Errorf("provider '%s': cache ttl must not be negative", p)
+		}
+		if pc.CircuitBreaker.Failures < 0 || pc.CircuitBreaker.Cooldown < 0 {
+			return fmt.Errorf("provider '%s': circuit breaker failures and cooldown must not be negative", p)
+		}
+		if pc.SendUserIP == UserIPNever && pc.Cache.PerUser != nil && *pc.Cache.PerUser {
+			return fmt.Errorf("provider '%s': per user caching can't be used when the provider never gets the user IP", p)
+		}
+		if pc.Client != nil {
+			if p == ProviderStatic {
+				return fmt.Errorf("provider '%s' is built in, its client can't be configured", p)
+			}
+			if _, ok := clientFactory(pc.Client.Type); !ok {
+				return fmt.Errorf("provider '%s': unknown client type '%s', must be one of %v", p, pc.Client.Type, ClientTypes())
+			}
+		}
+		for i, c := range pc.AllowedCounts {
+			if c <= 0 || (i > 0 && c <= pc.AllowedCounts[i-1]) {
+				return fmt.Errorf("provider '%s': allowed counts must be positive and ascending", p)
+			}
+		}
+		if pc.MaxConcurrentCalls < 0 {
+			return fmt.Errorf("provider '%s': max concurrent calls must not be negative", p)
+		}
+		if pc.ExpirySkew < 0 {
+			return fmt.Errorf("provider '%s': expiry skew must not be negative", p)
+		}
+	}
+
+	return nil
+}
+
+func validateItems(items []ItemConfig) error {
+	total := 0
+	for i, item := range items {
+		if item.Provider == "" {
+			return fmt.Errorf("item %d: provider is empty", i)
+		}
+		if item.Weight < 0 {
+			return fmt.Errorf("item %d: weight must not be negative", i)
+		}
+		total += max(item.Weight, 1)
+	}
+	if total > maxTotalWeight {
+		return fmt.Errorf("the total weight of the items must not exceed %d", maxTotalWeight)
+	}
+
+	return nil
+}
+
+// CacheSettings returns the per-provider cache settings.
+func (c *FileConfig) CacheSettings() map[Provider]ProviderCacheSettings {
+	settings := make(map[Provider]ProviderCacheSettings, len(c.Providers))
+	for p, pc := range c.Providers {
+		settings[p] = pc.Cache
+	}
+
+	return settings
+}
+
+// CircuitBreakerSettings returns the per-provider circuit breaker settings.
+func (c *FileConfig) CircuitBreakerSettings() map[Provider]ProviderCircuitBreakerSettings {
+	settings := make(map[Provider]ProviderCircuitBreakerSettings, len(c.Providers))
+	for p, pc := range c.Providers {
+		settings[p] = pc.CircuitBreaker
+	}
+
+	return settings
+}
+
+// AllowedCounts returns the counts allowed by the providers, for the providers with such restrictions.
+func (c *FileConfig) AllowedCounts() map[Provider][]int {
+	counts := make(map[Provider][]int)
+	for p, pc := range c.Providers {
+		if len(pc.AllowedCounts) > 0 {
+			counts[p] = pc.AllowedCounts
+		}
+	}
+
+	return counts
+}
+
+// ConcurrencyLimits returns the limits of the concurrent calls, for the providers with a limit.
+func (c *FileConfig) ConcurrencyLimits() map[Provider]int {
+	limits := make(map[Provider]int)
+	for p, pc := range c.Providers {
+		if pc.MaxConcurrentCalls > 0 {
+			limits[p] = pc.MaxConcurrentCalls
+		}
+	}
+
+	return limits
+}
+
+// UserIPPolicies returns the user IP policies of the providers that have one.
+func (c *FileConfig) UserIPPolicies() map[Provider]UserIPPolicy {
+	policies := make(map[Provider]UserIPPolicy)
+	for p, pc := range c.Providers {
+		if pc.SendUserIP != "" {
+			policies[p] = pc.SendUserIP
+		}
+	}
+
+	return policies
+}
+
+// ExpirySkews returns the clock skew tolerances of the providers that have one.
+func (c *FileConfig) ExpirySkews() map[Provider]time.Duration {
+	skews := make(map[Provider]time.Duration)
+	for p, pc := range c.Providers {
+		if pc.ExpirySkew > 0 {
+			skews[p] = time.Duration(pc.ExpirySkew)
+		}
+	}
+
+	return skews
+}
+
+// SandboxProviders returns the providers in the sandbox mode.
+func (c *FileConfig) SandboxProviders() map[Provider]bool {
+	providers := make(map[Provider]bool)
+	for p, pc := range c.Providers {
+		if pc.Sandbox {
+			providers[p] = true
+		}
+	}
+
+	return providers
+}
+
+// InvalidItemsPolicies returns the invalid items policies of the providers that have one.
+func (c *FileConfig) InvalidItemsPolicies() map[Provider]InvalidItemsPolicy {
+	policies := make(map[Provider]InvalidItemsPolicy)
+	for p, pc := range c.Providers {
+		if pc.InvalidItems != "" {
+			policies[p] = pc.InvalidItems
+		}
+	}
+
+	return policies
+}
+
+// EndpointTimeoutOverrides returns the timeouts of the endpoints that override the timeout.
+func (c *FileConfig) EndpointTimeoutOverrides() map[Endpoint]time.Duration {
+	timeouts := make(map[Endpoint]time.Duration, len(c.EndpointTimeouts))
+	for e, t := range c.EndpointTimeouts {
+		timeouts[e] = time.Duration(t)
+	}
+
+	return timeouts
+}
+
+// ContentConfigs returns the items configuration.
+func (c *FileConfig) ContentConfigs() []ContentConfig {
+	return contentConfigs(c.Items)
+}
+
+// DeviceContentConfigs returns the items configurations of the device classes that have one.
+func (c *FileConfig) DeviceContentConfigs() map[DeviceClass][]ContentConfig {
+	configs := make(map[DeviceClass][]ContentConfig, len(c.DeviceItems))
+	for class, items := range c.DeviceItems {
+		configs[class] = contentConfigs(items)
+	}
+
+	return configs
+}
+
+// FeedContentConfigs returns the items configurations of the named feeds.
+func (c *FileConfig) FeedContentConfigs() map[string][]ContentConfig {
+	configs := make(map[string][]ContentConfig, len(c.Feeds))
+	for name, items := range c.Feeds {
+		configs[name] = contentConfigs(items)
+	}
+
+	return configs
+}
+
+func contentConfigs(items []ItemConfig) []ContentConfig {
+	configs := make([]ContentConfig, len(items))
+	for i, item := range items {
+		configs[i] = ContentConfig{Type: item.Provider, Weight: item.Weight, Score: item.Score}
+		if item.Fallback != "" {
+			fallback := item.Fallback
+			configs[i].Fallback = &fallback
+		}
+	}
+
+	return configs
+}
+
+// itemConfigs is the reverse of contentConfigs.
+func itemConfigs(configs []ContentConfig) []ItemConfig {
+	items := make([]ItemConfig, len(configs))
+	for i, c := range configs {
+		items[i].Provider = c.Type
+		items[i].Weight = c.Weight
+		items[i].Score = c.Score
+		if c.Fallback != nil {
+			items[i].Fallback = *c.Fallback
+		}
+	}
+
+	return items
+}
+
+// UsedProviders returns all providers used in the configuration, including fallbacks, in order of appearance.
+func (c *FileConfig) UsedProviders() []Provider {
+	var providers []Provider
+	seen := make(map[Provider]bool)
+	items := append([]ItemConfig(nil), c.Items...)
+	for _, class := range deviceClasses {
+		items = append(items, c.DeviceItems[class]...)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Feeds)) {
+		items = append(items, c.Feeds[name]...)
+	}
+	for _, item := range items {
+		for _, p := range []Provider{item.Provider, item.Fallback} {
+			if p != "" && !seen[p] {
+				seen[p] = true
+				providers = append(providers, p)
+			}
+		}
+	}
+
+	return providers
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// DiffQuery is a content request used for comparing configurations.
+type DiffQuery struct {
+	Count  int `json:"count"`
+	Offset int `json:"offset"`
+	// Device is the device class of the request, for comparing the device items. Empty means the default items.
+	Device DeviceClass `json:"device,omitempty"`
+}
+
+// fakeClient returns items numbered per provider, so two runs against the same configuration return the same items.
+type fakeClient struct {
+	provider Provider
+	failing  bool
+	ids      IDGenerator
+}
+
+// GetContent implements Client.
+func (c *fakeClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	if c.failing {
+		return nil, errors.New("simulated failure")
+	}
+	items := make([]*ContentItem, count)
+	for i := range items {
+		items[i] = &ContentItem{ID: c.ids.NewID(), Title: "item", Source: string(c.provider)}
+	}
+	return items, nil
+}
+
+func runDiffCommand(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	configA := fs.String("config-a", "", "path to the current configuration file (JSON or YAML)")
+	configB := fs.String("config-b", "", "path to the new configuration file (JSON or YAML)")
+	queriesPath := fs.String("queries", "", `path to a JSON file with the requests to compare, like [{"count": 10, "offset": 0}]`)
+	failing := fs.String("failing", "", "comma-separated providers simulated as failing, to preview the fallbacks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *configA == "" || *configB == "" || *queriesPath == "" {
+		return errors.New("usage: diff -config-a a.json -config-b b.json -queries queries.json [-failing providers]")
+	}
+
+	a, err := LoadConfig(*configA)
+	if err != nil {
+		return err
+	}
+	b, err := LoadConfig(*configB)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(*queriesPath)
+	if err != nil {
+		return fmt.Errorf("reading queries: %w", err)
+	}
+	var queries []DiffQuery
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return fmt.Errorf("parsing queries: %w", err)
+	}
+
+	// The service logs every provider call, which would only obscure the report.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	var failingProviders []Provider
+	for _, p := range strings.Split(*failing, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			failingProviders = append(failingProviders, Provider(p))
+		}
+	}
+
+	return diffConfigs(os.Stdout, a, b, queries, failingProviders)
+}
+
+// diffConfigs runs the queries against services with both configurations and fake providers,
+// and writes how the providers of the positions change.
+func diffConfigs(w io.Writer, a, b *FileConfig, queries []DiffQuery, failing []Provider) error {
+	var changedQueries int
+	for _, q := range queries {
+		if q.Count <= 0 || q.Offset < 0 {
+			return fmt.Errorf("invalid query %+v: count must be positive and offset must be positive or zero", q)
+		}
+		sourcesA, err := diffRun(a, q, failing)
+		if err != nil {
+			return fmt.Errorf("config a: %w", err)
+		}
+		sourcesB, err := diffRun(b, q, failing)
+		if err != nil {
+			return fmt.Errorf("config b: %w", err)
+		}
+
+		var lines []string
+		for i := 0; i < max(len(sourcesA), len(sourcesB)); i++ {
+			sa, sb := positionSource(sourcesA, i), positionSource(sourcesB, i)
+			if sa != sb {
+				lines = append(lines, fmt.Sprintf("  position %d: %s -> %s", i, sa, sb))
+			}
+		}
+		query := fmt.Sprintf("count=%d offset=%d", q.Count, q.Offset)
+		if q.Device != "" {
+			query += " device=" + string(q.Device)
+		}
+		fmt.Fprintf(w, "%s: %d of %d items, %d positions changed\n", query, len(sourcesB), q.Count, len(lines))
+		for _, l := range lines {
+			fmt.Fprintln(w, l)
+		}
+		if len(lines) > 0 {
+			changedQueries++
+		}
+	}
+	fmt.Fprintf(w, "%d of %d queries changed\n", changedQueries, len(queries))
+
+	return nil
+}
+
+// diffRun returns the providers of the items returned for the query.
+func diffRun(cfg *FileConfig, q DiffQuery, failing []Provider) ([]string, error) {
+	clients := make(map[Provider]Client)
+	for _, p := range cfg.UsedProviders() {
+		clients[p] = &fakeClient{provider: p, ids: NewSequentialIDGenerator(string(p) + "-")}
+	}
+	for _, p := range failing {
+		if c, ok := clients[p].(*fakeClient); ok {
+			c.failing = true
+		}
+	}
+	service, err := NewServiceFromConfig(cfg, clients)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1", Device: DeviceHints{Class: q.Device}}, q.Count, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]string, len(items))
+	for i, item := range items {
+		sources[i] = item.Source
+	}
+
+	return sources, nil
+}
+
+func positionSource(sources []string, i int) string {
+	if i < len(sources) {
+		return sources[i]
+	}
+	return "(none)"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	p1, p2, p3 := Provider1, Provider2, Provider3
+	a := &FileConfig{Items: []ItemConfig{{Provider: p1, Fallback: p2}, {Provider: p2}}}
+	b := &FileConfig{Items: []ItemConfig{{Provider: p1, Fallback: p3}, {Provider: p1}}}
+	for _, cfg := range []*FileConfig{a, b} {
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("invalid config: %v", err)
+		}
+	}
+	queries := []DiffQuery{{Count: 2}, {Count: 1}}
+
+	for name, tc := range map[string]struct {
+		failing []Provider
+		want    string
+	}{
+		"all providers working": {
+			want: `count=2 offset=0: 2 of 2 items, 1 positions changed
+  position 1: 2 -> 1
+count=1 offset=0: 1 of 1 items, 0 positions changed
+1 of 2 queries changed
+`,
+		},
+		"failing provider": {
+			failing: []Provider{p1},
+			want: `count=2 offset=0: 1 of 2 items, 2 positions changed
+  position 0: 2 -> 3
+  position 1: 2 -> (none)
+count=1 offset=0: 1 of 1 items, 1 positions changed
+  position 0: 2 -> 3
+2 of 2 queries changed
+`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := diffConfigs(&out, a, b, queries, tc.failing); err != nil {
+				t.Fatalf("diff: %v", err)
+			}
+			if out.String() != tc.want {
+				t.Errorf("got report:\n%s\nwant:\n%s", out.String(), tc.want)
+			}
+		})
+	}
+
+	if err := diffConfigs(&bytes.Buffer{}, a, b, []DiffQuery{{Count: 0}}, nil); err == nil || !strings.Contains(err.Error(), "invalid query") {
+		t.Errorf("got error %v, want an invalid query error", err)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoStagedConfig is returned when applying without a staged configuration.
+	ErrNoStagedConfig = errors.New("no staged config")
+	// ErrNoPreviousConfig is returned when rolling back without a previous configuration.
+	ErrNoPreviousConfig = errors.New("no previous config")
+)
+
+// ConfigVersion is a numbered version of the items configuration.
+type ConfigVersion struct {
+	Version int         `json:"version"`
+	Created time.Time   `json:"created"`
+	Config  *FileConfig `json:"config"`
+}
+
+// ConfigVersions are the configuration versions known to the service.
+type ConfigVersions struct {
+	Active   *ConfigVersion `json:"active"`
+	Previous *ConfigVersion `json:"previous,omitempty"`
+	Staged   *ConfigVersion `json:"staged,omitempty"`
+}
+
+// ConfigHistory manages the configuration versions of the service: a new version is staged, then applied,
+// and can be rolled back to the previous one. The versions are persisted in the file, if there is one.
+type ConfigHistory struct {
+	service  *Service
+	path     string
+	now      func() time.Time
+	versions ConfigVersions
+	m        sync.Mutex
+}
+
+// newConfigHistory returns the history of the service configuration, restoring the persisted active version.
+func newConfigHistory(s *Service, path string) (*ConfigHistory, error) {
+	h := &ConfigHistory{
+		service: s,
+		path:    path,
+		now:     time.Now,
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("reading config history: %w", err)
+		default:
+			if err := json.Unmarshal(data, &h.versions); err != nil {
+				return nil, fmt.Errorf("parsing config history '%s': %w", path, err)
+			}
+			if h.versions.Active == nil {
+				return nil, fmt.Errorf("config history '%s' has no active version", path)
+			}
+			if err := h.apply(h.versions.Active); err != nil {
+				return nil, fmt.Errorf("restoring config version %d: %w", h.versions.Active.Version, err)
+			}
+			slog.Info("restored config version", "version", h.versions.Active.Version, "path", path)
+			return h, nil
+		}
+	}
+
+	h.versions.Active = &ConfigVersion{Version: 1, Created: h.now(), Config: s.Config()}
+
+	return h, nil
+}
+
+// Versions returns the known configuration versions.
+func (h *ConfigHistory) Versions() ConfigVersions {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return h.versions
+}
+
+// Stage validates the configuration and stores it as the staged version, replacing the previously staged one.
+// Only the items and the timeout can be changed at runtime.
+func (h *ConfigHistory) Stage(cfg *FileConfig) (*ConfigVersion, error) {
+	if len(cfg.Providers) > 0 {
+		return nil, errors.New("provider settings can't be changed at runtime")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkClients(cfg.ContentConfigs(), h.service.clients); err != nil {
+		return nil, err
+	}
+	for class, configs := range cfg.DeviceContentConfigs() {
+		if err := checkClients(configs, h.service.clients); err != nil {
+			return nil, fmt.Errorf("device '%s': %w", class, err)
+		}
+	}
+	for name, configs := range cfg.FeedContentConfigs() {
+		if err := checkClients(configs, h.service.clients); err != nil {
+			return nil, fmt.Errorf("feed '%s': %w", name, err)
+		}
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	versions := h.versions
+	versions.Staged = &ConfigVersion{Version: h.lastVersion() + 1, Created: h.now(), Config: cfg}
+	if err := h.save(versions); err != nil {
+		return nil, err
+	}
+	h.versions = versions
+
+	return versions.Staged, nil
+}
+
+// Apply makes the staged version active. The active version becomes the previous one.
+func (h *ConfigHistory) Apply() (*ConfigVersion, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.versions.Staged == nil {
+		return nil, ErrNoStagedConfig
+	}
+	versions := ConfigVersions{Active: h.versions.Staged, Previous: h.versions.Active}
+
+	return h.switchTo(versions)
+}
+
+// Rollback makes the previous version active again. The active version becomes the previous one,
+// so a rollback can be undone with another rollback.
+func (h *ConfigHistory) Rollback() (*ConfigVersion, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.versions.Previous == nil {
+		return nil, ErrNoPreviousConfig
+	}
+	versions := ConfigVersions{Active: h.versions.Previous, Previous: h.versions.Active, Staged: h.versions.Staged}
+
+	return h.switchTo(versions)
+}
+
+// switchTo persists the versions and applies the active one.
+func (h *ConfigHistory) switchTo(versions ConfigVersions) (*ConfigVersion, error) {
+	if err := h.save(versions); err != nil {
+		return nil, err
+	}
+	if err := h.apply(versions.Active); err != nil {
+		return nil, err
+	}
+	h.versions = versions
+	slog.Info("applied config version", "version", versions.Active.Version, "previous", versions.Previous.Version)
+
+	return versions.Active, nil
+}
+
+func (h *ConfigHistory) apply(v *ConfigVersion) error {
+	if err := v.Config.Validate(); err != nil {
+		return err
+	}
+	return h.service.setItemsConfig(v.Config)
+}
+
+func (h *ConfigHistory) lastVersion() int {
+	last := 0
+	for _, v := range []*ConfigVersion{h.versions.Active, h.versions.Previous, h.versions.Staged} {
+		if v != nil && v.Version > last {
+			last = v.Version
+		}
+	}
+	return last
+}
+
+// save writes the versions to the file atomically, so a crash doesn't leave a partial file.
+func (h *ConfigHistory) save(versions ConfigVersions) error {
+	if h.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(versions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding config history: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("saving config history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saving config history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("saving config history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		return fmt.Errorf("saving config history: %w", err)
+	}
+
+	return nil
+}
+
+// ConfigHistory returns the configuration versions manager.
+func (s *Service) ConfigHistory() *ConfigHistory {
+	return s.configs
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config-history.json")
+	newService := func() *Service {
+		t.Helper()
+		service, err := NewService(
+			[]ContentConfig{{Type: Provider1}},
+			map[Provider]Client{
+				Provider1: &mockContentProvider{source: Provider1},
+				Provider2: &mockContentProvider{source: Provider2},
+			},
+			defaultTimeout,
+			WithConfigHistory(path),
+		)
+		if err != nil {
+			t.Fatalf("creating a service: %v", err)
+		}
+		return service
+	}
+	source := func(service *Service) string {
+		t.Helper()
+		items, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 1, 0)
+		if err != nil || len(items) != 1 {
+			t.Fatalf("getting content: %v, %d items", err, len(items))
+		}
+		return items[0].Source
+	}
+
+	service := newService()
+	history := service.ConfigHistory()
+	if _, err := history.Apply(); !errors.Is(err, ErrNoStagedConfig) {
+		t.Errorf("got error %v applying without a staged config, want %v", err, ErrNoStagedConfig)
+	}
+	if _, err := history.Stage(&FileConfig{Items: []ItemConfig{{Provider: "9"}}}); err == nil {
+		t.Error("expected an error staging a config with an unknown provider")
+	}
+
+	staged, err := history.Stage(&FileConfig{Items: []ItemConfig{{Provider: Provider2}}})
+	if err != nil {
+		t.Fatalf("staging: %v", err)
+	}
+	if staged.Version != 2 {
+		t.Errorf("got staged version %d, want 2", staged.Version)
+	}
+	if got := source(service); got != string(Provider1) {
+		t.Errorf("got items from provider %s before applying, want %s", got, Provider1)
+	}
+	if _, err := history.Apply(); err != nil {
+		t.Fatalf("applying: %v", err)
+	}
+	if got := source(service); got != string(Provider2) {
+		t.Errorf("got items from provider %s after applying, want %s", got, Provider2)
+	}
+
+	// The applied version survives a restart, and it's still possible to roll back.
+	service = newService()
+	if got := source(service); got != string(Provider2) {
+		t.Errorf("got items from provider %s after restart, want %s", got, Provider2)
+	}
+	active, err := service.ConfigHistory().Rollback()
+	if err != nil {
+		t.Fatalf("rolling back: %v", err)
+	}
+	if active.Version != 1 {
+		t.Errorf("got version %d after rollback, want 1", active.Version)
+	}
+	if got := source(service); got != string(Provider1) {
+		t.Errorf("got items from provider %s after rollback, want %s", got, Provider1)
+	}
+}
+
+func TestAdminConfigVersions(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(NewAdminHandler(service, nil))
+	defer srv.Close()
+
+	for _, step := range []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "rollback without previous", method: http.MethodPost, path: "/admin/config/rollback", wantStatus: http.StatusConflict},
+		{name: "apply without staged", method: http.MethodPost, path: "/admin/config/apply", wantStatus: http.StatusConflict},
+		{name: "stage invalid", method: http.MethodPut, path: "/admin/config/staged", body: `{"items": []}`, wantStatus: http.StatusBadRequest},
+		{name: "stage provider settings", method: http.MethodPut, path: "/admin/config/staged", body: `{"items": [{"provider": "1"}], "providers": {"1": {}}}`, wantStatus: http.StatusBadRequest},
+		{name: "stage", method: http.MethodPut, path: "/admin/config/staged", body: `{"timeout": "1s", "items": [{"provider": "3"}]}`, wantStatus: http.StatusOK},
+		{name: "apply", method: http.MethodPost, path: "/admin/config/apply", wantStatus: http.StatusOK},
+		{name: "rollback", method: http.MethodPost, path: "/admin/config/rollback", wantStatus: http.StatusOK},
+		{name: "versions", method: http.MethodGet, path: "/admin/config/versions", wantStatus: http.StatusOK},
+	} {
+		req, _ := http.NewRequest(step.method, srv.URL+step.path, strings.NewReader(step.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != step.wantStatus {
+			t.Errorf("%s: got status %d, want %d", step.name, resp.StatusCode, step.wantStatus)
+		}
+	}
+
+	versions := service.ConfigHistory().Versions()
+	if versions.Active.Version != 1 || versions.Previous.Version != 2 {
+		t.Errorf("got active version %d and previous %d, want 1 and 2", versions.Active.Version, versions.Previous.Version)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadExampleConfig(t *testing.T) {
+	cfg, err := LoadConfig("config.example.json")
+	if err != nil {
+		t.Fatalf("loading config: %v", err)
+	}
+
+	if time.Duration(cfg.Timeout) != defaultTimeout {
+		t.Errorf("got timeout %v, want %v", time.Duration(cfg.Timeout), defaultTimeout)
+	}
+
+	// The example config should be the same as the default one.
+	configs := cfg.ContentConfigs()
+	if len(configs) != len(DefaultConfig) {
+		t.Fatalf("got %d items, want %d", len(configs), len(DefaultConfig))
+	}
+	for i, c := range configs {
+		want := DefaultConfig[i]
+		if c.Type != want.Type {
+			t.Errorf("item %d: got provider %s, want %s", i, c.Type, want.Type)
+		}
+		if (c.Fallback == nil) != (want.Fallback == nil) || (c.Fallback != nil && *c.Fallback != *want.Fallback) {
+			t.Errorf("item %d: got fallback %v, want %v", i, c.Fallback, want.Fallback)
+		}
+	}
+
+	if _, err := NewServiceFromConfig(cfg, SampleClients(cfg.UsedProviders()...)); err != nil {
+		t.Errorf("creating service: %v", err)
+	}
+}
+
+func TestLoadYAMLConfig(t *testing.T) {
+	content := `timeout: 2s
+items:
+  - provider: "1"
+    fallback: "2"
+  - {provider: "2"}
+providers:
+  1:
+    max_concurrent_calls: 4
+`
+	for _, name := range []string{"config.yaml", "config.yml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatalf("writing config: %v", err)
+			}
+			cfg, err := LoadConfig(path)
+			if err != nil {
+				t.Fatalf("loading config: %v", err)
+			}
+			configs := cfg.ContentConfigs()
+			if time.Duration(cfg.Timeout) != 2*time.Second || len(configs) != 2 || *configs[0].Fallback != Provider2 || cfg.Providers[Provider1].MaxConcurrentCalls != 4 {
+				t.Errorf("got config %+v", cfg)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("items:\n  - provider: \"1\"\n    color: red\n"), 0o600); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("got no error for an unknown field")
+	}
+}
+
+func TestLoadInvalidConfig(t *testing.T) {
+	for name, content := range map[string]string{
+		"invalid json":              `{"items": [`,
+		"no items":                  `{"timeout": "1s", "items": []}`,
+		"empty provider":            `{"items": [{"fallback": "1"}]}`,
+		"invalid timeout":           `{"timeout": "abc", "items": [{"provider": "1"}]}`,
+		"negative timeout":          `{"timeout": "-1s", "items": [{"provider": "1"}]}`,
+		"unknown field":             `{"items": [{"provider": "1", "color": "red"}]}`,
+		"negative breaker":          `{"items": [{"provider": "1"}], "providers": {"1": {"circuit_breaker": {"failures": -1}}}}`,
+		"unsorted counts":           `{"items": [{"provider": "1"}], "providers": {"1": {"allowed_counts": [10, 5]}}}`,
+		"invalid user IP policy":    `{"items": [{"provider": "1"}], "providers": {"1": {"send_user_ip": "sometimes"}}}`,
+		"negative expiry skew":      `{"items": [{"provider": "1"}], "providers": {"1": {"expiry_skew": "-1s"}}}`,
+		"invalid items policy":      `{"items": [{"provider": "1"}], "providers": {"1": {"invalid_items": "ignore"}}}`,
+		"per user cache without IP": `{"items": [{"provider": "1"}], "providers": {"1": {"send_user_ip": "never", "cache": {"per_user": true}}}}`,
+		"zero count":                `{"items": [{"provider": "1"}], "providers": {"1": {"allowed_counts": [0, 5]}}}`,
+		"negative concurrency":      `{"items": [{"provider": "1"}], "providers": {"1": {"max_concurrent_calls": -1}}}`,
+		"unknown device class":      `{"items": [{"provider": "1"}], "device_items": {"tablet": [{"provider": "1"}]}}`,
+		"no device items":           `{"items": [{"provider": "1"}], "device_items": {"mobile": []}}`,
+		"invalid feed name":         `{"items": [{"provider": "1"}], "feeds": {"home/top": [{"provider": "1"}]}}`,
+		"no feed items":             `{"items": [{"provider": "1"}], "feeds": {"home": []}}`,
+		"unknown feed priority":     `{"items": [{"provider": "1"}], "feed_priorities": {"home": 1}}`,
+		"unknown endpoint":          `{"items": [{"provider": "1"}], "endpoint_timeouts": {"sse": "10s"}}`,
+		"zero endpoint timeout":     `{"items": [{"provider": "1"}], "endpoint_timeouts": {"stream": "0s"}}`,
+		"negative weight":           `{"items": [{"provider": "1", "weight": -1}]}`,
+		"too large weight":          `{"items": [{"provider": "1", "weight": 1000}, {"provider": "2"}]}`,
+		"unknown client type":       `{"items": [{"provider": "1"}], "providers": {"1": {"client": {"type": "ftp"}}}}`,
+		"static client":             `{"items": [{"provider": "1"}], "providers": {"static": {"client": {"type": "sample"}}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatalf("writing config: %v", err)
+			}
+			if _, err := LoadConfig(path); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
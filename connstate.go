@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// connChurnMinClosed is the minimum number of closed connections in a check interval to consider reporting churn.
+	connChurnMinClosed = 50
+	// connChurnRatio is the ratio of single-request connections (among the closed ones) considered as churn.
+	connChurnRatio = 0.9
+)
+
+var (
+	httpConnections        = newGaugeVec("http_connections", "Number of open HTTP connections by state.", "server", "state")
+	httpConnectionsOpened  = newCounterVec("http_connections_opened_total", "Number of accepted HTTP connections.", "server")
+	httpConnectionRequests = newHistogramVec(
+		"http_connection_requests",
+		"Number of requests served by a closed HTTP connection.",
+		[]float64{1, 2, 5, 10, 50, 100, 1000},
+		"server",
+	)
+)
+
+// ConnTracker tracks connection states of an http.Server, exporting them as metrics.
+// Use its ConnState method as the http.Server.ConnState callback.
+type ConnTracker struct {
+	server string
+
+	conns        map[net.Conn]*trackedConn
+	opened       int // Opened since the last check.
+	closed       int // Closed since the last check.
+	closedSingle int // Closed since the last check, after serving at most one request.
+	m            sync.Mutex
+}
+
+type trackedConn struct {
+	state    http.ConnState
+	requests int
+}
+
+// NewConnTracker returns a tracker for the server with the given name, used as the metrics label.
+func NewConnTracker(server string) *ConnTracker {
+	return &ConnTracker{
+		server: server,
+		conns:  make(map[net.Conn]*trackedConn),
+	}
+}
+
+// ConnState is the http.Server.ConnState callback.
+func (t *ConnTracker) ConnState(c net.Conn, state http.ConnState) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	tc, ok := t.conns[c]
+	if ok {
+		httpConnections.Add(-1, t.server, tc.state.String())
+	} else {
+		tc = &trackedConn{}
+		t.conns[c] = tc
+	}
+
+	switch state {
+	case http.StateNew:
+		t.opened++
+		httpConnectionsOpened.Inc(t.server)
+	case http.StateActive:
+		tc.requests++
+	case http.StateHijacked, http.StateClosed:
+		delete(t.conns, c)
+		t.closed++
+		if tc.requests <= 1 {
+			t.closedSingle++
+		}
+		httpConnectionRequests.Observe(float64(tc.requests), t.server)
+		return
+	}
+
+	tc.state = state
+	httpConnections.Add(1, t.server, state.String())
+}
+
+// Run periodically checks the connection patterns and logs the abnormal ones, until the context is done.
+func (t *ConnTracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.check(interval)
+		}
+	}
+}
+
+func (t *ConnTracker) check(interval time.Duration) {
+	t.m.Lock()
+	opened, closed, closedSingle := t.opened, t.closed, t.closedSingle
+	t.opened, t.closed, t.closedSingle = 0, 0, 0
+	t.m.Unlock()
+
+	if closed < connChurnMinClosed {
+		return
+	}
+	if ratio := float64(closedSingle) / float64(closed); ratio >= connChurnRatio {
+		slog.Warn(
+			"connection churn detected, check the keep-alive settings of clients and load balancers",
+			"server", t.server, "opened", opened, "closed", closed, "single_request_ratio", ratio, "interval", interval,
+		)
+	}
+}
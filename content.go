@@ -1,14 +1,15 @@
 package main
 
 import (
-	"math/rand"
-	"strconv"
+	"context"
 	"time"
 )
 
-// Client represents a provider's client or SDK
+// Client represents a provider's client or SDK.
+// Implementations should return as soon as the context is done.
+// Clients using only the user IP can be adapted with AdaptSimpleClient.
 type Client interface {
-	GetContent(userIP string, count int) ([]*ContentItem, error)
+	GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error)
 }
 
 // ContentItem represent one piece of content fetched from a provider
@@ -18,6 +19,7 @@ type ContentItem struct {
 	Source  string    `json:"source"`
 	Summary string    `json:"summary"`
 	Link    string    `json:"link"`
+	Media   []string  `json:"media,omitempty"`
 	Expiry  time.Time `json:"expiry"`
 }
 
@@ -31,17 +33,23 @@ var (
 	Provider3 = Provider("3")
 )
 
-// SampleContentProvider is an example for a Provider's client
+// SampleContentProvider is an example for a Provider's client. It's a SimpleClient.
 type SampleContentProvider struct {
 	Source Provider
+	// IDs creates the item IDs. When nil, random prefixed UUIDs are used.
+	IDs IDGenerator
 }
 
 // GetContent returns content items given a user IP, and the number of content items desired.
-func (cp SampleContentProvider) GetContent(userIP string, count int) ([]*ContentItem, error) {
+func (cp SampleContentProvider) GetContent(ctx context.Context, userIP string, count int) ([]*ContentItem, error) {
+	ids := cp.IDs
+	if ids == nil {
+		ids = NewUUIDv7Generator(string(cp.Source) + "-")
+	}
 	resp := make([]*ContentItem, count)
 	for i := range resp {
 		resp[i] = &ContentItem{
-			ID:     strconv.Itoa(rand.Int()),
+			ID:     ids.NewID(),
 			Title:  "title",
 			Source: string(cp.Source),
 			Expiry: time.Now(),
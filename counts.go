@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var bufferedItems = newCounterVec(
+	"provider_buffered_items_total",
+	"Number of content items served from the surplus of rounded-up provider calls.",
+	"provider",
+)
+
+// roundCount returns the smallest allowed count not less than `count`, or the largest allowed one.
+// The allowed counts must be sorted ascending.
+func roundCount(count int, allowed []int) int {
+	for _, c := range allowed {
+		if c >= count {
+			return c
+		}
+	}
+	return allowed[len(allowed)-1]
+}
+
+// maxRoundingBuffers limits the surplus buffers of a provider, one per personalization of the requests.
+const maxRoundingBuffers = 100
+
+// countRoundingClient is a Client decorator for providers serving only some counts.
+// It requests the nearest allowed count and keeps the surplus items for the next calls with the same personalization.
+type countRoundingClient struct {
+	client   Client
+	provider Provider
+	allowed  []int
+	// perUser disables the surplus buffer, because the items of one user can't be served to others.
+	perUser bool
+
+	// buffers are keyed by the personalization of the requests, like the cache, so the items go only to matching requests.
+	buffers map[string][]*ContentItem
+	m       sync.Mutex
+}
+
+// GetContent implements Client.
+func (c *countRoundingClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	key := meta.personalization()
+	items := c.takeBuffered(key, count)
+	if len(items) > 0 {
+		bufferedItems.Add(float64(len(items)), string(c.provider))
+	}
+	if len(items) == count {
+		return items, nil
+	}
+
+	fetched, err := c.client.GetContent(ctx, meta, roundCount(count-len(items), c.allowed))
+	if err != nil {
+		if len(items) > 0 {
+			// The buffered items are still good for another call.
+			c.putBuffered(key, items)
+		}
+		return nil, err
+	}
+	missing := min(count-len(items), len(fetched))
+	items = append(items, fetched[:missing]...)
+	c.putBuffered(key, fetched[missing:])
+
+	return items, nil
+}
+
+// takeBuffered removes up to `count` not expired items from the buffer.
+func (c *countRoundingClient) takeBuffered(key string, count int) []*ContentItem {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	var items []*ContentItem
+	buffer := c.buffers[key]
+	now := time.Now()
+	for len(buffer) > 0 && len(items) < count {
+		item := buffer[0]
+		buffer = buffer[1:]
+		if item.Expiry.After(now) {
+			items = append(items, item)
+		}
+	}
+	if len(buffer) == 0 {
+		delete(c.buffers, key)
+	} else {
+		c.buffers[key] = buffer
+	}
+
+	return items
+}
+
+// putBuffered adds the items to the buffer, keeping at most the largest allowed count of items.
+// When there are too many buffers, another one is dropped.
+func (c *countRoundingClient) putBuffered(key string, items []*ContentItem) {
+	if c.perUser || len(items) == 0 {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.buffers == nil {
+		c.buffers = make(map[string][]*ContentItem)
+	}
+	if _, ok := c.buffers[key]; !ok && len(c.buffers) >= maxRoundingBuffers {
+		for other := range c.buffers {
+			delete(c.buffers, other)
+			break
+		}
+	}
+	buffer := append(c.buffers[key], items...)
+	if limit := c.allowed[len(c.allowed)-1]; len(buffer) > limit {
+		buffer = buffer[len(buffer)-limit:]
+	}
+	c.buffers[key] = buffer
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// countingClient returns `count` numbered items, and remembers the requested counts.
+type countingClient struct {
+	counts []int
+	next   int
+}
+
+func (c *countingClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	c.counts = append(c.counts, count)
+	items := make([]*ContentItem, count)
+	for i := range items {
+		items[i] = &ContentItem{ID: strconv.Itoa(c.next), Expiry: time.Now().Add(time.Hour)}
+		c.next++
+	}
+	return items, nil
+}
+
+func TestRoundCount(t *testing.T) {
+	allowed := []int{5, 10, 20}
+	for count, want := range map[int]int{1: 5, 5: 5, 6: 10, 20: 20, 21: 20} {
+		if got := roundCount(count, allowed); got != want {
+			t.Errorf("count %d: got %d, want %d", count, got, want)
+		}
+	}
+}
+
+func TestCountRoundingClient(t *testing.T) {
+	for name, tc := range map[string]struct {
+		perUser bool
+		// locales are the locales of the calls, the default one when empty.
+		locales    []string
+		wantCounts []int
+		wantIDs    []string
+	}{
+		"buffered surplus": {
+			wantCounts: []int{5, 5},
+			wantIDs:    []string{"0", "1", "2", "3", "4", "5", "6", "7", "8"},
+		},
+		"per user": {
+			perUser:    true,
+			wantCounts: []int{5, 5, 5},
+			wantIDs:    []string{"0", "1", "2", "5", "6", "7", "10", "11", "12"},
+		},
+		"personalized": {
+			locales:    []string{"en", "de", "en"},
+			wantCounts: []int{5, 5, 5},
+			wantIDs:    []string{"0", "1", "2", "5", "6", "7", "3", "4", "10"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			upstream := &countingClient{}
+			client := &countRoundingClient{client: upstream, provider: Provider1, allowed: []int{5, 10}, perUser: tc.perUser}
+
+			var ids []string
+			for i := 0; i < 3; i++ {
+				meta := RequestMeta{IP: "127.0.0.1"}
+				if len(tc.locales) > 0 {
+					meta.Locale = tc.locales[i]
+				}
+				items, err := client.GetContent(context.Background(), meta, 3)
+				if err != nil {
+					t.Fatalf("getting content: %v", err)
+				}
+				for _, item := range items {
+					ids = append(ids, item.ID)
+				}
+			}
+
+			if !reflect.DeepEqual(upstream.counts, tc.wantCounts) {
+				t.Errorf("got upstream counts %v, want %v", upstream.counts, tc.wantCounts)
+			}
+			if !reflect.DeepEqual(ids, tc.wantIDs) {
+				t.Errorf("got items %v, want %v", ids, tc.wantIDs)
+			}
+		})
+	}
+}
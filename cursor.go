@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	cursorVersion = 1
+	// cursorMACSize is the length of the truncated HMAC-SHA256 signature.
+	cursorMACSize = 16
+	// nextCursorHeader is the response header with the cursor of the next page.
+	nextCursorHeader = "Next-Cursor"
+	// minCursorSecretLength is the minimum length of the signing key, so it can't be guessed.
+	minCursorSecretLength = 16
+)
+
+// Cursor errors, with the codes returned to the clients.
+var (
+	errCursorInvalid = errors.New("is invalid")
+	errCursorExpired = errors.New("has expired")
+)
+
+// cursorErrorCodes are the codes of the cursor errors in the validation errors.
+var cursorErrorCodes = map[error]string{
+	errCursorInvalid: "cursor_invalid",
+	errCursorExpired: "cursor_expired",
+}
+
+// CursorSigner encodes the pagination positions as opaque cursors, signed and timestamped,
+// so the clients can't forge the positions, and old cursors are rejected.
+type CursorSigner struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewCursorSigner returns a signer using the secret key. The cursors are valid for ttl.
+func NewCursorSigner(key []byte, ttl time.Duration) (*CursorSigner, error) {
+	if len(key) < minCursorSecretLength {
+		return nil, fmt.Errorf("the cursor key must have at least %d bytes", minCursorSecretLength)
+	}
+	return &CursorSigner{key: key, ttl: ttl, now: time.Now}, nil
+}
+
+// Encode returns the cursor of the offset.
+func (s *CursorSigner) Encode(offset int) string {
+	b := []byte{cursorVersion}
+	b = binary.AppendUvarint(b, uint64(offset))
+	b = binary.AppendVarint(b, s.now().Unix())
+	b = append(b, s.mac(b)...)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode returns the offset of the cursor, errCursorInvalid for a malformed or tampered cursor,
+// or errCursorExpired for a cursor older than the ttl.
+func (s *CursorSigner) Decode(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) < 1+cursorMACSize {
+		return 0, errCursorInvalid
+	}
+	payload, sig := b[:len(b)-cursorMACSize], b[len(b)-cursorMACSize:]
+	if !hmac.Equal(sig, s.mac(payload)) || payload[0] != cursorVersion {
+		return 0, errCursorInvalid
+	}
+
+	offset, n := binary.Uvarint(payload[1:])
+	if n <= 0 || offset > math.MaxInt32 {
+		return 0, errCursorInvalid
+	}
+	issued, m := binary.Varint(payload[1+n:])
+	if m <= 0 || 1+n+m != len(payload) {
+		return 0, errCursorInvalid
+	}
+	if s.now().Sub(time.Unix(issued, 0)) > s.ttl {
+		return 0, errCursorExpired
+	}
+
+	return int(offset), nil
+}
+
+func (s *CursorSigner) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(payload)
+	return h.Sum(nil)[:cursorMACSize]
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCursorSigner(t *testing.T) {
+	signer, err := NewCursorSigner([]byte("0123456789abcdef"), time.Hour)
+	if err != nil {
+		t.Fatalf("creating signer: %v", err)
+	}
+	now := time.Now()
+	signer.now = func() time.Time { return now }
+	other, _ := NewCursorSigner([]byte("fedcba9876543210"), time.Hour)
+
+	cursor := signer.Encode(42)
+	tampered, _ := base64.RawURLEncoding.DecodeString(cursor)
+	tampered[1]++
+
+	for name, tc := range map[string]struct {
+		cursor     string
+		age        time.Duration
+		wantOffset int
+		wantErr    error
+	}{
+		"valid":          {cursor: cursor, wantOffset: 42},
+		"almost expired": {cursor: cursor, age: time.Hour - time.Second, wantOffset: 42},
+		"expired":        {cursor: cursor, age: time.Hour + time.Second, wantErr: errCursorExpired},
+		"tampered":       {cursor: base64.RawURLEncoding.EncodeToString(tampered), wantErr: errCursorInvalid},
+		"other key":      {cursor: other.Encode(42), wantErr: errCursorInvalid},
+		"not base64":     {cursor: "!!!", wantErr: errCursorInvalid},
+		"too short":      {cursor: "AQ", wantErr: errCursorInvalid},
+	} {
+		t.Run(name, func(t *testing.T) {
+			signer.now = func() time.Time { return now.Add(tc.age) }
+			offset, err := signer.Decode(tc.cursor)
+			if err != tc.wantErr {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if offset != tc.wantOffset {
+				t.Errorf("got offset %d, want %d", offset, tc.wantOffset)
+			}
+		})
+	}
+
+	if _, err := NewCursorSigner([]byte("short"), time.Hour); err == nil {
+		t.Error("expected error for a short key")
+	}
+}
+
+func TestCursorPagination(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	signer, err := NewCursorSigner([]byte("0123456789abcdef"), time.Hour)
+	if err != nil {
+		t.Fatalf("creating signer: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service, deltas: newDeltaStore(10, time.Minute), cursors: signer, limits: RequestLimits{MaxItems: 1000}})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/?count=3")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	next := resp.Header.Get(nextCursorHeader)
+	if offset, err := signer.Decode(next); err != nil || offset != 3 {
+		t.Fatalf("got cursor of offset %d (error %v), want 3", offset, err)
+	}
+
+	for name, tc := range map[string]struct {
+		query      string
+		wantStatus int
+		wantCode   string
+	}{
+		"next page":       {query: "count=3&cursor=" + next, wantStatus: http.StatusOK},
+		"forged cursor":   {query: "count=3&cursor=AQYAAAAAAAAAAAAAAAAAAAAAAA", wantStatus: http.StatusBadRequest, wantCode: "cursor_invalid"},
+		"with offset":     {query: "count=3&offset=3&cursor=" + next, wantStatus: http.StatusBadRequest},
+		"over the limits": {query: "count=3&cursor=" + signer.Encode(5000), wantStatus: http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/?" + tc.query)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantCode == "" {
+				return
+			}
+			var body ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding errors: %v", err)
+			}
+			if errs := body.Details; len(errs) != 1 || errs[0].Code != tc.wantCode {
+				t.Errorf("got errors %+v, want code %s", errs, tc.wantCode)
+			}
+		})
+	}
+}
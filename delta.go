@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// DeltaResponse is the response for requests with the `since_etag` parameter.
+// It contains only the positions that changed since the response identified by BaseETag.
+type DeltaResponse struct {
+	ETag     string `json:"etag"`
+	BaseETag string `json:"base_etag"`
+	// Full is true when the base response is unknown (e.g., expired), and Changed contains all the items.
+	Full bool `json:"full"`
+	// Count is the number of items in the current response.
+	Count   int           `json:"count"`
+	Changed []DeltaChange `json:"changed"`
+	// Removed lists IDs of the base response items that are no longer in the response.
+	Removed []string `json:"removed"`
+}
+
+// DeltaChange is an item that changed at the given position.
+type DeltaChange struct {
+	Position int       `json:"position"`
+	Item     *ItemView `json:"item"`
+}
+
+// deltaStore keeps recent responses by their ETags, so it's possible to compute deltas against them.
+type deltaStore struct {
+	cache *MemoryCache
+	ttl   time.Duration
+}
+
+// newDeltaStore returns a store remembering up to `size` responses for `ttl`.
+func newDeltaStore(size int, ttl time.Duration) *deltaStore {
+	return &deltaStore{
+		cache: NewMemoryCache(size),
+		ttl:   ttl,
+	}
+}
+
+// put remembers the items returned with the ETag.
+func (s *deltaStore) put(ctx context.Context, etag string, items []*ContentItem) {
+	if s == nil {
+		return
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		slog.ErrorContext(ctx, "encoding items for delta store", "error", err)
+		return
+	}
+	_ = s.cache.Set(ctx, etag, data, s.ttl)
+}
+
+// get returns the items returned with the ETag, if they are still remembered.
+func (s *deltaStore) get(ctx context.Context, etag string) ([]*ContentItem, bool) {
+	if s == nil {
+		return nil, false
+	}
+	data, ok, _ := s.cache.Get(ctx, etag)
+	if !ok {
+		return nil, false
+	}
+	var items []*ContentItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		slog.ErrorContext(ctx, "decoding items from delta store", "error", err)
+		return nil, false
+	}
+
+	return items, true
+}
+
+// computeETag returns a strong ETag for the items.
+func computeETag(items []*ContentItem) (string, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", fmt.Errorf("encoding items: %w", err)
+	}
+	sum := sha256.Sum256(data)
+
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// normalizeETag returns the ETag in a quoted form, accepting also unquoted values and weak ETags.
+func normalizeETag(s string) string {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "W/")
+	return `"` + strings.Trim(s, `"`) + `"`
+}
+
+// etagMatches checks if the ETag is listed in the If-None-Match header value.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || (v != "" && normalizeETag(v) == etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// computeDelta compares the items position by position.
+// When `base` is nil, all items are reported as changed.
+func computeDelta(etag, baseETag string, base, items []*ContentItem, full bool, render renderOptions) (*DeltaResponse, error) {
+	resp := &DeltaResponse{
+		ETag:     etag,
+		BaseETag: baseETag,
+		Full:     full,
+		Count:    len(items),
+		Changed:  []DeltaChange{},
+		Removed:  []string{},
+	}
+
+	current := make(map[string]bool, len(items))
+	for i, item := range items {
+		current[item.ID] = true
+
+		if i < len(base) {
+			same, err := sameItems(base[i], item)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				continue
+			}
+		}
+		resp.Changed = append(resp.Changed, DeltaChange{Position: i, Item: render.renderItem(item)})
+	}
+	for _, item := range base {
+		if !current[item.ID] {
+			resp.Removed = append(resp.Removed, item.ID)
+		}
+	}
+
+	return resp, nil
+}
+
+func sameItems(a, b *ContentItem) (bool, error) {
+	if a.ID != b.ID {
+		return false, nil
+	}
+	da, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	db, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(da, db), nil
+}
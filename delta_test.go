@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestComputeDelta(t *testing.T) {
+	a := &ContentItem{ID: "a", Title: "a"}
+	b := &ContentItem{ID: "b", Title: "b"}
+	b2 := &ContentItem{ID: "b", Title: "b updated"}
+	c := &ContentItem{ID: "c", Title: "c"}
+	d := &ContentItem{ID: "d", Title: "d"}
+
+	delta, err := computeDelta(`"new"`, `"old"`, []*ContentItem{a, b, c}, []*ContentItem{a, b2, d, c}, false, renderOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantChanged := []DeltaChange{
+		{Position: 1, Item: renderOptions{}.renderItem(b2)},
+		{Position: 2, Item: renderOptions{}.renderItem(d)},
+		{Position: 3, Item: renderOptions{}.renderItem(c)},
+	}
+	if !reflect.DeepEqual(delta.Changed, wantChanged) {
+		t.Errorf("got changes %+v, want %+v", delta.Changed, wantChanged)
+	}
+	if len(delta.Removed) != 0 {
+		t.Errorf("got removed %v, want none", delta.Removed)
+	}
+	if delta.Count != 4 {
+		t.Errorf("got count %d, want 4", delta.Count)
+	}
+
+	delta, _ = computeDelta(`"new"`, `"old"`, []*ContentItem{a, b, c}, []*ContentItem{a}, false, renderOptions{})
+	if !reflect.DeepEqual(delta.Removed, []string{"b", "c"}) {
+		t.Errorf("got removed %v, want [b c]", delta.Removed)
+	}
+}
+
+func TestDeltaResponses(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+	}
+	service, err := NewService([]ContentConfig{{Type: Provider1}}, clients, defaultTimeout, WithCache(NewMemoryCache(0), CacheSettings{TTL: time.Minute}))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service, deltas: newDeltaStore(10, time.Minute)})
+	defer srv.Close()
+
+	get := func(query string, header http.Header) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?count=3"+query, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		return resp
+	}
+
+	resp := get("", nil)
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag header")
+	}
+
+	resp = get("", http.Header{"If-None-Match": {etag}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("got status %d for matching If-None-Match, want 304", resp.StatusCode)
+	}
+
+	for name, tc := range map[string]struct {
+		sinceETag   string
+		wantFull    bool
+		wantChanged int
+	}{
+		"known etag": {
+			sinceETag:   etag,
+			wantChanged: 0,
+		},
+		"unknown etag": {
+			sinceETag:   `"unknown"`,
+			wantFull:    true,
+			wantChanged: 3,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := get("&since_etag="+tc.sinceETag, nil)
+			defer resp.Body.Close()
+
+			var delta DeltaResponse
+			if err := json.NewDecoder(resp.Body).Decode(&delta); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if delta.Full != tc.wantFull {
+				t.Errorf("got full %v, want %v", delta.Full, tc.wantFull)
+			}
+			if len(delta.Changed) != tc.wantChanged {
+				t.Errorf("got %d changed items, want %d", len(delta.Changed), tc.wantChanged)
+			}
+			if delta.ETag != etag {
+				t.Errorf("got etag %s, want %s", delta.ETag, etag)
+			}
+		})
+	}
+}
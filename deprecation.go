@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Warning codes of the deprecated features used by a request.
+const (
+	WarningDeprecatedParam = "deprecated_param"
+	WarningDeprecatedField = "deprecated_field"
+)
+
+var deprecatedUsage = newCounterVec(
+	"deprecated_usage_total",
+	"Number of content requests using a deprecated feature, by kind (param, field) and name.",
+	"kind", "name",
+)
+
+// Deprecation marks a content API query parameter, or an item field of the responses, as deprecated.
+// The requests using it get the Deprecation and Sunset headers, and a warning in the envelope.
+type Deprecation struct {
+	// Param is the deprecated query parameter, like "exclude". Either Param or Field must be set.
+	Param string `json:"param,omitempty"`
+	// Field is the deprecated item field, like "summary". All the responses with items use it.
+	Field string `json:"field,omitempty"`
+	// Since is when the feature was deprecated.
+	Since time.Time `json:"since"`
+	// Sunset is when the feature is going to be removed. Zero means it isn't planned yet.
+	Sunset time.Time `json:"sunset"`
+	// Link is the URL of the migration guide, sent in the Link header with rel="deprecation".
+	Link string `json:"link,omitempty"`
+	// Message tells the clients what to use instead.
+	Message string `json:"message,omitempty"`
+}
+
+// Warning describes a deprecated feature used by the request.
+type Warning struct {
+	Code    string     `json:"code"`
+	Name    string     `json:"name"`
+	Message string     `json:"message"`
+	Sunset  *time.Time `json:"sunset,omitempty"`
+}
+
+// validateDeprecations checks that the deprecations refer to the existing parameters and fields, and that their
+// dates make sense.
+func validateDeprecations(deprecations []Deprecation) error {
+	params := contentParamNames()
+	fields := itemFieldNames()
+	for i, d := range deprecations {
+		switch {
+		case (d.Param == "") == (d.Field == ""):
+			return fmt.Errorf("deprecation %d: either param or field must be set", i)
+		case d.Param != "" && !slices.Contains(params, d.Param):
+			return fmt.Errorf("deprecation %d: unknown param '%s', must be one of %v", i, d.Param, params)
+		case d.Field != "" && !slices.Contains(fields, d.Field):
+			return fmt.Errorf("deprecation %d: unknown field '%s', must be one of %v", i, d.Field, fields)
+		case d.Since.IsZero():
+			return fmt.Errorf("deprecation %d: since must be set", i)
+		case !d.Sunset.IsZero() && !d.Sunset.After(d.Since):
+			return fmt.Errorf("deprecation %d: sunset must be after since", i)
+		}
+	}
+	return nil
+}
+
+// contentParamNames returns the query parameters of the content API (the headers aren't deprecated this way).
+func contentParamNames() []string {
+	spec := openAPISpec(RequestLimits{}, true, nil)
+	op := spec["paths"].(map[string]any)["/"].(map[string]any)["get"].(map[string]any)
+	var names []string
+	for _, p := range op["parameters"].([]map[string]any) {
+		if p["in"] == "query" {
+			names = append(names, p["name"].(string))
+		}
+	}
+	return names
+}
+
+// itemFieldNames returns the JSON names of the ItemView fields.
+func itemFieldNames() []string {
+	t := reflect.TypeOf(ItemView{})
+	names := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+	return names
+}
+
+// deprecationWarnings returns the warnings about the deprecated features used by the request, and sets the headers:
+// Deprecation with the earliest deprecation date, Sunset with the earliest removal date,
+// and Link with the migration guides.
+func (h *Handler) deprecationWarnings(w http.ResponseWriter, req *http.Request) []Warning {
+	if len(h.deprecations) == 0 {
+		return nil
+	}
+	query := req.URL.Query()
+	var warnings []Warning
+	var since, sunset time.Time
+	for _, d := range h.deprecations {
+		kind, warning := "field", Warning{Code: WarningDeprecatedField, Name: d.Field, Message: d.Message}
+		if d.Param != "" {
+			if !query.Has(d.Param) {
+				continue
+			}
+			kind, warning.Code, warning.Name = "param", WarningDeprecatedParam, d.Param
+		}
+		if warning.Message == "" {
+			warning.Message = fmt.Sprintf("%s is deprecated", warning.Name)
+		}
+		if !d.Sunset.IsZero() {
+			warning.Sunset = &d.Sunset
+			if sunset.IsZero() || d.Sunset.Before(sunset) {
+				sunset = d.Sunset
+			}
+		}
+		if since.IsZero() || d.Since.Before(since) {
+			since = d.Since
+		}
+		if d.Link != "" {
+			w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"deprecation\"", d.Link))
+		}
+		deprecatedUsage.Inc(kind, warning.Name)
+		warnings = append(warnings, warning)
+	}
+	if len(warnings) == 0 {
+		return nil
+	}
+
+	// The Deprecation header (RFC 9745) is a structured field date; Sunset (RFC 8594) is an HTTP date.
+	w.Header().Set("Deprecation", "@"+strconv.FormatInt(since.Unix(), 10))
+	if !sunset.IsZero() {
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+	}
+	return warnings
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDeprecations(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	paramSince := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fieldSince := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	handler := &Handler{service: service, deprecations: []Deprecation{
+		{Param: "exclude", Since: paramSince, Sunset: sunset, Link: "https://example.com/migration", Message: "use providers instead"},
+		{Field: "summary", Since: fieldSince},
+	}}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		query           string
+		wantDeprecation string
+		wantSunset      string
+		wantLink        string
+		wantWarnings    []string
+	}{
+		"deprecated param": {
+			query:           "count=1&exclude=2&partial=true",
+			wantDeprecation: "@1767225600",
+			wantSunset:      "Fri, 01 Jan 2027 00:00:00 GMT",
+			wantLink:        `<https://example.com/migration>; rel="deprecation"`,
+			wantWarnings:    []string{"deprecated_param exclude", "deprecated_field summary"},
+		},
+		"deprecated field only": {
+			query:           "count=1&partial=true",
+			wantDeprecation: "@1772323200",
+			wantWarnings:    []string{"deprecated_field summary"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/?" + tc.query)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("got status %d", resp.StatusCode)
+			}
+			if got := resp.Header.Get("Deprecation"); got != tc.wantDeprecation {
+				t.Errorf("got Deprecation %q, want %q", got, tc.wantDeprecation)
+			}
+			if got := resp.Header.Get("Sunset"); got != tc.wantSunset {
+				t.Errorf("got Sunset %q, want %q", got, tc.wantSunset)
+			}
+			if got := resp.Header.Get("Link"); got != tc.wantLink {
+				t.Errorf("got Link %q, want %q", got, tc.wantLink)
+			}
+			var envelope ContentEnvelope
+			if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			var warnings []string
+			for _, w := range envelope.Warnings {
+				warnings = append(warnings, w.Code+" "+w.Name)
+			}
+			if !slices.Equal(warnings, tc.wantWarnings) {
+				t.Errorf("got warnings %v, want %v", warnings, tc.wantWarnings)
+			}
+		})
+	}
+
+	// The OpenAPI document marks the deprecated parameter and field.
+	spec := openAPISpec(RequestLimits{}, false, handler.deprecations)
+	item := spec["components"].(map[string]any)["schemas"].(map[string]any)["ItemView"].(map[string]any)
+	if item["properties"].(map[string]any)["summary"].(map[string]any)["deprecated"] != true {
+		t.Error("the summary field isn't marked as deprecated")
+	}
+	op := spec["paths"].(map[string]any)["/"].(map[string]any)["get"].(map[string]any)
+	for _, p := range op["parameters"].([]map[string]any) {
+		if deprecated := p["deprecated"] == true; deprecated != (p["name"] == "exclude") {
+			t.Errorf("got parameter %s deprecated %v", p["name"], deprecated)
+		}
+	}
+}
+
+func TestValidateDeprecations(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, tc := range map[string]struct {
+		deprecation Deprecation
+		wantErr     bool
+	}{
+		"param":             {deprecation: Deprecation{Param: "exclude", Since: since}},
+		"field with sunset": {deprecation: Deprecation{Field: "summary", Since: since, Sunset: since.AddDate(1, 0, 0)}},
+		"unknown param":     {deprecation: Deprecation{Param: "limit", Since: since}, wantErr: true},
+		"unknown field":     {deprecation: Deprecation{Field: "body", Since: since}, wantErr: true},
+		"param and field":   {deprecation: Deprecation{Param: "exclude", Field: "summary", Since: since}, wantErr: true},
+		"without since":     {deprecation: Deprecation{Param: "exclude"}, wantErr: true},
+		"sunset before":     {deprecation: Deprecation{Param: "exclude", Since: since, Sunset: since.AddDate(0, -1, 0)}, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := validateDeprecations([]Deprecation{tc.deprecation})
+			if (err != nil) != tc.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
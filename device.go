@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DeviceClass is the kind of the user's device, used to pick the items configuration.
+type DeviceClass string
+
+// Device classes.
+const (
+	DeviceDesktop DeviceClass = "desktop"
+	DeviceMobile  DeviceClass = "mobile"
+	DeviceBot     DeviceClass = "bot"
+)
+
+// deviceClasses lists all the device classes, in a stable order.
+var deviceClasses = []DeviceClass{DeviceDesktop, DeviceMobile, DeviceBot}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *DeviceClass) UnmarshalText(text []byte) error {
+	switch v := DeviceClass(text); v {
+	case DeviceDesktop, DeviceMobile, DeviceBot:
+		*c = v
+		return nil
+	default:
+		return fmt.Errorf("invalid device class '%s', must be desktop, mobile or bot", v)
+	}
+}
+
+var (
+	// botPattern matches the user agents of crawlers. HTTP libraries (like Go-http-client) aren't matched,
+	// because the backends calling the API use them.
+	botPattern = regexp.MustCompile(`(?i)bot\b|crawl|spider|slurp|facebookexternalhit|headlesschrome`)
+	// mobilePattern matches the user agents of phones; tablets get the desktop pages.
+	mobilePattern = regexp.MustCompile(`Mobi|iPhone|iPod|Android.+Mobile|Windows Phone`)
+)
+
+// classifyDevice returns the device class from the device hints.
+// The Sec-CH-UA-Mobile client hint takes precedence over the user agent, and requests without hints are from desktops.
+func classifyDevice(hints DeviceHints) DeviceClass {
+	switch {
+	case botPattern.MatchString(hints.UserAgent):
+		return DeviceBot
+	case hints.Mobile || mobilePattern.MatchString(hints.UserAgent):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClassifyDevice(t *testing.T) {
+	for name, tc := range map[string]struct {
+		hints DeviceHints
+		want  DeviceClass
+	}{
+		"no hints":         {want: DeviceDesktop},
+		"desktop":          {hints: DeviceHints{UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36"}, want: DeviceDesktop},
+		"iphone":           {hints: DeviceHints{UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148 Safari/604.1"}, want: DeviceMobile},
+		"android phone":    {hints: DeviceHints{UserAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) Chrome/120.0 Mobile Safari/537.36"}, want: DeviceMobile},
+		"android tablet":   {hints: DeviceHints{UserAgent: "Mozilla/5.0 (Linux; Android 14; SM-X710) Chrome/120.0 Safari/537.36"}, want: DeviceDesktop},
+		"mobile hint":      {hints: DeviceHints{UserAgent: "Mozilla/5.0 (Linux; Android 10; K) Chrome/120.0 Safari/537.36", Mobile: true}, want: DeviceMobile},
+		"googlebot":        {hints: DeviceHints{UserAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"}, want: DeviceBot},
+		"mobile googlebot": {hints: DeviceHints{UserAgent: "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X) Chrome/120.0 Mobile Safari/537.36 (compatible; Googlebot/2.1)"}, want: DeviceBot},
+		"go client":        {hints: DeviceHints{UserAgent: "Go-http-client/1.1"}, want: DeviceDesktop},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := classifyDevice(tc.hints); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDeviceItems(t *testing.T) {
+	cfg := &FileConfig{
+		Items: []ItemConfig{{Provider: Provider1}, {Provider: Provider1}, {Provider: Provider1}},
+		DeviceItems: map[DeviceClass][]ItemConfig{
+			DeviceMobile: {{Provider: Provider2}},
+			DeviceBot:    {{Provider: Provider3}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: &mockContentProvider{source: Provider2},
+		Provider3: &mockContentProvider{source: Provider3},
+	}
+	service, err := NewServiceFromConfig(cfg, clients)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		userAgent  string
+		wantSource Provider
+	}{
+		"desktop": {userAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0", wantSource: Provider1},
+		"mobile":  {userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148", wantSource: Provider2},
+		"bot":     {userAgent: "Mozilla/5.0 (compatible; bingbot/2.0)", wantSource: Provider3},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?count=2", nil)
+			req.Header.Set("User-Agent", tc.userAgent)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			var items []*ContentItem
+			if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+
+			if len(items) != 2 {
+				t.Fatalf("got %d items, want 2", len(items))
+			}
+			for _, item := range items {
+				if item.Source != string(tc.wantSource) {
+					t.Errorf("got item from provider %s, want %s", item.Source, tc.wantSource)
+				}
+			}
+		})
+	}
+
+	if got := service.Config().DeviceItems[DeviceMobile]; len(got) != 1 || got[0].Provider != Provider2 {
+		t.Errorf("got mobile items %+v in the config, want the configured ones", got)
+	}
+}
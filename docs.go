@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// docSpec is the part of the OpenAPI document rendered in the documentation page.
+type docSpec struct {
+	Info struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]docOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*docSchema `json:"schemas"`
+	} `json:"components"`
+}
+
+type docOperation struct {
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description"`
+	Parameters  []docParameter         `json:"parameters"`
+	Responses   map[string]docResponse `json:"responses"`
+}
+
+type docParameter struct {
+	Name        string     `json:"name"`
+	In          string     `json:"in"`
+	Description string     `json:"description"`
+	Required    bool       `json:"required"`
+	Schema      *docSchema `json:"schema"`
+}
+
+type docResponse struct {
+	Description string         `json:"description"`
+	Content     map[string]any `json:"content"`
+}
+
+type docSchema struct {
+	Ref        string                `json:"$ref"`
+	Type       string                `json:"type"`
+	Format     string                `json:"format"`
+	Enum       []any                 `json:"enum"`
+	Default    any                   `json:"default"`
+	Minimum    *float64              `json:"minimum"`
+	Maximum    *float64              `json:"maximum"`
+	Pattern    string                `json:"pattern"`
+	Items      *docSchema            `json:"items"`
+	OneOf      []*docSchema          `json:"oneOf"`
+	Properties map[string]*docSchema `json:"properties"`
+	Required   []string              `json:"required"`
+}
+
+// typeName describes the schema in a few words, like "integer, 1 to 100" or "array of ItemView".
+func (s *docSchema) typeName() string {
+	if s == nil {
+		return ""
+	}
+	if s.Ref != "" {
+		return s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+	}
+	if len(s.OneOf) > 0 {
+		names := make([]string, len(s.OneOf))
+		for i, o := range s.OneOf {
+			names[i] = o.typeName()
+		}
+		return strings.Join(names, " or ")
+	}
+
+	name := s.Type
+	switch {
+	case s.Type == "array":
+		name = "array of " + s.Items.typeName()
+	case s.Format != "":
+		name += " (" + s.Format + ")"
+	}
+	var details []string
+	if len(s.Enum) > 0 {
+		values := make([]string, len(s.Enum))
+		for i, v := range s.Enum {
+			values[i] = fmt.Sprint(v)
+		}
+		details = append(details, "one of "+strings.Join(values, ", "))
+	}
+	switch {
+	case s.Minimum != nil && s.Maximum != nil:
+		details = append(details, fmt.Sprintf("%v to %v", *s.Minimum, *s.Maximum))
+	case s.Minimum != nil:
+		details = append(details, fmt.Sprintf("at least %v", *s.Minimum))
+	case s.Maximum != nil:
+		details = append(details, fmt.Sprintf("at most %v", *s.Maximum))
+	}
+	if s.Pattern != "" {
+		details = append(details, "matching "+s.Pattern)
+	}
+	if s.Default != nil {
+		details = append(details, fmt.Sprintf("default %v", s.Default))
+	}
+	if len(details) > 0 {
+		name += ", " + strings.Join(details, ", ")
+	}
+	return name
+}
+
+// ContentTypes returns the sorted media types of the response.
+func (r docResponse) ContentTypes() []string {
+	types := make([]string, 0, len(r.Content))
+	for t := range r.Content {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// renderDocs renders the OpenAPI document as an HTML page.
+func renderDocs(openAPI []byte) ([]byte, error) {
+	var spec docSpec
+	if err := json.Unmarshal(openAPI, &spec); err != nil {
+		return nil, fmt.Errorf("decoding the OpenAPI document: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := docsTemplate.Execute(&buf, spec); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GetDocs returns the API documentation, rendered from the OpenAPI document.
+func (h *Handler) GetDocs(w http.ResponseWriter, req *http.Request) {
+	h.docsOnce.Do(func() {
+		var err error
+		if h.docs, err = renderDocs(h.openAPIDocument()); err != nil {
+			h.docsErr = err
+		}
+	})
+	if h.docsErr != nil {
+		writeServerErr(w, req, h.docsErr)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(h.docs)
+}
+
+var docsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"typeName": (*docSchema).typeName,
+	"upper":    strings.ToUpper,
+	"anchor":   func(s string) string { return strings.NewReplacer("/", "-", "{", "", "}", "").Replace(s) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Info.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; line-height: 1.4; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.5em; text-align: left; vertical-align: top; }
+code { background: #f3f3f3; padding: 0 0.2em; }
+</style>
+</head>
+<body>
+<h1>{{.Info.Title}} <small>{{.Info.Version}}</small></h1>
+<p>The machine-readable document is at <a href="/openapi.json">/openapi.json</a>.</p>
+<ul>
+{{- range $path, $ops := .Paths}}{{range $method, $op := $ops}}
+<li><a href="#{{$method}}{{anchor $path}}"><code>{{upper $method}} {{$path}}</code></a> - {{$op.Summary}}</li>
+{{- end}}{{end}}
+</ul>
+{{range $path, $ops := .Paths}}{{range $method, $op := $ops}}
+<h2 id="{{$method}}{{anchor $path}}"><code>{{upper $method}} {{$path}}</code></h2>
+<p>{{$op.Summary}}. {{$op.Description}}</p>
+<h3>Parameters</h3>
+<table>
+<tr><th>Name</th><th>In</th><th>Type</th><th>Description</th></tr>
+{{- range $op.Parameters}}
+<tr><td><code>{{.Name}}</code>{{if .Required}} (required){{end}}</td><td>{{.In}}</td><td>{{typeName .Schema}}</td><td>{{.Description}}</td></tr>
+{{- end}}
+</table>
+<h3>Responses</h3>
+<table>
+<tr><th>Status</th><th>Description</th><th>Formats</th></tr>
+{{- range $status, $resp := $op.Responses}}
+<tr><td>{{$status}}</td><td>{{$resp.Description}}</td><td>{{range $i, $t := $resp.ContentTypes}}{{if $i}}, {{end}}<code>{{$t}}</code>{{end}}</td></tr>
+{{- end}}
+</table>
+{{end}}{{end}}
+<h2>Schemas</h2>
+{{range $name, $schema := .Components.Schemas}}
+<h3 id="schema-{{$name}}">{{$name}}</h3>
+<table>
+<tr><th>Field</th><th>Type</th></tr>
+{{- range $field, $fs := $schema.Properties}}
+<tr><td><code>{{$field}}</code></td><td>{{typeName $fs}}</td></tr>
+{{- end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
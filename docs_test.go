@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDocs(t *testing.T) {
+	srv := httptest.NewServer(&Handler{limits: RequestLimits{MaxCount: 50, MaxItems: 500}})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/docs")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("got content type %q, want HTML", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		"<code>GET /feeds/{name}</code>",
+		"<code>count</code> (required)</td><td>query</td><td>integer, 1 to 50</td>",
+		"<code>expiry_format</code>",
+		"one of rfc3339, unix",
+		"must not be greater than 500",
+		"<tr><td>429</td>",
+		"<code>application/x-ndjson</code>",
+		`<h3 id="schema-ItemView">ItemView</h3>`,
+		"<tr><td><code>media</code></td><td>array of string</td></tr>",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("the page doesn't contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrDraining is the error of the provider calls refused because the service is shutting down.
+var ErrDraining = errors.New("service is draining")
+
+// fetchGroup tracks the running provider calls, for draining. Unlike a sync.WaitGroup, calls can be added while
+// the drain waits: the calls started by the running ones (like a coalesced call) are waited for too,
+// while the new ones (the requests, prefetches and refreshes) are refused once the drain started.
+type fetchGroup struct {
+	m        sync.Mutex
+	running  int
+	draining bool
+	// idle is closed when no call is running anymore. It's created by the first waiter.
+	idle chan struct{}
+}
+
+// begin registers a new call, unless the service is draining.
+func (g *fetchGroup) begin() bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.draining {
+		return false
+	}
+	g.running++
+	return true
+}
+
+// add registers a call started by a running one. It's accepted while draining, so the running calls can finish.
+func (g *fetchGroup) add() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	g.running++
+}
+
+// done marks the end of a registered call.
+func (g *fetchGroup) done() {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	g.running--
+	if g.running == 0 && g.idle != nil {
+		close(g.idle)
+		g.idle = nil
+	}
+}
+
+// wait waits until no call is running, or the context is done.
+func (g *fetchGroup) wait(ctx context.Context) error {
+	g.m.Lock()
+	if g.running == 0 {
+		g.m.Unlock()
+		return nil
+	}
+	if g.idle == nil {
+		g.idle = make(chan struct{})
+	}
+	idle := g.idle
+	g.m.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain refuses the new calls, and waits until the running ones finish, or the context is done.
+func (g *fetchGroup) drain(ctx context.Context) error {
+	g.m.Lock()
+	g.draining = true
+	g.m.Unlock()
+
+	return g.wait(ctx)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFetchGroupDrain(t *testing.T) {
+	var g fetchGroup
+	if !g.begin() {
+		t.Fatal("got a call refused before the drain")
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- g.drain(context.Background()) }()
+	for !func() bool { g.m.Lock(); defer g.m.Unlock(); return g.draining }() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if g.begin() {
+		t.Error("got a new call accepted while draining")
+	}
+	// The running call starts another one, which is waited for too.
+	g.add()
+	g.done()
+	select {
+	case err := <-drained:
+		t.Fatalf("got the drain finished with %v while a call is running", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	g.done()
+	if err := <-drained; err != nil {
+		t.Errorf("got drain error %v", err)
+	}
+}
+
+func TestServiceRefusesCallsWhenDraining(t *testing.T) {
+	provider := &mockContentProvider{source: Provider1}
+	service, err := NewService([]ContentConfig{{Type: Provider1}}, map[Provider]Client{Provider1: provider}, defaultTimeout, WithCache(NewMemoryCache(0), CacheSettings{TTL: time.Minute}))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	if err := service.Drain(context.Background()); err != nil {
+		t.Fatalf("draining: %v", err)
+	}
+
+	result, err := service.GetContentResult(context.Background(), RequestMeta{}, 1, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if len(result.Items) != 0 || len(result.Failures) != 1 || result.Failures[0].Reason != "service draining" {
+		t.Errorf("got %d items and failures %+v, want the position failed with the draining reason", len(result.Items), result.Failures)
+	}
+	service.Prefetch(context.Background(), RequestMeta{}, 1, 1)
+	service.refreshProvider(context.Background(), Provider1, service.cached[Provider1])
+	if provider.calls != 0 {
+		t.Errorf("got %d provider calls after the drain, want none", provider.calls)
+	}
+}
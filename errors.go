@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// Error codes of the error responses. They're part of the API, so the clients can branch on them;
+// the messages are for humans and may change.
+const (
+	ErrorCodeInvalidParams    = "invalid_params"
+	ErrorCodeInvalidRequest   = "invalid_request"
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeForbidden        = "forbidden"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	ErrorCodeConflict         = "conflict"
+	ErrorCodeRequestTooLarge  = "request_too_large"
+	ErrorCodeUnsupportedMedia = "unsupported_media_type"
+	ErrorCodeRateLimited      = "rate_limited"
+	ErrorCodeOverloaded       = "overloaded"
+	ErrorCodeInternal         = "internal_error"
+	ErrorCodeNotImplemented   = "not_implemented"
+	ErrorCodeUpstream         = "upstream_error"
+	ErrorCodeTimeout          = "timeout"
+)
+
+// ErrorResponse is the body of all the error responses.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Details lists the invalid parameters of the invalid_params errors.
+	Details ValidationErrors `json:"details,omitempty"`
+	// RequestID is the X-Request-ID of the request, for matching the error with the logs.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeError writes the error response with the status, the code and the message.
+func writeError(w http.ResponseWriter, req *http.Request, status int, code, message string) {
+	writeErrorResponse(w, req, status, ErrorResponse{Code: code, Message: message})
+}
+
+func writeErrorResponse(w http.ResponseWriter, req *http.Request, status int, resp ErrorResponse) {
+	resp.RequestID = requestIDFromContext(req.Context())
+	h := w.Header()
+	// As with http.Error, a length set for the successful response doesn't apply to the error.
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.WarnContext(req.Context(), "encoding error response to http writer", "error", err)
+	}
+}
+
+// writeNotFound writes the not_found error response.
+func writeNotFound(w http.ResponseWriter, req *http.Request) {
+	writeError(w, req, http.StatusNotFound, ErrorCodeNotFound, "not found")
+}
+
+// writeMethodNotAllowed writes the method_not_allowed error response.
+func writeMethodNotAllowed(w http.ResponseWriter, req *http.Request) {
+	writeError(w, req, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
+}
+
+// writeServerErr writes the error response of a request that failed on the server side.
+// The timeouts and the provider failures get their own codes; the details of the other errors are only logged.
+func writeServerErr(w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		slog.WarnContext(req.Context(), "http request timed out", "error", err)
+		writeError(w, req, http.StatusGatewayTimeout, ErrorCodeTimeout, "the content couldn't be assembled in time")
+	case isUpstreamErr(err):
+		slog.WarnContext(req.Context(), "http request failed on the providers", "error", err)
+		writeError(w, req, http.StatusBadGateway, ErrorCodeUpstream, failureReason(err))
+	default:
+		// We don't want to uncover error details to the client...
+		writeError(w, req, http.StatusInternalServerError, ErrorCodeInternal, "internal server error")
+
+		// ... but we want to have all the details in the logs.
+		slog.ErrorContext(req.Context(), "http server error", "error", err)
+	}
+}
+
+// isUpstreamErr tells whether the error comes from the providers, rather than from the service itself.
+func isUpstreamErr(err error) bool {
+	for _, target := range []error{errNotEnoughItems, ErrProviderDisabled, ErrCircuitOpen, ErrProviderBusy, ErrProviderRateLimited, ErrInvalidItems} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorResponses(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(withRequestID(&Handler{service: service}))
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		method     string
+		path       string
+		wantStatus int
+		wantCode   string
+	}{
+		"invalid params":   {method: http.MethodGet, path: "/?count=0", wantStatus: http.StatusBadRequest, wantCode: ErrorCodeInvalidParams},
+		"unknown path":     {method: http.MethodGet, path: "/unknown", wantStatus: http.StatusNotFound, wantCode: ErrorCodeNotFound},
+		"unknown feed":     {method: http.MethodGet, path: "/feeds/unknown?count=1", wantStatus: http.StatusNotFound, wantCode: ErrorCodeNotFound},
+		"wrong method":     {method: http.MethodPost, path: "/", wantStatus: http.StatusNotFound, wantCode: ErrorCodeNotFound},
+		"graphql delete":   {method: http.MethodDelete, path: "/graphql", wantStatus: http.StatusMethodNotAllowed, wantCode: ErrorCodeMethodNotAllowed},
+		"feeds batch post": {method: http.MethodPost, path: "/feeds", wantStatus: http.StatusMethodNotAllowed, wantCode: ErrorCodeMethodNotAllowed},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, srv.URL+tc.path, nil)
+			req.Header.Set(requestIDHeader, "test-request")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("got content type %q", ct)
+			}
+			var body ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if body.Code != tc.wantCode || body.Message == "" || body.RequestID != "test-request" {
+				t.Errorf("got error %+v, want code %s with the request ID", body, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestWriteServerErr(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		"timeout": {
+			err:         fmt.Errorf("assembling: %w", context.DeadlineExceeded),
+			wantStatus:  http.StatusGatewayTimeout,
+			wantCode:    ErrorCodeTimeout,
+			wantMessage: "the content couldn't be assembled in time",
+		},
+		"provider unavailable": {
+			err:         fmt.Errorf("provider 1: %w", ErrCircuitOpen),
+			wantStatus:  http.StatusBadGateway,
+			wantCode:    ErrorCodeUpstream,
+			wantMessage: "provider unavailable",
+		},
+		"internal": {
+			err:         errors.New("secret details"),
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    ErrorCodeInternal,
+			wantMessage: "internal server error",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeServerErr(rec, httptest.NewRequest(http.MethodGet, "/", nil), tc.err)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tc.wantStatus)
+			}
+			var body ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			want := ErrorResponse{Code: tc.wantCode, Message: tc.wantMessage}
+			if body.Code != want.Code || body.Message != want.Message {
+				t.Errorf("got error %+v, want %+v", body, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// experimentUserHeader identifies the user for the experiment assignments. The user IP is used when it's not set.
+const experimentUserHeader = "X-User-ID"
+
+var experimentAssignments = newCounterVec(
+	"experiment_assignments_total",
+	"Number of requests assigned to an experiment variant by the service, by the experiment and variant.",
+	"experiment", "variant",
+)
+
+var (
+	// ErrUnknownExperiment is returned for the experiments that weren't created.
+	ErrUnknownExperiment = errors.New("unknown experiment")
+	// ErrInvalidExperiment is returned for the experiments that can't be created or updated as given.
+	ErrInvalidExperiment = errors.New("invalid experiment")
+)
+
+// ExperimentVariant is a variant of an experiment, with its share of the traffic.
+type ExperimentVariant struct {
+	Name string `json:"name"`
+	// Weight is the share of the users in the variant, relative to the other variants. Zero means 1.
+	Weight int `json:"weight,omitempty"`
+}
+
+// ExperimentSpec defines an experiment, as created and updated with the admin API.
+type ExperimentSpec struct {
+	Variants []ExperimentVariant `json:"variants"`
+	// Tenants are the clients (the principal names, like the API key names) in the experiment. Empty means all the clients.
+	Tenants []string `json:"tenants,omitempty"`
+	// ReshuffleEvery is the interval of the reshuffle points, counted from the start of the experiment.
+	// The updates take effect at the next point, so the users keep their variants until then. Zero applies them immediately.
+	ReshuffleEvery Duration `json:"reshuffle_every,omitempty"`
+}
+
+// Validate returns an error when the spec can't be used.
+func (s ExperimentSpec) Validate() error {
+	if len(s.Variants) == 0 {
+		return errors.New("at least one variant must be configured")
+	}
+	seen := make(map[string]bool, len(s.Variants))
+	for i, v := range s.Variants {
+		if v.Name == "" {
+			return fmt.Errorf("variant %d: name is empty", i)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("variant '%s' is repeated", v.Name)
+		}
+		seen[v.Name] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("variant '%s': weight must not be negative", v.Name)
+		}
+	}
+	if s.ReshuffleEvery < 0 {
+		return errors.New("reshuffle interval must not be negative")
+	}
+	return nil
+}
+
+// Experiment is the state of an experiment.
+type Experiment struct {
+	Name string `json:"name"`
+	ExperimentSpec
+	// Version is the assignment version. It changes when an update takes effect, and the users are reassigned with it.
+	Version int       `json:"version"`
+	Started time.Time `json:"started"`
+	Stopped bool      `json:"stopped,omitempty"`
+	// Pending is the update waiting for the next reshuffle point.
+	Pending *PendingExperimentUpdate `json:"pending,omitempty"`
+}
+
+// PendingExperimentUpdate is an update of a running experiment, and the reshuffle point it takes effect at.
+type PendingExperimentUpdate struct {
+	ExperimentSpec
+	EffectiveAt time.Time `json:"effective_at"`
+}
+
+// promote applies the pending update when its reshuffle point has passed.
+func (e *Experiment) promote(now time.Time) {
+	if e.Pending == nil || now.Before(e.Pending.EffectiveAt) {
+		return
+	}
+	e.ExperimentSpec = e.Pending.ExperimentSpec
+	e.Version++
+	e.Pending = nil
+}
+
+// nextReshuffle returns the first reshuffle point after now.
+func (e *Experiment) nextReshuffle(now time.Time) time.Time {
+	every := time.Duration(e.ReshuffleEvery)
+	return e.Started.Add((now.Sub(e.Started)/every + 1) * every)
+}
+
+// targets tells whether the client is in the experiment.
+func (e *Experiment) targets(tenant string) bool {
+	return len(e.Tenants) == 0 || slices.Contains(e.Tenants, tenant)
+}
+
+// variant returns the variant of the user. The users are spread by the weights, in the same way for the same version.
+func (e *Experiment) variant(user string) string {
+	total := 0
+	for _, v := range e.Variants {
+		total += max(v.Weight, 1)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(e.Name + "\x00" + strconv.Itoa(e.Version) + "\x00" + user))
+	bucket := int(h.Sum64() % uint64(total))
+	for _, v := range e.Variants {
+		if bucket -= max(v.Weight, 1); bucket < 0 {
+			return v.Name
+		}
+	}
+	return ""
+}
+
+// Experiments are the experiments managed at runtime with the admin API. The service assigns the users to their variants,
+// for the requests without a variant set by the experimentation layer in front of it.
+// The experiments are persisted in the file, if there is one, so they survive restarts and new replicas start with them.
+type Experiments struct {
+	m           sync.Mutex
+	experiments map[string]*Experiment
+	path        string
+	now         func() time.Time
+}
+
+// NewExperiments returns the experiments persisted in the file, or none when the file doesn't exist yet.
+// The changes are saved to the file; an empty path keeps the experiments in memory only.
+func NewExperiments(path string) (*Experiments, error) {
+	x := &Experiments{
+		experiments: make(map[string]*Experiment),
+		path:        path,
+		now:         time.Now,
+	}
+	if path == "" {
+		return x, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return x, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading experiments: %w", err)
+	}
+	var list []*Experiment
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parsing experiments '%s': %w", path, err)
+	}
+	for _, e := range list {
+		if !validFeedName(e.Name) || x.experiments[e.Name] != nil {
+			return nil, fmt.Errorf("experiments '%s': invalid or repeated name '%s'", path, e.Name)
+		}
+		if err := e.Validate(); err != nil {
+			return nil, fmt.Errorf("experiments '%s': experiment '%s': %w", path, e.Name, err)
+		}
+		x.experiments[e.Name] = e
+	}
+	slog.Info("restored experiments", "experiments", len(list), "path", path)
+
+	return x, nil
+}
+
+// List returns the experiments, sorted by the name.
+func (x *Experiments) List() []Experiment {
+	x.m.Lock()
+	defer x.m.Unlock()
+
+	now := x.now()
+	list := make([]Experiment, 0, len(x.experiments))
+	for _, name := range slices.Sorted(maps.Keys(x.experiments)) {
+		e := x.experiments[name]
+		e.promote(now)
+		list = append(list, *e)
+	}
+	return list
+}
+
+// Put creates the experiment, or updates it. The update of a running experiment with a reshuffle interval
+// takes effect at the next reshuffle point; until then, another update replaces the pending one.
+// A stopped experiment is started again, with new assignments.
+func (x *Experiments) Put(name string, spec ExperimentSpec) (Experiment, error) {
+	if !validFeedName(name) {
+		return Experiment{}, fmt.Errorf("%w '%s': the name must be non-empty and have only letters, digits, '-' and '_'", ErrInvalidExperiment, name)
+	}
+	if err := spec.Validate(); err != nil {
+		return Experiment{}, fmt.Errorf("%w '%s': %w", ErrInvalidExperiment, name, err)
+	}
+
+	x.m.Lock()
+	defer x.m.Unlock()
+
+	now := x.now()
+	e := &Experiment{}
+	prev, ok := x.experiments[name]
+	if ok {
+		*e = *prev
+	}
+	switch {
+	case !ok:
+		*e = Experiment{Name: name, ExperimentSpec: spec, Version: 1, Started: now}
+	case e.Stopped:
+		*e = Experiment{Name: name, ExperimentSpec: spec, Version: e.Version + 1, Started: now}
+	case e.ReshuffleEvery == 0:
+		// Without a reshuffle interval, the next point is now.
+		e.ExperimentSpec, e.Pending = spec, nil
+		e.Version++
+	default:
+		e.promote(now)
+		e.Pending = &PendingExperimentUpdate{ExperimentSpec: spec, EffectiveAt: e.nextReshuffle(now)}
+	}
+	if err := x.replace(e); err != nil {
+		return Experiment{}, err
+	}
+	return *e, nil
+}
+
+// Stop stops the experiment immediately: its users aren't assigned to the variants anymore, and a pending update is dropped.
+func (x *Experiments) Stop(name string) (Experiment, error) {
+	x.m.Lock()
+	defer x.m.Unlock()
+
+	prev, ok := x.experiments[name]
+	if !ok {
+		return Experiment{}, fmt.Errorf("%w '%s'", ErrUnknownExperiment, name)
+	}
+	e := *prev
+	e.Stopped, e.Pending = true, nil
+	if err := x.replace(&e); err != nil {
+		return Experiment{}, err
+	}
+	return e, nil
+}
+
+// replace stores the experiment and saves the experiments. When they can't be saved, the previous state is kept.
+func (x *Experiments) replace(e *Experiment) error {
+	prev, ok := x.experiments[e.Name]
+	x.experiments[e.Name] = e
+	if err := x.save(); err != nil {
+		if ok {
+			x.experiments[e.Name] = prev
+		} else {
+			delete(x.experiments, e.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// save writes the experiments to the file atomically, so a crash doesn't leave a partial file.
+func (x *Experiments) save() error {
+	if x.path == "" {
+		return nil
+	}
+
+	list := make([]*Experiment, 0, len(x.experiments))
+	for _, name := range slices.Sorted(maps.Keys(x.experiments)) {
+		list = append(list, x.experiments[name])
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding experiments: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(x.path), filepath.Base(x.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("saving experiments: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saving experiments: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("saving experiments: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), x.path); err != nil {
+		return fmt.Errorf("saving experiments: %w", err)
+	}
+
+	return nil
+}
+
+// assign returns the variants of the user of the client in the running experiments, as `experiment:variant` pairs
+// separated with commas, in the order of the experiment names. It's empty when the user isn't in any experiment.
+func (x *Experiments) assign(tenant, user string) string {
+	x.m.Lock()
+	defer x.m.Unlock()
+
+	now := x.now()
+	var variants []string
+	for _, name := range slices.Sorted(maps.Keys(x.experiments)) {
+		e := x.experiments[name]
+		e.promote(now)
+		if e.Stopped || !e.targets(tenant) {
+			continue
+		}
+		v := e.variant(user)
+		experimentAssignments.Inc(name, v)
+		variants = append(variants, name+":"+v)
+	}
+	return strings.Join(variants, ",")
+}
+
+// Wrap returns a handler setting the experiment variants of the requests without the X-Experiment-Variant header.
+// It must be wrapped by the authentication, when the experiments target the tenants. Bots aren't part of the experiments.
+func (x *Experiments) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(experimentVariantHeader) != "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		meta := requestMeta(req)
+		user := req.Header.Get(experimentUserHeader)
+		if user == "" {
+			user = meta.IP
+		}
+		if user != "" && meta.Device.Class != DeviceBot {
+			if v := x.assign(apiKeyNameFromContext(req.Context()), user); v != "" {
+				req = req.Clone(req.Context())
+				req.Header.Set(experimentVariantHeader, v)
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminExperiments(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "experiments.json")
+	experiments, err := NewExperiments(path)
+	if err != nil {
+		t.Fatalf("creating experiments: %v", err)
+	}
+	experiments.now = func() time.Time { return now }
+	h := NewAdminHandler(nil, nil)
+	h.experiments = experiments
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	do := func(method, path, body string) (int, Experiment) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		defer resp.Body.Close()
+		var e Experiment
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+		}
+		return resp.StatusCode, e
+	}
+	// users returns the variants of 100 users.
+	users := func() []string {
+		variants := make([]string, 100)
+		for i := range variants {
+			variants[i] = experiments.assign("", fmt.Sprintf("user-%d", i))
+		}
+		return variants
+	}
+
+	for name, tc := range map[string]struct {
+		path string
+		body string
+	}{
+		"no variants":    {path: "?name=mix", body: `{"variants": []}`},
+		"repeated":       {path: "?name=mix", body: `{"variants": [{"name": "a"}, {"name": "a"}]}`},
+		"invalid name":   {path: "?name=a/b", body: `{"variants": [{"name": "a"}]}`},
+		"unknown field":  {path: "?name=mix", body: `{"variants": [{"name": "a"}], "split": 5}`},
+		"negative":       {path: "?name=mix", body: `{"variants": [{"name": "a", "weight": -1}]}`},
+		"negative delay": {path: "?name=mix", body: `{"variants": [{"name": "a"}], "reshuffle_every": "-1h"}`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if status, _ := do(http.MethodPut, "/admin/experiments"+tc.path, tc.body); status != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", status, http.StatusBadRequest)
+			}
+		})
+	}
+
+	status, e := do(http.MethodPut, "/admin/experiments?name=mix", `{"variants": [{"name": "a"}, {"name": "b"}], "reshuffle_every": "24h"}`)
+	if status != http.StatusOK || e.Version != 1 || !e.Started.Equal(now) {
+		t.Fatalf("got status %d and experiment %+v, want the created experiment", status, e)
+	}
+	before := users()
+	if !strings.Contains(strings.Join(before, ""), "mix:a") || !strings.Contains(strings.Join(before, ""), "mix:b") {
+		t.Errorf("got variants %v, want both variants", before)
+	}
+
+	// The update waits for the reshuffle point, so the users keep their variants.
+	now = now.Add(30 * time.Hour)
+	_, e = do(http.MethodPut, "/admin/experiments?name=mix", `{"variants": [{"name": "a"}, {"name": "c", "weight": 3}], "reshuffle_every": "24h"}`)
+	if want := now.Add(18 * time.Hour); e.Version != 1 || e.Pending == nil || !e.Pending.EffectiveAt.Equal(want) {
+		t.Fatalf("got experiment %+v, want the update pending until %v", e, want)
+	}
+	if after := users(); strings.Join(after, " ") != strings.Join(before, " ") {
+		t.Errorf("got variants %v before the reshuffle point, want %v", after, before)
+	}
+	now = now.Add(18 * time.Hour)
+	if after := strings.Join(users(), " "); strings.Contains(after, "mix:b") || !strings.Contains(after, "mix:c") {
+		t.Errorf("got variants %s after the reshuffle point, want the updated ones", after)
+	}
+	var list []Experiment
+	resp, err := http.Get(srv.URL + "/admin/experiments")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil || len(list) != 1 || list[0].Version != 2 || list[0].Pending != nil {
+		t.Errorf("got experiments %+v (%v), want the updated one", list, err)
+	}
+
+	if status, _ := do(http.MethodPost, "/admin/experiments/stop?name=unknown", ""); status != http.StatusNotFound {
+		t.Errorf("got status %d for an unknown experiment, want %d", status, http.StatusNotFound)
+	}
+	if status, e := do(http.MethodPost, "/admin/experiments/stop?name=mix", ""); status != http.StatusOK || !e.Stopped {
+		t.Errorf("got status %d and experiment %+v, want it stopped", status, e)
+	}
+	if v := experiments.assign("", "user-1"); v != "" {
+		t.Errorf("got variant %q of a stopped experiment, want none", v)
+	}
+
+	// A restart restores the experiments.
+	restored, err := NewExperiments(path)
+	if err != nil {
+		t.Fatalf("restoring experiments: %v", err)
+	}
+	if got, want := restored.List(), experiments.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got restored experiments %+v, want %+v", got, want)
+	}
+}
+
+func TestExperimentsFile(t *testing.T) {
+	for name, tc := range map[string]struct {
+		data    string
+		wantErr bool
+	}{
+		"valid":         {data: `[{"name": "mix", "variants": [{"name": "a"}], "version": 1}]`},
+		"empty list":    {data: `[]`},
+		"invalid json":  {data: `{`, wantErr: true},
+		"invalid name":  {data: `[{"name": "a/b", "variants": [{"name": "a"}]}]`, wantErr: true},
+		"repeated name": {data: `[{"name": "mix", "variants": [{"name": "a"}]}, {"name": "mix", "variants": [{"name": "b"}]}]`, wantErr: true},
+		"invalid spec":  {data: `[{"name": "mix", "variants": []}]`, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "experiments.json")
+			if err := os.WriteFile(path, []byte(tc.data), 0o600); err != nil {
+				t.Fatalf("writing file: %v", err)
+			}
+			if _, err := NewExperiments(path); (err != nil) != tc.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	t.Run("not saved", func(t *testing.T) {
+		experiments, err := NewExperiments(filepath.Join(t.TempDir(), "missing", "experiments.json"))
+		if err != nil {
+			t.Fatalf("creating experiments: %v", err)
+		}
+		_, err = experiments.Put("mix", ExperimentSpec{Variants: []ExperimentVariant{{Name: "a"}}})
+		if err == nil || errors.Is(err, ErrInvalidExperiment) {
+			t.Errorf("got error %v, want a saving error", err)
+		}
+		if list := experiments.List(); len(list) != 0 {
+			t.Errorf("got experiments %+v, want none when they can't be saved", list)
+		}
+	})
+}
+
+func TestExperimentsWrap(t *testing.T) {
+	experiments, err := NewExperiments("")
+	if err != nil {
+		t.Fatalf("creating experiments: %v", err)
+	}
+	if _, err := experiments.Put("mix", ExperimentSpec{Variants: []ExperimentVariant{{Name: "a"}}}); err != nil {
+		t.Fatalf("creating an experiment: %v", err)
+	}
+	if _, err := experiments.Put("partners", ExperimentSpec{Variants: []ExperimentVariant{{Name: "b"}}, Tenants: []string{"partner"}}); err != nil {
+		t.Fatalf("creating an experiment: %v", err)
+	}
+	keys, err := NewAPIKeys([]APIKey{{Name: "partner", Key: "partner-key"}, {Name: "web", Key: "web-key"}}, 0, 0)
+	if err != nil {
+		t.Fatalf("creating API keys: %v", err)
+	}
+	handler := keys.Wrap(experiments.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(requestMeta(req).Variant))
+	})))
+
+	for name, tc := range map[string]struct {
+		key    string
+		header http.Header
+		want   string
+	}{
+		"all clients":    {key: "web-key", header: http.Header{"X-User-Id": {"1"}}, want: "mix:a"},
+		"tenant":         {key: "partner-key", header: http.Header{"X-User-Id": {"1"}}, want: "mix:a,partners:b"},
+		"by ip":          {key: "web-key", want: "mix:a"},
+		"variant header": {key: "partner-key", header: http.Header{"X-Experiment-Variant": {"control"}}, want: "control"},
+		"bot":            {key: "web-key", header: http.Header{"User-Agent": {"Googlebot/2.1"}}, want: ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			req.Header.Set(apiKeyHeader, tc.key)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tc.want {
+				t.Errorf("got variant %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
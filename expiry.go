@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// expiryBackfillAttempts is the maximum number of extra provider calls made to replace the expired items of one fetch.
+const expiryBackfillAttempts = 2
+
+var (
+	expiredItems = newCounterVec(
+		"expired_items_total",
+		"Number of expired provider items filtered out of the responses.",
+		"provider",
+	)
+	expiryBackfills = newCounterVec(
+		"expiry_backfill_calls_total",
+		"Number of extra provider calls made to replace expired items, by result (ok, error).",
+		"provider", "result",
+	)
+	expirySkew = newHistogramVec(
+		"provider_expiry_skew_seconds",
+		"How long before the fetch the provider items had expired, for the items already expired when fetched.",
+		[]float64{.1, .5, 1, 5, 10, 30, 60, 300, 3600},
+		"provider",
+	)
+)
+
+// filterExpired returns the items that haven't expired yet, or expired less than `skew` ago.
+// Items without an expiry never expire.
+func filterExpired(items []*ContentItem, now time.Time, skew time.Duration) []*ContentItem {
+	now = now.Add(-skew)
+	filtered := items[:0:0]
+	for _, item := range items {
+		if item.Expiry.IsZero() || item.Expiry.After(now) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return filtered
+}
+
+// observeExpirySkew records how long before `now` the expired items had expired, so the providers' clock skew
+// (and the tolerance it needs) can be seen.
+func observeExpirySkew(items []*ContentItem, p Provider, now time.Time) {
+	for _, item := range items {
+		if item != nil && !item.Expiry.IsZero() && item.Expiry.Before(now) {
+			expirySkew.Observe(now.Sub(item.Expiry).Seconds(), string(p))
+		}
+	}
+}
+
+// dropExpired filters out the expired items and asks the provider for more, until there are `count` fresh items
+// or the attempts run out. Items already collected aren't added again.
+// The items that expired within the provider's clock skew tolerance are kept.
+func (s *Service) dropExpired(ctx context.Context, client Client, p Provider, meta RequestMeta, count int, items []*ContentItem) []*ContentItem {
+	skew := s.expirySkews[p]
+	fresh := filterExpired(items, time.Now(), skew)
+	expiredItems.Add(float64(len(items)-len(fresh)), string(p))
+
+	for attempt := 0; len(fresh) < count && len(fresh) < len(items) && attempt < expiryBackfillAttempts; attempt++ {
+		more, err := client.GetContent(ctx, meta, count-len(fresh))
+		if err != nil {
+			slog.WarnContext(ctx, "backfilling expired items failed", "provider", p, "error", err)
+			expiryBackfills.Inc(string(p), "error")
+			break
+		}
+		expiryBackfills.Inc(string(p), "ok")
+
+		seen := make(map[string]bool, len(fresh))
+		for _, item := range fresh {
+			seen[item.ID] = true
+		}
+		moreFresh := filterExpired(more, time.Now(), skew)
+		expiredItems.Add(float64(len(more)-len(moreFresh)), string(p))
+		for _, item := range moreFresh {
+			if !seen[item.ID] && len(fresh) < count {
+				seen[item.ID] = true
+				fresh = append(fresh, item)
+			}
+		}
+	}
+
+	return fresh
+}
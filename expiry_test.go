@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// scriptedClient returns the responses in order, and then no items.
+type scriptedClient struct {
+	responses [][]*ContentItem
+	counts    []int
+}
+
+func (c *scriptedClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	c.counts = append(c.counts, count)
+	if len(c.responses) == 0 {
+		return nil, nil
+	}
+	items := c.responses[0]
+	c.responses = c.responses[1:]
+	return items, nil
+}
+
+func TestExpiredItemsFiltering(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	item := func(id string, expiry time.Time) *ContentItem {
+		return &ContentItem{ID: id, Source: string(Provider1), Expiry: expiry}
+	}
+
+	for name, tc := range map[string]struct {
+		responses  [][]*ContentItem
+		skew       time.Duration
+		wantIDs    []string
+		wantCounts []int
+	}{
+		"no expired items": {
+			responses:  [][]*ContentItem{{item("a", future), item("b", time.Time{}), item("c", future)}},
+			wantIDs:    []string{"a", "b", "c"},
+			wantCounts: []int{3},
+		},
+		"backfilled": {
+			responses: [][]*ContentItem{
+				{item("a", future), item("b", past), item("c", past)},
+				{item("a", future), item("d", future)},
+				{item("e", future)},
+			},
+			wantIDs:    []string{"a", "d", "e"},
+			wantCounts: []int{3, 2, 1},
+		},
+		"within the clock skew": {
+			responses:  [][]*ContentItem{{item("a", future), item("b", past), item("c", past.Add(-time.Hour))}, {item("d", future)}},
+			skew:       2 * time.Minute,
+			wantIDs:    []string{"a", "b", "d"},
+			wantCounts: []int{3, 1},
+		},
+		"attempts run out": {
+			responses: [][]*ContentItem{
+				{item("a", past), item("b", past), item("c", future)},
+				{item("d", past), item("e", past)},
+				{item("f", future), item("g", past)},
+				{item("h", future)},
+			},
+			wantIDs:    []string{"c", "f"},
+			wantCounts: []int{3, 2, 2},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := &scriptedClient{responses: tc.responses}
+			service, err := NewService([]ContentConfig{{Type: Provider1}}, map[Provider]Client{Provider1: client}, defaultTimeout,
+				WithExpiredItemsFiltering(), WithExpirySkews(map[Provider]time.Duration{Provider1: tc.skew}))
+			if err != nil {
+				t.Fatalf("creating a service: %v", err)
+			}
+
+			items, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 3, 0)
+			if err != nil {
+				t.Fatalf("getting content: %v", err)
+			}
+			var ids []string
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.wantIDs) {
+				t.Errorf("got items %v, want %v", ids, tc.wantIDs)
+			}
+			if !reflect.DeepEqual(client.counts, tc.wantCounts) {
+				t.Errorf("got provider calls for counts %v, want %v", client.counts, tc.wantCounts)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultExplainNetworks are the networks allowed to use the `explain` parameter by default.
+const defaultExplainNetworks = "127.0.0.0/8,::1/128"
+
+// ContentEnvelope is the content response wrapped with metadata, used when the plain list of items isn't enough.
+type ContentEnvelope struct {
+	Items   []*ItemView     `json:"items"`
+	Status  *ResponseStatus `json:"status,omitempty"`
+	Explain *Explanation    `json:"explain,omitempty"`
+	// Warnings list the deprecated features used by the request.
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+// ResponseStatus tells whether all requested items were returned, and why not.
+type ResponseStatus struct {
+	Complete bool              `json:"complete"`
+	Failures []PositionFailure `json:"failures,omitempty"`
+}
+
+// Explanation describes how a response was assembled.
+type Explanation struct {
+	// Plan lists, for every position (including the skipped `offset` ones), the configured and the actual provider.
+	Plan []PlanStep `json:"plan"`
+	// Fetches lists the provider calls, in order of completion.
+	Fetches []*ProviderFetch `json:"fetches"`
+}
+
+// PlanStep describes one position of the response.
+type PlanStep struct {
+	Position int      `json:"position"`
+	Provider Provider `json:"provider"`
+	Fallback Provider `json:"fallback,omitempty"`
+	// ServedBy is the provider the item came from. It's empty when there is no item for the position.
+	ServedBy Provider `json:"served_by,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// ProviderFetch describes one provider call.
+type ProviderFetch struct {
+	Provider   Provider `json:"provider"`
+	Fallback   bool     `json:"fallback"`
+	Count      int      `json:"count"`
+	Items      int      `json:"items"`
+	DurationMS float64  `json:"duration_ms"`
+	// Cache is "hit" or "miss" when the provider responses are cached.
+	Cache string `json:"cache,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// explainRecorder collects the explanation of a request. A nil recorder records nothing.
+type explainRecorder struct {
+	explanation Explanation
+	m           sync.Mutex
+}
+
+type explainKey struct{}
+
+type fetchKey struct{}
+
+// withExplain returns a context collecting the explanation of the request.
+func withExplain(ctx context.Context) (context.Context, *explainRecorder) {
+	rec := &explainRecorder{explanation: Explanation{Plan: []PlanStep{}, Fetches: []*ProviderFetch{}}}
+	return context.WithValue(ctx, explainKey{}, rec), rec
+}
+
+func explainFromContext(ctx context.Context) *explainRecorder {
+	rec, _ := ctx.Value(explainKey{}).(*explainRecorder)
+	return rec
+}
+
+// Explanation returns the collected explanation.
+func (r *explainRecorder) Explanation() *Explanation {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	e := r.explanation
+	return &e
+}
+
+// startFetch records a provider call. The returned function completes the record.
+// The record is stored in the returned context, so the client decorators can add details to it.
+func (r *explainRecorder) startFetch(ctx context.Context, p Provider, count int, fallback bool) (context.Context, func(items int, err error)) {
+	if r == nil {
+		return ctx, func(int, error) {}
+	}
+
+	start := time.Now()
+	fetch := &ProviderFetch{Provider: p, Fallback: fallback, Count: count}
+	return context.WithValue(ctx, fetchKey{}, fetch), func(items int, err error) {
+		r.m.Lock()
+		defer r.m.Unlock()
+
+		fetch.Items = items
+		fetch.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+		if err != nil {
+			fetch.Error = err.Error()
+		}
+		r.explanation.Fetches = append(r.explanation.Fetches, fetch)
+	}
+}
+
+// setPlan records the configs used for the positions and their responses.
+func (r *explainRecorder) setPlan(configs []ContentConfig, responses []*configResponse) {
+	if r == nil {
+		return
+	}
+
+	plan := make([]PlanStep, len(configs))
+	for i, cfg := range configs {
+		plan[i] = PlanStep{Position: i, Provider: cfg.Type}
+		if cfg.Fallback != nil {
+			plan[i].Fallback = *cfg.Fallback
+		}
+		if resp := responses[i]; resp.err != nil {
+			plan[i].Error = resp.err.Error()
+		} else {
+			plan[i].ServedBy = resp.provider
+		}
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.explanation.Plan = plan
+}
+
+// recordCacheResult marks the current provider fetch as served from the cache, or not.
+func recordCacheResult(ctx context.Context, result string) {
+	if fetch, ok := ctx.Value(fetchKey{}).(*ProviderFetch); ok {
+		fetch.Cache = result
+	}
+}
+
+// ipNetworks is a list of IP networks, settable with a comma-separated list of CIDRs.
+type ipNetworks []*net.IPNet
+
+// String implements flag.Value.
+func (n *ipNetworks) String() string {
+	s := make([]string, len(*n))
+	for i, ipNet := range *n {
+		s[i] = ipNet.String()
+	}
+	return strings.Join(s, ",")
+}
+
+// Set implements flag.Value.
+func (n *ipNetworks) Set(s string) error {
+	var networks ipNetworks
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return fmt.Errorf("invalid network '%s': %w", v, err)
+		}
+		networks = append(networks, ipNet)
+	}
+	*n = networks
+
+	return nil
+}
+
+// contains checks if the IP belongs to any of the networks.
+func (n ipNetworks) contains(ip net.IP) bool {
+	for _, ipNet := range n {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInternalRequest checks if the request comes directly (not through a proxy header) from one of the networks.
+func isInternalRequest(req *http.Request, networks ipNetworks) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && networks.contains(ip)
+}
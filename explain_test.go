@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExplain(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1, shouldFail: true},
+		Provider2: &mockContentProvider{source: Provider2},
+	}
+	configs := []ContentConfig{{Type: Provider1, Fallback: &Provider2}, {Type: Provider2}}
+	service, err := NewService(configs, clients, defaultTimeout, WithCache(NewMemoryCache(0), CacheSettings{TTL: time.Minute}))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	var localhost ipNetworks
+	_ = localhost.Set(defaultExplainNetworks)
+	srv := httptest.NewServer(&Handler{service: service, explainNetworks: localhost})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/?count=2&explain=true")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var envelope ContentEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(envelope.Items) != 2 || envelope.Explain == nil {
+		t.Fatalf("got %d items and explanation %v, want 2 items with an explanation", len(envelope.Items), envelope.Explain)
+	}
+
+	plan := envelope.Explain.Plan
+	if len(plan) != 2 || plan[0].Provider != Provider1 || plan[0].ServedBy != Provider2 || plan[1].ServedBy != Provider2 {
+		t.Errorf("got plan %+v, want the first position served by the fallback", plan)
+	}
+	// The fallback fetch has the same count as the first provider 2 fetch, so it's served from the cache.
+	var fallbackHits, misses int
+	for _, f := range envelope.Explain.Fetches {
+		switch {
+		case f.Fallback && f.Cache == "hit":
+			fallbackHits++
+		case !f.Fallback && f.Cache == "miss":
+			misses++
+		}
+	}
+	if len(envelope.Explain.Fetches) != 3 || fallbackHits != 1 || misses != 2 {
+		t.Errorf("got %d fetches (%d fallback cache hits, %d misses), want 3 (1 fallback cache hit, 2 misses)", len(envelope.Explain.Fetches), fallbackHits, misses)
+	}
+}
+
+func TestExplainValidation(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	var localhost, other ipNetworks
+	_ = localhost.Set(defaultExplainNetworks)
+	_ = other.Set("10.0.0.0/8")
+
+	for name, tc := range map[string]struct {
+		networks   ipNetworks
+		query      string
+		wantStatus int
+	}{
+		"internal client":   {networks: localhost, query: "explain=true", wantStatus: http.StatusOK},
+		"external client":   {networks: other, query: "explain=true", wantStatus: http.StatusBadRequest},
+		"disabled explain":  {networks: other, query: "explain=false", wantStatus: http.StatusOK},
+		"invalid value":     {networks: localhost, query: "explain=maybe", wantStatus: http.StatusBadRequest},
+		"with since_etag":   {networks: localhost, query: "explain=1&since_etag=abc", wantStatus: http.StatusBadRequest},
+		"no networks given": {query: "explain=true", wantStatus: http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(&Handler{service: service, explainNetworks: tc.networks})
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/?count=1&" + tc.query)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+}
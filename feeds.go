@@ -0,0 +1,219 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxBatchFeeds is the maximum number of feeds in one batch request.
+	maxBatchFeeds = 10
+	// maxDedupFetches is the number of service calls for one feed of a deduplicated batch, when its items are in the other feeds.
+	maxDedupFetches = 3
+)
+
+// FeedBatch is the response of a batch of feeds, in the requested order.
+type FeedBatch struct {
+	Feeds []FeedPage `json:"feeds"`
+}
+
+// FeedPage is the first page of a feed in a batch.
+type FeedPage struct {
+	Name  string      `json:"name"`
+	Items []*ItemView `json:"items"`
+}
+
+type feedKey struct{}
+
+// withFeed returns the context of a request for the items of the named feed.
+func withFeed(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, feedKey{}, name)
+}
+
+// feedFromContext returns the name of the feed the request is for, or "" for the default items.
+func feedFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(feedKey{}).(string)
+	return name
+}
+
+// validFeedName tells whether the name can be a feed name, a single URL path segment of letters, digits, '-' and '_'.
+func validFeedName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// HasFeed tells whether the named feed is configured.
+func (s *Service) HasFeed(name string) bool {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	_, ok := s.feedSequences[name]
+	return ok
+}
+
+// Feeds returns the names of the configured feeds, sorted.
+func (s *Service) Feeds() []string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return slices.Sorted(maps.Keys(s.feedSequences))
+}
+
+// FeedPriority returns the priority of the feed in the deduplicated batches.
+func (s *Service) FeedPriority(name string) int {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return s.feedPriorities[name]
+}
+
+// routeFeeds handles the "GET /feeds" and "GET /feeds/{name}" requests. It returns false for the other paths.
+func (h *Handler) routeFeeds(w http.ResponseWriter, req *http.Request) bool {
+	if req.URL.Path == "/feeds" {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeMethodNotAllowed(w, req)
+			return true
+		}
+		h.GetFeedBatch(w, req)
+		return true
+	}
+	name, ok := strings.CutPrefix(req.URL.Path, "/feeds/")
+	if !ok || !validFeedName(name) {
+		return false
+	}
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeMethodNotAllowed(w, req)
+		return true
+	}
+	h.GetFeed(w, req, name)
+	return true
+}
+
+// GetFeed returns the content items of the named feed. It takes the same parameters as GetContent.
+func (h *Handler) GetFeed(w http.ResponseWriter, req *http.Request, name string) {
+	if !h.service.HasFeed(name) {
+		writeNotFound(w, req)
+		return
+	}
+	h.GetContent(w, req.WithContext(withFeed(req.Context(), name)))
+}
+
+// GetFeedBatch handles GET /feeds?names=home,sports&count=N. It returns the first `count` items of each of the feeds,
+// for rendering them on one screen. With `dedup=true`, an item is shown only once: the feed with the highest priority
+// (the feed_priorities config, then the order in `names`) keeps it, and the other feeds get their next items instead.
+// The `expiry_format`, `tz` and `checksum` parameters work like for GET /.
+func (h *Handler) GetFeedBatch(w http.ResponseWriter, req *http.Request) {
+	var errs ValidationErrors
+	count, err := h.getIntParam("count", true, false, req)
+	if err != nil {
+		errs = append(errs, ParamError{Param: "count", Message: err.Error()})
+	}
+	errs = append(errs, h.limits.check(count, 0)...)
+	query := req.URL.Query()
+	var names []string
+	if v := query.Get("names"); v != "" {
+		names = strings.Split(v, ",")
+	}
+	switch {
+	case len(names) == 0:
+		errs = append(errs, ParamError{Param: "names", Message: "is required"})
+	case len(names) > maxBatchFeeds:
+		errs = append(errs, ParamError{Param: "names", Message: "must have at most " + strconv.Itoa(maxBatchFeeds) + " feeds"})
+	}
+	for i, name := range names {
+		switch {
+		case !h.service.HasFeed(name):
+			errs = append(errs, ParamError{Param: "names", Message: "unknown feed '" + name + "'"})
+		case slices.Contains(names[:i], name):
+			errs = append(errs, ParamError{Param: "names", Message: "feed '" + name + "' is given twice"})
+		}
+	}
+	var dedup bool
+	if v := query.Get("dedup"); v != "" {
+		if dedup, err = strconv.ParseBool(v); err != nil {
+			errs = append(errs, ParamError{Param: "dedup", Message: "must be a boolean"})
+		}
+	}
+	render, renderErrs := parseRenderOptions(query.Get("expiry_format"), query.Get("tz"))
+	render.policy = fieldPolicyFromContext(req.Context())
+	errs = append(errs, renderErrs...)
+	if v := query.Get("checksum"); v != "" {
+		if render.checksum, err = strconv.ParseBool(v); err != nil {
+			errs = append(errs, ParamError{Param: "checksum", Message: "must be a boolean"})
+		}
+	}
+	if len(errs) > 0 {
+		h.handleValidationErr(w, req, errs)
+		return
+	}
+
+	// The feeds are filled in the priority order, so the feeds filled first keep the shared items.
+	order := make([]int, len(names))
+	for i := range order {
+		order[i] = i
+	}
+	if dedup {
+		slices.SortStableFunc(order, func(a, b int) int {
+			return cmp.Compare(h.service.FeedPriority(names[b]), h.service.FeedPriority(names[a]))
+		})
+	}
+
+	ctx := withEndpoint(req.Context(), EndpointContent)
+	meta := requestMeta(req)
+	batch := &FeedBatch{Feeds: make([]FeedPage, len(names))}
+	seen := make(map[string]bool)
+	for _, i := range order {
+		page := FeedPage{Name: names[i], Items: []*ItemView{}}
+		feedCtx := withFeed(ctx, names[i])
+		offset := 0
+		for range maxDedupFetches {
+			n := count - len(page.Items)
+			if h.limits.MaxItems > 0 && offset+n > h.limits.MaxItems {
+				n = h.limits.MaxItems - offset
+			}
+			if n <= 0 {
+				break
+			}
+
+			release, err := h.memory.acquire(n, offset)
+			if err != nil {
+				writeMemoryErr(w, req, err)
+				return
+			}
+			result, err := h.service.GetContentResult(feedCtx, meta, n, offset)
+			release()
+			if err != nil {
+				writeServerErr(w, req, err)
+				return
+			}
+			offset += len(result.Items)
+			for _, item := range result.Items {
+				if dedup && seen[item.ID] {
+					continue
+				}
+				seen[item.ID] = true
+				page.Items = append(page.Items, render.renderItem(item))
+			}
+			if !dedup || len(result.Items) < n || len(page.Items) == count {
+				break
+			}
+		}
+		batch.Feeds[i] = page
+	}
+
+	h.writeJSON(w, req, batch)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFeeds(t *testing.T) {
+	cfg := &FileConfig{
+		Items: []ItemConfig{{Provider: Provider1}},
+		Feeds: map[string][]ItemConfig{
+			"sports":   {{Provider: Provider2}, {Provider: Provider3, Fallback: Provider2}},
+			"breaking": {{Provider: Provider3}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validating config: %v", err)
+	}
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: &mockContentProvider{source: Provider2},
+		Provider3: &mockContentProvider{source: Provider3},
+	}
+	service, err := NewServiceFromConfig(cfg, clients)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	if got := strings.Join(service.Feeds(), ","); got != "breaking,sports" {
+		t.Errorf("got feeds %s, want breaking,sports", got)
+	}
+	if got := len(service.Config().Feeds); got != 2 {
+		t.Errorf("got %d feeds in the active config, want 2", got)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		method      string
+		path        string
+		wantStatus  int
+		wantSources string
+	}{
+		"default items":     {path: "/?count=3", wantStatus: http.StatusOK, wantSources: "1,1,1"},
+		"feed":              {path: "/feeds/sports?count=3", wantStatus: http.StatusOK, wantSources: "2,3,2"},
+		"selected provider": {path: "/feeds/sports?count=2&exclude=2", wantStatus: http.StatusOK, wantSources: "3,3"},
+		"another feed":      {path: "/feeds/breaking?count=2", wantStatus: http.StatusOK, wantSources: "3,3"},
+		"unknown feed":      {path: "/feeds/home?count=2", wantStatus: http.StatusNotFound},
+		"invalid name":      {path: "/feeds/sports/top?count=2", wantStatus: http.StatusNotFound},
+		"invalid params":    {path: "/feeds/sports?count=0", wantStatus: http.StatusBadRequest},
+		"post":              {method: http.MethodPost, path: "/feeds/sports?count=2", wantStatus: http.StatusMethodNotAllowed},
+	} {
+		t.Run(name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, err := http.NewRequest(method, srv.URL+tc.path, nil)
+			if err != nil {
+				t.Fatalf("creating request: %v", err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var items []ContentItem
+			if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			sources := make([]string, len(items))
+			for i, item := range items {
+				sources[i] = item.Source
+			}
+			if got := strings.Join(sources, ","); got != tc.wantSources {
+				t.Errorf("got sources %s, want %s", got, tc.wantSources)
+			}
+		})
+	}
+}
+
+// listClient always returns the first items of the same list, with the IDs "<prefix>0", "<prefix>1" and so on.
+type listClient struct {
+	prefix string
+}
+
+func (c *listClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	items := make([]*ContentItem, count)
+	for i := range items {
+		items[i] = &ContentItem{ID: fmt.Sprintf("%s%d", c.prefix, i), Title: "test title"}
+	}
+	return items, nil
+}
+
+func TestFeedBatch(t *testing.T) {
+	cfg := &FileConfig{
+		Items: []ItemConfig{{Provider: Provider1}},
+		Feeds: map[string][]ItemConfig{
+			"home":     {{Provider: Provider1}, {Provider: Provider2}},
+			"breaking": {{Provider: Provider1}},
+			"sports":   {{Provider: Provider3}},
+		},
+		FeedPriorities: map[string]int{"breaking": 10},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("validating config: %v", err)
+	}
+	clients := map[Provider]Client{
+		Provider1: &listClient{prefix: "a"},
+		Provider2: &listClient{prefix: "b"},
+		Provider3: &listClient{prefix: "c"},
+	}
+	service, err := NewServiceFromConfig(cfg, clients)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service, limits: RequestLimits{MaxItems: 6}})
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		query      string
+		wantStatus int
+		wantFeeds  string
+	}{
+		"without dedup": {
+			query:      "names=home,breaking&count=4",
+			wantStatus: http.StatusOK,
+			wantFeeds:  "home:a0,b0,a1,b1 breaking:a0,a1,a2,a3",
+		},
+		"priority keeps the items": {
+			query:      "names=home,breaking&count=4&dedup=true",
+			wantStatus: http.StatusOK,
+			wantFeeds:  "home:b0,b1,b2 breaking:a0,a1,a2,a3",
+		},
+		"request order keeps the items": {
+			query:      "names=sports,home&count=2&dedup=true",
+			wantStatus: http.StatusOK,
+			wantFeeds:  "sports:c0,c1 home:a0,b0",
+		},
+		"limited by max items": {
+			query:      "names=breaking,home&count=6&dedup=true",
+			wantStatus: http.StatusOK,
+			wantFeeds:  "breaking:a0,a1,a2,a3,a4,a5 home:b0,b1,b2",
+		},
+		"no names":       {query: "count=2", wantStatus: http.StatusBadRequest},
+		"unknown feed":   {query: "names=home,news&count=2", wantStatus: http.StatusBadRequest},
+		"repeated feed":  {query: "names=home,home&count=2", wantStatus: http.StatusBadRequest},
+		"invalid dedup":  {query: "names=home&count=2&dedup=yes", wantStatus: http.StatusBadRequest},
+		"too many items": {query: "names=home&count=7", wantStatus: http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/feeds?" + tc.query)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var batch FeedBatch
+			if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			var feeds []string
+			for _, f := range batch.Feeds {
+				ids := make([]string, len(f.Items))
+				for i, item := range f.Items {
+					ids[i] = item.ID
+				}
+				feeds = append(feeds, f.Name+":"+strings.Join(ids, ","))
+			}
+			if got := strings.Join(feeds, " "); got != tc.wantFeeds {
+				t.Errorf("got feeds %s, want %s", got, tc.wantFeeds)
+			}
+		})
+	}
+}
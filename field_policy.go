@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// hideableFields are the item fields a field policy can hide. The ID and the title are always sent.
+// Hiding the source hides the other provider metadata too: the providers of the failed positions, the explanations,
+// and the provider selection, which would tell the items' providers apart.
+var hideableFields = []string{"source", "summary", "link", "media", "expiry", "checksum"}
+
+// FieldPolicy is the set of the item fields hidden from a client, in every output format.
+type FieldPolicy map[string]bool
+
+// hides tells whether the field is hidden. A nil policy hides nothing.
+func (p FieldPolicy) hides(field string) bool {
+	return p[field]
+}
+
+// redact returns the item without the hidden fields. The item is returned as is when nothing is hidden.
+func (p FieldPolicy) redact(item *ContentItem) *ContentItem {
+	if len(p) == 0 {
+		return item
+	}
+	c := *item
+	if p.hides("source") {
+		c.Source = ""
+	}
+	if p.hides("summary") {
+		c.Summary = ""
+	}
+	if p.hides("link") {
+		c.Link = ""
+	}
+	if p.hides("media") {
+		c.Media = nil
+	}
+	if p.hides("expiry") {
+		c.Expiry = time.Time{}
+	}
+	return &c
+}
+
+// FieldPolicies are the field policies of the clients, by the principal name (e.g. the API key name).
+type FieldPolicies map[string]FieldPolicy
+
+// LoadFieldPolicies reads the policies from a JSON file, an object with the lists of the hidden fields by the principal name,
+// like `{"partner": ["source", "checksum"]}`.
+func LoadFieldPolicies(path string) (FieldPolicies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading field policies: %w", err)
+	}
+	var lists map[string][]string
+	if err := json.Unmarshal(data, &lists); err != nil {
+		return nil, fmt.Errorf("decoding field policies: %w", err)
+	}
+
+	return NewFieldPolicies(lists)
+}
+
+// NewFieldPolicies returns the policies hiding the listed fields from the clients.
+func NewFieldPolicies(hidden map[string][]string) (FieldPolicies, error) {
+	policies := make(FieldPolicies, len(hidden))
+	for name, fields := range hidden {
+		policy := make(FieldPolicy, len(fields))
+		for _, f := range fields {
+			if !slices.Contains(hideableFields, f) {
+				return nil, fmt.Errorf("client '%s': field '%s' can't be hidden, must be one of: %s", name, f, strings.Join(hideableFields, ", "))
+			}
+			policy[f] = true
+		}
+		policies[name] = policy
+	}
+
+	return policies, nil
+}
+
+// Wrap returns a handler with the policy of the authenticated client in the request context.
+// It must be wrapped by the authentication, which sets the client.
+func (p FieldPolicies) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if policy, ok := p[apiKeyNameFromContext(req.Context())]; ok && len(policy) > 0 {
+			req = req.WithContext(withFieldPolicy(req.Context(), policy))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+type fieldPolicyKey struct{}
+
+func withFieldPolicy(ctx context.Context, p FieldPolicy) context.Context {
+	return context.WithValue(ctx, fieldPolicyKey{}, p)
+}
+
+// fieldPolicyFromContext returns the request's field policy, or nil when nothing is hidden.
+func fieldPolicyFromContext(ctx context.Context) FieldPolicy {
+	p, _ := ctx.Value(fieldPolicyKey{}).(FieldPolicy)
+	return p
+}
+
+// checkSourcesAllowed rejects the provider selection for the clients the sources are hidden from.
+func checkSourcesAllowed(ctx context.Context, param string, selected bool) ValidationErrors {
+	if selected && fieldPolicyFromContext(ctx).hides("source") {
+		return ValidationErrors{{Param: param, Message: "isn't available to this client"}}
+	}
+	return nil
+}
+
+// redactFailures returns the failed positions without their providers, when the sources are hidden.
+func redactFailures(failures []PositionFailure, p FieldPolicy) []PositionFailure {
+	if !p.hides("source") {
+		return failures
+	}
+	redacted := make([]PositionFailure, len(failures))
+	for i, f := range failures {
+		f.Provider = ""
+		redacted[i] = f
+	}
+	return redacted
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secretsClient returns the items with all the fields set to values containing "secret".
+type secretsClient struct{}
+
+func (secretsClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	items := make([]*ContentItem, count)
+	for i := range items {
+		items[i] = &ContentItem{
+			ID:      testIDs.NewID(),
+			Title:   "title",
+			Source:  "secret-source",
+			Summary: "secret summary",
+			Link:    "https://secret.example.com/item",
+			Media:   []string{"https://secret.example.com/image.jpg"},
+			Expiry:  time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+	}
+	return items, nil
+}
+
+func TestFieldPolicies(t *testing.T) {
+	secretProvider, failingProvider := Provider("secret-provider"), Provider("secret-failing")
+	clients := map[Provider]Client{
+		secretProvider:  secretsClient{},
+		failingProvider: &mockContentProvider{source: failingProvider, shouldFail: true},
+	}
+	service, err := NewService([]ContentConfig{{Type: secretProvider}, {Type: failingProvider}}, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	keys, err := NewAPIKeys([]APIKey{{Name: "partner", Key: "partner-key"}, {Name: "web", Key: "web-key"}}, 0, 0)
+	if err != nil {
+		t.Fatalf("creating API keys: %v", err)
+	}
+	policies, err := NewFieldPolicies(map[string][]string{"partner": hideableFields})
+	if err != nil {
+		t.Fatalf("creating field policies: %v", err)
+	}
+	var localhost ipNetworks
+	_ = localhost.Set(defaultExplainNetworks)
+	handler := &Handler{service: service, deltas: newDeltaStore(10, time.Minute), explainNetworks: localhost, mediaHints: MediaHintsEarly}
+	srv := httptest.NewServer(keys.Wrap(policies.Wrap(handler)))
+	defer srv.Close()
+	grpcHandler := keys.Wrap(policies.Wrap(&GRPCHandler{service: service}))
+	// The freshness report lists the providers after their first calls, whatever case runs first.
+	if _, err := service.GetContentResult(context.Background(), RequestMeta{}, 2, 0); err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		method string
+		path   string
+		header http.Header
+		body   string
+	}{
+		"json":     {path: "/?count=1&checksum=true"},
+		"xml":      {path: "/?count=1&checksum=true", header: http.Header{"Accept": {"application/xml"}}},
+		"msgpack":  {path: "/?count=1&checksum=true", header: http.Header{"Accept": {"application/msgpack"}}},
+		"unix":     {path: "/?count=1&expiry_format=unix"},
+		"ndjson":   {path: "/?count=1&stream=true&checksum=true"},
+		"partial":  {path: "/?count=2&partial=true&checksum=true"},
+		"delta":    {path: "/?count=1&since_etag=unknown&checksum=true"},
+		"graphql":  {method: http.MethodPost, path: "/graphql", body: `{"query": "{ content(count: 1) { id title source summary link media expiry checksum } }"}`},
+		"grpc":     {method: http.MethodPost, path: grpcGetContentPath},
+		"explain":  {path: "/?count=1&explain=true"},
+		"selected": {path: "/?count=1&providers=secret-provider"},
+		"gql sources": {
+			method: http.MethodPost, path: "/graphql", body: `{"query": "{ content(count: 1, sources: [\"secret-provider\"]) { id source } }"}`,
+		},
+		"freshness": {path: "/providers/freshness"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// request returns the status, the body, and the media hints of the response.
+			request := func(key string) (int, []byte, string) {
+				if tc.method == "" {
+					tc.method = http.MethodGet
+				}
+				if name == "grpc" {
+					var body bytes.Buffer
+					_ = writeGRPCMessage(&body, (&GRPCContentRequest{Count: 1}).Marshal())
+					req := httptest.NewRequest(tc.method, tc.path, &body)
+					req.ProtoMajor = 2
+					req.Header.Set("Content-Type", "application/grpc")
+					req.Header.Set(apiKeyHeader, key)
+					w := httptest.NewRecorder()
+					grpcHandler.ServeHTTP(w, req)
+					return w.Code, w.Body.Bytes(), ""
+				}
+
+				req, _ := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+				for k, v := range tc.header {
+					req.Header[k] = v
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set(apiKeyHeader, key)
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatalf("request: %v", err)
+				}
+				defer resp.Body.Close()
+				var body bytes.Buffer
+				_, _ = body.ReadFrom(resp.Body)
+				return resp.StatusCode, body.Bytes(), strings.Join(resp.Header.Values("Link"), ", ")
+			}
+
+			// The client without a policy gets the fields, so the check below finds them when they leak.
+			if _, body, _ := request("web-key"); !bytes.Contains(body, []byte("secret")) {
+				t.Fatalf("got no hidden fields without a policy: %s", body)
+			}
+
+			status, body, hints := request("partner-key")
+			if hints != "" {
+				t.Errorf("got media hints %s", hints)
+			}
+			// The GraphQL response has the selected fields, with empty values.
+			for _, leak := range []string{"secret", "2031", "1924992000", "checksum"} {
+				if bytes.Contains(body, []byte(leak)) && !(name == "graphql" && leak == "checksum") {
+					t.Errorf("got %q in the response with status %d: %s", leak, status, body)
+				}
+			}
+			if status >= http.StatusInternalServerError {
+				t.Errorf("got status %d: %s", status, body)
+			}
+			if name == "json" {
+				var items []map[string]any
+				if err := json.Unmarshal(body, &items); err != nil || len(items) != 1 || items[0]["title"] != "title" {
+					t.Errorf("got items %s, want one item with the visible fields", body)
+				}
+			}
+		})
+	}
+}
+
+func TestNewFieldPolicies(t *testing.T) {
+	if _, err := NewFieldPolicies(map[string][]string{"partner": {"source", "media"}}); err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	for _, field := range []string{"id", "title", "unknown"} {
+		if _, err := NewFieldPolicies(map[string][]string{"partner": {field}}); err == nil {
+			t.Errorf("got no error for field %s", field)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// responseFormat is the serialization of the item list responses.
+type responseFormat string
+
+// Supported response formats, by their media types.
+const (
+	formatJSON    responseFormat = "application/json"
+	formatXML     responseFormat = "application/xml"
+	formatMsgpack responseFormat = "application/msgpack"
+)
+
+// formatAliases are the other media types used for the formats.
+var formatAliases = map[string]responseFormat{
+	"application/json":        formatJSON,
+	"application/xml":         formatXML,
+	"text/xml":                formatXML,
+	"application/msgpack":     formatMsgpack,
+	"application/x-msgpack":   formatMsgpack,
+	"application/vnd.msgpack": formatMsgpack,
+}
+
+// negotiateFormat returns the format with the highest quality in the Accept header.
+// JSON is preferred on ties, and used when no supported format is listed.
+func negotiateFormat(accept string) responseFormat {
+	best, bestQ := formatJSON, 0.0
+	for _, v := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(v)
+		if err != nil {
+			continue
+		}
+		format, ok := formatAliases[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ || (q > 0 && q == bestQ && format == formatJSON) {
+			best, bestQ = format, q
+		}
+	}
+
+	return best
+}
+
+// itemsXML is the XML document of an item list.
+type itemsXML struct {
+	XMLName xml.Name    `xml:"items"`
+	Items   []*ItemView `xml:"item"`
+}
+
+// writeItems writes the item list in the format.
+func writeItems(w http.ResponseWriter, req *http.Request, format responseFormat, views []*ItemView) {
+	w.Header().Set("Content-Type", string(format))
+	w.WriteHeader(http.StatusOK)
+
+	var err error
+	switch format {
+	case formatXML:
+		if _, err = w.Write([]byte(xml.Header)); err == nil {
+			err = xml.NewEncoder(w).Encode(itemsXML{Items: views})
+		}
+	case formatMsgpack:
+		_, err = w.Write(marshalMsgpackItems(views))
+	default:
+		err = json.NewEncoder(w).Encode(views)
+	}
+	if err != nil {
+		slog.WarnContext(req.Context(), "encoding response to http writer", "error", err, "format", format)
+	}
+}
+
+// MessagePack encoding of the item views, with the same field names as in JSON.
+// The views are simple, so they are encoded by hand instead of using a library.
+
+// marshalMsgpackItems encodes the views as an array of maps.
+func marshalMsgpackItems(views []*ItemView) []byte {
+	b := appendMsgpackArrayHeader(nil, len(views))
+	for _, v := range views {
+		b = appendMsgpackItem(b, v)
+	}
+	return b
+}
+
+func appendMsgpackItem(b []byte, v *ItemView) []byte {
+	fields := 6
+	if len(v.Media) > 0 {
+		fields++
+	}
+	if v.Checksum != "" {
+		fields++
+	}
+
+	b = appendMsgpackMapHeader(b, fields)
+	for _, f := range []struct{ name, value string }{
+		{"id", v.ID}, {"title", v.Title}, {"source", v.Source}, {"summary", v.Summary}, {"link", v.Link},
+	} {
+		b = appendMsgpackString(b, f.name)
+		b = appendMsgpackString(b, f.value)
+	}
+	if len(v.Media) > 0 {
+		b = appendMsgpackString(b, "media")
+		b = appendMsgpackArrayHeader(b, len(v.Media))
+		for _, m := range v.Media {
+			b = appendMsgpackString(b, m)
+		}
+	}
+	b = appendMsgpackString(b, "expiry")
+	switch e := v.Expiry.(type) {
+	case int64:
+		b = appendMsgpackInt(b, e)
+	case time.Time:
+		b = appendMsgpackString(b, e.Format(time.RFC3339Nano))
+	default:
+		// The expiry hidden by the client's field policy is nil.
+		b = append(b, 0xc0)
+	}
+	if v.Checksum != "" {
+		b = appendMsgpackString(b, "checksum")
+		b = appendMsgpackString(b, v.Checksum)
+	}
+
+	return b
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	// The item maps have at most 8 fields.
+	return append(b, 0x80|byte(n))
+}
+
+func appendMsgpackInt(b []byte, v int64) []byte {
+	if v >= 0 && v < 128 {
+		return append(b, byte(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+}
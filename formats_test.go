@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	for accept, want := range map[string]responseFormat{
+		"":                                  formatJSON,
+		"*/*":                               formatJSON,
+		"text/html":                         formatJSON,
+		"application/xml":                   formatXML,
+		"text/xml; charset=utf-8":           formatXML,
+		"application/x-msgpack":             formatMsgpack,
+		"application/json, application/xml": formatJSON,
+		"application/json;q=0.5, text/xml":  formatXML,
+		"application/msgpack;q=0, application/xml;q=0.1": formatXML,
+	} {
+		if got := negotiateFormat(accept); got != want {
+			t.Errorf("%q: got %s, want %s", accept, got, want)
+		}
+	}
+}
+
+func TestMsgpackItems(t *testing.T) {
+	views := []*ItemView{{ID: "1", Title: "t", Media: []string{"m"}, Expiry: int64(1622548800)}}
+	want := []byte{0x91, 0x87,
+		0xa2, 'i', 'd', 0xa1, '1',
+		0xa5, 't', 'i', 't', 'l', 'e', 0xa1, 't',
+		0xa6, 's', 'o', 'u', 'r', 'c', 'e', 0xa0,
+		0xa7, 's', 'u', 'm', 'm', 'a', 'r', 'y', 0xa0,
+		0xa4, 'l', 'i', 'n', 'k', 0xa0,
+		0xa5, 'm', 'e', 'd', 'i', 'a', 0x91, 0xa1, 'm',
+		0xa6, 'e', 'x', 'p', 'i', 'r', 'y', 0xd3, 0, 0, 0, 0, 0x60, 0xb6, 0x21, 0x40,
+	}
+	if got := marshalMsgpackItems(views); !bytes.Equal(got, want) {
+		t.Errorf("got % x, want % x", got, want)
+	}
+
+	long := string(bytes.Repeat([]byte("a"), 300))
+	got := appendMsgpackString(nil, long)
+	if !bytes.Equal(got[:3], []byte{0xda, 0x01, 0x2c}) || len(got) != 303 {
+		t.Errorf("got header % x and length %d for a 300 bytes string", got[:3], len(got))
+	}
+}
+
+func TestXMLResponse(t *testing.T) {
+	client := &mockContentProvider{source: Provider1, media: []string{"https://cdn.example.com/a.jpg"}}
+	service, err := NewService([]ContentConfig{{Type: Provider1}}, map[Provider]Client{Provider1: client}, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service, deltas: newDeltaStore(10, time.Minute)})
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?count=2", nil)
+	req.Header.Set("Accept", "application/xml")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != string(formatXML) {
+		t.Errorf("got content type %s, want %s", ct, formatXML)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	var doc struct {
+		Items []struct {
+			ID     string    `xml:"id"`
+			Source string    `xml:"source"`
+			Media  []string  `xml:"media"`
+			Expiry time.Time `xml:"expiry"`
+		} `xml:"item"`
+	}
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	if len(doc.Items) != 2 || doc.Items[0].Source != string(Provider1) || len(doc.Items[0].Media) != 1 || doc.Items[0].Expiry.IsZero() {
+		t.Errorf("got items %+v from %s", doc.Items, body)
+	}
+}
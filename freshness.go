@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+var providerStale = newGaugeVec(
+	"provider_content_stale",
+	"Whether the provider calls succeed but haven't returned fresh content within the freshness window (1) or not (0).",
+	"provider",
+)
+
+// FreshnessTracker tracks the freshness of the content returned by providers.
+// Content is fresh when it's not expired at the time it was requested.
+type FreshnessTracker struct {
+	window time.Duration
+	now    func() time.Time
+
+	providers map[Provider]*ProviderFreshness
+	stale     map[Provider]bool // Last reported staleness.
+	m         sync.Mutex
+}
+
+// ProviderFreshness describes the content freshness of one provider.
+type ProviderFreshness struct {
+	Provider     Provider  `json:"provider"`
+	LastFetch    time.Time `json:"last_fetch"`
+	LastSuccess  time.Time `json:"last_success,omitzero"`
+	LastFresh    time.Time `json:"last_fresh,omitzero"`
+	NewestExpiry time.Time `json:"newest_expiry,omitzero"`
+	Stale        bool      `json:"stale"`
+
+	firstSuccess time.Time
+}
+
+// FreshnessReport is the freshness of all providers called so far.
+type FreshnessReport struct {
+	Window    Duration             `json:"window"`
+	Providers []*ProviderFreshness `json:"providers"`
+}
+
+// NewFreshnessTracker returns a tracker reporting providers as stale when they don't return fresh content within the window.
+// Zero window disables reporting stale providers.
+func NewFreshnessTracker(window time.Duration) *FreshnessTracker {
+	return &FreshnessTracker{
+		window:    window,
+		now:       time.Now,
+		providers: make(map[Provider]*ProviderFreshness),
+		stale:     make(map[Provider]bool),
+	}
+}
+
+// Record stores the result of a provider call started at `start`.
+func (t *FreshnessTracker) Record(p Provider, start time.Time, items []*ContentItem, err error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	f, ok := t.providers[p]
+	if !ok {
+		f = &ProviderFreshness{Provider: p}
+		t.providers[p] = f
+	}
+	f.LastFetch = start
+	if err != nil {
+		return
+	}
+	f.LastSuccess = start
+	if f.firstSuccess.IsZero() {
+		f.firstSuccess = start
+	}
+
+	for _, item := range items {
+		if item.Expiry.After(f.NewestExpiry) {
+			f.NewestExpiry = item.Expiry
+		}
+		if !item.Expiry.Before(start) {
+			f.LastFresh = start
+		}
+	}
+}
+
+// Report returns the current freshness of all providers.
+func (t *FreshnessTracker) Report() FreshnessReport {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	now := t.now()
+	report := FreshnessReport{
+		Window:    Duration(t.window),
+		Providers: make([]*ProviderFreshness, 0, len(t.providers)),
+	}
+	for _, f := range t.providers {
+		v := *f
+		v.Stale = t.isStale(f, now)
+		report.Providers = append(report.Providers, &v)
+	}
+	sort.Slice(report.Providers, func(i, j int) bool {
+		return report.Providers[i].Provider < report.Providers[j].Provider
+	})
+
+	return report
+}
+
+// Run periodically logs the providers that became stale (or fresh again), until the context is done.
+func (t *FreshnessTracker) Run(ctx context.Context, interval time.Duration) {
+	if t.window <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.check()
+		}
+	}
+}
+
+func (t *FreshnessTracker) check() {
+	for _, f := range t.Report().Providers {
+		t.m.Lock()
+		changed := t.stale[f.Provider] != f.Stale
+		t.stale[f.Provider] = f.Stale
+		t.m.Unlock()
+
+		if f.Stale {
+			providerStale.Set(1, string(f.Provider))
+		} else {
+			providerStale.Set(0, string(f.Provider))
+		}
+		if !changed {
+			continue
+		}
+		if f.Stale {
+			slog.Warn(
+				"provider returned no fresh content within the window",
+				"provider", f.Provider, "window", t.window, "last_fresh", formatTime(f.LastFresh), "newest_expiry", formatTime(f.NewestExpiry),
+			)
+		} else {
+			slog.Info("provider returns fresh content again", "provider", f.Provider)
+		}
+	}
+}
+
+// isStale returns true if the provider calls succeed, but there was no fresh content within the window.
+func (t *FreshnessTracker) isStale(f *ProviderFreshness, now time.Time) bool {
+	if t.window <= 0 || f.LastSuccess.IsZero() || now.Sub(f.LastSuccess) > t.window {
+		// Disabled, or no recent successful calls - that's a provider health problem, not a freshness one.
+		return false
+	}
+	since := f.LastFresh
+	if since.IsZero() {
+		since = f.firstSuccess
+	}
+	return now.Sub(since) > t.window
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFreshnessTracker(t *testing.T) {
+	now := time.Now()
+	tracker := NewFreshnessTracker(time.Minute)
+	tracker.now = func() time.Time { return now }
+
+	fresh := []*ContentItem{{Expiry: now.Add(time.Hour)}}
+	expired := []*ContentItem{{Expiry: now.Add(-time.Hour)}}
+
+	tracker.Record("fresh", now.Add(-2*time.Minute), expired, nil)
+	tracker.Record("fresh", now.Add(-time.Second), fresh, nil)
+	tracker.Record("stale", now.Add(-2*time.Minute), expired, nil)
+	tracker.Record("stale", now.Add(-time.Second), expired, nil)
+	tracker.Record("new", now.Add(-time.Second), expired, nil)
+	tracker.Record("failing", now.Add(-time.Second), nil, errors.New("test error"))
+
+	wantStale := map[Provider]bool{
+		"fresh":   false,
+		"stale":   true,
+		"new":     false, // Not returning fresh content for less than the window.
+		"failing": false, // Calls don't succeed, so freshness is unknown.
+	}
+	report := tracker.Report()
+	if len(report.Providers) != len(wantStale) {
+		t.Fatalf("got %d providers, want %d", len(report.Providers), len(wantStale))
+	}
+	for _, f := range report.Providers {
+		if f.Stale != wantStale[f.Provider] {
+			t.Errorf("provider '%s': got stale %v, want %v", f.Provider, f.Stale, wantStale[f.Provider])
+		}
+	}
+}
+
+func TestFreshnessEndpoint(t *testing.T) {
+	service, err := NewDefaultService(WithFreshnessWindow(time.Minute))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/?count=4") // All 3 providers are used for 4 items.
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/providers/freshness")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var report FreshnessReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if time.Duration(report.Window) != time.Minute {
+		t.Errorf("got window %v, want 1m", time.Duration(report.Window))
+	}
+	if len(report.Providers) != 3 {
+		t.Fatalf("got %d providers, want 3", len(report.Providers))
+	}
+	for _, f := range report.Providers {
+		if f.LastFresh.IsZero() || f.Stale {
+			t.Errorf("provider '%s' should be fresh: %+v", f.Provider, f)
+		}
+	}
+}
@@ -1,3 +1,15 @@
 module github.com/m-zajac/another-go-challange
 
-go 1.17
+go 1.24
+
+require (
+	github.com/andybalholm/brotli v1.2.5
+	github.com/lib/pq v1.10.9
+	golang.org/x/crypto v0.40.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/text v0.27.0 // indirect
+)
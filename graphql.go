@@ -0,0 +1,942 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxGraphQLBodySize limits the size of the GraphQL request bodies.
+const maxGraphQLBodySize = 1 << 20
+
+// maxGraphQLContentFields limits the content fields (aliases included) of a query.
+const maxGraphQLContentFields = 10
+
+// graphqlSchema is the schema of the GraphQL API, served for reference only (there is no introspection).
+const graphqlSchema = `type Query {
+  content(count: Int!, offset: Int = 0, sources: [String!]): [Item!]!
+}
+
+type Item {
+  id: String!
+  title: String!
+  source: String!
+  summary: String!
+  link: String!
+  media: [String!]!
+  expiry: String!
+  checksum: String!
+}
+`
+
+// graphqlItemFields are the fields of the Item type. The checksum is computed only when it's selected.
+var graphqlItemFields = map[string]func(*ContentItem) any{
+	"id":      func(i *ContentItem) any { return i.ID },
+	"title":   func(i *ContentItem) any { return i.Title },
+	"source":  func(i *ContentItem) any { return i.Source },
+	"summary": func(i *ContentItem) any { return i.Summary },
+	"link":    func(i *ContentItem) any { return i.Link },
+	"media": func(i *ContentItem) any {
+		if i.Media == nil {
+			return []string{}
+		}
+		return i.Media
+	},
+	"expiry":     func(i *ContentItem) any { return i.Expiry.Format(time.RFC3339Nano) },
+	"checksum":   func(i *ContentItem) any { return itemChecksum(i) },
+	"__typename": func(*ContentItem) any { return "Item" },
+}
+
+// graphqlRequest is a GraphQL request, sent as the JSON body of a POST request, or as the query parameters of a GET request.
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphqlResponse is a GraphQL response. Data is missing when the request is invalid.
+type graphqlResponse struct {
+	Data   graphqlObject  `json:"data,omitempty"`
+	Errors []graphqlError `json:"errors,omitempty"`
+}
+
+type graphqlError struct {
+	Message string   `json:"message"`
+	Path    []string `json:"path,omitempty"`
+}
+
+// graphqlObject is a JSON object with the fields in the order of the selection.
+type graphqlObject []graphqlEntry
+
+type graphqlEntry struct {
+	key   string
+	value any
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o graphqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, e := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(e.key)
+		b.Write(key)
+		b.WriteByte(':')
+		value, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// GetGraphQL serves the GraphQL API, with the `content(count, offset, sources)` query.
+// Only the selected item fields are returned (and computed, like the checksum).
+// GET /graphql?schema returns the schema.
+func (h *Handler) GetGraphQL(w http.ResponseWriter, req *http.Request) {
+	var gr graphqlRequest
+	switch req.Method {
+	case http.MethodGet:
+		query := req.URL.Query()
+		if query.Has("schema") {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(graphqlSchema))
+			return
+		}
+		gr.Query = query.Get("query")
+		gr.OperationName = query.Get("operationName")
+		if v := query.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &gr.Variables); err != nil {
+				h.writeGraphQL(w, req, http.StatusBadRequest, graphqlResponse{Errors: []graphqlError{{Message: "invalid variables: " + err.Error()}}})
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxGraphQLBodySize)).Decode(&gr); err != nil {
+			h.writeGraphQL(w, req, http.StatusBadRequest, graphqlResponse{Errors: []graphqlError{{Message: "invalid request body: " + err.Error()}}})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeMethodNotAllowed(w, req)
+		return
+	}
+
+	queries, err := h.planGraphQL(gr)
+	var validationErrs ValidationErrors
+	if errors.As(err, &validationErrs) {
+		resp := graphqlResponse{}
+		for _, pe := range validationErrs {
+			resp.Errors = append(resp.Errors, graphqlError{Message: fmt.Sprintf("invalid %s argument: %s", pe.Param, pe.Message)})
+		}
+		h.writeGraphQL(w, req, http.StatusBadRequest, resp)
+		return
+	}
+	if err != nil {
+		h.writeGraphQL(w, req, http.StatusBadRequest, graphqlResponse{Errors: []graphqlError{{Message: err.Error()}}})
+		return
+	}
+
+	// The memory is reserved for all the content fields at once, so the aliases can't get around the budget.
+	var count, offset int
+	for _, q := range queries {
+		count, offset = count+q.count, offset+q.offset
+	}
+	release, err := h.memory.acquire(count, offset)
+	if err != nil {
+		status := http.StatusRequestEntityTooLarge
+		if errors.Is(err, errMemoryExhausted) {
+			w.Header().Set("Retry-After", "1")
+			status = http.StatusTooManyRequests
+		}
+		h.writeGraphQL(w, req, status, graphqlResponse{Errors: []graphqlError{{Message: err.Error()}}})
+		return
+	}
+	defer release()
+
+	var resp graphqlResponse
+	for _, q := range queries {
+		value, err := h.resolveGraphQL(req, q)
+		if err != nil {
+			resp.Errors = append(resp.Errors, graphqlError{Message: err.Error(), Path: []string{q.alias}})
+		}
+		resp.Data = append(resp.Data, graphqlEntry{key: q.alias, value: value})
+	}
+	h.writeGraphQL(w, req, http.StatusOK, resp)
+}
+
+func (h *Handler) writeGraphQL(w http.ResponseWriter, req *http.Request, status int, resp graphqlResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.WarnContext(req.Context(), "encoding response to http writer", "error", err)
+	}
+}
+
+// graphqlQuery is a validated top-level field of the operation.
+type graphqlQuery struct {
+	alias string
+	// typename is set for the __typename field, instead of the content query.
+	typename bool
+	count    int
+	offset   int
+	sources  []Provider
+	fields   []*gqlField
+}
+
+// planGraphQL parses and validates the request, and returns the top-level fields to resolve.
+func (h *Handler) planGraphQL(gr graphqlRequest) ([]*graphqlQuery, error) {
+	if strings.TrimSpace(gr.Query) == "" {
+		return nil, errors.New("query is empty")
+	}
+	ops, err := parseGraphQL(gr.Query)
+	if err != nil {
+		return nil, err
+	}
+	op, err := selectOperation(ops, gr.OperationName)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := op.variableValues(gr.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	selections, err := mergeGQLFields(op.selections)
+	if err != nil {
+		return nil, err
+	}
+	var queries []*graphqlQuery
+	contentFields, items := 0, 0
+	for _, f := range selections {
+		switch f.name {
+		case "__typename":
+			queries = append(queries, &graphqlQuery{alias: f.responseKey(), typename: true})
+		case "content":
+			if contentFields++; contentFields > maxGraphQLContentFields {
+				return nil, fmt.Errorf("the query must not have more than %d content fields", maxGraphQLContentFields)
+			}
+			q, err := h.planContentQuery(f, vars)
+			if err != nil {
+				return nil, err
+			}
+			queries = append(queries, q)
+			// Every field is within the limit, so the sum of the few fields doesn't overflow.
+			items += q.count + q.offset
+		default:
+			return nil, fmt.Errorf("cannot query field %q on type Query", f.name)
+		}
+	}
+	// The limit applies to the whole query, like to a single request.
+	if h.limits.MaxItems > 0 && items > h.limits.MaxItems {
+		return nil, ValidationErrors{{Param: "count", Message: fmt.Sprintf("count + offset of all the content fields must not be greater than %d", h.limits.MaxItems)}}
+	}
+	return queries, nil
+}
+
+// mergeGQLFields merges the fields with the same response key, as the response can have every key once.
+// The merged fields must be the same field with the same arguments; their selections are merged too.
+func mergeGQLFields(fields []*gqlField) ([]*gqlField, error) {
+	merged := make([]*gqlField, 0, len(fields))
+	byKey := make(map[string]*gqlField, len(fields))
+	for _, f := range fields {
+		prev, ok := byKey[f.responseKey()]
+		if !ok {
+			byKey[f.responseKey()] = f
+			merged = append(merged, f)
+			continue
+		}
+		if prev.name != f.name || !reflect.DeepEqual(prev.args, f.args) {
+			return nil, fmt.Errorf("fields %q conflict: they have different names or arguments", f.responseKey())
+		}
+		prev.selections = append(prev.selections, f.selections...)
+	}
+	for _, f := range merged {
+		var err error
+		if f.selections, err = mergeGQLFields(f.selections); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+func (h *Handler) planContentQuery(f *gqlField, vars map[string]any) (*graphqlQuery, error) {
+	q := &graphqlQuery{alias: f.responseKey(), fields: f.selections}
+	if len(f.selections) == 0 {
+		return nil, errors.New("field content must have a selection of the Item fields")
+	}
+	for _, sf := range f.selections {
+		if _, ok := graphqlItemFields[sf.name]; !ok {
+			return nil, fmt.Errorf("cannot query field %q on type Item", sf.name)
+		}
+		if len(sf.selections) > 0 || len(sf.args) > 0 {
+			return nil, fmt.Errorf("field %q of type Item has no arguments and no selection", sf.name)
+		}
+	}
+
+	for name := range f.args {
+		if name != "count" && name != "offset" && name != "sources" {
+			return nil, fmt.Errorf("unknown argument %q on field content", name)
+		}
+	}
+
+	var errs ValidationErrors
+	hasCount := false
+	for _, name := range []string{"count", "offset", "sources"} {
+		raw, ok := f.args[name]
+		if !ok {
+			continue
+		}
+		v := resolveGQLValue(raw, vars)
+		switch name {
+		case "count", "offset":
+			n, ok := v.(int64)
+			switch {
+			case v == nil && name == "offset":
+			case !ok:
+				errs = append(errs, ParamError{Param: name, Message: "must be an integer"})
+			case name == "count" && n <= 0:
+				errs = append(errs, ParamError{Param: name, Message: "must be positive"})
+			case n < 0:
+				errs = append(errs, ParamError{Param: name, Message: "must be positive or zero"})
+			case name == "count":
+				q.count, hasCount = int(n), true
+			default:
+				q.offset = int(n)
+			}
+		case "sources":
+			sources, err := graphqlSources(v)
+			if err != nil {
+				errs = append(errs, ParamError{Param: name, Message: err.Error()})
+				continue
+			}
+			for _, p := range sources {
+				if !h.service.HasProvider(p) {
+					errs = append(errs, ParamError{Param: name, Message: fmt.Sprintf("unknown provider %q", p)})
+				}
+			}
+			q.sources = sources
+		}
+	}
+	if !hasCount && len(errs) == 0 {
+		errs = append(errs, ParamError{Param: "count", Message: "is empty"})
+	}
+	if len(errs) == 0 {
+		errs = h.limits.check(q.count, q.offset)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return q, nil
+}
+
+// graphqlSources returns the providers of the `sources` argument, a list of strings or a single string.
+func graphqlSources(v any) ([]Provider, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []Provider{Provider(v)}, nil
+	case []any:
+		sources := make([]Provider, 0, len(v))
+		for _, s := range v {
+			name, ok := s.(string)
+			if !ok {
+				return nil, errors.New("must be a list of strings")
+			}
+			sources = append(sources, Provider(name))
+		}
+		return sources, nil
+	default:
+		return nil, errors.New("must be a list of strings")
+	}
+}
+
+// resolveGraphQL returns the value of a top-level field.
+func (h *Handler) resolveGraphQL(req *http.Request, q *graphqlQuery) (any, error) {
+	if q.typename {
+		return "Query", nil
+	}
+
+	policy := fieldPolicyFromContext(req.Context())
+	if q.sources != nil && policy.hides("source") {
+		return nil, errors.New("argument sources isn't available to this client")
+	}
+	ctx := withEndpoint(req.Context(), EndpointGraphQL)
+	if q.sources != nil {
+		ctx = withSources(ctx, q.sources)
+	}
+	result, err := h.service.GetContentResult(ctx, requestMeta(req), q.count, q.offset)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "graphql server error", "error", err)
+		return nil, errors.New("internal server error")
+	}
+
+	items := make([]graphqlObject, len(result.Items))
+	for i, item := range result.Items {
+		item = policy.redact(item)
+		obj := make(graphqlObject, len(q.fields))
+		for j, f := range q.fields {
+			obj[j] = graphqlEntry{key: f.responseKey(), value: graphqlItemFields[f.name](item)}
+			// The schema's fields are non-null, so the hidden ones are empty.
+			if policy.hides(f.name) {
+				obj[j].value = graphqlHiddenValue(f.name)
+			}
+		}
+		items[i] = obj
+	}
+	return items, nil
+}
+
+// graphqlHiddenValue returns the empty value of the Item field hidden by the client's field policy.
+func graphqlHiddenValue(name string) any {
+	if name == "media" {
+		return []string{}
+	}
+	return ""
+}
+
+// The rest of the file is the parser of the GraphQL query documents.
+// It supports the operations, variables, aliases and arguments; fragments, directives and input objects aren't supported.
+
+// gqlOperation is a query operation of a document.
+type gqlOperation struct {
+	name       string
+	variables  []*gqlVariableDef
+	selections []*gqlField
+}
+
+type gqlVariableDef struct {
+	name       string
+	required   bool
+	defaultVal any
+	hasDefault bool
+}
+
+// gqlField is a selected field.
+type gqlField struct {
+	alias      string
+	name       string
+	args       map[string]any
+	selections []*gqlField
+}
+
+// responseKey returns the name of the field in the response.
+func (f *gqlField) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// gqlVariable is a reference to a variable in an argument value.
+type gqlVariable string
+
+// selectOperation returns the operation to execute.
+func selectOperation(ops []*gqlOperation, name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(ops) > 1 {
+			return nil, errors.New("operationName is required for documents with multiple operations")
+		}
+		return ops[0], nil
+	}
+	for _, op := range ops {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// variableValues returns the values of the operation variables, from the request or the defaults.
+func (op *gqlOperation) variableValues(values map[string]any) (map[string]any, error) {
+	vars := make(map[string]any, len(op.variables))
+	for _, def := range op.variables {
+		v, ok := values[def.name]
+		switch {
+		case ok:
+			vars[def.name] = normalizeGQLVariable(v)
+		case def.hasDefault:
+			vars[def.name] = def.defaultVal
+		case def.required:
+			return nil, fmt.Errorf("variable $%s is required", def.name)
+		}
+		if def.required && vars[def.name] == nil {
+			return nil, fmt.Errorf("variable $%s must not be null", def.name)
+		}
+	}
+	return vars, nil
+}
+
+// normalizeGQLVariable converts the JSON numbers of a variable value to the parsed literal types (int64 for the integers).
+func normalizeGQLVariable(v any) any {
+	switch v := v.(type) {
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+		return v
+	case []any:
+		list := make([]any, len(v))
+		for i, e := range v {
+			list[i] = normalizeGQLVariable(e)
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+// resolveGQLValue replaces the variable references with their values.
+func resolveGQLValue(v any, vars map[string]any) any {
+	switch v := v.(type) {
+	case gqlVariable:
+		return vars[string(v)]
+	case []any:
+		list := make([]any, len(v))
+		for i, e := range v {
+			list[i] = resolveGQLValue(e, vars)
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunct
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind  gqlTokenKind
+	value string
+}
+
+// gqlParser is a recursive descent parser of the GraphQL query documents.
+type gqlParser struct {
+	src string
+	pos int
+	tok gqlToken
+	// variables are the variables defined by the current operation.
+	variables map[string]bool
+}
+
+// parseGraphQL parses the operations of a query document.
+func parseGraphQL(src string) ([]*gqlOperation, error) {
+	p := &gqlParser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	var ops []*gqlOperation
+	for p.tok.kind != gqlEOF {
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) == 0 {
+		return nil, errors.New("the document has no operations")
+	}
+	return ops, nil
+}
+
+func (p *gqlParser) parseOperation() (*gqlOperation, error) {
+	op := &gqlOperation{}
+	p.variables = map[string]bool{}
+	if p.tok.kind == gqlName {
+		switch p.tok.value {
+		case "query":
+		case "mutation", "subscription":
+			return nil, fmt.Errorf("%s operations are not supported", p.tok.value)
+		case "fragment":
+			return nil, errors.New("fragments are not supported")
+		default:
+			return nil, p.unexpected()
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == gqlName {
+			op.name = p.tok.value
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		if p.isPunct("(") {
+			vars, err := p.parseVariableDefs()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = vars
+		}
+	}
+
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selections = selections
+	return op, nil
+}
+
+func (p *gqlParser) parseVariableDefs() ([]*gqlVariableDef, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var defs []*gqlVariableDef
+	for !p.isPunct(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		def := &gqlVariableDef{name: name}
+		if def.required, err = p.parseType(); err != nil {
+			return nil, err
+		}
+		if p.isPunct("=") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if def.defaultVal, err = p.parseValue(true); err != nil {
+				return nil, err
+			}
+			def.hasDefault = true
+		}
+		p.variables[name] = true
+		defs = append(defs, def)
+	}
+	return defs, p.next()
+}
+
+// parseType skips a type reference, and tells whether it's non-null.
+func (p *gqlParser) parseType() (bool, error) {
+	if p.isPunct("[") {
+		if err := p.next(); err != nil {
+			return false, err
+		}
+		if _, err := p.parseType(); err != nil {
+			return false, err
+		}
+		if err := p.expect("]"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.expectName(); err != nil {
+		return false, err
+	}
+
+	if p.isPunct("!") {
+		return true, p.next()
+	}
+	return false, nil
+}
+
+func (p *gqlParser) parseSelectionSet() ([]*gqlField, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []*gqlField
+	for !p.isPunct("}") {
+		if p.isPunct("...") {
+			return nil, errors.New("fragments are not supported")
+		}
+		f, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("empty selection")
+	}
+	return fields, p.next()
+}
+
+func (p *gqlParser) parseField() (*gqlField, error) {
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	f := &gqlField{name: name}
+	if p.isPunct(":") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		f.alias = name
+		if f.name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.isPunct("(") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		f.args = map[string]any{}
+		for !p.isPunct(")") {
+			arg, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if _, ok := f.args[arg]; ok {
+				return nil, fmt.Errorf("argument %q is given more than once", arg)
+			}
+			if f.args[arg], err = p.parseValue(false); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.isPunct("@") {
+		return nil, errors.New("directives are not supported")
+	}
+	if p.isPunct("{") {
+		if f.selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// parseValue parses a literal or a variable reference. The default values of variables must be constant.
+func (p *gqlParser) parseValue(constant bool) (any, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == gqlPunct && tok.value == "$":
+		if constant {
+			return nil, errors.New("variables are not allowed in default values")
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if !p.variables[name] {
+			return nil, fmt.Errorf("variable $%s is not defined", name)
+		}
+		return gqlVariable(name), nil
+	case tok.kind == gqlPunct && tok.value == "[":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for !p.isPunct("]") {
+			v, err := p.parseValue(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.next()
+	case tok.kind == gqlPunct && tok.value == "{":
+		return nil, errors.New("input objects are not supported")
+	case tok.kind == gqlInt:
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s", tok.value)
+		}
+		return n, p.next()
+	case tok.kind == gqlFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", tok.value)
+		}
+		return f, p.next()
+	case tok.kind == gqlString:
+		return tok.value, p.next()
+	case tok.kind == gqlName:
+		var v any
+		switch tok.value {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = tok.value // An enum value.
+		}
+		return v, p.next()
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+func (p *gqlParser) isPunct(v string) bool {
+	return p.tok.kind == gqlPunct && p.tok.value == v
+}
+
+func (p *gqlParser) expect(punct string) error {
+	if !p.isPunct(punct) {
+		return fmt.Errorf("syntax error at %d: expected %q, got %s", p.pos, punct, p.describe())
+	}
+	return p.next()
+}
+
+func (p *gqlParser) expectName() (string, error) {
+	if p.tok.kind != gqlName {
+		return "", fmt.Errorf("syntax error at %d: expected a name, got %s", p.pos, p.describe())
+	}
+	name := p.tok.value
+	return name, p.next()
+}
+
+func (p *gqlParser) unexpected() error {
+	return fmt.Errorf("syntax error at %d: unexpected %s", p.pos, p.describe())
+}
+
+func (p *gqlParser) describe() string {
+	if p.tok.kind == gqlEOF {
+		return "end of document"
+	}
+	return strconv.Quote(p.tok.value)
+}
+
+// next reads the next token. Whitespace, commas and comments are ignored.
+func (p *gqlParser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+			continue
+		}
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		break
+	}
+	if p.pos >= len(p.src) {
+		p.tok = gqlToken{kind: gqlEOF}
+		return nil
+	}
+
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = gqlToken{kind: gqlPunct, value: "..."}
+	case strings.IndexByte("!$():=@[]{}|&", c) >= 0:
+		p.pos++
+		p.tok = gqlToken{kind: gqlPunct, value: string(c)}
+	case c == '_' || isASCIILetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isASCIILetter(p.src[p.pos]) || isASCIIDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = gqlToken{kind: gqlName, value: p.src[start:p.pos]}
+	case c == '-' || isASCIIDigit(c):
+		return p.readNumber()
+	case c == '"':
+		return p.readString()
+	default:
+		return fmt.Errorf("syntax error at %d: unexpected character %q", p.pos, c)
+	}
+	return nil
+}
+
+func (p *gqlParser) readNumber() error {
+	start := p.pos
+	digits := func() int {
+		n := 0
+		for p.pos < len(p.src) && isASCIIDigit(p.src[p.pos]) {
+			p.pos++
+			n++
+		}
+		return n
+	}
+
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	kind := gqlInt
+	ok := digits() > 0
+	if ok && p.pos < len(p.src) && p.src[p.pos] == '.' {
+		p.pos++
+		kind = gqlFloat
+		ok = digits() > 0
+	}
+	if ok && p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		kind = gqlFloat
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		ok = digits() > 0
+	}
+	if !ok {
+		return fmt.Errorf("syntax error at %d: invalid number", start)
+	}
+	p.tok = gqlToken{kind: kind, value: p.src[start:p.pos]}
+	return nil
+}
+
+// readString reads a quoted string. The escapes are the same as in JSON; block strings aren't supported.
+func (p *gqlParser) readString() error {
+	start := p.pos
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		return fmt.Errorf("syntax error at %d: block strings are not supported", start)
+	}
+	p.pos++
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+		case '"':
+			p.pos++
+			var s string
+			if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+				return fmt.Errorf("syntax error at %d: invalid string", start)
+			}
+			p.tok = gqlToken{kind: gqlString, value: s}
+			return nil
+		case '\n', '\r':
+			return fmt.Errorf("syntax error at %d: unterminated string", start)
+		default:
+			p.pos++
+		}
+	}
+	return fmt.Errorf("syntax error at %d: unterminated string", start)
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isASCIIDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
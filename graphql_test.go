@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseGraphQL(t *testing.T) {
+	for name, tc := range map[string]struct {
+		query   string
+		wantErr string
+	}{
+		"shorthand":             {query: `{ content(count: 2) { id title } }`},
+		"named with variables":  {query: `query Feed($count: Int! = 5, $sources: [String!]) { items: content(count: $count, sources: $sources) { id } }`},
+		"comments and commas":   {query: "# the feed\n{ content(count: 2, offset: 1,) { id, title, } }"},
+		"string and list":       {query: `{ content(count: 1, sources: ["1", "2é"]) { id } }`},
+		"mutation":              {query: `mutation { content(count: 1) { id } }`, wantErr: "mutation operations are not supported"},
+		"fragment spread":       {query: `{ content(count: 1) { ...F } }`, wantErr: "fragments are not supported"},
+		"directive":             {query: `{ content(count: 1) @skip(if: true) { id } }`, wantErr: "directives are not supported"},
+		"undefined variable":    {query: `{ content(count: $count) { id } }`, wantErr: "variable $count is not defined"},
+		"unterminated string":   {query: `{ content(count: 1, sources: ["1) { id } }`, wantErr: "unterminated string"},
+		"missing brace":         {query: `{ content(count: 1) { id }`, wantErr: "syntax error"},
+		"empty selection":       {query: `{ content(count: 1) { } }`, wantErr: "empty selection"},
+		"invalid number":        {query: `{ content(count: 1.) { id } }`, wantErr: "invalid number"},
+		"unexpected character":  {query: `{ content(count: 1) { id; } }`, wantErr: "unexpected character"},
+		"variable in a default": {query: `query ($a: Int = $b) { content(count: $a) { id } }`, wantErr: "variables are not allowed"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseGraphQL(tc.query)
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("got error %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: &mockContentProvider{source: Provider2},
+		Provider3: &mockContentProvider{source: Provider3},
+	}
+	service, err := NewService([]ContentConfig{{Type: Provider1}, {Type: Provider2}, {Type: Provider3}}, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service, limits: RequestLimits{MaxCount: 10, MaxItems: 15}})
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		request    graphqlRequest
+		get        bool
+		wantStatus int
+		want       string
+		wantErr    string
+	}{
+		"selected fields only": {
+			request:    graphqlRequest{Query: `{ content(count: 2) { title id } }`},
+			wantStatus: http.StatusOK,
+			want:       `{"data":{"content":[{"title":"test title","id":"1"},{"title":"test title","id":"1"}]}}`,
+		},
+		"aliases and variables": {
+			request: graphqlRequest{
+				Query:     `query Feed($count: Int!, $sources: [String!]) { feed: content(count: $count, sources: $sources) { src: source } kind: __typename }`,
+				Variables: map[string]any{"count": 3, "sources": []string{"2", "3"}},
+			},
+			wantStatus: http.StatusOK,
+			want:       `{"data":{"feed":[{"src":"2"},{"src":"3"},{"src":"2"}],"kind":"Query"}}`,
+		},
+		"operation name": {
+			request:    graphqlRequest{Query: `query A { content(count: 1) { source } } query B { content(count: 1, offset: 1) { source } }`, OperationName: "B"},
+			wantStatus: http.StatusOK,
+			want:       `{"data":{"content":[{"source":"2"}]}}`,
+		},
+		"get request": {
+			request:    graphqlRequest{Query: `query ($n: Int = 1) { content(count: $n, sources: "3") { source __typename } }`},
+			get:        true,
+			wantStatus: http.StatusOK,
+			want:       `{"data":{"content":[{"source":"3","__typename":"Item"}]}}`,
+		},
+		"invalid count": {
+			request:    graphqlRequest{Query: `{ content(count: 0) { id } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "invalid count argument: must be positive",
+		},
+		"missing count": {
+			request:    graphqlRequest{Query: `{ content { id } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "invalid count argument: is empty",
+		},
+		"over the limit": {
+			request:    graphqlRequest{Query: `{ content(count: 11) { id } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "invalid count argument: must not be greater than 10",
+		},
+		"huge offset": {
+			request:    graphqlRequest{Query: `{ content(count: 1, offset: 9223372036854775807) { id } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "invalid offset argument: count + offset must not be greater than 15",
+		},
+		"merged fields": {
+			request:    graphqlRequest{Query: `{ content(count: 1) { id } content(count: 1) { title id } }`},
+			wantStatus: http.StatusOK,
+			want:       `{"data":{"content":[{"id":"1","title":"test title"}]}}`,
+		},
+		"conflicting fields": {
+			request:    graphqlRequest{Query: `{ feed: content(count: 1) { id } feed: content(count: 2) { id } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    `fields \"feed\" conflict`,
+		},
+		"conflicting item fields": {
+			request:    graphqlRequest{Query: `{ content(count: 1) { id id: title } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    `fields \"id\" conflict`,
+		},
+		"duplicate argument": {
+			request:    graphqlRequest{Query: `{ content(count: 1, count: 2) { id } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    `argument \"count\" is given more than once`,
+		},
+		"items over the limit in total": {
+			request:    graphqlRequest{Query: `{ a: content(count: 10) { id } b: content(count: 10) { id } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "invalid count argument: count + offset of all the content fields must not be greater than 15",
+		},
+		"too many content fields": {
+			request:    graphqlRequest{Query: `{ a0: content(count: 1) { id } a1: content(count: 1) { id } a2: content(count: 1) { id } a3: content(count: 1) { id } a4: content(count: 1) { id } a5: content(count: 1) { id } a6: content(count: 1) { id } a7: content(count: 1) { id } a8: content(count: 1) { id } a9: content(count: 1) { id } a10: content(count: 1) { id } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "must not have more than 10 content fields",
+		},
+		"unknown source": {
+			request:    graphqlRequest{Query: `{ content(count: 1, sources: ["4"]) { id } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    `unknown provider \"4\"`,
+		},
+		"unknown field": {
+			request:    graphqlRequest{Query: `{ content(count: 1) { id author } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    `cannot query field \"author\" on type Item`,
+		},
+		"no item selection": {
+			request:    graphqlRequest{Query: `{ content(count: 1) }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "must have a selection",
+		},
+		"missing variable": {
+			request:    graphqlRequest{Query: `query ($count: Int!) { content(count: $count) { id } }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "variable $count is required",
+		},
+		"ambiguous operation": {
+			request:    graphqlRequest{Query: `query A { __typename } query B { __typename }`},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "operationName is required",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var resp *http.Response
+			var err error
+			if tc.get {
+				resp, err = http.Get(srv.URL + "/graphql?query=" + url.QueryEscape(tc.request.Query))
+			} else {
+				body, _ := json.Marshal(tc.request)
+				resp, err = http.Post(srv.URL+"/graphql", "application/json", bytes.NewReader(body))
+			}
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("got status %d, want %d: %s", resp.StatusCode, tc.wantStatus, body)
+			}
+
+			if tc.want != "" {
+				// The mock provider items have random IDs.
+				if normalized := normalizeGraphQLIDs(string(body)); normalized != tc.want {
+					t.Errorf("got response %s, want %s", normalized, tc.want)
+				}
+			}
+			if tc.wantErr != "" && !strings.Contains(string(body), tc.wantErr) {
+				t.Errorf("got response %s, want error %q", body, tc.wantErr)
+			}
+		})
+	}
+
+	resp, err := http.Get(srv.URL + "/graphql?schema")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	schema, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(schema), "content(count: Int!") {
+		t.Errorf("got schema %s, want the content query", schema)
+	}
+}
+
+// normalizeGraphQLIDs replaces the values of the "id" fields with "1", and trims the response.
+func normalizeGraphQLIDs(body string) string {
+	parts := strings.Split(strings.TrimSpace(body), `"id":"`)
+	for i := 1; i < len(parts); i++ {
+		_, rest, _ := strings.Cut(parts[i], `"`)
+		parts[i] = `1"` + rest
+	}
+	return strings.Join(parts, `"id":"`)
+}
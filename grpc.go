@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	grpcGetContentPath = "/content.v1.ContentService/GetContent"
+	grpcMaxMessageSize = 4 << 20
+)
+
+// gRPC status codes, see https://grpc.github.io/grpc/core/md_doc_statuscodes.html.
+const (
+	grpcOK                = 0
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+)
+
+// GRPCHandler serves the content.v1.ContentService gRPC service (see proto/content.proto).
+// It implements the gRPC over HTTP/2 protocol directly, so it must be served with HTTP/2 enabled.
+type GRPCHandler struct {
+	service *Service
+	limits  RequestLimits
+	// memory rejects the requests that would use too much memory; nil allows all requests.
+	memory *MemoryBudget
+}
+
+// ServeHTTP implements http.Handler.
+func (h *GRPCHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.ProtoMajor != 2 || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+		writeError(w, req, http.StatusUnsupportedMediaType, ErrorCodeUnsupportedMedia, "gRPC requests must use HTTP/2 and the application/grpc content type")
+		return
+	}
+	if req.Method != http.MethodPost {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	if req.URL.Path != grpcGetContentPath {
+		writeGRPCStatus(w, grpcUnimplemented, fmt.Sprintf("unknown method %s", req.URL.Path))
+		return
+	}
+
+	ctx := req.Context()
+	if timeout, ok := parseGRPCTimeout(req.Header.Get("Grpc-Timeout")); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	msg, err := readGRPCMessage(req.Body)
+	if err != nil {
+		writeGRPCStatus(w, grpcInvalidArgument, err.Error())
+		return
+	}
+	var in GRPCContentRequest
+	if err := in.Unmarshal(msg); err != nil {
+		writeGRPCStatus(w, grpcInvalidArgument, err.Error())
+		return
+	}
+	if in.Count <= 0 || in.Offset < 0 {
+		writeGRPCStatus(w, grpcInvalidArgument, "count must be positive and offset must be positive or zero")
+		return
+	}
+	if errs := h.limits.check(int(in.Count), int(in.Offset)); len(errs) > 0 {
+		writeGRPCStatus(w, grpcInvalidArgument, errs.Error())
+		return
+	}
+	release, err := h.memory.acquire(int(in.Count), int(in.Offset))
+	if err != nil {
+		writeGRPCStatus(w, grpcResourceExhausted, err.Error())
+		return
+	}
+	defer release()
+
+	items, err := h.service.GetContent(withEndpoint(ctx, EndpointGRPC), requestMeta(req), int(in.Count), int(in.Offset))
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeGRPCStatus(w, grpcDeadlineExceeded, "deadline exceeded")
+		return
+	case err != nil:
+		slog.ErrorContext(ctx, "grpc server error", "error", err)
+		writeGRPCStatus(w, grpcInternal, "internal server error")
+		return
+	}
+
+	if policy := fieldPolicyFromContext(ctx); policy != nil {
+		for i, item := range items {
+			items[i] = policy.redact(item)
+		}
+	}
+	out := &GRPCContentResponse{Items: items}
+	if err := writeGRPCMessage(w, out.Marshal()); err != nil {
+		slog.WarnContext(ctx, "writing grpc response", "error", err)
+		return
+	}
+	writeGRPCStatus(w, grpcOK, "")
+}
+
+// writeGRPCStatus sets the gRPC status trailers.
+func writeGRPCStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", url.PathEscape(msg))
+	}
+}
+
+// readGRPCMessage reads one length-prefixed gRPC message.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("reading message prefix: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > grpcMaxMessageSize {
+		return nil, fmt.Errorf("message too large (%d bytes)", size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("reading message: %w", err)
+	}
+
+	return msg, nil
+}
+
+// writeGRPCMessage writes one length-prefixed, uncompressed gRPC message.
+func writeGRPCMessage(w io.Writer, msg []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// parseGRPCTimeout parses the "grpc-timeout" header value, like "100m" (100 milliseconds).
+func parseGRPCTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || v < 0 {
+		return 0, false
+	}
+
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[s[len(s)-1]]
+	if !ok {
+		return 0, false
+	}
+
+	return time.Duration(v) * unit, true
+}
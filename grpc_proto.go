@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Protobuf encoding of the messages defined in proto/content.proto.
+// The messages are simple, so they are encoded by hand instead of using generated code.
+
+// Protobuf wire types.
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireLen    = 2
+	wireI32    = 5
+)
+
+// GRPCContentRequest is the content.v1.GetContentRequest message.
+type GRPCContentRequest struct {
+	Count  int32
+	Offset int32
+}
+
+// Marshal encodes the message.
+func (m *GRPCContentRequest) Marshal() []byte {
+	var b []byte
+	b = appendVarintField(b, 1, uint64(m.Count))
+	b = appendVarintField(b, 2, uint64(m.Offset))
+	return b
+}
+
+// Unmarshal decodes the message.
+func (m *GRPCContentRequest) Unmarshal(b []byte) error {
+	return decodeFields(b, func(num int, typ int, v uint64, data []byte) error {
+		switch {
+		case num == 1 && typ == wireVarint:
+			m.Count = int32(v)
+		case num == 2 && typ == wireVarint:
+			m.Offset = int32(v)
+		}
+		return nil
+	})
+}
+
+// GRPCContentResponse is the content.v1.GetContentResponse message.
+type GRPCContentResponse struct {
+	Items []*ContentItem
+}
+
+// Marshal encodes the message.
+func (m *GRPCContentResponse) Marshal() []byte {
+	var b []byte
+	for _, item := range m.Items {
+		b = appendBytesField(b, 1, marshalContentItem(item))
+	}
+	return b
+}
+
+// Unmarshal decodes the message.
+func (m *GRPCContentResponse) Unmarshal(b []byte) error {
+	return decodeFields(b, func(num int, typ int, _ uint64, data []byte) error {
+		if num != 1 || typ != wireLen {
+			return nil
+		}
+		item, err := unmarshalContentItem(data)
+		if err != nil {
+			return fmt.Errorf("item %d: %w", len(m.Items), err)
+		}
+		m.Items = append(m.Items, item)
+		return nil
+	})
+}
+
+func marshalContentItem(item *ContentItem) []byte {
+	var b []byte
+	b = appendStringField(b, 1, item.ID)
+	b = appendStringField(b, 2, item.Title)
+	b = appendStringField(b, 3, item.Source)
+	b = appendStringField(b, 4, item.Summary)
+	b = appendStringField(b, 5, item.Link)
+	for _, media := range item.Media {
+		b = appendBytesField(b, 6, []byte(media))
+	}
+	if !item.Expiry.IsZero() {
+		// google.protobuf.Timestamp
+		var ts []byte
+		ts = appendVarintField(ts, 1, uint64(item.Expiry.Unix()))
+		ts = appendVarintField(ts, 2, uint64(item.Expiry.Nanosecond()))
+		b = appendBytesField(b, 7, ts)
+	}
+	return b
+}
+
+func unmarshalContentItem(b []byte) (*ContentItem, error) {
+	item := &ContentItem{}
+	err := decodeFields(b, func(num int, typ int, _ uint64, data []byte) error {
+		if typ != wireLen {
+			return nil
+		}
+		switch num {
+		case 1:
+			item.ID = string(data)
+		case 2:
+			item.Title = string(data)
+		case 3:
+			item.Source = string(data)
+		case 4:
+			item.Summary = string(data)
+		case 5:
+			item.Link = string(data)
+		case 6:
+			item.Media = append(item.Media, string(data))
+		case 7:
+			var seconds, nanos int64
+			err := decodeFields(data, func(num int, typ int, v uint64, _ []byte) error {
+				switch {
+				case num == 1 && typ == wireVarint:
+					seconds = int64(v)
+				case num == 2 && typ == wireVarint:
+					nanos = int64(int32(v))
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("expiry: %w", err)
+			}
+			item.Expiry = time.Unix(seconds, nanos).UTC()
+		}
+		return nil
+	})
+
+	return item, err
+}
+
+func appendTag(b []byte, num int, typ int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(typ))
+}
+
+// appendVarintField appends a varint field, skipping the default (zero) value like proto3 does.
+func appendVarintField(b []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, num, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendStringField appends a string field, skipping the default (empty) value like proto3 does.
+func appendStringField(b []byte, num int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	return appendBytesField(b, num, []byte(s))
+}
+
+func appendBytesField(b []byte, num int, data []byte) []byte {
+	b = appendTag(b, num, wireLen)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+var errInvalidProto = errors.New("invalid protobuf message")
+
+// decodeFields calls fn for each field of the message.
+// For varint fields `v` is set, for length-delimited fields `data` is set. Fixed-size fields are skipped.
+func decodeFields(b []byte, fn func(num int, typ int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errInvalidProto
+		}
+		b = b[n:]
+		num, typ := int(tag>>3), int(tag&7)
+
+		var v uint64
+		var data []byte
+		switch typ {
+		case wireVarint:
+			v, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errInvalidProto
+			}
+			b = b[n:]
+		case wireI64:
+			if len(b) < 8 {
+				return errInvalidProto
+			}
+			b = b[8:]
+			continue
+		case wireI32:
+			if len(b) < 4 {
+				return errInvalidProto
+			}
+			b = b[4:]
+			continue
+		case wireLen:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errInvalidProto
+			}
+			data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			return errInvalidProto
+		}
+
+		if err := fn(num, typ, v, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
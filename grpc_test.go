@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGRPCGetContent(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(&GRPCHandler{service: service})
+	configureHTTP2(srv.Config, HTTP2Settings{H2C: true})
+	srv.Start()
+	defer srv.Close()
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+	call := func(t *testing.T, path string, in *GRPCContentRequest) (*GRPCContentResponse, string) {
+		t.Helper()
+
+		var body bytes.Buffer
+		_ = writeGRPCMessage(&body, in.Marshal())
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, &body)
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("Grpc-Timeout", "5S")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var out GRPCContentResponse
+		msg, err := readGRPCMessage(resp.Body)
+		if err == nil {
+			if err := out.Unmarshal(msg); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+		}
+		_, _ = io.Copy(io.Discard, resp.Body) // Trailers are available after reading the whole body.
+
+		return &out, resp.Trailer.Get("Grpc-Status")
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		out, status := call(t, grpcGetContentPath, &GRPCContentRequest{Count: 3, Offset: 1})
+		if status != "0" {
+			t.Fatalf("got grpc status %s", status)
+		}
+		if len(out.Items) != 3 {
+			t.Fatalf("got %d items, want 3", len(out.Items))
+		}
+		for j, item := range out.Items {
+			i := j + 1
+			if Provider(item.Source) != DefaultConfig[i].Type {
+				t.Errorf("position %d: got provider %s, want %s", i, item.Source, DefaultConfig[i].Type)
+			}
+		}
+	})
+
+	t.Run("invalid argument", func(t *testing.T) {
+		if _, status := call(t, grpcGetContentPath, &GRPCContentRequest{Count: -1}); status != "3" {
+			t.Errorf("got grpc status %s, want 3", status)
+		}
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		if _, status := call(t, "/content.v1.ContentService/Other", &GRPCContentRequest{Count: 1}); status != "12" {
+			t.Errorf("got grpc status %s, want 12", status)
+		}
+	})
+}
+
+func TestGRPCMessageEncoding(t *testing.T) {
+	expiry := time.Date(2021, 6, 1, 12, 0, 0, 5, time.UTC)
+	in := &GRPCContentResponse{Items: []*ContentItem{
+		{ID: "1", Title: "title", Source: "2", Media: []string{"a", "b"}, Expiry: expiry},
+		{ID: "2"},
+	}}
+
+	var out GRPCContentResponse
+	if err := out.Unmarshal(in.Marshal()); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	if len(out.Items) != 2 {
+		t.Fatalf("got %d items, want 2", len(out.Items))
+	}
+	got := out.Items[0]
+	if got.ID != "1" || got.Title != "title" || got.Source != "2" || len(got.Media) != 2 || !got.Expiry.Equal(expiry) {
+		t.Errorf("got item %+v, want %+v", got, in.Items[0])
+	}
+}
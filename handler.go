@@ -1,70 +1,467 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Handler can handle apps HTTP requests.
 type Handler struct {
-	service *Service
+	service    *Service
+	mediaHints MediaHintsMode
+	deltas     *deltaStore
+	limits     RequestLimits
+	// memory rejects the requests that would use too much memory; nil allows all requests.
+	memory *MemoryBudget
+	// cursors sign the pagination cursors; nil disables the cursors.
+	cursors *CursorSigner
+	// explainNetworks are the client networks allowed to use the `explain` parameter.
+	explainNetworks ipNetworks
+	// swaggerUI enables the Swagger UI page at /swagger/.
+	swaggerUI bool
+	// sessions keep the feed sessions; nil disables the /sessions endpoints.
+	sessions *sessionStore
+	// deprecations are the deprecated parameters and item fields, signaled to the clients using them.
+	deprecations []Deprecation
+	// streamBuffer configures the send buffers of the streamed responses.
+	streamBuffer StreamBufferSettings
+	// liveHeartbeat is the interval of the heartbeats of the live updates stream.
+	liveHeartbeat time.Duration
+	// maxLiveSubscribers limits the clients of the live updates stream; zero means no limit.
+	maxLiveSubscribers int
+
+	openAPIOnce sync.Once
+	openAPI     []byte
+	docsOnce    sync.Once
+	docs        []byte
+	docsErr     error
 }
 
 // ServeHTTP is the main handler.
-// It knows how to handle "GET /" requests, and returns 404 for the rest.
+// It knows how to handle "GET /", "GET /feeds", "GET /feeds/{name}", "GET /providers/freshness", "GET /openapi.json",
+// "GET /docs" and "GET|POST /graphql" requests
+// (and "GET /swagger/", "POST /sessions" and "POST /sessions/{id}/next", when enabled),
+// and returns 404 for the rest.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if req.Method != http.MethodGet || req.URL.Path != "/" {
-		http.Error(w, "Not found", http.StatusNotFound)
+	instrumentHandler(http.HandlerFunc(h.route)).ServeHTTP(w, req)
+}
+
+func (h *Handler) route(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/graphql" {
+		h.GetGraphQL(w, req)
+		return
+	}
+	if h.routeSessions(w, req) || h.routeFeeds(w, req) {
+		return
+	}
+	if req.Method != http.MethodGet {
+		writeNotFound(w, req)
 		return
 	}
 
-	h.GetContent(w, req)
+	switch req.URL.Path {
+	case "/":
+		h.GetContent(w, req)
+	case "/stream":
+		h.GetLiveStream(w, req)
+	case "/providers/freshness":
+		h.GetFreshness(w, req)
+	case "/openapi.json":
+		h.GetOpenAPI(w, req)
+	case "/docs":
+		h.GetDocs(w, req)
+	case "/swagger/":
+		if !h.swaggerUI {
+			writeNotFound(w, req)
+			return
+		}
+		h.GetSwaggerUI(w, req)
+	default:
+		writeNotFound(w, req)
+	}
+}
+
+// GetFreshness returns the content freshness report of the providers.
+func (h *Handler) GetFreshness(w http.ResponseWriter, req *http.Request) {
+	if fieldPolicyFromContext(req.Context()).hides("source") {
+		writeError(w, req, http.StatusForbidden, ErrorCodeForbidden, "the providers aren't available to this client")
+		return
+	}
+	h.writeJSON(w, req, h.service.Freshness().Report())
+}
+
+// contentRequest holds the validated parameters of a content request.
+type contentRequest struct {
+	count     int
+	offset    int
+	sinceETag string
+	explain   bool
+	partial   bool
+	stream    bool
+	render    renderOptions
+	// seed shuffles the mix, when it's set.
+	seed *uint32
+	// ordering overrides the service's ordering strategy, when it's set.
+	ordering OrderingStrategy
+	// prefetchNext asks for warming the next page.
+	prefetchNext bool
+	// sources are the only providers used for the request, when set.
+	sources []Provider
+	// format is the serialization of the item list, negotiated with the Accept header.
+	format responseFormat
+	// timeout is the client timeout (timeout_ms or X-Request-Timeout), when set.
+	timeout time.Duration
 }
 
 // GetContent returns a list of content items for the `count` and `offset` query parameters.
+// The response has an ETag. When the `since_etag` parameter is given, a DeltaResponse against that ETag is returned instead.
+// The `expiry_format` (rfc3339 or unix) and `tz` (IANA time zone name) parameters control how the items expiry is rendered.
+// With `providers` (like `1,3`) and `exclude` (like `2`), only some of the configured providers are used, in the configured order.
+// With `prefetch=next`, the next page is fetched in the background after a full page, so its provider responses are cached
+// by the time the client asks for it; the response then has a Link rel=next header.
+// With `seed` (0 to 4294967295), the providers sequence is shuffled, always in the same order for the same seed.
+// With `ordering` (round_robin, priority, shuffled or score), the providers sequence is ordered with that strategy
+// instead of the configured one.
+// With `checksum=true`, every item has a content checksum, for deduplication by the clients.
+// With `partial=true`, the items are wrapped in a ContentEnvelope with the status telling which positions failed.
+// With `stream=true` or the `Accept: application/x-ndjson` header, the items are streamed as newline-delimited JSON.
+// The item list is serialized as JSON, XML or MessagePack, as negotiated with the Accept header; the other responses are always JSON.
 func (h *Handler) GetContent(w http.ResponseWriter, req *http.Request) {
-	count, offset, err := h.validateContentReq(req)
+	w.Header().Add("Vary", "Accept")
+	params, err := h.validateContentReq(req)
+	var validationErrs ValidationErrors
+	if errors.As(err, &validationErrs) {
+		h.handleValidationErr(w, req, validationErrs)
+		return
+	}
+	warnings := h.deprecationWarnings(w, req)
+	release, err := h.memory.acquire(params.count, params.offset)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeMemoryErr(w, req, err)
 		return
 	}
+	defer release()
 
-	items, err := h.service.GetContent(
-		req.Context(),
-		h.getIP(req),
-		count,
-		offset,
+	if params.stream {
+		h.streamContent(w, req, params)
+		return
+	}
+
+	ctx := params.context(req.Context(), EndpointContent)
+	var explain *explainRecorder
+	if params.explain {
+		ctx, explain = withExplain(ctx)
+	}
+
+	// The envelopes have no media hints.
+	hints := newMediaHintWriter(w, req, h.mediaHints, params.render.policy)
+	var emit func(*ContentItem)
+	if !params.explain && !params.partial {
+		emit = hints.emit
+	}
+	result, err := h.service.StreamContent(
+		ctx,
+		requestMeta(req),
+		params.count,
+		params.offset,
+		emit,
 	)
 	if err != nil {
-		h.handleServerErr(w, err)
+		writeServerErr(w, req, err)
 		return
 	}
+	items := result.Items
+	if h.cursors != nil && len(items) == params.count {
+		w.Header().Set(nextCursorHeader, h.cursors.Encode(params.offset+params.count))
+	}
+	if params.prefetchNext && len(items) == params.count && h.limits.check(params.count, params.offset+params.count) == nil {
+		w.Header().Add("Link", h.nextPageLink(req, params))
+		// Started after the response is written, so it doesn't compete with it.
+		defer h.service.Prefetch(params.context(req.Context(), EndpointContent), requestMeta(req), params.count, params.offset+params.count)
+	}
 
+	etag, err := computeETag(items)
+	if err != nil {
+		writeServerErr(w, req, err)
+		return
+	}
+	h.deltas.put(req.Context(), etag, items)
+	w.Header().Set("ETag", etag)
+	if params.explain || params.partial {
+		// The envelope metadata may differ for the same items, so it's never "not modified".
+		envelope := &ContentEnvelope{
+			Items:    params.render.renderItems(items),
+			Warnings: warnings,
+		}
+		if params.partial {
+			envelope.Status = &ResponseStatus{
+				Complete: len(result.Failures) == 0,
+				Failures: redactFailures(result.Failures, params.render.policy),
+			}
+		}
+		if explain != nil {
+			envelope.Explain = explain.Explanation()
+		}
+		h.writeJSON(w, req, envelope)
+		return
+	}
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if params.sinceETag != "" {
+		base, ok := h.deltas.get(req.Context(), params.sinceETag)
+		delta, err := computeDelta(etag, params.sinceETag, base, items, !ok, params.render)
+		if err != nil {
+			writeServerErr(w, req, err)
+			return
+		}
+		hints.write(items)
+		h.writeJSON(w, req, delta)
+		return
+	}
+
+	hints.write(items)
+	writeItems(w, req, params.format, params.render.renderItems(items))
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, req *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(items); err != nil {
-		log.Printf("encoding response to http writer: %v", err)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.WarnContext(req.Context(), "encoding response to http writer", "error", err)
 	}
 }
 
-func (h *Handler) validateContentReq(req *http.Request) (count int, offset int, err error) {
-	v, err := h.getIntParam("count", true, false, req)
+// ParamError describes an invalid request parameter.
+type ParamError struct {
+	Param   string `json:"param"`
+	Message string `json:"error"`
+	// Code identifies the errors the clients may need to handle, like an expired cursor.
+	Code string `json:"code,omitempty"`
+}
+
+// ValidationErrors is a list of all invalid request parameters.
+type ValidationErrors []ParamError
+
+// Error implements error.
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, pe := range e {
+		msgs[i] = fmt.Sprintf("invalid %s parameter: %s", pe.Param, pe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// validateContentReq checks all request parameters. If any of them is invalid, it returns ValidationErrors.
+func (h *Handler) validateContentReq(req *http.Request) (*contentRequest, error) {
+	var errs ValidationErrors
+	var err error
+	params := &contentRequest{}
+	query := req.URL.Query()
+
+	params.count, err = h.getIntParam("count", true, false, req)
 	if err != nil {
-		return 0, 0, fmt.Errorf("invalid count parameter: %w", err)
+		errs = append(errs, ParamError{Param: "count", Message: err.Error()})
 	}
-	count = v
 
-	v, err = h.getIntParam("offset", false, true, req)
+	params.offset, err = h.getIntParam("offset", false, true, req)
 	if err != nil {
-		return 0, 0, fmt.Errorf("invalid offset parameter: %w", err)
+		errs = append(errs, ParamError{Param: "offset", Message: err.Error()})
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		switch {
+		case h.cursors == nil:
+			errs = append(errs, ParamError{Param: "cursor", Message: "cursors are disabled"})
+		case query.Get("offset") != "":
+			errs = append(errs, ParamError{Param: "cursor", Message: "can't be used with offset"})
+		default:
+			params.offset, err = h.cursors.Decode(v)
+			if err != nil {
+				errs = append(errs, ParamError{Param: "cursor", Message: err.Error(), Code: cursorErrorCodes[err]})
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		errs = append(errs, h.limits.check(params.count, params.offset)...)
+	}
+
+	if v := query.Get("since_etag"); v != "" {
+		params.sinceETag = normalizeETag(v)
+	}
+
+	if v := query.Get("explain"); v != "" {
+		explain, err := strconv.ParseBool(v)
+		switch {
+		case err != nil:
+			errs = append(errs, ParamError{Param: "explain", Message: "must be a boolean"})
+		case explain && !isInternalRequest(req, h.explainNetworks):
+			errs = append(errs, ParamError{Param: "explain", Message: "is available only to internal clients"})
+		case explain && params.sinceETag != "":
+			errs = append(errs, ParamError{Param: "explain", Message: "can't be used with since_etag"})
+		case explain && fieldPolicyFromContext(req.Context()).hides("source"):
+			errs = append(errs, ParamError{Param: "explain", Message: "isn't available to this client"})
+		}
+		params.explain = explain
+	}
+
+	if v := query.Get("partial"); v != "" {
+		partial, err := strconv.ParseBool(v)
+		switch {
+		case err != nil:
+			errs = append(errs, ParamError{Param: "partial", Message: "must be a boolean"})
+		case partial && params.sinceETag != "":
+			errs = append(errs, ParamError{Param: "partial", Message: "can't be used with since_etag"})
+		}
+		params.partial = partial
 	}
-	offset = v
 
-	return count, offset, nil
+	params.format = negotiateFormat(req.Header.Get("Accept"))
+	params.stream = acceptsNDJSON(req)
+	if v := query.Get("stream"); v != "" {
+		stream, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, ParamError{Param: "stream", Message: "must be a boolean"})
+		}
+		params.stream = params.stream || stream
+	}
+	if params.stream && (params.sinceETag != "" || params.explain || params.partial) {
+		errs = append(errs, ParamError{Param: "stream", Message: "can't be used with since_etag, explain or partial"})
+	}
+
+	render, renderErrs := parseRenderOptions(query.Get("expiry_format"), query.Get("tz"))
+	params.render = render
+	params.render.policy = fieldPolicyFromContext(req.Context())
+	errs = append(errs, renderErrs...)
+	if v := query.Get("checksum"); v != "" {
+		checksum, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, ParamError{Param: "checksum", Message: "must be a boolean"})
+		}
+		params.render.checksum = checksum
+	}
+	sources, sourceErrs := h.parseSources(query.Get("providers"), query.Get("exclude"))
+	params.sources = sources
+	errs = append(errs, sourceErrs...)
+	errs = append(errs, checkSourcesAllowed(req.Context(), "providers", sources != nil)...)
+	if v := query.Get("prefetch"); v != "" {
+		switch {
+		case v != "next":
+			errs = append(errs, ParamError{Param: "prefetch", Message: "must be next"})
+		case params.stream:
+			errs = append(errs, ParamError{Param: "prefetch", Message: "can't be used with stream"})
+		}
+		params.prefetchNext = true
+	}
+	for _, p := range []struct{ name, value string }{
+		{"timeout_ms", query.Get("timeout_ms")},
+		{requestTimeoutHeader, req.Header.Get(requestTimeoutHeader)},
+	} {
+		if p.value == "" {
+			continue
+		}
+		ms, err := strconv.Atoi(p.value)
+		if err != nil || ms <= 0 {
+			errs = append(errs, ParamError{Param: p.name, Message: "must be a positive number of milliseconds"})
+			continue
+		}
+		// The shorter one wins; the service caps it with its own timeout.
+		if timeout := time.Duration(ms) * time.Millisecond; params.timeout == 0 || timeout < params.timeout {
+			params.timeout = timeout
+		}
+	}
+	if v := query.Get("seed"); v != "" {
+		seed, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			errs = append(errs, ParamError{Param: "seed", Message: "must be an integer from 0 to 4294967295"})
+		}
+		s := uint32(seed)
+		params.seed = &s
+	}
+	if v := OrderingStrategy(query.Get("ordering")); v != "" {
+		if err := v.validate(); err != nil {
+			errs = append(errs, ParamError{Param: "ordering", Message: err.Error()})
+		}
+		params.ordering = v
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return params, nil
+}
+
+// context returns the request context for the service, with the endpoint, the shuffle seed, the ordering strategy,
+// the selected providers and the client timeout.
+func (p *contentRequest) context(ctx context.Context, e Endpoint) context.Context {
+	ctx = withEndpoint(ctx, e)
+	if p.seed != nil {
+		ctx = withShuffleSeed(ctx, *p.seed)
+	}
+	if p.ordering != "" {
+		ctx = withOrdering(ctx, p.ordering)
+	}
+	if p.timeout > 0 {
+		ctx = withClientTimeout(ctx, p.timeout)
+	}
+	if p.sources != nil {
+		ctx = withSources(ctx, p.sources)
+	}
+	return ctx
+}
+
+// parseSources returns the providers selected with the comma-separated `providers` and `exclude` parameter values,
+// or nil when none are given.
+func (h *Handler) parseSources(providers, exclude string) ([]Provider, ValidationErrors) {
+	if providers == "" && exclude == "" {
+		return nil, nil
+	}
+
+	var errs ValidationErrors
+	parse := func(param, v string) map[Provider]bool {
+		set := map[Provider]bool{}
+		for _, name := range strings.Split(v, ",") {
+			p := Provider(strings.TrimSpace(name))
+			if !h.service.HasProvider(p) {
+				errs = append(errs, ParamError{Param: param, Message: fmt.Sprintf("unknown provider '%s'", p)})
+				continue
+			}
+			set[p] = true
+		}
+		return set
+	}
+	var included, excluded map[Provider]bool
+	if providers != "" {
+		included = parse("providers", providers)
+	}
+	if exclude != "" {
+		excluded = parse("exclude", exclude)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	sources := []Provider{}
+	for _, p := range h.service.Providers() {
+		if (included == nil || included[p]) && !excluded[p] {
+			sources = append(sources, p)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, ValidationErrors{{Param: "exclude", Message: "excludes all the selected providers"}}
+	}
+	return sources, nil
 }
 
 func (h *Handler) getIntParam(name string, required bool, allowZero bool, req *http.Request) (int, error) {
@@ -81,23 +478,18 @@ func (h *Handler) getIntParam(name string, required bool, allowZero bool, req *h
 	case err != nil:
 		return 0, errors.New("must be an integer")
 	case v <= 0 && !allowZero:
-		return 0, errors.New("must be positive or zero")
-	case v < 0:
 		return 0, errors.New("must be positive")
+	case v < 0:
+		return 0, errors.New("must be positive or zero")
 	}
 	return int(v), nil
 }
 
-func (h *Handler) handleServerErr(w http.ResponseWriter, err error) {
-	// We don't want to uncover error details to the client...
-	http.Error(w, "internal server error", http.StatusInternalServerError)
-
-	// ... but we want to have all the details in the logs.
-	log.Printf("http server error: %v", err)
-}
-
-func (h *Handler) getIP(req *http.Request) string {
-	v := req.RemoteAddr
-	vs := strings.Split(v, ":")
-	return vs[0]
+// handleValidationErr writes the invalid_params error with the 400 status, listing the invalid parameters in the details.
+func (h *Handler) handleValidationErr(w http.ResponseWriter, req *http.Request, errs ValidationErrors) {
+	writeErrorResponse(w, req, http.StatusBadRequest, ErrorResponse{
+		Code:    ErrorCodeInvalidParams,
+		Message: "invalid request parameters",
+		Details: errs,
+	})
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+var hedgedFallbacks = newCounterVec(
+	"hedged_fallback_calls_total",
+	"Number of fallback provider calls started because the primary provider was slow.",
+	"provider", "fallback",
+)
+
+// hedger starts the fallback fetches of the primary providers that didn't respond within the delay,
+// and serves the positions with whichever succeeds first.
+type hedger struct {
+	s     *Service
+	meta  RequestMeta
+	timer *time.Timer
+	// fired is closed when the delay passes.
+	fired chan struct{}
+
+	// counts are the numbers of positions with a fallback, by the primary and the fallback provider.
+	counts map[Provider]map[Provider]int
+	// promises are the started fallback fetches, by the primary and the fallback provider.
+	promises map[Provider]map[Provider]<-chan *configResponse
+	// failures are the first failed responses of the primary providers.
+	failures map[Provider]*configResponse
+	// tried marks the positions for which the fallback was already fetched.
+	tried []bool
+}
+
+func newHedger(s *Service, meta RequestMeta, requestConfigs []ContentConfig, delay time.Duration) *hedger {
+	h := &hedger{
+		s:        s,
+		meta:     meta,
+		fired:    make(chan struct{}),
+		counts:   make(map[Provider]map[Provider]int),
+		promises: make(map[Provider]map[Provider]<-chan *configResponse),
+		failures: make(map[Provider]*configResponse),
+		tried:    make([]bool, len(requestConfigs)),
+	}
+	for _, cfg := range requestConfigs {
+		if cfg.Fallback == nil {
+			continue
+		}
+		if h.counts[cfg.Type] == nil {
+			h.counts[cfg.Type] = make(map[Provider]int)
+		}
+		h.counts[cfg.Type][*cfg.Fallback]++
+	}
+	h.timer = time.AfterFunc(delay, func() { close(h.fired) })
+
+	return h
+}
+
+// stop releases the timer.
+func (h *hedger) stop() {
+	h.timer.Stop()
+}
+
+// await returns the response for the position i, which has a fallback.
+// Until the delay passes, only the primary provider is awaited. Then the fallbacks of the primary provider are fetched too,
+// and the first successful response is used. A primary response received before a fallback one wins.
+func (h *hedger) await(ctx context.Context, i int, cfg ContentConfig, primary <-chan *configResponse) (*configResponse, error) {
+	p := cfg.Type
+	if h.promises[p] == nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case v, ok := <-primary:
+			return h.primaryResponse(p, v, ok), nil
+		case <-h.fired:
+			h.start(ctx, p)
+		}
+	}
+
+	h.tried[i] = true
+	fallback := h.promises[p][*cfg.Fallback]
+	select {
+	case v, ok := <-primary:
+		if v := h.primaryResponse(p, v, ok); v.err == nil {
+			return v, nil
+		}
+		primary = nil
+	default:
+	}
+	for primary != nil || fallback != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case v, ok := <-primary:
+			if v := h.primaryResponse(p, v, ok); v.err == nil {
+				return v, nil
+			}
+			primary = nil
+		case v, ok := <-fallback:
+			if ok && v.err == nil {
+				contentFallbacks.Inc(string(p), string(*cfg.Fallback))
+				return v, nil
+			}
+			fallback = nil
+		}
+	}
+
+	return h.failures[p], nil
+}
+
+// start fetches the fallbacks of the primary provider.
+func (h *hedger) start(ctx context.Context, p Provider) {
+	h.promises[p] = make(map[Provider]<-chan *configResponse)
+	for fallback, count := range h.counts[p] {
+		h.promises[p][fallback] = h.s.getPromiseForProvider(ctx, fallback, h.meta, count, true)
+		hedgedFallbacks.Inc(string(p), string(fallback))
+	}
+}
+
+// primaryResponse returns the response received from the primary provider's promise, remembering the first failure.
+func (h *hedger) primaryResponse(p Provider, v *configResponse, ok bool) *configResponse {
+	if !ok {
+		v = &configResponse{err: errNotEnoughItems, provider: p}
+	}
+	if v.err != nil && h.failures[p] == nil {
+		h.failures[p] = v
+	}
+	if v.err != nil {
+		return h.failures[p]
+	}
+
+	return v
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHedgedFallbacks(t *testing.T) {
+	p3 := Provider3
+	for name, tc := range map[string]struct {
+		primary     *mockContentProvider
+		fallback    *mockContentProvider
+		wantSources []Provider
+		wantCalls   int
+		maxDuration time.Duration
+	}{
+		"fast primary": {
+			primary:     &mockContentProvider{source: Provider1},
+			fallback:    &mockContentProvider{source: Provider3},
+			wantSources: []Provider{Provider1, Provider2, Provider1},
+		},
+		"slow primary": {
+			primary:     &mockContentProvider{source: Provider1, responseDelay: time.Second},
+			fallback:    &mockContentProvider{source: Provider3},
+			wantSources: []Provider{Provider3, Provider2, Provider3},
+			wantCalls:   1,
+			maxDuration: 500 * time.Millisecond,
+		},
+		"slow failing primary": {
+			primary:     &mockContentProvider{source: Provider1, responseDelay: 50 * time.Millisecond, shouldFail: true},
+			fallback:    &mockContentProvider{source: Provider3, responseDelay: 100 * time.Millisecond},
+			wantSources: []Provider{Provider3, Provider2, Provider3},
+			wantCalls:   1,
+		},
+		"slow primary and failing fallback": {
+			primary:     &mockContentProvider{source: Provider1, responseDelay: 50 * time.Millisecond},
+			fallback:    &mockContentProvider{source: Provider3, shouldFail: true},
+			wantSources: []Provider{Provider1, Provider2, Provider1},
+			wantCalls:   1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clients := map[Provider]Client{
+				Provider1: tc.primary,
+				Provider2: &mockContentProvider{source: Provider2},
+				Provider3: tc.fallback,
+			}
+			configs := []ContentConfig{{Type: Provider1, Fallback: &p3}, {Type: Provider2}}
+			service, err := NewService(configs, clients, defaultTimeout, WithHedgedFallbacks(10*time.Millisecond))
+			if err != nil {
+				t.Fatalf("creating a service: %v", err)
+			}
+
+			start := time.Now()
+			items, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 3, 0)
+			if err != nil {
+				t.Fatalf("getting content: %v", err)
+			}
+			if tc.maxDuration > 0 && time.Since(start) > tc.maxDuration {
+				t.Errorf("got response after %v, want it within %v", time.Since(start), tc.maxDuration)
+			}
+			if len(items) != len(tc.wantSources) {
+				t.Fatalf("got %d items, want %d", len(items), len(tc.wantSources))
+			}
+			for i, item := range items {
+				if item.Source != string(tc.wantSources[i]) {
+					t.Errorf("item %d: got source %s, want %s", i, item.Source, tc.wantSources[i])
+				}
+			}
+			tc.fallback.m.Lock()
+			defer tc.fallback.m.Unlock()
+			if tc.fallback.calls != tc.wantCalls {
+				t.Errorf("got %d fallback calls, want %d", tc.fallback.calls, tc.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// maxPreconnectHosts limits the number of preconnect hints sent in one response.
+const maxPreconnectHosts = 8
+
+// MediaHintsMode defines how clients are hinted about the media hosts used by the returned items.
+type MediaHintsMode string
+
+// Supported media hints modes.
+const (
+	// MediaHintsOff disables the hints.
+	MediaHintsOff MediaHintsMode = "off"
+	// MediaHintsLink adds "Link: rel=preconnect" headers to the response.
+	MediaHintsLink MediaHintsMode = "link"
+	// MediaHintsEarly sends the "Link: rel=preconnect" headers in a "103 Early Hints" response too.
+	MediaHintsEarly MediaHintsMode = "early-hints"
+)
+
+// String implements flag.Value.
+func (m *MediaHintsMode) String() string {
+	if m == nil || *m == "" {
+		return string(MediaHintsOff)
+	}
+	return string(*m)
+}
+
+// Set implements flag.Value.
+func (m *MediaHintsMode) Set(s string) error {
+	switch v := MediaHintsMode(s); v {
+	case MediaHintsOff, MediaHintsLink, MediaHintsEarly:
+		*m = v
+		return nil
+	default:
+		return fmt.Errorf("invalid media hints mode %q, must be one of: off, link, early-hints", s)
+	}
+}
+
+// mediaHintWriter adds the preconnect hints for the media hosts of the items of a response.
+// There are no hints for a client whose field policy hides the media, as they would tell the media hosts.
+type mediaHintWriter struct {
+	w      http.ResponseWriter
+	req    *http.Request
+	mode   MediaHintsMode
+	policy FieldPolicy
+	// hinted are the origins with the Link headers.
+	hinted map[string]bool
+	// early is set when the 103 Early Hints was sent.
+	early bool
+}
+
+func newMediaHintWriter(w http.ResponseWriter, req *http.Request, mode MediaHintsMode, policy FieldPolicy) *mediaHintWriter {
+	return &mediaHintWriter{w: w, req: req, mode: mode, policy: policy, hinted: make(map[string]bool)}
+}
+
+func (h *mediaHintWriter) enabled() bool {
+	return (h.mode == MediaHintsLink || h.mode == MediaHintsEarly) && !h.policy.hides("media")
+}
+
+// emit sends the "103 Early Hints" with the media hosts of the first ready item having media, while the other items are
+// still being fetched, so the client can start connecting before the response. It's passed to Service.StreamContent.
+func (h *mediaHintWriter) emit(item *ContentItem) {
+	// Informational responses are not supported by HTTP/1.0 clients.
+	if h.early || h.mode != MediaHintsEarly || !h.enabled() || !h.req.ProtoAtLeast(1, 1) {
+		return
+	}
+	if h.add([]*ContentItem{item}) {
+		h.early = true
+		h.w.WriteHeader(http.StatusEarlyHints)
+	}
+}
+
+// write adds the hints for the media hosts of all the items to the response. It must be called before the response status is written.
+func (h *mediaHintWriter) write(items []*ContentItem) {
+	if h.enabled() {
+		h.add(items)
+	}
+}
+
+// add adds the Link headers for the origins not hinted yet, up to maxPreconnectHosts in total.
+// It returns false when there was nothing to add.
+func (h *mediaHintWriter) add(items []*ContentItem) bool {
+	added := false
+	for _, origin := range mediaOrigins(items, maxPreconnectHosts) {
+		if h.hinted[origin] || len(h.hinted) == maxPreconnectHosts {
+			continue
+		}
+		h.hinted[origin] = true
+		h.w.Header().Add("Link", fmt.Sprintf("<%s>; rel=preconnect", origin))
+		added = true
+	}
+	return added
+}
+
+// mediaOrigins returns up to `limit` distinct origins (scheme and host) of the items' media URLs, in order of appearance.
+func mediaOrigins(items []*ContentItem, limit int) []string {
+	var origins []string
+	seen := make(map[string]bool)
+	for _, item := range items {
+		for _, media := range item.Media {
+			u, err := url.Parse(media)
+			if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+			origin := u.Scheme + "://" + u.Host
+			if seen[origin] {
+				continue
+			}
+			seen[origin] = true
+			origins = append(origins, origin)
+			if len(origins) == limit {
+				return origins
+			}
+		}
+	}
+
+	return origins
+}
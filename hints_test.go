@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"reflect"
+	"testing"
+)
+
+func TestMediaHints(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1, media: []string{"https://img.example.com/a.jpg", "https://cdn.example.com/b.mp4"}},
+		Provider2: &mockContentProvider{source: Provider2, media: []string{"https://img.example.com/c.jpg", "not a url"}},
+	}
+	configs := []ContentConfig{{Type: Provider1}, {Type: Provider2}}
+	service, err := NewService(configs, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	wantLinks := []string{
+		"<https://img.example.com>; rel=preconnect",
+		"<https://cdn.example.com>; rel=preconnect",
+	}
+
+	for name, tc := range map[string]struct {
+		mode      MediaHintsMode
+		wantLinks []string
+		wantEarly bool
+	}{
+		"off": {
+			mode: MediaHintsOff,
+		},
+		"link": {
+			mode:      MediaHintsLink,
+			wantLinks: wantLinks,
+		},
+		"early hints": {
+			mode:      MediaHintsEarly,
+			wantLinks: wantLinks,
+			wantEarly: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(&Handler{service: service, mediaHints: tc.mode})
+			defer srv.Close()
+
+			var gotEarly bool
+			trace := &httptrace.ClientTrace{
+				Got1xxResponse: func(code int, _ textproto.MIMEHeader) error {
+					gotEarly = gotEarly || code == http.StatusEarlyHints
+					return nil
+				},
+			}
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?count=4", nil)
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			resp.Body.Close()
+
+			if links := resp.Header.Values("Link"); !reflect.DeepEqual(links, tc.wantLinks) {
+				t.Errorf("got Link headers %v, want %v", links, tc.wantLinks)
+			}
+			if gotEarly != tc.wantEarly {
+				t.Errorf("got early hints: %v, want %v", gotEarly, tc.wantEarly)
+			}
+		})
+	}
+}
+
+func TestEarlyHintsBeforeFetchesFinish(t *testing.T) {
+	slow := &gatedClient{release: make(chan struct{})}
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1, media: []string{"https://img.example.com/a.jpg"}},
+		Provider2: slow,
+	}
+	service, err := NewService([]ContentConfig{{Type: Provider1}, {Type: Provider2}}, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service, mediaHints: MediaHintsEarly})
+	defer srv.Close()
+
+	// The slow provider responds only after the client got the hints for the first item.
+	var earlyLinks []string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints && earlyLinks == nil {
+				earlyLinks = header.Values("Link")
+				close(slow.release)
+			}
+			return nil
+		},
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?count=2", nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var items []ItemView
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil || len(items) != 2 {
+		t.Errorf("got %d items (%v), want 2, with the slow provider released by the early hints", len(items), err)
+	}
+	if want := []string{"<https://img.example.com>; rel=preconnect"}; !reflect.DeepEqual(earlyLinks, want) {
+		t.Errorf("got early Link headers %v, want %v", earlyLinks, want)
+	}
+	if links := resp.Header.Values("Link"); !reflect.DeepEqual(links, earlyLinks) {
+		t.Errorf("got Link headers %v, want the early ones once", links)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+)
+
+// HTTP2Settings configures the HTTP/2 support of the server.
+type HTTP2Settings struct {
+	// H2C enables unencrypted HTTP/2 ("prior knowledge" only), meant for internal traffic.
+	H2C bool
+	// MaxConcurrentStreams limits the number of concurrent streams per connection.
+	MaxConcurrentStreams int
+	// MaxReceiveBufferPerConnection is the connection-level flow-control window size.
+	MaxReceiveBufferPerConnection int
+	// MaxReceiveBufferPerStream is the stream-level flow-control window size.
+	MaxReceiveBufferPerStream int
+}
+
+// configureHTTP2 enables HTTP/2 for the server.
+// HTTP/2 over TLS is negotiated automatically when the server uses TLS.
+// Zero settings fall back to the net/http defaults.
+func configureHTTP2(srv *http.Server, settings HTTP2Settings) {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(settings.H2C)
+	srv.Protocols = protocols
+
+	srv.HTTP2 = &http.HTTP2Config{
+		MaxConcurrentStreams:          settings.MaxConcurrentStreams,
+		MaxReceiveBufferPerConnection: settings.MaxReceiveBufferPerConnection,
+		MaxReceiveBufferPerStream:     settings.MaxReceiveBufferPerStream,
+	}
+}
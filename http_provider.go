@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultHTTPProviderTimeout = 5 * time.Second
+	// maxHTTPProviderResponse limits the size of the provider responses.
+	maxHTTPProviderResponse = 10 << 20
+)
+
+// HTTPProviderClient fetches the items from a provider's HTTP API.
+// It calls GET <url>?count=<count> and expects a JSON list of content items, like the ones this service returns.
+// The request metadata is passed in the X-Forwarded-For, Accept-Language, X-Experiment-Variant and traceparent headers.
+type HTTPProviderClient struct {
+	provider Provider
+	url      *url.URL
+	headers  map[string]string
+	client   *http.Client
+	// capabilitiesURL is the endpoint returning the provider Capabilities; nil when the provider has none.
+	capabilitiesURL *url.URL
+}
+
+// httpProviderParams are the parameters of the "http" clients.
+type httpProviderParams struct {
+	URL string `json:"url"`
+	// Timeout of one call, 5s by default. The calls are also limited by the content timeout.
+	Timeout Duration `json:"timeout,omitempty"`
+	// Headers are added to every call, e.g. for authentication.
+	Headers map[string]string `json:"headers,omitempty"`
+	// CapabilitiesURL is the optional endpoint returning the provider capabilities, as a JSON object like in the admin API.
+	CapabilitiesURL string `json:"capabilities_url,omitempty"`
+}
+
+// NewHTTPProviderClient returns a client of the provider's API at the URL.
+func NewHTTPProviderClient(p Provider, rawURL string, timeout time.Duration, headers map[string]string) (*HTTPProviderClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url '%s', must be an absolute http or https URL", rawURL)
+	}
+	if timeout <= 0 {
+		timeout = defaultHTTPProviderTimeout
+	}
+
+	return &HTTPProviderClient{
+		provider: p,
+		url:      u,
+		headers:  headers,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func newHTTPProviderClientFromParams(_ context.Context, p Provider, params json.RawMessage) (Client, error) {
+	var hp httpProviderParams
+	if err := decodeClientParams(params, &hp); err != nil {
+		return nil, err
+	}
+	if hp.URL == "" {
+		return nil, errors.New("url is required")
+	}
+
+	c, err := NewHTTPProviderClient(p, hp.URL, time.Duration(hp.Timeout), hp.Headers)
+	if err != nil {
+		return nil, err
+	}
+	if hp.CapabilitiesURL != "" {
+		if err := c.SetCapabilitiesURL(hp.CapabilitiesURL); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// SetCapabilitiesURL sets the endpoint returning the provider Capabilities.
+func (c *HTTPProviderClient) SetCapabilitiesURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid capabilities url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid capabilities url '%s', must be an absolute http or https URL", rawURL)
+	}
+	c.capabilitiesURL = u
+	return nil
+}
+
+// Capabilities implements CapabilityReporter. It calls GET <capabilities_url>, and returns ErrCapabilitiesUnknown without it.
+func (c *HTTPProviderClient) Capabilities(ctx context.Context) (Capabilities, error) {
+	if c.capabilitiesURL == nil {
+		return Capabilities{}, ErrCapabilitiesUnknown
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.capabilitiesURL.String(), nil)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxHTTPProviderResponse))
+		return Capabilities{}, fmt.Errorf("provider responded with status %d", resp.StatusCode)
+	}
+
+	var caps Capabilities
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxHTTPProviderResponse)).Decode(&caps); err != nil {
+		return Capabilities{}, fmt.Errorf("decoding provider capabilities: %w", err)
+	}
+	if caps.MaxCount < 0 || caps.RateLimit < 0 || caps.RateBurst < 0 {
+		return Capabilities{}, errors.New("provider capabilities must not be negative")
+	}
+
+	return caps, nil
+}
+
+// GetContent implements Client. Items without a source get the provider as the source.
+func (c *HTTPProviderClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	u := *c.url
+	q := u.Query()
+	q.Set("count", strconv.Itoa(count))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range map[string]string{
+		"X-Forwarded-For":       meta.IP,
+		"Accept-Language":       meta.Locale,
+		experimentVariantHeader: meta.Variant,
+		traceparentHeader:       meta.TraceParent,
+	} {
+		if v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxHTTPProviderResponse))
+		return nil, fmt.Errorf("provider responded with status %d", resp.StatusCode)
+	}
+
+	var items []*ContentItem
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxHTTPProviderResponse)).Decode(&items); err != nil {
+		return nil, fmt.Errorf("decoding provider response: %w", err)
+	}
+	if len(items) > count {
+		items = items[:count]
+	}
+	for _, item := range items {
+		if item == nil {
+			return nil, errors.New("provider response has a null item")
+		}
+		if item.Source == "" {
+			item.Source = string(c.provider)
+		}
+	}
+
+	return items, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	idempotencyReplayHeader = "Idempotent-Replayed"
+	idempotencyMaxKeyLength = 255
+
+	// Responses for retried requests are remembered for idempotencyWindow, up to idempotencySize of them.
+	idempotencyWindow = 24 * time.Hour
+	idempotencySize   = 1000
+)
+
+// IdempotencyGuard makes POST requests with an Idempotency-Key header safe to retry:
+// the request is handled once, and retries within the window get the original response.
+type IdempotencyGuard struct {
+	responses *MemoryCache
+	window    time.Duration
+
+	inFlight map[string]bool
+	m        sync.Mutex
+}
+
+// idempotentResponse is a remembered response, with the fingerprint of the request that produced it.
+type idempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// NewIdempotencyGuard returns a guard remembering up to `size` responses for `window`.
+func NewIdempotencyGuard(size int, window time.Duration) *IdempotencyGuard {
+	return &IdempotencyGuard{
+		responses: NewMemoryCache(size),
+		window:    window,
+		inFlight:  make(map[string]bool),
+	}
+}
+
+// Wrap returns a handler deduplicating the POST requests with an Idempotency-Key header.
+// Requests without the header are passed through.
+func (g *IdempotencyGuard) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		idempotencyKey := req.Header.Get(idempotencyKeyHeader)
+		if req.Method != http.MethodPost || idempotencyKey == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if len(idempotencyKey) > idempotencyMaxKeyLength {
+			writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(w, req, http.StatusBadRequest, ErrorCodeInvalidRequest, "couldn't read the request body")
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		key := req.URL.Path + " " + idempotencyKey
+
+		if resp, ok := g.lookup(req, key); ok {
+			if resp.Fingerprint != fingerprint {
+				writeError(w, req, http.StatusUnprocessableEntity, ErrorCodeInvalidRequest, "Idempotency-Key was already used for a different request")
+				return
+			}
+			slog.InfoContext(req.Context(), "replaying response for a retried request", "path", req.URL.Path, "idempotency_key", idempotencyKey)
+			resp.write(w)
+			return
+		}
+
+		if !g.begin(key) {
+			writeError(w, req, http.StatusConflict, ErrorCodeConflict, "a request with the same Idempotency-Key is in progress")
+			return
+		}
+		defer g.end(key)
+
+		rec := &capturingWriter{ResponseWriter: w, header: make(http.Header)}
+		next.ServeHTTP(rec, req)
+		if rec.status >= http.StatusInternalServerError {
+			// Server errors aren't remembered, so the retries can succeed.
+			return
+		}
+		g.store(req, key, &idempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      rec.status,
+			Header:      rec.header,
+			Body:        rec.body.Bytes(),
+		})
+	})
+}
+
+func (g *IdempotencyGuard) lookup(req *http.Request, key string) (*idempotentResponse, bool) {
+	data, ok, _ := g.responses.Get(req.Context(), key)
+	if !ok {
+		return nil, false
+	}
+	var resp idempotentResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		slog.ErrorContext(req.Context(), "decoding idempotent response", "error", err)
+		return nil, false
+	}
+
+	return &resp, true
+}
+
+func (g *IdempotencyGuard) store(req *http.Request, key string, resp *idempotentResponse) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "encoding idempotent response", "error", err)
+		return
+	}
+	_ = g.responses.Set(req.Context(), key, data, g.window)
+}
+
+// begin marks the key as being processed. It returns false if it already is.
+func (g *IdempotencyGuard) begin(key string) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.inFlight[key] {
+		return false
+	}
+	g.inFlight[key] = true
+	return true
+}
+
+func (g *IdempotencyGuard) end(key string) {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	delete(g.inFlight, key)
+}
+
+func (r *idempotentResponse) write(w http.ResponseWriter) {
+	for k, v := range r.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(idempotencyReplayHeader, "true")
+	w.WriteHeader(r.Status)
+	_, _ = w.Write(r.Body)
+}
+
+// capturingWriter is a http.ResponseWriter copying the written response.
+// The informational (1xx) responses, like the early hints, aren't captured.
+type capturingWriter struct {
+	http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+	// limit is the maximum size of the copied body, zero means no limit. A longer body sets truncated, and isn't copied.
+	limit     int
+	truncated bool
+}
+
+func (w *capturingWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= http.StatusOK {
+		w.status = code
+		for k, v := range w.ResponseWriter.Header() {
+			w.header[k] = v
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case w.truncated:
+	case w.limit > 0 && w.body.Len()+len(b) > w.limit:
+		w.truncated = true
+		w.body = bytes.Buffer{}
+	default:
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the original writer, for http.ResponseController.
+func (w *capturingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyGuard(t *testing.T) {
+	var calls atomic.Int32
+	guard := NewIdempotencyGuard(10, time.Minute)
+	srv := httptest.NewServer(guard.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("X-Call", strings.Repeat("x", int(n)))
+		w.WriteHeader(http.StatusCreated)
+	})))
+	defer srv.Close()
+
+	post := func(key, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/ingest", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// Cases depend on each other, so they run in order.
+	steps := []struct {
+		name       string
+		key        string
+		body       string
+		wantStatus int
+		wantCalls  int32
+		wantReplay bool
+	}{
+		{name: "first request", key: "a", body: "1", wantStatus: http.StatusCreated, wantCalls: 1},
+		{name: "retry", key: "a", body: "1", wantStatus: http.StatusCreated, wantCalls: 1, wantReplay: true},
+		{name: "different body", key: "a", body: "2", wantStatus: http.StatusUnprocessableEntity, wantCalls: 1},
+		{name: "another key", key: "b", body: "1", wantStatus: http.StatusCreated, wantCalls: 2},
+		{name: "no key", body: "1", wantStatus: http.StatusCreated, wantCalls: 3},
+		{name: "no key again", body: "1", wantStatus: http.StatusCreated, wantCalls: 4},
+	}
+	for _, step := range steps {
+		resp := post(step.key, step.body)
+		if resp.StatusCode != step.wantStatus {
+			t.Errorf("%s: got status %d, want %d", step.name, resp.StatusCode, step.wantStatus)
+		}
+		if got := calls.Load(); got != step.wantCalls {
+			t.Errorf("%s: got %d handler calls, want %d", step.name, got, step.wantCalls)
+		}
+		if got := resp.Header.Get(idempotencyReplayHeader) == "true"; got != step.wantReplay {
+			t.Errorf("%s: got replayed %v, want %v", step.name, got, step.wantReplay)
+		}
+		if step.wantReplay && resp.Header.Get("X-Call") != "x" {
+			t.Errorf("%s: got header %q, want the original response header", step.name, resp.Header.Get("X-Call"))
+		}
+	}
+}
+
+func TestCapturingWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &capturingWriter{ResponseWriter: rec, header: make(http.Header), limit: 8}
+	// The early hints are informational, the final status comes after them.
+	w.WriteHeader(http.StatusEarlyHints)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write([]byte("1234"))
+	if w.status != http.StatusCreated || w.body.String() != "1234" || w.truncated {
+		t.Errorf("got status %d, body %q and truncated %v, want %d and the body", w.status, w.body.String(), w.truncated, http.StatusCreated)
+	}
+
+	_, _ = w.Write([]byte("56789"))
+	if !w.truncated || w.body.Len() != 0 {
+		t.Errorf("got body %q and truncated %v over the limit, want it truncated", w.body.String(), w.truncated)
+	}
+	if rec.Body.String() != "123456789" {
+		t.Errorf("got response %q, want the whole body", rec.Body.String())
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IDGenerator creates IDs for the items created by the service itself, like sample or placeholder content.
+type IDGenerator interface {
+	NewID() string
+}
+
+// UUIDv7Generator creates prefixed, time-ordered UUIDs (version 7, RFC 9562), unique across instances.
+type UUIDv7Generator struct {
+	// Prefix is added to every ID, e.g. to tell the subsystem that created the item.
+	Prefix string
+	now    func() time.Time
+}
+
+// NewUUIDv7Generator returns a generator of UUIDs with the prefix.
+func NewUUIDv7Generator(prefix string) *UUIDv7Generator {
+	return &UUIDv7Generator{Prefix: prefix, now: time.Now}
+}
+
+// NewID implements IDGenerator.
+func (g *UUIDv7Generator) NewID() string {
+	var u [16]byte
+	_, _ = rand.Read(u[6:])
+	// The first 48 bits are the Unix timestamp in milliseconds.
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(g.now().UnixMilli()))
+	copy(u[:6], ts[2:])
+	u[6] = (u[6] & 0x0f) | 0x70 // Version 7.
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 9562 variant.
+
+	var s [36]byte
+	hex.Encode(s[0:8], u[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], u[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], u[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], u[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], u[10:])
+
+	return g.Prefix + string(s[:])
+}
+
+// SequentialIDGenerator creates prefixed, numbered IDs. The same sequence of calls always gets the same IDs,
+// so it's meant for reproducible runs, like the fake providers.
+type SequentialIDGenerator struct {
+	Prefix string
+
+	next int
+	m    sync.Mutex
+}
+
+// NewSequentialIDGenerator returns a generator of IDs with the prefix, numbered from zero.
+func NewSequentialIDGenerator(prefix string) *SequentialIDGenerator {
+	return &SequentialIDGenerator{Prefix: prefix}
+}
+
+// NewID implements IDGenerator.
+func (g *SequentialIDGenerator) NewID() string {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	id := g.Prefix + strconv.Itoa(g.next)
+	g.next++
+
+	return id
+}
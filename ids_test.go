@@ -0,0 +1,37 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestUUIDv7Generator(t *testing.T) {
+	g := NewUUIDv7Generator("p-")
+	g.now = func() time.Time { return time.UnixMilli(0x0123456789ab) }
+
+	format := regexp.MustCompile(`^p-01234567-89ab-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := g.NewID()
+		if !format.MatchString(id) {
+			t.Fatalf("got ID %q, want a prefixed UUIDv7 with the timestamp", id)
+		}
+		if seen[id] {
+			t.Fatalf("got duplicate ID %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestSequentialIDGenerator(t *testing.T) {
+	a, b := NewSequentialIDGenerator("x-"), NewSequentialIDGenerator("x-")
+	for i := 0; i < 3; i++ {
+		if idA, idB := a.NewID(), b.NewID(); idA != idB {
+			t.Errorf("got IDs %q and %q, want the same sequence", idA, idB)
+		}
+	}
+	if id := a.NewID(); id != "x-3" {
+		t.Errorf("got ID %q, want x-3", id)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	httpRequests = newCounterVec(
+		"http_requests_total",
+		"Number of handled HTTP requests by response status code.",
+		"code",
+	)
+	httpRequestDuration = newHistogramVec(
+		"http_request_duration_seconds",
+		"HTTP request handling duration by response status code.",
+		defaultDurationBuckets,
+		"code",
+	)
+	providerRequests = newCounterVec(
+		"provider_requests_total",
+		"Number of provider client calls by result (ok, error).",
+		"provider", "result",
+	)
+	providerRequestDuration = newHistogramVec(
+		"provider_request_duration_seconds",
+		"Provider client call duration.",
+		defaultDurationBuckets,
+		"provider",
+	)
+	providerItems = newCounterVec(
+		"provider_items_total",
+		"Number of content items returned by providers.",
+		"provider",
+	)
+	contentFallbacks = newCounterVec(
+		"content_fallbacks_total",
+		"Number of content items for which a fallback provider was used.",
+		"provider", "fallback",
+	)
+	contentFallbackSurplus = newCounterVec(
+		"content_fallback_surplus_items_total",
+		"Number of fallback items served from the surplus of the fallback provider's call for its own positions, without another call.",
+		"fallback",
+	)
+)
+
+// instrumentedClient is a Client decorator collecting call metrics and content freshness.
+type instrumentedClient struct {
+	client    Client
+	provider  Provider
+	freshness *FreshnessTracker
+	errors    *ErrorLog
+	sizes     *ItemSizeStats
+}
+
+// GetContent implements Client.
+func (c *instrumentedClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	start := time.Now()
+	items, err := c.client.GetContent(ctx, meta, count)
+	providerRequestDuration.Observe(time.Since(start).Seconds(), string(c.provider))
+	c.freshness.Record(c.provider, start, items, err)
+	if providerDebugEnabled(c.provider) {
+		// Logged at the info level, so the provider can be debugged without making all the logs verbose.
+		slog.InfoContext(ctx, "provider call",
+			"provider", c.provider,
+			"count", count,
+			"meta", meta,
+			"duration", time.Since(start),
+			"items", len(items),
+			"error", err,
+		)
+	}
+
+	if err != nil {
+		c.errors.Record(c.provider, start, err)
+		providerRequests.Inc(string(c.provider), "error")
+		return nil, err
+	}
+	providerRequests.Inc(string(c.provider), "ok")
+	providerItems.Add(float64(len(items)), string(c.provider))
+	c.sizes.Observe(items)
+
+	return items, nil
+}
+
+// instrumentHandler collects request metrics for the handler.
+func instrumentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req)
+
+		code := strconv.Itoa(rec.Status())
+		httpRequests.Inc(code)
+		httpRequestDuration.Observe(time.Since(start).Seconds(), code)
+	})
+}
+
+// statusRecorder is a http.ResponseWriter remembering the response status code.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (r *statusRecorder) WriteHeader(code int) {
+	// Informational responses (like 103 Early Hints) are not the final status.
+	if r.status == 0 && code >= 200 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements http.ResponseWriter.
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Status returns the response status code.
+func (r *statusRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of the tracked goroutines.
+const (
+	// fetchGoroutine is the goroutine fulfilling a provider promise.
+	fetchGoroutine = "fetch"
+	// refreshGoroutine is the goroutine of the background refresher calling a provider.
+	refreshGoroutine = "refresh"
+)
+
+// trackedGoroutineLabel is the profiler label with the tracker ID of a goroutine, for finding its stack.
+const trackedGoroutineLabel = "tracked_goroutine"
+
+// trackedIDs are the IDs of the tracked goroutines. They're unique in the process, so the labels of the trackers don't collide.
+var trackedIDs atomic.Uint64
+
+var (
+	liveGoroutines = newGaugeVec(
+		"provider_goroutines",
+		"Number of running provider fetch and refresh goroutines.",
+		"provider", "kind",
+	)
+	goroutineAge = newHistogramVec(
+		"provider_goroutine_age_seconds",
+		"Lifetime of the finished provider fetch and refresh goroutines.",
+		defaultDurationBuckets,
+		"provider", "kind",
+	)
+	leakedGoroutines = newCounterVec(
+		"provider_goroutines_leaked_total",
+		"Number of provider goroutines reported running for longer than the content timeout.",
+		"provider", "kind",
+	)
+)
+
+// GoroutineTracker keeps track of the provider goroutines, to find the leaking ones.
+// The goroutines are registered with IDs of the tracker, and labeled with them for the profiler,
+// so the stacks of the leaking ones can be found in the goroutine profile.
+type GoroutineTracker struct {
+	now func() time.Time
+
+	m    sync.Mutex
+	live map[uint64]*trackedGoroutine
+}
+
+type trackedGoroutine struct {
+	provider Provider
+	kind     string
+	// requestID is the ID of the request the goroutine was started for, which ties it to the request's log lines.
+	requestID string
+	started   time.Time
+	reported  bool
+}
+
+// NewGoroutineTracker returns an empty tracker.
+func NewGoroutineTracker() *GoroutineTracker {
+	return &GoroutineTracker{
+		now:  time.Now,
+		live: make(map[uint64]*trackedGoroutine),
+	}
+}
+
+// Track registers the calling goroutine, started for the request of the context.
+// The returned function must be called when the goroutine finishes; it restores the profiler labels of the context.
+func (t *GoroutineTracker) Track(ctx context.Context, p Provider, kind string) func() {
+	g := &trackedGoroutine{provider: p, kind: kind, requestID: requestIDFromContext(ctx), started: t.now()}
+
+	id := trackedIDs.Add(1)
+	t.m.Lock()
+	t.live[id] = g
+	t.m.Unlock()
+	liveGoroutines.Add(1, string(p), kind)
+	pprof.SetGoroutineLabels(pprof.WithLabels(ctx, pprof.Labels(trackedGoroutineLabel, strconv.FormatUint(id, 10))))
+
+	return func() {
+		pprof.SetGoroutineLabels(ctx)
+		t.m.Lock()
+		delete(t.live, id)
+		t.m.Unlock()
+		liveGoroutines.Add(-1, string(p), kind)
+		goroutineAge.Observe(t.now().Sub(g.started).Seconds(), string(p), kind)
+	}
+}
+
+// Watch reports the goroutines running for longer than maxAge every interval, until the context is done.
+// maxAge is called on every check, so it can follow the configuration changes.
+func (t *GoroutineTracker) Watch(ctx context.Context, interval time.Duration, maxAge func() time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.check(maxAge())
+		}
+	}
+}
+
+// check logs the goroutines older than maxAge, with the IDs of their requests and their stacks.
+// Every goroutine is reported once.
+func (t *GoroutineTracker) check(maxAge time.Duration) int {
+	now := t.now()
+	old := make(map[uint64]*trackedGoroutine)
+	t.m.Lock()
+	for id, g := range t.live {
+		if !g.reported && now.Sub(g.started) > maxAge {
+			g.reported = true
+			old[id] = g
+		}
+	}
+	t.m.Unlock()
+	if len(old) == 0 {
+		return 0
+	}
+
+	stacks := trackedStacks()
+	for id, g := range old {
+		leakedGoroutines.Inc(string(g.provider), g.kind)
+		slog.Warn("provider goroutine outlived the content timeout",
+			"provider", g.provider,
+			"kind", g.kind,
+			"age", now.Sub(g.started),
+			"request_id", g.requestID,
+			"stack", stacks[strconv.FormatUint(id, 10)],
+		)
+	}
+
+	return len(old)
+}
+
+// trackedStacks returns the current stacks of the tracked goroutines from the goroutine profile, by the tracker IDs.
+// The goroutines started by a tracked one inherit its label, so their stacks are included too.
+func trackedStacks() map[string]string {
+	var profile bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&profile, 1); err != nil {
+		return nil
+	}
+
+	stacks := make(map[string]string)
+	// The records of the goroutines with the same stack and labels are separated by empty lines.
+	for _, record := range strings.Split(profile.String(), "\n\n") {
+		_, rest, ok := strings.Cut(record, "\n# labels: ")
+		if !ok {
+			continue
+		}
+		rawLabels, stack, _ := strings.Cut(rest, "\n")
+		var labels map[string]string
+		if err := json.Unmarshal([]byte(rawLabels), &labels); err != nil || labels[trackedGoroutineLabel] == "" {
+			continue
+		}
+		id := labels[trackedGoroutineLabel]
+		if stacks[id] != "" {
+			stack = stacks[id] + "\n" + stack
+		}
+		stacks[id] = stack
+	}
+
+	return stacks
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGoroutineLeaks(t *testing.T) {
+	client := &gatedClient{release: make(chan struct{})}
+	clients := map[Provider]Client{Provider1: client}
+	service, err := NewService([]ContentConfig{{Type: Provider1}}, clients, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+
+	// The client ignores the context, but the request still ends on time.
+	start := time.Now()
+	if _, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 1, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want deadline exceeded", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("got response after %v, want it after the timeout", d)
+	}
+
+	// Only the abandoned fetch is left running, and it's reported once.
+	time.Sleep(20 * time.Millisecond)
+	if n := service.goroutines.check(service.MaxTimeout()); n != 1 {
+		t.Errorf("got %d goroutines reported, want 1", n)
+	}
+	if n := service.goroutines.check(service.MaxTimeout()); n != 0 {
+		t.Errorf("got %d goroutines reported again, want 0", n)
+	}
+
+	close(client.release)
+	if err := service.Drain(context.Background()); err != nil {
+		t.Fatalf("draining: %v", err)
+	}
+	service.goroutines.m.Lock()
+	defer service.goroutines.m.Unlock()
+	if len(service.goroutines.live) != 0 {
+		t.Errorf("got %d goroutines tracked after they finished, want 0", len(service.goroutines.live))
+	}
+}
+
+func TestGoroutineTracker(t *testing.T) {
+	now := time.Now()
+	tracker := NewGoroutineTracker()
+	tracker.now = func() time.Time { return now }
+
+	// The goroutines are told apart by their registrations, so one goroutine can track several calls.
+	ctx := contextWithRequestID(context.Background(), "test-request")
+	doneFetch := tracker.Track(ctx, Provider1, fetchGoroutine)
+	doneRefresh := tracker.Track(context.Background(), Provider1, refreshGoroutine)
+	now = now.Add(time.Minute)
+	if n := tracker.check(time.Second); n != 2 {
+		t.Errorf("got %d goroutines reported, want 2", n)
+	}
+
+	doneFetch()
+	doneRefresh()
+
+	// The stacks are found by the labels of the running goroutines.
+	tracked, release, finished := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		defer tracker.Track(ctx, Provider1, fetchGoroutine)()
+		close(tracked)
+		<-release
+	}()
+	<-tracked
+	tracker.m.Lock()
+	var id uint64
+	for id = range tracker.live {
+	}
+	tracker.m.Unlock()
+	stacks := trackedStacks()
+	if !strings.Contains(stacks[strconv.FormatUint(id, 10)], "TestGoroutineTracker") {
+		t.Errorf("got stack %q, want the stack of the tracked goroutine", stacks[strconv.FormatUint(id, 10)])
+	}
+	// The finished registrations of this goroutine removed their labels.
+	if len(stacks) > 0 && strings.Contains(strings.Join(slices.Collect(maps.Values(stacks)), "\n"), "TestGoroutineTracker+") {
+		t.Errorf("got the stack of the test goroutine after its registrations finished")
+	}
+	close(release)
+	<-finished
+
+	tracker.m.Lock()
+	defer tracker.m.Unlock()
+	if len(tracker.live) != 0 {
+		t.Errorf("got %d goroutines tracked after they finished, want 0", len(tracker.live))
+	}
+}
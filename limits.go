@@ -0,0 +1,25 @@
+package main
+
+import "fmt"
+
+// RequestLimits bound the work a single content request can cause. Zero values mean no limit.
+type RequestLimits struct {
+	// MaxCount is the maximum `count` parameter.
+	MaxCount int
+	// MaxItems is the maximum of `count` + `offset`, the number of items fetched from the providers.
+	MaxItems int
+}
+
+// check returns the errors for the parameters exceeding the limits.
+func (l RequestLimits) check(count, offset int) ValidationErrors {
+	var errs ValidationErrors
+	if l.MaxCount > 0 && count > l.MaxCount {
+		errs = append(errs, ParamError{Param: "count", Message: fmt.Sprintf("must not be greater than %d", l.MaxCount)})
+	}
+	// The offset is compared with the items left after the count, as count + offset overflows for huge offsets.
+	if l.MaxItems > 0 && offset > l.MaxItems-count {
+		errs = append(errs, ParamError{Param: "offset", Message: fmt.Sprintf("count + offset must not be greater than %d", l.MaxItems)})
+	}
+
+	return errs
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// liveContentType is the media type of the Server-Sent Events responses.
+const liveContentType = "text/event-stream"
+
+var (
+	liveSubscribers = newGaugeVec(
+		"live_subscribers",
+		"Number of clients connected to the live updates stream (/stream).",
+	)
+	liveRejected = newCounterVec(
+		"live_subscribers_rejected_total",
+		"Number of live updates stream connections rejected with 503, because of the -max-live-subscribers limit.",
+	)
+	liveItems = newCounterVec(
+		"live_items_total",
+		"Number of new items found by the background refresher and pushed to the live updates stream.",
+		"provider",
+	)
+)
+
+// liveUpdates passes the new items found by the background refresher to the subscribers of the live updates stream.
+// An item is new when it wasn't in the provider's previous refresh; the first refresh of a provider only sets the baseline.
+type liveUpdates struct {
+	// seen are the IDs of the items of the last refresh, by provider.
+	seen        map[Provider]map[string]bool
+	subscribers map[*liveSubscriber]bool
+	closed      bool
+	m           sync.Mutex
+}
+
+// liveSubscriber receives the new items of the providers it's subscribed to.
+type liveSubscriber struct {
+	// providers are the providers of the items, nil for all of them.
+	providers map[Provider]bool
+	items     chan *ContentItem
+	// done is closed when the subscriber is dropped, because it was too slow or the updates stopped.
+	done chan struct{}
+}
+
+func newLiveUpdates() *liveUpdates {
+	return &liveUpdates{
+		seen:        make(map[Provider]map[string]bool),
+		subscribers: make(map[*liveSubscriber]bool),
+	}
+}
+
+// subscribe returns a subscriber to the items of the providers (all of them when nil), buffering up to size items.
+// It returns nil when there are `limit` subscribers already; zero means no limit.
+func (u *liveUpdates) subscribe(providers []Provider, size, limit int) *liveSubscriber {
+	sub := &liveSubscriber{items: make(chan *ContentItem, max(size, 1)), done: make(chan struct{})}
+	if providers != nil {
+		sub.providers = make(map[Provider]bool, len(providers))
+		for _, p := range providers {
+			sub.providers[p] = true
+		}
+	}
+
+	u.m.Lock()
+	defer u.m.Unlock()
+	if u.closed {
+		close(sub.done)
+		return sub
+	}
+	if limit > 0 && len(u.subscribers) >= limit {
+		return nil
+	}
+	u.subscribers[sub] = true
+	liveSubscribers.Add(1)
+
+	return sub
+}
+
+// unsubscribe stops passing the items to the subscriber.
+func (u *liveUpdates) unsubscribe(sub *liveSubscriber) {
+	u.m.Lock()
+	defer u.m.Unlock()
+	u.drop(sub)
+}
+
+// drop removes the subscriber, and closes its done channel. It's called with the lock held.
+func (u *liveUpdates) drop(sub *liveSubscriber) {
+	if !u.subscribers[sub] {
+		return
+	}
+	delete(u.subscribers, sub)
+	close(sub.done)
+	liveSubscribers.Add(-1)
+}
+
+// publish passes the provider's refreshed items that weren't in its previous refresh to the subscribers.
+// A subscriber with a full buffer is dropped, so a slow client never delays the refresher.
+func (u *liveUpdates) publish(p Provider, items []*ContentItem) {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	previous, ok := u.seen[p]
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		seen[item.ID] = true
+	}
+	u.seen[p] = seen
+	if !ok {
+		return
+	}
+
+	for _, item := range items {
+		if previous[item.ID] {
+			continue
+		}
+		liveItems.Inc(string(p))
+		for sub := range u.subscribers {
+			if sub.providers != nil && !sub.providers[p] {
+				continue
+			}
+			select {
+			case sub.items <- item:
+			default:
+				streamSlowConsumers.Inc()
+				u.drop(sub)
+			}
+		}
+	}
+}
+
+// close drops all the subscribers, and rejects the new ones.
+func (u *liveUpdates) close() {
+	u.m.Lock()
+	defer u.m.Unlock()
+	u.closed = true
+	for sub := range u.subscribers {
+		u.drop(sub)
+	}
+}
+
+// LiveUpdatesEnabled tells whether the live updates stream has any items, which are found by the background refresher.
+func (s *Service) LiveUpdatesEnabled() bool {
+	return len(s.refreshed) > 0
+}
+
+// CloseLiveUpdates disconnects the live updates subscribers, e.g. when the server shuts down.
+func (s *Service) CloseLiveUpdates() {
+	s.live.close()
+}
+
+// GetLiveStream streams the new items found by the background refresher as Server-Sent Events, until the client disconnects.
+// Every item is an `item` event with the item ID as the event ID. A comment is sent every heartbeat interval,
+// so the proxies don't close an idle connection. With `providers` and `exclude`, only some providers' items are sent.
+func (h *Handler) GetLiveStream(w http.ResponseWriter, req *http.Request) {
+	if !h.service.LiveUpdatesEnabled() {
+		writeError(w, req, http.StatusNotFound, ErrorCodeNotFound, "live updates need the background refresher (-refresh-items)")
+		return
+	}
+	query := req.URL.Query()
+	sources, errs := h.parseSources(query.Get("providers"), query.Get("exclude"))
+	errs = append(errs, checkSourcesAllowed(req.Context(), "providers", sources != nil)...)
+	if len(errs) > 0 {
+		h.handleValidationErr(w, req, errs)
+		return
+	}
+
+	render := renderOptions{policy: fieldPolicyFromContext(req.Context())}
+	sub := h.service.live.subscribe(sources, h.streamBuffer.Size, h.maxLiveSubscribers)
+	if sub == nil {
+		liveRejected.Inc()
+		w.Header().Set("Retry-After", shedRetryAfter)
+		writeError(w, req, http.StatusServiceUnavailable, ErrorCodeOverloaded, "the live updates stream has too many subscribers, try again later")
+		return
+	}
+	defer h.service.live.unsubscribe(sub)
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout; the slow clients are disconnected with the maximum lag instead.
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", liveContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	// Disables the response buffering of nginx.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	write := func(event string) error {
+		if h.streamBuffer.MaxLag > 0 {
+			_ = rc.SetWriteDeadline(time.Now().Add(h.streamBuffer.MaxLag))
+		}
+		if _, err := fmt.Fprint(w, event); err != nil {
+			return writeErr(err)
+		}
+		return rc.Flush()
+	}
+	if err := write(": connected\n\n"); err != nil {
+		return
+	}
+
+	var heartbeat <-chan time.Time
+	if h.liveHeartbeat > 0 {
+		ticker := time.NewTicker(h.liveHeartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	for {
+		var err error
+		select {
+		case <-req.Context().Done():
+			return
+		case <-sub.done:
+			return
+		case <-heartbeat:
+			err = write(": heartbeat\n\n")
+		case item := <-sub.items:
+			err = h.writeLiveItem(req.Context(), write, item, render)
+		}
+		if err != nil {
+			slog.DebugContext(req.Context(), "writing live updates", "error", err)
+			return
+		}
+	}
+}
+
+func (h *Handler) writeLiveItem(ctx context.Context, write func(string) error, item *ContentItem, render renderOptions) error {
+	data, err := json.Marshal(render.renderItem(item))
+	if err != nil {
+		slog.ErrorContext(ctx, "encoding a live item", "id", item.ID, "error", err)
+		return nil
+	}
+	// The line breaks would end the event ID field early.
+	id := strings.NewReplacer("\r", "", "\n", "").Replace(item.ID)
+	return write(fmt.Sprintf("id: %s\nevent: item\ndata: %s\n\n", id, data))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLiveStream(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: &mockContentProvider{source: Provider2},
+	}
+	configs := []ContentConfig{{Type: Provider1}, {Type: Provider2}}
+	service, err := NewService(configs, clients, defaultTimeout,
+		WithCache(NewMemoryCache(100), CacheSettings{TTL: time.Minute}),
+		WithBackgroundRefresh(RefreshSettings{Items: 2, Interval: time.Minute, MaxStaleness: 2 * time.Minute}),
+	)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service, streamBuffer: StreamBufferSettings{Size: 16}, liveHeartbeat: 10 * time.Millisecond})
+	defer srv.Close()
+	disabled, err := NewService(configs, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	disabledSrv := httptest.NewServer(&Handler{service: disabled})
+	defer disabledSrv.Close()
+
+	// The first refresh is the baseline, its items aren't new.
+	for p, c := range service.refreshed {
+		service.refreshProvider(context.Background(), p, c)
+	}
+
+	for name, tc := range map[string]struct {
+		url         string
+		wantStatus  int
+		wantSources []string
+	}{
+		"all providers":     {url: srv.URL + "/stream", wantStatus: http.StatusOK, wantSources: []string{"1", "1", "2", "2"}},
+		"excluded provider": {url: srv.URL + "/stream?exclude=1", wantStatus: http.StatusOK, wantSources: []string{"2", "2"}},
+		"unknown provider":  {url: srv.URL + "/stream?providers=9", wantStatus: http.StatusBadRequest},
+		"no refresher":      {url: disabledSrv.URL + "/stream", wantStatus: http.StatusNotFound},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, tc.url, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != liveContentType {
+				t.Errorf("got content type %q, want %q", ct, liveContentType)
+			}
+
+			scanner := bufio.NewScanner(resp.Body)
+			// The subscription is made before the first comment.
+			scanner.Scan()
+			for _, p := range []Provider{Provider1, Provider2} {
+				service.refreshProvider(context.Background(), p, service.refreshed[p])
+			}
+
+			var sources []string
+			var ids, heartbeats int
+			for len(sources) < len(tc.wantSources) || heartbeats == 0 {
+				if !scanner.Scan() {
+					t.Fatalf("stream ended after items from %v and %d heartbeats: %v", sources, heartbeats, scanner.Err())
+				}
+				line := scanner.Text()
+				switch {
+				case line == ": heartbeat":
+					heartbeats++
+				case strings.HasPrefix(line, "id: "):
+					ids++
+				case strings.HasPrefix(line, "data: "):
+					var item ItemView
+					if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &item); err != nil {
+						t.Fatalf("decoding item: %v", err)
+					}
+					sources = append(sources, item.Source)
+				}
+			}
+			if strings.Join(sources, ",") != strings.Join(tc.wantSources, ",") {
+				t.Errorf("got items from %v, want from %v", sources, tc.wantSources)
+			}
+			if ids != len(sources) {
+				t.Errorf("got %d event IDs for %d items", ids, len(sources))
+			}
+		})
+	}
+}
+
+func TestLiveSubscriberLimit(t *testing.T) {
+	service, err := NewService([]ContentConfig{{Type: Provider1}}, map[Provider]Client{Provider1: &mockContentProvider{source: Provider1}}, defaultTimeout,
+		WithCache(NewMemoryCache(100), CacheSettings{TTL: time.Minute}),
+		WithBackgroundRefresh(RefreshSettings{Items: 2, Interval: time.Minute, MaxStaleness: 2 * time.Minute}),
+	)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	// The live updates streams aren't counted by the in-flight limit, so a subscriber doesn't block the other requests.
+	srv := httptest.NewServer(withInFlightLimit(&Handler{service: service, maxLiveSubscribers: 1}, 1))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	// The subscription is made before the first comment.
+	bufio.NewScanner(resp.Body).Scan()
+
+	for path, want := range map[string]int{"/stream": http.StatusServiceUnavailable, "/?count=1": http.StatusOK} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s: got status %d with a subscriber connected, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestLiveUpdatesSlowSubscriber(t *testing.T) {
+	u := newLiveUpdates()
+	sub := u.subscribe(nil, 1, 0)
+	u.publish(Provider1, []*ContentItem{{ID: "a"}})
+	u.publish(Provider1, []*ContentItem{{ID: "b"}, {ID: "c"}})
+
+	select {
+	case <-sub.done:
+	default:
+		t.Fatal("the subscriber with a full buffer wasn't dropped")
+	}
+	if item := <-sub.items; item.ID != "b" {
+		t.Errorf("got item %s, want b", item.ID)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const (
+	requestIDHeader      = "X-Request-ID"
+	maxRequestIDLength   = 128
+	requestIDLogAttrName = "request_id"
+	apiKeyLogAttrName    = "api_key"
+)
+
+type requestIDKey struct{}
+
+// LogFormat is the log output format.
+type LogFormat string
+
+// Log formats.
+const (
+	LogFormatText LogFormat = "text"
+	LogFormatJSON LogFormat = "json"
+)
+
+// String implements flag.Value.
+func (f *LogFormat) String() string {
+	return string(*f)
+}
+
+// Set implements flag.Value.
+func (f *LogFormat) Set(s string) error {
+	switch LogFormat(s) {
+	case LogFormatText, LogFormatJSON:
+		*f = LogFormat(s)
+		return nil
+	default:
+		return fmt.Errorf("invalid log format '%s', must be one of: text, json", s)
+	}
+}
+
+// newLogger returns a logger writing in the given format, adding request IDs from the context to the records.
+func newLogger(w io.Writer, format LogFormat, level slog.Leveler) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	if format == LogFormatJSON {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+
+	return slog.New(contextHandler{h})
+}
+
+// contextHandler is a slog.Handler adding the request ID and the API key name from the context to the records.
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle implements slog.Handler.
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String(requestIDLogAttrName, id))
+	}
+	if ctx != nil {
+		if name := apiKeyNameFromContext(ctx); name != "" {
+			r.AddAttrs(slog.String(apiKeyLogAttrName, name))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler.
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler.
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// withRequestID makes sure every request has an ID: the one from the X-Request-ID header, or a generated one.
+// The ID is returned in the response header and stored in the request context, so all the request logs include it.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, req.WithContext(contextWithRequestID(req.Context(), id)))
+	})
+}
+
+func contextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFromContext returns the request ID, or an empty string if there is none.
+func requestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII characters, so they're safe to log and return.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool { return r <= ' ' || r > '~' }) < 0
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
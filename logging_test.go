@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(newLogger(&logs, LogFormatText, slog.LevelInfo))
+	defer slog.SetDefault(defaultLogger)
+
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(withRequestID(&Handler{service: service}))
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		header string
+		want   string
+	}{
+		"propagated":    {header: "abc-123", want: "abc-123"},
+		"generated":     {header: "", want: ""},
+		"invalid":       {header: "a b", want: ""},
+		"too long":      {header: strings.Repeat("a", maxRequestIDLength+1), want: ""},
+		"max length ok": {header: strings.Repeat("b", maxRequestIDLength), want: strings.Repeat("b", maxRequestIDLength)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			logs.Reset()
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?count=3", nil)
+			if tc.header != "" {
+				req.Header.Set(requestIDHeader, tc.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			resp.Body.Close()
+
+			id := resp.Header.Get(requestIDHeader)
+			if tc.want != "" && id != tc.want {
+				t.Errorf("got request ID %q, want %q", id, tc.want)
+			}
+			if tc.want == "" && (id == "" || id == tc.header) {
+				t.Errorf("got request ID %q, want a generated one", id)
+			}
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				if strings.Contains(line, "fetched data") && !strings.Contains(line, "request_id="+id) {
+					t.Errorf("provider fetch log line without the request ID: %s", line)
+				}
+			}
+			if !strings.Contains(logs.String(), "fetched data") {
+				t.Error("no provider fetch log lines")
+			}
+		})
+	}
+}
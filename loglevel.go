@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxLogLevelDuration is the longest time a log level change can last before it's reverted.
+const maxLogLevelDuration = 24 * time.Hour
+
+// debugProviders are the providers whose calls are logged in detail, regardless of the log level.
+var debugProviders atomic.Pointer[map[Provider]bool]
+
+// providerDebugEnabled tells if the provider calls should be logged in detail.
+func providerDebugEnabled(p Provider) bool {
+	providers := debugProviders.Load()
+	return providers != nil && (*providers)[p]
+}
+
+// LogLevelChange is a temporary change of the logging, made at runtime.
+type LogLevelChange struct {
+	Level slog.Level `json:"level"`
+	// Providers are the providers whose calls are logged in detail.
+	Providers []Provider `json:"providers,omitempty"`
+	// Duration is how long the change lasts. Zero uses the default duration.
+	Duration Duration `json:"duration,omitempty"`
+}
+
+// LogLevelState describes the current logging settings.
+type LogLevelState struct {
+	Level slog.Level `json:"level"`
+	// DefaultLevel is the level set on startup, restored when the change is reverted.
+	DefaultLevel   slog.Level `json:"default_level"`
+	DebugProviders []Provider `json:"debug_providers"`
+	// RevertsAt is when the current change is reverted; it's empty when the default settings are used.
+	RevertsAt *time.Time `json:"reverts_at,omitempty"`
+}
+
+// LogLevelController changes the log level at runtime, and reverts the change after a while,
+// so the verbose logging isn't left on by accident.
+type LogLevelController struct {
+	level           *slog.LevelVar
+	defaultLevel    slog.Level
+	defaultDuration time.Duration
+
+	m     sync.Mutex
+	timer *time.Timer
+	// changes counts the changes, so a timer of a replaced change doesn't revert the current one.
+	changes   int
+	providers []Provider
+	revertsAt time.Time
+}
+
+// NewLogLevelController returns a controller of the level. The current level is the default one.
+func NewLogLevelController(level *slog.LevelVar, defaultDuration time.Duration) *LogLevelController {
+	return &LogLevelController{
+		level:           level,
+		defaultLevel:    level.Level(),
+		defaultDuration: defaultDuration,
+	}
+}
+
+// Set applies the change, replacing the previous one.
+func (c *LogLevelController) Set(ctx context.Context, change LogLevelChange) error {
+	d := time.Duration(change.Duration)
+	if d == 0 {
+		d = c.defaultDuration
+	}
+	if d <= 0 || d > maxLogLevelDuration {
+		return fmt.Errorf("duration must be positive and at most %v", maxLogLevelDuration)
+	}
+	if slices.Contains(change.Providers, "") {
+		return errors.New("provider names must not be empty")
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.level.Set(change.Level)
+	c.providers = slices.Clone(change.Providers)
+	providers := make(map[Provider]bool, len(change.Providers))
+	for _, p := range change.Providers {
+		providers[p] = true
+	}
+	debugProviders.Store(&providers)
+	c.revertsAt = time.Now().Add(d)
+	c.changes++
+	n := c.changes
+	c.timer = time.AfterFunc(d, func() { c.revert(n) })
+
+	slog.InfoContext(ctx, "log level changed", "level", change.Level, "providers", change.Providers, "reverts_at", c.revertsAt)
+
+	return nil
+}
+
+// Reset restores the default settings.
+func (c *LogLevelController) Reset(ctx context.Context) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.reset()
+	slog.InfoContext(ctx, "log level reset", "level", c.defaultLevel)
+}
+
+// State returns the current settings.
+func (c *LogLevelController) State() LogLevelState {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	state := LogLevelState{
+		Level:          c.level.Level(),
+		DefaultLevel:   c.defaultLevel,
+		DebugProviders: slices.Clone(c.providers),
+	}
+	if state.DebugProviders == nil {
+		state.DebugProviders = []Provider{}
+	}
+	if c.timer != nil {
+		revertsAt := c.revertsAt
+		state.RevertsAt = &revertsAt
+	}
+
+	return state
+}
+
+// revert restores the default settings when the timer of the current change fires.
+func (c *LogLevelController) revert(n int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// The change was replaced or reset in the meantime.
+	if c.changes != n || c.timer == nil {
+		return
+	}
+	c.reset()
+	slog.Info("log level change reverted", "level", c.defaultLevel)
+}
+
+func (c *LogLevelController) reset() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.level.Set(c.defaultLevel)
+	c.providers = nil
+	c.revertsAt = time.Time{}
+	debugProviders.Store(nil)
+}
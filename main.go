@@ -2,56 +2,710 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 var (
-	addr = flag.String("addr", "127.0.0.1:8080", "the TCP address for the server to listen on, in the form 'host:port'")
+	addr              = flag.String("addr", "127.0.0.1:8080", "the TCP address for the server to listen on, in the form 'host:port'")
+	grpcAddr          = flag.String("grpc-addr", "", "the TCP address for the gRPC server to listen on, in the form 'host:port'; empty disables the gRPC server")
+	configPath        = flag.String("config", "", "path to the JSON or YAML (.yaml, .yml) configuration file; when empty, the default configuration is used")
+	experimentsFile   = flag.String("experiments-file", "", "path to the file persisting the experiments managed with the admin API, loaded on start; empty keeps them in memory only")
+	configHistoryPath = flag.String("config-history", "", "path to the file persisting the active and previous config versions changed with the admin API; when it exists, its active version is used instead of the -config file; empty keeps the versions in memory only")
+	staticContentPath = flag.String("static-content", "", "path to the JSON or YAML (.yaml, .yml) file with the items of the 'static' provider, reloaded when changed; when empty, the built-in items are used")
+	tlsCert           = flag.String("tls-cert", "", "path to the PEM encoded TLS certificate; with -tls-key, the server serves HTTPS")
+	tlsKey            = flag.String("tls-key", "", "path to the PEM encoded private key of the -tls-cert certificate")
+	autocertHosts     = flag.String("autocert-hosts", "", "comma-separated host names for which TLS certificates are obtained from Let's Encrypt, instead of -tls-cert; empty disables it")
+	autocertCacheDir  = flag.String("autocert-cache-dir", "autocert", "directory where the certificates obtained from Let's Encrypt are kept")
+	autocertEmail     = flag.String("autocert-email", "", "contact email of the Let's Encrypt account, for notifications about the certificates")
+	autocertHTTPAddr  = flag.String("autocert-http-addr", "", "the TCP address of the HTTP server answering the Let's Encrypt HTTP-01 challenges and redirecting other requests to HTTPS, e.g. ':80'; empty disables it, and only the TLS-ALPN-01 challenges on the HTTPS port are used")
+	adminAddr         = flag.String("admin-addr", "", "the TCP address for the admin server to listen on, in the form 'host:port'; empty disables the admin server")
+
+	cacheTTL      = flag.Duration("cache-ttl", 0, "how long provider responses are kept in the in-memory cache; zero disables the in-memory cache")
+	cachePerUser  = flag.Bool("cache-per-user", false, "cache provider responses separately for each user IP")
+	cacheRefetch  = flag.Bool("cache-refetch-expired", false, "fetch the cached items that expired before they are served again from the provider, within the request timeout")
+	cacheSize     = flag.Int("cache-size", 1000, "maximum number of entries in the in-memory cache")
+	refreshItems  = flag.Int("refresh-items", 0, "number of items fetched from each provider in the background into the cache, so the requests are served from warm data; zero disables the background refresh")
+	refreshEvery  = flag.Duration("refresh-interval", 30*time.Second, "average time between the background refreshes of a provider")
+	refreshJitter = flag.Float64("refresh-jitter", 0.2, "fraction of -refresh-interval the refreshes are randomly moved by, from 0 to less than 1")
+	refreshStale  = flag.Duration("refresh-max-staleness", 2*time.Minute, "how long the refreshed items are served; when the refreshes fail for longer, the providers are called again")
+	redisAddr     = flag.String("redis-addr", "", "address of the Redis server used as a shared cache, in the form 'host:port'; empty disables the shared cache (env REDIS_URL)")
+	redisPassword = flag.String("redis-password", "", "password for the Redis server (env REDIS_PASSWORD)")
+	redisDB       = flag.Int("redis-db", 0, "Redis database number (env REDIS_URL)")
+	redisTTL      = flag.Duration("redis-ttl", time.Minute, "how long provider responses are kept in the shared Redis cache")
+	cacheSnapshot = flag.String("cache-snapshot-file", "", "file the in-memory cache is saved to on shutdown and loaded from on start, so a restart doesn't begin with a cold cache; empty disables it")
+
+	memoryLimit         byteSize
+	mediaHints          = MediaHintsOff
+	gcPercent           = flag.Int("gc-percent", 0, "the GC target percentage (like GOGC); zero leaves the runtime default")
+	h2c                 = flag.Bool("h2c", false, "enable unencrypted HTTP/2 (prior knowledge), meant for internal traffic")
+	http2MaxStreams     = flag.Int("http2-max-streams", 250, "maximum number of concurrent HTTP/2 streams per connection")
+	http2ConnBuffer     byteSize
+	readHeaderTimeout   = flag.Duration("read-header-timeout", 5*time.Second, "maximum time for reading the request headers; zero disables the limit")
+	readTimeout         = flag.Duration("read-timeout", 10*time.Second, "maximum time for reading a whole request, including the body; zero disables the limit")
+	writeTimeout        = flag.Duration("write-timeout", 30*time.Second, "maximum time for writing a response, counted from the end of the request headers; keep it longer than the content timeout; zero disables the limit")
+	idleTimeout         = flag.Duration("idle-timeout", 2*time.Minute, "how long a keep-alive connection waits for the next request; zero disables the limit")
+	maxHeaderBytes      = byteSize(64 << 10)
+	compressMinSize     = byteSize(1 << 10)
+	sessionMemory       = byteSize(64 << 20)
+	requestMemory       byteSize
+	totalRequestMemory  byteSize
+	http2StreamBuffer   byteSize
+	otlpEndpoint        = flag.String("otlp-endpoint", "", "OTLP/HTTP endpoint for exporting traces, e.g. 'http://localhost:4318/v1/traces'; defaults to the OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT environment variables; empty disables tracing")
+	traceSampleRatio    = flag.Float64("trace-sample-ratio", -1, "fraction of new traces that are recorded, from 0 to 1; defaults to OTEL_TRACES_SAMPLER_ARG or 1")
+	explainNetworks     ipNetworks
+	trustedProxies      ipNetworks
+	logFormat           = LogFormatText
+	invalidItemsPolicy  = InvalidItemsDrop
+	staticSelection     StaticSelection
+	streamBufferPolicy  StreamBufferPolicy
+	streamBufferSize    = flag.Int("stream-buffer", 16, "number of items buffered per streamed response, written to the client in the background; zero writes them as they're fetched")
+	streamMaxLag        = flag.Duration("stream-max-lag", 10*time.Second, "how long a write of a streamed response may block before the slow client is disconnected; zero disables it")
+	maxLiveSubscribers  = flag.Int("max-live-subscribers", 1000, "maximum number of clients of the live updates stream (/stream); zero disables the limit")
+	liveHeartbeat       = flag.Duration("live-heartbeat", 15*time.Second, "interval of the heartbeat comments of the live updates stream (/stream), keeping idle connections open through the proxies")
+	logLevel            slog.LevelVar
+	logLevelRevert      = flag.Duration("log-level-revert", 15*time.Minute, "how long a log level change made with the admin API lasts by default, before the -log-level is restored")
+	freshnessWindow     = flag.Duration("freshness-window", 15*time.Minute, "report providers that return no fresh (non-expired) content for this long, even though their calls succeed; zero disables it")
+	deltaWindow         = flag.Duration("delta-window", 10*time.Minute, "how long responses are remembered for computing delta responses (the 'since_etag' parameter)")
+	deltaSize           = flag.Int("delta-size", 1000, "maximum number of responses remembered for computing delta responses")
+	sessionTTL          = flag.Duration("session-ttl", 30*time.Minute, "how long the feed sessions (POST /sessions) are kept since they were last used; zero disables the sessions")
+	maxSessions         = flag.Int("max-sessions", 10000, "maximum number of the feed sessions kept; the least recently used ones are dropped")
+	cacheMemoryFraction = flag.Float64("cache-memory-fraction", 0, "maximum fraction of the memory limit used by the in-memory cache, e.g. 0.25; zero disables the limit")
+	breakerFailures     = flag.Int("breaker-failures", 5, "number of consecutive provider failures after which the provider is skipped (and its fallback used) for the cooldown; zero disables circuit breakers")
+	breakerCooldown     = flag.Duration("breaker-cooldown", 30*time.Second, "how long a provider is skipped after its circuit breaker opens")
+	sharedRateLimits    = flag.Bool("shared-rate-limits", false, "share the rate limits reported by the providers among the replicas in Redis (-redis-addr), so they hold for the whole fleet")
+	breakerSync         = flag.Duration("breaker-sync-interval", 0, "how often the circuit breakers load the state shared by the replicas in Redis (-redis-addr), so a provider failing for one replica is skipped by all; zero keeps the breakers per instance")
+	maxCount            = flag.Int("max-count", 100, "maximum 'count' parameter of a content request; zero disables the limit")
+	maxInFlight         = flag.Int("max-in-flight-requests", 0, "maximum number of requests handled by the main server at once; the requests over it get 503 with Retry-After; zero disables the limit")
+	maxItems            = flag.Int("max-items", 1000, "maximum 'count' + 'offset' of a content request, the number of items fetched from the providers; zero disables the limit")
+	coalesceCalls       = flag.Bool("coalesce-provider-calls", true, "share one provider call among concurrent identical calls (same provider, count, user IP, locale, variant and device hints)")
+	mirrorURL           = flag.String("mirror-url", "", "base URL of a deployment (e.g. staging) receiving a sample of the content requests, with anonymized client IPs; empty disables mirroring")
+	mirrorRatio         = flag.Float64("mirror-ratio", 0.01, "fraction of the content requests mirrored to -mirror-url")
+	mirrorTimeout       = flag.Duration("mirror-timeout", 5*time.Second, "timeout of the mirrored requests")
+	filterExpiredItems  = flag.Bool("filter-expired", false, "drop the expired provider items, and ask the providers for more to replace them")
+	fallbackSurplus     = flag.Bool("fallback-surplus", false, "ask a provider that is also the fallback of other positions for their items too, so the fallbacks need no other call; the healthy requests fetch more items than they use")
+	hedgeDelay          = flag.Duration("hedge-delay", 0, "fetch the fallbacks of a provider that doesn't respond within the delay concurrently with it, and use whichever succeeds first; zero fetches the fallbacks only after the provider fails")
+	botPageTTL          = flag.Duration("bot-page-ttl", 5*time.Minute, "how long the non-personalized pages served to bots (crawlers) are cached; zero serves bots like other users")
+	apiKeysFile         = flag.String("api-keys-file", "", "JSON file with the API keys required for the content requests (env API_KEYS, as 'name:key' pairs separated by commas); no keys leave the API open")
+	apiKeyRateLimit     = flag.Float64("api-key-rate-limit", 0, "default number of requests per second allowed per API key; zero disables the limit")
+	apiKeyBurst         = flag.Int("api-key-burst", 10, "default number of requests allowed at once per API key above the rate limit")
+	jwtIssuer           = flag.String("jwt-issuer", "", "issuer ('iss') the JWTs must have; JWT authentication is enabled by the JWT_SECRET environment variable (HS256, at least 32 bytes)")
+	jwtAudience         = flag.String("jwt-audience", "", "audience ('aud') the JWTs must be issued for; empty accepts any")
+	hmacMaxSkew         = flag.Duration("hmac-max-skew", 5*time.Minute, "how far the timestamps of the HMAC signed requests may be from the server's clock; HMAC authentication is enabled by the HMAC_KEYS environment variable ('id:secret' pairs separated by commas)")
+	tlsClientCA         = flag.String("tls-client-ca", "", "path to the PEM encoded CA certificates the TLS client certificates are verified with; needs HTTPS")
+	clientCertSubjects  = flag.String("client-cert-subjects", "", "comma-separated subject common names of the client certificates allowed to use the API; enables the client certificate authentication, with -tls-client-ca")
+	fieldPoliciesFile   = flag.String("field-policies-file", "", "JSON file with the item fields hidden from the clients, by the client (principal) name, like {\"partner\": [\"source\"]}; needs authentication")
+	authOrder           = flag.String("auth-order", "client_cert,hmac,jwt,api_key", "comma-separated order in which the configured authentication methods (client_cert, hmac, jwt, api_key) are tried")
+	cursorTTL           = flag.Duration("cursor-ttl", 24*time.Hour, "how long the pagination cursors are valid; cursors are enabled by the CURSOR_SECRET environment variable")
+	compress            = flag.Bool("compress", true, "compress the JSON responses with gzip or brotli, when the clients accept it")
+	swaggerUI           = flag.Bool("swagger-ui", false, "serve the Swagger UI for the /openapi.json document at /swagger/; the UI is loaded from the unpkg.com CDN")
+	verifyBots          = flag.Bool("verify-bots", false, "verify the IPs of the requests claiming to be from well-known crawlers (like Googlebot) with reverse DNS, and reject the fake ones with 403")
+	shutdownTimeout     = flag.Duration("shutdown-timeout", 15*time.Second, "maximum time for finishing the in-flight requests and provider calls after SIGINT or SIGTERM")
+	capabilityTimeout   = flag.Duration("capability-discovery-timeout", 5*time.Second, "how long the service waits at startup for the capabilities of the providers with a capabilities endpoint; zero disables the discovery, and the providers are used as configured")
+	aaSampleRatio       = flag.Float64("aa-sample-ratio", 0, "fraction of provider calls duplicated for A/A latency comparison, e.g. 0.01; zero disables A/A testing")
+	aaWindow            = flag.Int("aa-window", defaultAAWindow, "number of the latest A/A call pairs per provider used for the comparison")
 )
 
-const shutdownTimeout = 15 * time.Second
+func init() {
+	flag.Var(&memoryLimit, "memory-limit", "soft memory limit for the process (like GOMEMLIMIT), e.g. '512MiB'; zero leaves the runtime default")
+	flag.Var(&mediaHints, "media-hints", "preconnect hints for media hosts of the returned items: off, link (Link headers) or early-hints (Link headers and a 103 Early Hints response)")
+	flag.Var(&http2ConnBuffer, "http2-conn-window", "HTTP/2 connection-level flow-control window size, e.g. '1MiB'; zero uses the default")
+	_ = explainNetworks.Set(defaultExplainNetworks)
+	flag.Var(&explainNetworks, "explain-networks", "comma-separated client networks (CIDRs) allowed to use the 'explain' parameter; empty disables it")
+	flag.Var(&trustedProxies, "trusted-proxies", "comma-separated networks (CIDRs) of the proxies and load balancers whose Forwarded, X-Forwarded-For and X-Real-IP headers are trusted for the client IP; empty uses the connection address only")
+	flag.Var(&logFormat, "log-format", "log output format: text or json")
+	flag.Func("invalid-items", "what happens to the invalid provider items: drop (replaced with more items of the provider), fail (the provider call fails) or off (default drop); the providers invalid_items setting overrides it", func(s string) error {
+		return invalidItemsPolicy.UnmarshalText([]byte(s))
+	})
+	flag.Func("stream-buffer-policy", "what happens when the buffer of a streamed response is full: wait (the fetching waits for the client), drop (the stream is cut) or merge (like wait, but the buffered items are written at once) (default wait)", func(s string) error {
+		return streamBufferPolicy.UnmarshalText([]byte(s))
+	})
+	flag.Func("static-selection", "which items of the 'static' provider are served: first, round_robin (the next items on every call) or random (default first)", func(s string) error {
+		return staticSelection.UnmarshalText([]byte(s))
+	})
+	flag.Func("log-level", "minimum level of logged messages: debug, info, warn or error (default info)", func(s string) error {
+		return logLevel.UnmarshalText([]byte(s))
+	})
+	flag.Var(&maxHeaderBytes, "max-header-bytes", "maximum size of the request headers, e.g. '64KiB'; zero uses the net/http default (1MiB)")
+	flag.Var(&sessionMemory, "session-memory", "maximum memory taken by the feed sessions, e.g. '64MiB'; the least recently used ones are dropped beyond it; zero disables the limit")
+	flag.Var(&compressMinSize, "compress-min-size", "minimum size of the JSON responses compressed with gzip or brotli (negotiated with Accept-Encoding), e.g. '1KiB'")
+	flag.Var(&requestMemory, "request-memory-budget", "maximum memory a single content request is estimated to use (from the number of items and their average size), e.g. '16MiB'; larger requests get 413; zero disables the limit")
+	flag.Var(&totalRequestMemory, "total-request-memory-budget", "maximum memory all the content requests in progress are estimated to use, e.g. '256MiB'; requests over it get 429; zero disables the limit")
+	flag.Var(&http2StreamBuffer, "http2-stream-window", "HTTP/2 stream-level flow-control window size, e.g. '1MiB'; zero uses the default")
+}
+
+const (
+	connCheckInterval      = time.Minute
+	freshnessCheckInterval = time.Minute
+	goroutineCheckInterval = 10 * time.Second
+	staticReloadInterval   = 10 * time.Second
+	botVerificationTTL     = time.Hour
+)
 
 func main() {
+	if ok, err := runCommand(os.Args[1:]); ok {
+		if err != nil {
+			fatal("command failed", err)
+		}
+		return
+	}
+
 	flag.Parse()
+	slog.SetDefault(newLogger(os.Stderr, logFormat, &logLevel))
+
+	limit := applyMemorySettings(memoryLimit, *gcPercent)
+
+	var cfg *FileConfig
+	if *configPath != "" {
+		var err error
+		if cfg, err = LoadConfig(*configPath); err != nil {
+			fatal("failed to load config", err)
+		}
+	}
+
+	breakerSettings := CircuitBreakerSettings{Failures: *breakerFailures, Cooldown: *breakerCooldown}
+	if cfg != nil {
+		breakerSettings.Providers = cfg.CircuitBreakerSettings()
+	}
+	itemValidation := ItemValidationSettings{Policy: invalidItemsPolicy}
+	if cfg != nil {
+		itemValidation.Providers = cfg.InvalidItemsPolicies()
+	}
+	opts := []ServiceOption{
+		WithFreshnessWindow(*freshnessWindow),
+		WithItemValidation(itemValidation),
+		WithCircuitBreakers(breakerSettings),
+		WithConfigHistory(*configHistoryPath),
+	}
+	if cfg != nil {
+		opts = append(opts, WithAllowedCounts(cfg.AllowedCounts()), WithUserIPPolicies(cfg.UserIPPolicies()), WithConcurrencyLimits(cfg.ConcurrencyLimits()), WithExpirySkews(cfg.ExpirySkews()), WithSandboxProviders(cfg.SandboxProviders()))
+	}
+	if *filterExpiredItems {
+		opts = append(opts, WithExpiredItemsFiltering())
+	}
+	if *coalesceCalls {
+		opts = append(opts, WithCallCoalescing())
+	}
+	if *fallbackSurplus {
+		opts = append(opts, WithFallbackSurplus())
+	}
+	if *hedgeDelay > 0 {
+		opts = append(opts, WithHedgedFallbacks(*hedgeDelay))
+	}
+	if *botPageTTL > 0 {
+		opts = append(opts, WithBotPages(*botPageTTL))
+	}
+	if *capabilityTimeout > 0 {
+		opts = append(opts, WithCapabilityDiscovery(*capabilityTimeout))
+	}
+	if *aaSampleRatio > 0 {
+		opts = append(opts, WithAATesting(*aaSampleRatio, *aaWindow))
+	}
+	redisCfg, err := redisConfigFromFlags(os.Getenv)
+	if err != nil {
+		fatal("invalid redis settings", err)
+	}
+	if *breakerSync > 0 && redisCfg.Addr != "" {
+		opts = append(opts, WithSharedBreakerState(NewRedisBreakerStore(redisCfg), *breakerSync))
+	}
+	if *sharedRateLimits && redisCfg.Addr != "" {
+		opts = append(opts, WithSharedRateLimits(NewRedisRateBudgetStore(redisCfg)))
+	}
+	cache, ttl := newCacheFromFlags(limit, redisCfg)
+	if cache != nil {
+		settings := CacheSettings{TTL: ttl, PerUser: *cachePerUser, RefetchExpired: *cacheRefetch}
+		if cfg != nil {
+			settings.Providers = cfg.CacheSettings()
+		}
+		opts = append(opts, WithCache(cache, settings))
+	}
+	if *cacheSnapshot != "" && memoryTier(cache) == nil {
+		slog.Warn("the cache snapshot file needs the in-memory cache (-cache-ttl), ignoring it")
+		*cacheSnapshot = ""
+	}
+	if *cacheSnapshot != "" {
+		if n, err := loadCacheSnapshot(context.Background(), cache, *cacheSnapshot); err != nil {
+			slog.Error("loading cache snapshot", "file", *cacheSnapshot, "error", err)
+		} else if n > 0 {
+			slog.Info("loaded cache snapshot", "file", *cacheSnapshot, "entries", n)
+		}
+	}
+	if *refreshItems > 0 {
+		refresh := RefreshSettings{Items: *refreshItems, Interval: *refreshEvery, Jitter: *refreshJitter, MaxStaleness: *refreshStale}
+		if err := refresh.Validate(); err != nil {
+			fatal("invalid background refresh settings", err)
+		}
+		if cache == nil {
+			slog.Warn("the background refresh needs the cache, it's disabled")
+		} else {
+			opts = append(opts, WithBackgroundRefresh(refresh))
+		}
+	}
 
-	service, err := NewDefaultService()
+	static, err := NewStaticClient(*staticContentPath, staticSelection)
 	if err != nil {
-		log.Fatalf("failed to create service: %v", err)
+		fatal("failed to load static content", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go static.Run(ctx, staticReloadInterval)
+
+	var service *Service
+	if cfg != nil {
+		clients, err := NewClients(ctx, cfg)
+		if err != nil {
+			fatal("failed to create provider clients", err)
+		}
+		service, err = NewServiceFromConfig(cfg, withStaticClient(clients, static), opts...)
+		if err != nil {
+			fatal("failed to create service", err)
+		}
+	} else {
+		service, err = NewService(DefaultConfig, withStaticClient(SampleClients(Provider1, Provider2, Provider3), static), defaultTimeout, opts...)
+		if err != nil {
+			fatal("failed to create service", err)
+		}
+	}
+
+	tracingCfg := TracingConfigFromEnv()
+	if *otlpEndpoint != "" {
+		tracingCfg.Endpoint = *otlpEndpoint
+	}
+	if *traceSampleRatio >= 0 {
+		tracingCfg.SampleRatio = *traceSampleRatio
+	}
+	if tracingCfg.Endpoint != "" {
+		t := NewTracer(tracingCfg)
+		tracer.Store(t)
+		go t.Run()
+		slog.Info("exporting traces", "endpoint", tracingCfg.Endpoint, "sample_ratio", tracingCfg.SampleRatio)
+	}
+
+	limits := RequestLimits{MaxCount: *maxCount, MaxItems: *maxItems}
+	var memory *MemoryBudget
+	if requestMemory > 0 || totalRequestMemory > 0 {
+		memory = NewMemoryBudget(int64(requestMemory), int64(totalRequestMemory), service.ItemSizes())
+	}
+	var cursors *CursorSigner
+	if secret := os.Getenv("CURSOR_SECRET"); secret != "" {
+		if cursors, err = NewCursorSigner([]byte(secret), *cursorTTL); err != nil {
+			fatal("invalid CURSOR_SECRET", err)
+		}
 	}
 	handler := &Handler{
-		service: service,
+		service:            service,
+		mediaHints:         mediaHints,
+		deltas:             newDeltaStore(*deltaSize, *deltaWindow),
+		explainNetworks:    explainNetworks,
+		limits:             limits,
+		memory:             memory,
+		cursors:            cursors,
+		swaggerUI:          *swaggerUI,
+		streamBuffer:       StreamBufferSettings{Size: *streamBufferSize, Policy: streamBufferPolicy, MaxLag: *streamMaxLag},
+		liveHeartbeat:      *liveHeartbeat,
+		maxLiveSubscribers: *maxLiveSubscribers,
+	}
+	if cfg != nil {
+		handler.deprecations = cfg.Deprecations
+	}
+	if *sessionTTL > 0 {
+		handler.sessions = newSessionStore(*maxSessions, int64(sessionMemory), *sessionTTL)
+	}
+	go service.Freshness().Run(ctx, freshnessCheckInterval)
+	go service.WatchGoroutines(ctx, goroutineCheckInterval)
+	// The refresher is stopped before the provider calls are drained, as it would keep starting new ones.
+	refresherCtx, stopRefresher := context.WithCancel(ctx)
+	defer stopRefresher()
+	go service.RunRefresher(refresherCtx)
+	go service.RunBreakerSync(ctx)
+
+	var mainHandler http.Handler = handler
+	if *verifyBots {
+		mainHandler = withBotVerification(mainHandler, NewBotVerifier(botVerificationTTL))
+	}
+	var mirror *Mirror
+	if *mirrorURL != "" {
+		mirror, err = NewMirror(MirrorConfig{URL: *mirrorURL, SampleRatio: *mirrorRatio, Timeout: *mirrorTimeout})
+		if err != nil {
+			fatal("failed to configure mirroring", err)
+		}
+		go mirror.Run(ctx)
+		mainHandler = mirror.Wrap(mainHandler)
+		slog.Info("mirroring traffic", "url", *mirrorURL, "ratio", *mirrorRatio)
+	}
+
+	auth, err := authChainFromFlags(os.Getenv)
+	if err != nil {
+		fatal("invalid authentication settings", err)
+	}
+	grpcHandler := http.Handler(&GRPCHandler{service: service, limits: limits, memory: memory})
+	// The experiments target the tenants, so they're wrapped by the authentication.
+	experiments, err := NewExperiments(*experimentsFile)
+	if err != nil {
+		fatal("invalid experiments", err)
+	}
+	mainHandler = experiments.Wrap(mainHandler)
+	grpcHandler = experiments.Wrap(grpcHandler)
+	if *fieldPoliciesFile != "" {
+		if len(auth) == 0 {
+			fatal("invalid field policies", errors.New("the field policies need authentication"))
+		}
+		policies, err := LoadFieldPolicies(*fieldPoliciesFile)
+		if err != nil {
+			fatal("invalid field policies", err)
+		}
+		mainHandler = policies.Wrap(mainHandler)
+		grpcHandler = policies.Wrap(grpcHandler)
+		slog.Info("field policies loaded", "clients", len(policies))
+	}
+	if len(auth) > 0 {
+		mainHandler = auth.Wrap(mainHandler)
+		grpcHandler = auth.Wrap(grpcHandler)
+	}
+	if *compress {
+		mainHandler = withCompression(mainHandler, int(compressMinSize))
+	}
+	if *maxInFlight > 0 {
+		mainHandler = withInFlightLimit(mainHandler, *maxInFlight)
+	}
+
+	timeouts := ServerTimeouts{
+		ReadHeader:     *readHeaderTimeout,
+		Read:           *readTimeout,
+		Write:          *writeTimeout,
+		Idle:           *idleTimeout,
+		MaxHeaderBytes: int(maxHeaderBytes),
 	}
+	if contentTimeout := service.MaxTimeout(); *writeTimeout > 0 && contentTimeout >= *writeTimeout {
+		slog.Warn("the write timeout is not longer than the content timeout, slow responses will be cut off", "write_timeout", *writeTimeout, "content_timeout", contentTimeout)
+	}
+
+	connTracker := NewConnTracker("main")
+	go connTracker.Run(ctx, connCheckInterval)
 	httpServer := http.Server{
-		Addr:    *addr,
-		Handler: handler,
+		Addr:      *addr,
+		Handler:   withRequestID(withTracing(withRecovery(withClientIP(mainHandler, trustedProxies), "main"))),
+		ConnState: connTracker.ConnState,
+	}
+	configureTimeouts(&httpServer, timeouts)
+	// The live updates streams last until the clients disconnect, so they're closed for the shutdown to finish.
+	httpServer.RegisterOnShutdown(service.CloseLiveUpdates)
+	configureHTTP2(&httpServer, HTTP2Settings{
+		H2C:                           *h2c,
+		MaxConcurrentStreams:          *http2MaxStreams,
+		MaxReceiveBufferPerConnection: int(http2ConnBuffer),
+		MaxReceiveBufferPerStream:     int(http2StreamBuffer),
+	})
+
+	tlsSettings := TLSSettings{
+		CertFile:         *tlsCert,
+		KeyFile:          *tlsKey,
+		AutocertCacheDir: *autocertCacheDir,
+		AutocertEmail:    *autocertEmail,
+		ClientCAFile:     *tlsClientCA,
+	}
+	if *autocertHosts != "" {
+		tlsSettings.AutocertHosts = strings.Split(*autocertHosts, ",")
+	}
+	if tlsSettings.ClientCAFile != "" && !tlsSettings.Enabled() {
+		fatal("failed to configure TLS", errors.New("-tls-client-ca needs HTTPS"))
+	}
+	var challengeServer *http.Server
+	if tlsSettings.Enabled() {
+		challengeHandler, err := configureTLS(&httpServer, tlsSettings)
+		if err != nil {
+			fatal("failed to configure TLS", err)
+		}
+		if challengeHandler != nil && *autocertHTTPAddr != "" {
+			challengeServer = &http.Server{
+				Addr:    *autocertHTTPAddr,
+				Handler: challengeHandler,
+			}
+			configureTimeouts(challengeServer, timeouts)
+			go func() {
+				slog.Info("starting ACME challenge server", "addr", *autocertHTTPAddr)
+				if err := challengeServer.ListenAndServe(); err != http.ErrServerClosed {
+					fatal("ACME challenge HTTP server ListenAndServe", err)
+				}
+			}()
+		}
+	}
+
+	var adminServer *http.Server
+	if *adminAddr != "" {
+		adminConnTracker := NewConnTracker("admin")
+		go adminConnTracker.Run(ctx, connCheckInterval)
+		adminHandler := NewAdminHandler(service, cache)
+		adminHandler.mirror = mirror
+		adminHandler.logLevels = NewLogLevelController(&logLevel, *logLevelRevert)
+		adminHandler.experiments = experiments
+		adminServer = &http.Server{
+			Addr:      *adminAddr,
+			Handler:   withRequestID(withRecovery(adminHandler, "admin")),
+			ConnState: adminConnTracker.ConnState,
+		}
+		configureTimeouts(adminServer, timeouts)
+		go func() {
+			slog.Info("starting admin server", "addr", *adminAddr)
+			if err := adminServer.ListenAndServe(); err != http.ErrServerClosed {
+				fatal("admin HTTP server ListenAndServe", err)
+			}
+		}()
+	}
+
+	var grpcServer *http.Server
+	if *grpcAddr != "" {
+		grpcConnTracker := NewConnTracker("grpc")
+		go grpcConnTracker.Run(ctx, connCheckInterval)
+		grpcServer = &http.Server{
+			Addr:      *grpcAddr,
+			Handler:   withRequestID(withTracing(withRecovery(withClientIP(grpcHandler, trustedProxies), "grpc"))),
+			ConnState: grpcConnTracker.ConnState,
+		}
+		configureTimeouts(grpcServer, timeouts)
+		// gRPC clients connect with HTTP/2 prior knowledge.
+		configureHTTP2(grpcServer, HTTP2Settings{
+			H2C:                           true,
+			MaxConcurrentStreams:          *http2MaxStreams,
+			MaxReceiveBufferPerConnection: int(http2ConnBuffer),
+			MaxReceiveBufferPerStream:     int(http2StreamBuffer),
+		})
+		go func() {
+			slog.Info("starting gRPC server", "addr", *grpcAddr)
+			if err := grpcServer.ListenAndServe(); err != http.ErrServerClosed {
+				fatal("gRPC server ListenAndServe", err)
+			}
+		}()
 	}
 
 	idleConnsClosed := make(chan struct{})
 	go func() {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
-		<-sigint
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		sig := <-stop
+		slog.Info("shutting down", "signal", sig.String(), "timeout", *shutdownTimeout)
 
-		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
 		defer cancel()
 
-		if err := httpServer.Shutdown(ctx); err != nil {
-			log.Printf("HTTP server shutdown: %v", err)
+		// The servers stop accepting new requests together and wait for the in-flight ones.
+		// Then the service drains the provider calls that outlive their requests, refusing the new ones,
+		// and the prefetches and the background refresher are stopped.
+		servers := map[string]*http.Server{"HTTP": &httpServer, "gRPC": grpcServer, "admin HTTP": adminServer, "ACME challenge HTTP": challengeServer}
+		var wg sync.WaitGroup
+		for name, srv := range servers {
+			if srv == nil {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := srv.Shutdown(ctx); err != nil {
+					slog.Error(name+" server shutdown", "error", err)
+				}
+			}()
+		}
+		wg.Wait()
+		stopRefresher()
+		if err := service.Drain(ctx); err != nil {
+			slog.Error("draining provider calls", "error", err)
+		}
+		// Saved after the drain, so the responses of the last provider calls are saved too.
+		if *cacheSnapshot != "" {
+			if n, err := saveCacheSnapshot(ctx, cache, *cacheSnapshot); err != nil {
+				slog.Error("saving cache snapshot", "file", *cacheSnapshot, "error", err)
+			} else {
+				slog.Info("saved cache snapshot", "file", *cacheSnapshot, "entries", n)
+			}
+		}
+		if t := tracer.Load(); t != nil {
+			if err := t.Shutdown(ctx); err != nil {
+				slog.Error("exporting the remaining spans", "error", err)
+			}
 		}
 		close(idleConnsClosed)
 	}()
 
-	log.Printf("starting server on %s", *addr)
-	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+	slog.Info("starting server", "addr", *addr, "tls", tlsSettings.Enabled())
+	if tlsSettings.Enabled() {
+		err = httpServer.ListenAndServeTLS(tlsSettings.CertFile, tlsSettings.KeyFile)
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
 		// Error starting or closing listener:
-		log.Fatalf("HTTP server ListenAndServe: %v", err)
+		fatal("HTTP server ListenAndServe", err)
 	}
 
 	<-idleConnsClosed
-	log.Print("server closed")
+	slog.Info("server closed")
+}
+
+// withStaticClient adds the static content client to the clients, so it can be used in the configuration.
+func withStaticClient(clients map[Provider]Client, static *StaticClient) map[Provider]Client {
+	clients[ProviderStatic] = static
+	return clients
+}
+
+// fatal logs the error and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// apiKeysFromFlags returns the API keys from the -api-keys-file and the API_KEYS variable,
+// or nil when there are none and the API is open.
+func apiKeysFromFlags(getenv func(string) string) (*APIKeys, error) {
+	var keys []APIKey
+	if *apiKeysFile != "" {
+		var err error
+		if keys, err = LoadAPIKeys(*apiKeysFile); err != nil {
+			return nil, err
+		}
+	}
+	envKeys, err := ParseAPIKeys(getenv("API_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, envKeys...)
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	slog.Info("API keys required", "keys", len(keys))
+
+	return NewAPIKeys(keys, *apiKeyRateLimit, *apiKeyBurst)
+}
+
+// authChainFromFlags returns the chain of the configured authentication methods in the -auth-order,
+// or nil when there are none and the API is open.
+func authChainFromFlags(getenv func(string) string) (AuthChain, error) {
+	methods := make(map[string]Authenticator)
+	apiKeys, err := apiKeysFromFlags(getenv)
+	if err != nil {
+		return nil, fmt.Errorf("API keys: %w", err)
+	}
+	if apiKeys != nil {
+		methods[apiKeys.Method()] = apiKeys
+	}
+	if secret := getenv("JWT_SECRET"); secret != "" {
+		a, err := NewJWTAuthenticator(secret, *jwtIssuer, *jwtAudience)
+		if err != nil {
+			return nil, err
+		}
+		methods[a.Method()] = a
+	}
+	hmacKeys, err := ParseHMACKeys(getenv("HMAC_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+	if len(hmacKeys) > 0 {
+		a, err := NewHMACAuthenticator(hmacKeys, *hmacMaxSkew)
+		if err != nil {
+			return nil, err
+		}
+		methods[a.Method()] = a
+	}
+	if *clientCertSubjects != "" {
+		if *tlsClientCA == "" {
+			return nil, errors.New("the client certificate authentication needs -tls-client-ca")
+		}
+		a, err := NewClientCertAuthenticator(strings.Split(*clientCertSubjects, ","))
+		if err != nil {
+			return nil, err
+		}
+		methods[a.Method()] = a
+	}
+
+	var chain AuthChain
+	var names []string
+	for _, name := range strings.Split(*authOrder, ",") {
+		name = strings.TrimSpace(name)
+		a, ok := methods[name]
+		if !ok {
+			continue
+		}
+		chain = append(chain, a)
+		names = append(names, name)
+		delete(methods, name)
+	}
+	for name := range methods {
+		return nil, fmt.Errorf("authentication method %s is configured, but missing in -auth-order", name)
+	}
+	if len(chain) > 0 {
+		slog.Info("authentication required", "methods", names)
+	}
+
+	return chain, nil
+}
+
+// redisConfigFromFlags returns the Redis connection settings from the environment (REDIS_URL and REDIS_PASSWORD),
+// overridden by the command line flags set explicitly. The address is empty when the shared cache is disabled.
+func redisConfigFromFlags(getenv func(string) string) (RedisConfig, error) {
+	var cfg RedisConfig
+	if raw := getenv("REDIS_URL"); raw != "" {
+		var err error
+		if cfg, err = ParseRedisURL(raw); err != nil {
+			return RedisConfig{}, err
+		}
+	}
+	if password := getenv("REDIS_PASSWORD"); password != "" {
+		cfg.Password = password
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "redis-addr":
+			cfg.Addr = *redisAddr
+		case "redis-password":
+			cfg.Password = *redisPassword
+		case "redis-db":
+			cfg.DB = *redisDB
+		}
+	})
+	cfg.KeyPrefix = "another-go-challange:"
+
+	return cfg, nil
+}
+
+// newCacheFromFlags returns the cache configured with the command line flags and the longest TTL of its layers.
+// It returns nil cache when caching is disabled.
+// The in-memory cache size is scaled relative to the process memory limit, if there is one.
+func newCacheFromFlags(memoryLimit int64, redisCfg RedisConfig) (Cache, time.Duration) {
+	var hot Cache
+	if *cacheTTL > 0 {
+		mc := NewMemoryCache(*cacheSize)
+		if memoryLimit > 0 && *cacheMemoryFraction > 0 {
+			maxBytes := int64(float64(memoryLimit) * *cacheMemoryFraction)
+			mc.SetMaxBytes(maxBytes)
+			slog.Info("in-memory cache size limited", "max_bytes", maxBytes)
+		}
+		hot = mc
+	}
+	if redisCfg.Addr == "" {
+		return hot, *cacheTTL
+	}
+
+	shared := NewRedisCache(redisCfg)
+	if hot == nil {
+		return shared, *redisTTL
+	}
+
+	ttl := *redisTTL
+	if *cacheTTL > ttl {
+		ttl = *cacheTTL
+	}
+	return &LayeredCache{
+		Hot:       hot,
+		HotTTL:    *cacheTTL,
+		Shared:    shared,
+		SharedTTL: *redisTTL,
+	}, ttl
 }
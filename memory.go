@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+)
+
+// byteSize is a flag.Value for sizes in bytes, like "512MiB" or "2GB".
+type byteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	// Longer suffixes first, so "MiB" isn't matched as "B".
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"B", 1},
+}
+
+// String implements flag.Value.
+func (b *byteSize) String() string {
+	if b == nil {
+		return "0"
+	}
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+// Set implements flag.Value.
+func (b *byteSize) Set(s string) error {
+	s = strings.TrimSpace(s)
+	mul := int64(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			mul = u.size
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = byteSize(v * float64(mul))
+
+	return nil
+}
+
+// applyMemorySettings configures the Go runtime memory limit and GC target.
+// Zero values leave the runtime settings unchanged (e.g., set with GOMEMLIMIT and GOGC environment variables).
+// It returns the effective memory limit, or 0 if there is none.
+func applyMemorySettings(limit byteSize, gcPercent int) int64 {
+	if limit > 0 {
+		debug.SetMemoryLimit(int64(limit))
+	}
+	if gcPercent != 0 {
+		debug.SetGCPercent(gcPercent)
+	}
+
+	current := debug.SetMemoryLimit(-1) // Negative input only reads the current value.
+	if current == math.MaxInt64 {
+		return 0
+	}
+	return current
+}
+
+// MemoryReport describes the process memory usage and pressure.
+type MemoryReport struct {
+	HeapAlloc    uint64  `json:"heap_alloc"`
+	HeapInuse    uint64  `json:"heap_inuse"`
+	HeapSys      uint64  `json:"heap_sys"`
+	HeapObjects  uint64  `json:"heap_objects"`
+	TotalSys     uint64  `json:"total_sys"`
+	NumGC        uint32  `json:"num_gc"`
+	GCPercent    int64   `json:"gc_percent"`
+	MemoryLimit  int64   `json:"memory_limit,omitempty"`
+	HeapPressure float64 `json:"heap_pressure,omitempty"` // Heap in use relative to the memory limit.
+
+	Cache         *MemoryCacheStats `json:"cache,omitempty"`
+	CachePressure float64           `json:"cache_pressure,omitempty"` // Cache size relative to its byte limit.
+}
+
+// newMemoryReport collects the current memory statistics.
+func newMemoryReport(cache *MemoryCache) MemoryReport {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	samples := []metrics.Sample{
+		{Name: "/gc/gogc:percent"},
+		{Name: "/gc/gomemlimit:bytes"},
+	}
+	metrics.Read(samples)
+
+	r := MemoryReport{
+		HeapAlloc:   ms.HeapAlloc,
+		HeapInuse:   ms.HeapInuse,
+		HeapSys:     ms.HeapSys,
+		HeapObjects: ms.HeapObjects,
+		TotalSys:    ms.Sys,
+		NumGC:       ms.NumGC,
+	}
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		r.GCPercent = int64(samples[0].Value.Uint64())
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		if limit := samples[1].Value.Uint64(); limit < math.MaxInt64 {
+			r.MemoryLimit = int64(limit)
+			r.HeapPressure = float64(ms.HeapInuse) / float64(limit)
+		}
+	}
+	if cache != nil {
+		stats := cache.Stats()
+		r.Cache = &stats
+		if stats.MaxBytes > 0 {
+			r.CachePressure = float64(stats.Bytes) / float64(stats.MaxBytes)
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestByteSize(t *testing.T) {
+	for in, want := range map[string]byteSize{
+		"100":     100,
+		"100B":    100,
+		"2KB":     2000,
+		"2KiB":    2048,
+		"512MiB":  512 << 20,
+		"1.5 GiB": 3 << 29,
+	} {
+		var b byteSize
+		if err := b.Set(in); err != nil {
+			t.Errorf("%q: unexpected error: %v", in, err)
+			continue
+		}
+		if b != want {
+			t.Errorf("%q: got %d, want %d", in, b, want)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "-1MiB", "MiB"} {
+		var b byteSize
+		if err := b.Set(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
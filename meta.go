@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Headers read into RequestMeta, besides the standard ones.
+const (
+	// experimentVariantHeader is set by the experimentation layer in front of the service.
+	experimentVariantHeader = "X-Experiment-Variant"
+	mobileHintHeader        = "Sec-CH-UA-Mobile"
+	platformHintHeader      = "Sec-CH-UA-Platform"
+)
+
+// RequestMeta describes the request the content is fetched for, so the providers can personalize the content.
+// All fields are optional.
+type RequestMeta struct {
+	// IP is the user IP. Providers may get it anonymized or empty, depending on their user IP policy.
+	IP string
+	// Locale is the preferred language of the user, like "en-US".
+	Locale string
+	// Device holds the hints about the user's device.
+	Device DeviceHints
+	// Variant is the experiment variant of the user.
+	Variant string
+	// TraceParent is the W3C trace context of the request, for providers continuing the trace.
+	TraceParent string
+}
+
+// DeviceHints describe the user's device, as reported by the user agent.
+type DeviceHints struct {
+	UserAgent string
+	// Mobile is true when the user agent prefers the mobile experience (the Sec-CH-UA-Mobile client hint).
+	Mobile bool
+	// Platform is the operating system, like "Android" (the Sec-CH-UA-Platform client hint).
+	Platform string
+	// Class is the device class classified from the hints above.
+	Class DeviceClass
+}
+
+// personalization returns the fields the providers may personalize the content by (the locale, the variant
+// and the device hints), for the keys of the responses shared by requests. It's empty when they are all empty.
+// The user agent isn't a part of it: it's close to unique per user, and the device class and hints classify it.
+func (m RequestMeta) personalization() string {
+	mobile := ""
+	if m.Device.Mobile {
+		mobile = "mobile"
+	}
+	key := strings.Join([]string{m.Locale, m.Variant, string(m.Device.Class), mobile, m.Device.Platform}, "|")
+	if strings.Trim(key, "|") == "" {
+		return ""
+	}
+	return key
+}
+
+// requestMeta collects the metadata of the HTTP request.
+func requestMeta(req *http.Request) RequestMeta {
+	meta := RequestMeta{
+		IP:     clientIP(req),
+		Locale: preferredLocale(req.Header.Get("Accept-Language")),
+		Device: DeviceHints{
+			UserAgent: req.UserAgent(),
+			Mobile:    req.Header.Get(mobileHintHeader) == "?1",
+			Platform:  strings.Trim(req.Header.Get(platformHintHeader), `"`),
+		},
+		Variant:     req.Header.Get(experimentVariantHeader),
+		TraceParent: traceparent(req),
+	}
+	meta.Device.Class = classifyDevice(meta.Device)
+
+	return meta
+}
+
+// traceparent returns the trace context of the request's span, or the incoming one when tracing is disabled.
+func traceparent(req *http.Request) string {
+	if tp := traceparentFromContext(req.Context()); tp != "" {
+		return tp
+	}
+	if _, ok := parseTraceparent(req.Header.Get(traceparentHeader)); ok {
+		return req.Header.Get(traceparentHeader)
+	}
+
+	return ""
+}
+
+// preferredLocale returns the first language of the Accept-Language header, ignoring the wildcard.
+// Browsers list the languages in the order of preference, so the quality values aren't compared.
+func preferredLocale(acceptLanguage string) string {
+	for _, lang := range strings.Split(acceptLanguage, ",") {
+		lang, _, _ = strings.Cut(lang, ";")
+		if lang = strings.TrimSpace(lang); lang != "" && lang != "*" {
+			return lang
+		}
+	}
+
+	return ""
+}
+
+// SimpleClient is a provider client using only the user IP, like the clients written before RequestMeta.
+type SimpleClient interface {
+	GetContent(ctx context.Context, userIP string, count int) ([]*ContentItem, error)
+}
+
+// AdaptSimpleClient returns a Client passing only the user IP to the simple client.
+func AdaptSimpleClient(c SimpleClient) Client {
+	return simpleClientAdapter{client: c}
+}
+
+type simpleClientAdapter struct {
+	client SimpleClient
+}
+
+// GetContent implements Client.
+func (a simpleClientAdapter) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	return a.client.GetContent(ctx, meta.IP, count)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// metaRecordingClient remembers the request metadata of the last call.
+type metaRecordingClient struct {
+	meta RequestMeta
+}
+
+func (c *metaRecordingClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	c.meta = meta
+	items := make([]*ContentItem, count)
+	for i := range items {
+		items[i] = &ContentItem{ID: testIDs.NewID()}
+	}
+	return items, nil
+}
+
+func TestRequestMeta(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	for name, tc := range map[string]struct {
+		headers map[string]string
+		want    RequestMeta
+	}{
+		"no headers": {
+			want: RequestMeta{IP: "192.0.2.1", Device: DeviceHints{Class: DeviceDesktop}},
+		},
+		"all headers": {
+			headers: map[string]string{
+				"Accept-Language":      "pl-PL,pl;q=0.9,en;q=0.8",
+				"User-Agent":           "test-agent",
+				"Sec-CH-UA-Mobile":     "?1",
+				"Sec-CH-UA-Platform":   `"Android"`,
+				"X-Experiment-Variant": "b",
+				"traceparent":          traceparent,
+			},
+			want: RequestMeta{
+				IP:          "192.0.2.1",
+				Locale:      "pl-PL",
+				Device:      DeviceHints{UserAgent: "test-agent", Mobile: true, Platform: "Android", Class: DeviceMobile},
+				Variant:     "b",
+				TraceParent: traceparent,
+			},
+		},
+		"wildcard language": {
+			headers: map[string]string{"Accept-Language": "*, en;q=0.5"},
+			want:    RequestMeta{IP: "192.0.2.1", Locale: "en", Device: DeviceHints{Class: DeviceDesktop}},
+		},
+		"invalid traceparent": {
+			headers: map[string]string{"traceparent": "00-invalid"},
+			want:    RequestMeta{IP: "192.0.2.1", Device: DeviceHints{Class: DeviceDesktop}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?count=1", nil)
+			req.Header.Del("User-Agent")
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			if got := requestMeta(req); got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRequestMetaPassedToProviders(t *testing.T) {
+	client := &metaRecordingClient{}
+	simple := &ipRecordingClient{}
+	clients := map[Provider]Client{Provider1: client, Provider2: AdaptSimpleClient(simple)}
+	service, err := NewService([]ContentConfig{{Type: Provider1}, {Type: Provider2}}, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?count=2", nil)
+	req.Header.Set("Accept-Language", "de")
+	req.Header.Set("X-Experiment-Variant", "a")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	if client.meta.IP != "127.0.0.1" || client.meta.Locale != "de" || client.meta.Variant != "a" {
+		t.Errorf("provider got %+v, want the request metadata", client.meta)
+	}
+	if simple.userIP != "127.0.0.1" {
+		t.Errorf("simple provider got user IP %q, want %q", simple.userIP, "127.0.0.1")
+	}
+}
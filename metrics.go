@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics are exported in the Prometheus text format.
+// The implementation is intentionally minimal: counters, gauges and histograms with labels.
+
+// MetricsRegistry holds metrics and writes them in the Prometheus text exposition format.
+type MetricsRegistry struct {
+	metrics []*metricVec
+	m       sync.Mutex
+}
+
+// defaultMetrics is the registry used by the app metrics.
+var defaultMetrics = &MetricsRegistry{}
+
+// ServeHTTP implements http.Handler.
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+// WriteTo writes all metrics to `w`.
+func (r *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+	r.m.Lock()
+	metrics := append([]*metricVec(nil), r.metrics...)
+	r.m.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+
+	return cw.n, err
+}
+
+func (r *MetricsRegistry) register(m *metricVec) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.metrics = append(r.metrics, m)
+}
+
+type metricKind string
+
+const (
+	kindCounter   metricKind = "counter"
+	kindGauge     metricKind = "gauge"
+	kindHistogram metricKind = "histogram"
+)
+
+// metricVec is a metric family: a set of series sharing the name and label names.
+type metricVec struct {
+	name    string
+	help    string
+	kind    metricKind
+	labels  []string
+	buckets []float64 // Histograms only.
+
+	series map[string]*metricSeries
+	m      sync.Mutex
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64  // Counter and gauge value, histogram sum.
+	count       uint64   // Histograms only.
+	buckets     []uint64 // Histograms only, non-cumulative.
+}
+
+func newMetricVec(r *MetricsRegistry, kind metricKind, name, help string, labels []string, buckets []float64) *metricVec {
+	v := &metricVec{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*metricSeries),
+	}
+	r.register(v)
+
+	return v
+}
+
+// update calls fn with the series for the label values, under the lock.
+func (v *metricVec) update(labelValues []string, fn func(s *metricSeries)) {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s: got %d label values, want %d", v.name, len(labelValues), len(v.labels)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	s, ok := v.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: append([]string(nil), labelValues...)}
+		if v.kind == kindHistogram {
+			s.buckets = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	fn(s)
+}
+
+func (v *metricVec) write(w *bufio.Writer) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := v.series[k]
+		if v.kind != kindHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, s.labelValues, "", ""), formatFloat(s.value))
+			continue
+		}
+
+		var cumulative uint64
+		for i, upper := range v.buckets {
+			cumulative += s.buckets[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, s.labelValues, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, formatLabels(v.labels, s.labelValues, "", ""), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, formatLabels(v.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString("=")
+		sb.WriteString(strconv.Quote(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extraName)
+		sb.WriteString("=")
+		sb.WriteString(strconv.Quote(extraValue))
+	}
+	sb.WriteByte('}')
+
+	return sb.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// CounterVec is a counter metric with labels.
+type CounterVec struct{ vec *metricVec }
+
+// newCounterVec creates and registers a counter in the default registry.
+func newCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{vec: newMetricVec(defaultMetrics, kindCounter, name, help, labels, nil)}
+}
+
+// Inc increments the counter for the label values by 1.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the label values by `v`. Negative values are ignored.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.vec.update(labelValues, func(s *metricSeries) { s.value += v })
+}
+
+// GaugeVec is a gauge metric with labels.
+type GaugeVec struct{ vec *metricVec }
+
+// newGaugeVec creates and registers a gauge in the default registry.
+func newGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{vec: newMetricVec(defaultMetrics, kindGauge, name, help, labels, nil)}
+}
+
+// Set sets the gauge value for the label values.
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.vec.update(labelValues, func(s *metricSeries) { s.value = v })
+}
+
+// Add adds `v` (which may be negative) to the gauge value for the label values.
+func (g *GaugeVec) Add(v float64, labelValues ...string) {
+	g.vec.update(labelValues, func(s *metricSeries) { s.value += v })
+}
+
+// HistogramVec is a histogram metric with labels.
+type HistogramVec struct{ vec *metricVec }
+
+// defaultDurationBuckets are histogram buckets for durations in seconds.
+var defaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// newHistogramVec creates and registers a histogram in the default registry.
+// Buckets are upper bounds and must be sorted.
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{vec: newMetricVec(defaultMetrics, kindHistogram, name, help, labels, buckets)}
+}
+
+// Observe adds an observation for the label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.vec.update(labelValues, func(s *metricSeries) {
+		s.count++
+		s.value += v
+		if i := sort.SearchFloat64s(h.vec.buckets, v); i < len(s.buckets) {
+			s.buckets[i]++
+		}
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
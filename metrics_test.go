@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// metricValue returns the value of the series (the name with the labels, like `x_total{provider="1"}`)
+// in the default registry, or zero when it has none. The registry is shared by the tests (and their repetitions),
+// so the tests compare the values before and after.
+func metricValue(t *testing.T, series string) float64 {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := defaultMetrics.WriteTo(&buf); err != nil {
+		t.Fatalf("writing metrics: %v", err)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("parsing %s: %v", line, err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestMetricsFormat(t *testing.T) {
+	r := &MetricsRegistry{}
+	counter := &CounterVec{vec: newMetricVec(r, kindCounter, "test_total", "Test counter.", []string{"provider"}, nil)}
+	gauge := &GaugeVec{vec: newMetricVec(r, kindGauge, "test_gauge", "Test gauge.", nil, nil)}
+	histogram := &HistogramVec{vec: newMetricVec(r, kindHistogram, "test_seconds", "Test histogram.", []string{"provider"}, []float64{0.1, 1})}
+
+	counter.Inc("2")
+	counter.Add(2, "1")
+	gauge.Set(5)
+	gauge.Add(-2)
+	histogram.Observe(0.05, "1")
+	histogram.Observe(0.5, "1")
+	histogram.Observe(5, "1")
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("writing metrics: %v", err)
+	}
+
+	want := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{provider="1"} 2
+test_total{provider="2"} 1
+# HELP test_gauge Test gauge.
+# TYPE test_gauge gauge
+test_gauge 3
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{provider="1",le="0.1"} 1
+test_seconds_bucket{provider="1",le="1"} 2
+test_seconds_bucket{provider="1",le="+Inf"} 3
+test_seconds_sum{provider="1"} 5.55
+test_seconds_count{provider="1"} 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestConnTracker(t *testing.T) {
+	opened := metricValue(t, `http_connections_opened_total{server="test"}`)
+	tracker := NewConnTracker("test")
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	srv.Config.ConnState = tracker.ConnState
+	srv.Start()
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+	}
+	srv.Close()
+
+	tracker.m.Lock()
+	defer tracker.m.Unlock()
+	if tracker.opened != 3 {
+		t.Errorf("got %d opened connections, want 3", tracker.opened)
+	}
+	if tracker.closedSingle != 3 {
+		t.Errorf("got %d single-request connections, want 3", tracker.closedSingle)
+	}
+	if len(tracker.conns) != 0 {
+		t.Errorf("got %d tracked connections after server close, want 0", len(tracker.conns))
+	}
+
+	if got := metricValue(t, `http_connections_opened_total{server="test"}`) - opened; got != 3 {
+		t.Errorf("got the opened connections metric increased by %v, want 3", got)
+	}
+}
+
+func TestServiceMetrics(t *testing.T) {
+	failing := Provider("metrics-failing")
+	fallback := Provider("metrics-fallback")
+	clients := map[Provider]Client{
+		failing:  &mockContentProvider{source: failing, shouldFail: true},
+		fallback: &mockContentProvider{source: fallback},
+	}
+	service, err := NewService([]ContentConfig{{Type: failing, Fallback: &fallback}}, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+
+	want := map[string]float64{
+		`provider_requests_total{provider="metrics-failing",result="error"}`:              1,
+		`provider_requests_total{provider="metrics-fallback",result="ok"}`:                1,
+		`provider_items_total{provider="metrics-fallback"}`:                               2,
+		`content_fallbacks_total{provider="metrics-failing",fallback="metrics-fallback"}`: 2,
+		`provider_request_duration_seconds_count{provider="metrics-fallback"}`:            1,
+		`http_requests_total{code="200"}`:                                                 1,
+	}
+	before := make(map[string]float64, len(want))
+	for series := range want {
+		before[series] = metricValue(t, series)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/?count=2", nil)
+	if status, _ := runRequest(t, service, req); status != http.StatusOK {
+		t.Fatalf("got response status %d", status)
+	}
+
+	for series, diff := range want {
+		if got := metricValue(t, series) - before[series]; got != diff {
+			t.Errorf("got %s increased by %v, want %v", series, got, diff)
+		}
+	}
+}
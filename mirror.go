@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// mirrorQueueSize is the number of mirrored requests waiting to be sent. When the queue is full, requests aren't mirrored.
+	mirrorQueueSize = 100
+	// mirrorWorkers is the number of mirrored requests sent at the same time.
+	mirrorWorkers = 4
+	// mirrorDiffsSize is the number of the most recent response differences kept.
+	mirrorDiffsSize = 50
+	// mirrorMaxBody is the maximum size of a mirrored response body that is compared.
+	mirrorMaxBody = 1 << 20
+	// mirroredHeader marks the mirrored requests.
+	mirroredHeader = "X-Mirrored"
+)
+
+var mirrorRequests = newCounterVec(
+	"mirror_requests_total",
+	"Number of requests mirrored to the staging deployment by result (match, diff, error, dropped).",
+	"result",
+)
+
+// MirrorConfig configures traffic mirroring.
+type MirrorConfig struct {
+	// URL is the base URL of the deployment receiving the mirrored requests.
+	URL string
+	// SampleRatio is the fraction of requests mirrored.
+	SampleRatio float64
+	// Timeout is the timeout of a mirrored request.
+	Timeout time.Duration
+}
+
+// Mirror sends a sample of the requests to another deployment (e.g. staging) in the background,
+// and compares its responses with ours. The client IPs are anonymized.
+type Mirror struct {
+	target *url.URL
+	ratio  float64
+	client *http.Client
+	random func() float64
+	queue  chan *mirroredRequest
+
+	diffs []MirrorDiff
+	next  int
+	m     sync.Mutex
+}
+
+// MirrorDiff describes a mirrored request with a different response.
+type MirrorDiff struct {
+	Time   time.Time `json:"time"`
+	Target string    `json:"target"`
+	// Status and Sources describe our response, the Mirror ones the mirrored response.
+	// Sources are the providers of the returned items, in order.
+	Status        int      `json:"status"`
+	MirrorStatus  int      `json:"mirror_status"`
+	Sources       []string `json:"sources,omitempty"`
+	MirrorSources []string `json:"mirror_sources,omitempty"`
+}
+
+// mirroredRequest is a request to mirror, with our response.
+type mirroredRequest struct {
+	target   string
+	accept   string
+	clientIP string
+	status   int
+	body     []byte
+}
+
+// NewMirror returns a mirror for the configuration. Run must be called to send the requests.
+func NewMirror(cfg MirrorConfig) (*Mirror, error) {
+	target, err := url.Parse(cfg.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid mirror URL '%s'", cfg.URL)
+	}
+
+	return &Mirror{
+		target: target,
+		ratio:  cfg.SampleRatio,
+		client: &http.Client{Timeout: cfg.Timeout},
+		random: rand.Float64,
+		queue:  make(chan *mirroredRequest, mirrorQueueSize),
+	}, nil
+}
+
+// Wrap returns a handler mirroring a sample of the content requests to the handler.
+func (m *Mirror) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Mirrored requests aren't mirrored again, in case the other deployment mirrors traffic too.
+		if !mirrorable(req) || req.Header.Get(mirroredHeader) != "" || m.random() >= m.ratio {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		rec := &capturingWriter{ResponseWriter: w, header: make(http.Header), limit: mirrorMaxBody}
+		next.ServeHTTP(rec, req)
+		if rec.status == http.StatusNotModified || rec.truncated {
+			// There is nothing to compare, or the response is too large to compare.
+			return
+		}
+
+		select {
+		case m.queue <- &mirroredRequest{
+			target:   req.URL.RequestURI(),
+			accept:   req.Header.Get("Accept"),
+			clientIP: anonymizeIP(clientIP(req)),
+			status:   rec.status,
+			body:     rec.body.Bytes(),
+		}:
+		default:
+			mirrorRequests.Inc("dropped")
+		}
+	})
+}
+
+// mirrorable tells whether the request can be mirrored: a GET of the content pages (GET / and the feeds).
+// The streamed responses, the live updates stream and the other endpoints aren't mirrored, nor are
+// the requests changing a state, like advancing a session.
+func mirrorable(req *http.Request) bool {
+	if req.Method != http.MethodGet || (req.URL.Path != "/" && req.URL.Path != "/feeds" && !strings.HasPrefix(req.URL.Path, "/feeds/")) {
+		return false
+	}
+	if acceptsNDJSON(req) {
+		return false
+	}
+	stream, _ := strconv.ParseBool(req.URL.Query().Get("stream"))
+	return !stream
+}
+
+// Run sends the mirrored requests until the context is done.
+func (m *Mirror) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < mirrorWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case r := <-m.queue:
+					m.send(ctx, r)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Diffs returns the most recent response differences, the newest first.
+func (m *Mirror) Diffs() []MirrorDiff {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	diffs := make([]MirrorDiff, 0, len(m.diffs))
+	for i := 0; i < len(m.diffs); i++ {
+		idx := (m.next - 1 - i + len(m.diffs)) % len(m.diffs)
+		diffs = append(diffs, m.diffs[idx])
+	}
+
+	return diffs
+}
+
+func (m *Mirror) send(ctx context.Context, r *mirroredRequest) {
+	ref, err := url.Parse(r.target)
+	if err != nil {
+		mirrorRequests.Inc("error")
+		return
+	}
+	u := *m.target
+	u.Path = strings.TrimSuffix(m.target.Path, "/") + ref.Path
+	u.RawQuery = ref.RawQuery
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		mirrorRequests.Inc("error")
+		return
+	}
+	if r.accept != "" {
+		req.Header.Set("Accept", r.accept)
+	}
+	req.Header.Set("X-Forwarded-For", r.clientIP)
+	req.Header.Set(mirroredHeader, "true")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		slog.DebugContext(ctx, "mirrored request failed", "target", r.target, "error", err)
+		mirrorRequests.Inc("error")
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, mirrorMaxBody))
+	if err != nil {
+		mirrorRequests.Inc("error")
+		return
+	}
+
+	diff := MirrorDiff{
+		Time:          time.Now(),
+		Target:        r.target,
+		Status:        r.status,
+		MirrorStatus:  resp.StatusCode,
+		Sources:       itemSources(r.body),
+		MirrorSources: itemSources(body),
+	}
+	if diff.Status == diff.MirrorStatus && slices.Equal(diff.Sources, diff.MirrorSources) {
+		mirrorRequests.Inc("match")
+		return
+	}
+	mirrorRequests.Inc("diff")
+	m.record(diff)
+}
+
+func (m *Mirror) record(diff MirrorDiff) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if len(m.diffs) < mirrorDiffsSize {
+		m.diffs = append(m.diffs, diff)
+		m.next = len(m.diffs) % mirrorDiffsSize
+		return
+	}
+	m.diffs[m.next] = diff
+	m.next = (m.next + 1) % mirrorDiffsSize
+}
+
+// itemSources returns the sources of the items of a content response.
+// Item IDs differ between any two responses, but the providers of the positions shouldn't.
+func itemSources(body []byte) []string {
+	var items []struct {
+		Source string `json:"source"`
+	}
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil
+	}
+	sources := make([]string, len(items))
+	for i, item := range items {
+		sources[i] = item.Source
+	}
+
+	return sources
+}
+
+// anonymizeIP zeroes the host part of the IP address: the last byte of IPv4 addresses, and all but the first 48 bits of IPv6 ones.
+func anonymizeIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, _ := addr.Prefix(bits)
+
+	return prefix.Addr().String()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	mirrored := make(chan *http.Request, 10)
+	staging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mirrored <- req
+		if req.URL.Query().Get("count") == "2" {
+			w.Write([]byte(`[{"source": "1"}, {"source": "3"}]`))
+			return
+		}
+		w.Write([]byte(`[{"source": "1"}]`))
+	}))
+	defer staging.Close()
+
+	mirror, err := NewMirror(MirrorConfig{URL: staging.URL + "/base/", SampleRatio: 1, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("creating a mirror: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mirror.Run(ctx)
+
+	service, err := NewService([]ContentConfig{{Type: Provider1}}, map[Provider]Client{Provider1: &mockContentProvider{source: Provider1}}, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(mirror.Wrap(&Handler{service: service}))
+	defer srv.Close()
+
+	for _, target := range []string{"/?count=1", "/?count=2"} {
+		resp, err := http.Get(srv.URL + target)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+
+		select {
+		case req := <-mirrored:
+			if req.URL.Path != "/base/" || req.Header.Get("X-Forwarded-For") != "127.0.0.0" {
+				t.Errorf("got mirrored request to %s from %s, want to /base/ from 127.0.0.0", req.URL.Path, req.Header.Get("X-Forwarded-For"))
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("request %s wasn't mirrored", target)
+		}
+	}
+
+	// Only the second response differs. It's recorded after the mirrored response is read.
+	deadline := time.Now().Add(time.Second)
+	for len(mirror.Diffs()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	diffs := mirror.Diffs()
+	if len(diffs) != 1 || diffs[0].Target != "/?count=2" || len(diffs[0].MirrorSources) != 2 {
+		t.Errorf("got diffs %+v, want one for the second request", diffs)
+	}
+}
+
+func TestMirrorable(t *testing.T) {
+	for name, tc := range map[string]struct {
+		method string
+		target string
+		accept string
+		want   bool
+	}{
+		"content":         {target: "/?count=3", want: true},
+		"feed":            {target: "/feeds/home?count=3", want: true},
+		"feed batch":      {target: "/feeds?names=home", want: true},
+		"stream":          {target: "/?count=3&stream=true"},
+		"ndjson":          {target: "/?count=3", accept: "application/x-ndjson"},
+		"live updates":    {target: "/stream"},
+		"docs":            {target: "/docs"},
+		"session advance": {target: "/sessions/abc/next?count=3"},
+		"post":            {method: http.MethodPost, target: "/graphql"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(cmp.Or(tc.method, http.MethodGet), tc.target, nil)
+			req.Header.Set("Accept", tc.accept)
+			if got := mirrorable(req); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	for ip, want := range map[string]string{
+		"203.0.113.7":          "203.0.113.0",
+		"2001:db8:1:2:3:4:5:6": "2001:db8:1::",
+		"not an ip":            "",
+	} {
+		if got := anonymizeIP(ip); got != want {
+			t.Errorf("%s: got %q, want %q", ip, got, want)
+		}
+	}
+}
@@ -1,9 +1,8 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"math/rand"
-	"strconv"
 	"sync"
 	"time"
 )
@@ -13,15 +12,21 @@ type mockContentProvider struct {
 	shouldFail    bool
 	responseDelay time.Duration
 	maxResults    int
+	media         []string
+	itemID        string // When set, all items have this ID.
 
 	calls int
 	m     sync.Mutex
 }
 
 // GetContent returns content items given a user IP, and the number of content items desired.
-func (cp *mockContentProvider) GetContent(userIP string, count int) ([]*ContentItem, error) {
+func (cp *mockContentProvider) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
 	if cp.responseDelay > 0 {
-		time.Sleep(cp.responseDelay)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(cp.responseDelay):
+		}
 	}
 
 	cp.m.Lock()
@@ -38,13 +43,42 @@ func (cp *mockContentProvider) GetContent(userIP string, count int) ([]*ContentI
 	}
 	resp := make([]*ContentItem, count)
 	for i := range resp {
+		id := cp.itemID
+		if id == "" {
+			id = testIDs.NewID()
+		}
 		resp[i] = &ContentItem{
-			ID:     strconv.Itoa(rand.Int()),
+			ID:     id,
 			Title:  "test title",
 			Source: string(cp.source),
+			Media:  cp.media,
 			Expiry: time.Now(),
 		}
 	}
 
 	return resp, nil
 }
+
+// blockingClient blocks until the context is done, and reports the context error on `returned`.
+type blockingClient struct {
+	returned chan error
+}
+
+func (c *blockingClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	<-ctx.Done()
+	c.returned <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+// gatedClient ignores the context and returns an item only after `release` is closed.
+type gatedClient struct {
+	release chan struct{}
+}
+
+func (c *gatedClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	<-c.release
+	return []*ContentItem{{ID: "1"}}, nil
+}
+
+// testIDs creates the IDs of the mock items.
+var testIDs = NewUUIDv7Generator("test-")
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// swaggerUIVersion is the version of swagger-ui-dist loaded by the Swagger UI page.
+const swaggerUIVersion = "5.17.14"
+
+// openAPISpec returns the OpenAPI 3 document of the content API.
+// The schemas are generated from the response types, so they don't drift from what's served;
+// the parameters depend on the request limits and on whether the pagination cursors are enabled.
+// The deprecated parameters and item fields are marked as deprecated.
+func openAPISpec(limits RequestLimits, cursors bool, deprecations []Deprecation) map[string]any {
+	g := &schemaGenerator{components: map[string]any{}}
+	itemView := g.schema(reflect.TypeOf(ItemView{}))
+	errorSchema := g.schema(reflect.TypeOf(ErrorResponse{}))
+	errorResponse := func(description string) map[string]any {
+		return map[string]any{
+			"description": description,
+			"content":     map[string]any{string(formatJSON): map[string]any{"schema": errorSchema}},
+		}
+	}
+
+	count := map[string]any{"type": "integer", "minimum": 1}
+	if limits.MaxCount > 0 {
+		count["maximum"] = limits.MaxCount
+	}
+	params := []map[string]any{
+		queryParam("count", "Number of items to return.", true, count),
+		queryParam("offset", "Number of items to skip.", false, map[string]any{"type": "integer", "minimum": 0, "default": 0}),
+	}
+	if cursors {
+		params = append(params, queryParam("cursor", "Opaque cursor from the Next-Cursor header of the previous page, used instead of offset.", false, map[string]any{"type": "string"}))
+	}
+	params = append(params,
+		queryParam("since_etag", "ETag of a previous response; the response is then a delta against it.", false, map[string]any{"type": "string"}),
+		queryParam("expiry_format", "How the item expiry is rendered.", false, map[string]any{"type": "string", "enum": []ExpiryFormat{ExpiryRFC3339, ExpiryUnix}, "default": ExpiryRFC3339}),
+		queryParam("tz", "IANA time zone name of the rendered expiry.", false, map[string]any{"type": "string"}),
+		queryParam("checksum", "Adds the content checksum to every item.", false, map[string]any{"type": "boolean", "default": false}),
+		queryParam("providers", "Comma-separated providers; only these are used, in the configured order.", false, map[string]any{"type": "string"}),
+		queryParam("exclude", "Comma-separated providers that aren't used.", false, map[string]any{"type": "string"}),
+		queryParam("prefetch", "With `next`, the next page is fetched in the background, and linked with Link rel=next.", false, map[string]any{"type": "string", "enum": []string{"next"}}),
+		queryParam("seed", "Shuffles the providers sequence, always in the same order for the same seed.", false, map[string]any{"type": "integer", "minimum": 0, "maximum": uint64(1<<32 - 1)}),
+		queryParam("ordering", "Orders the providers sequence with the strategy instead of the configured one.", false, map[string]any{"type": "string", "enum": orderingStrategies}),
+		queryParam("partial", "Wraps the items in an envelope with the status of the failed positions.", false, map[string]any{"type": "boolean", "default": false}),
+		queryParam("stream", "Streams the items as newline-delimited JSON.", false, map[string]any{"type": "boolean", "default": false}),
+		queryParam("explain", "Adds the explanation of how the response was assembled. Available only to internal clients.", false, map[string]any{"type": "boolean", "default": false}),
+		queryParam("timeout_ms", "Shorter timeout of the request, capped by the server's one; the items ready by then are returned.", false, map[string]any{"type": "integer", "minimum": 1}),
+		map[string]any{
+			"name":        requestTimeoutHeader,
+			"in":          "header",
+			"description": "Like timeout_ms; the shorter one is used.",
+			"required":    false,
+			"schema":      map[string]any{"type": "integer", "minimum": 1},
+		},
+	)
+
+	itemProperties := g.components["ItemView"].(map[string]any)["properties"].(map[string]any)
+	for _, d := range deprecations {
+		if d.Field != "" {
+			itemProperties[d.Field].(map[string]any)["deprecated"] = true
+		}
+		for _, p := range params {
+			if d.Param != "" && p["name"] == d.Param {
+				p["deprecated"] = true
+			}
+		}
+	}
+
+	description := "The items in the configured providers order. The response is a DeltaResponse with `since_etag`, and a ContentEnvelope with `partial` or `explain`."
+	if limits.MaxItems > 0 {
+		description += fmt.Sprintf(" `count` + `offset` must not be greater than %d.", limits.MaxItems)
+	}
+	items := map[string]any{"type": "array", "items": itemView}
+	headers := map[string]any{
+		"ETag": map[string]any{"description": "Identifies the items, for If-None-Match and since_etag.", "schema": map[string]any{"type": "string"}},
+	}
+	if cursors {
+		headers[nextCursorHeader] = map[string]any{"description": "Cursor of the next page, set when the page is full.", "schema": map[string]any{"type": "string"}}
+	}
+
+	responses := map[string]any{
+		"200": map[string]any{
+			"description": "The content items.",
+			"headers":     headers,
+			"content": map[string]any{
+				string(formatJSON): map[string]any{"schema": map[string]any{"oneOf": []any{
+					items,
+					g.schema(reflect.TypeOf(DeltaResponse{})),
+					g.schema(reflect.TypeOf(ContentEnvelope{})),
+				}}},
+				string(formatXML): map[string]any{"schema": map[string]any{
+					"type":  "array",
+					"xml":   map[string]any{"name": "items", "wrapped": true},
+					"items": map[string]any{"allOf": []any{itemView}, "xml": map[string]any{"name": "item"}},
+				}},
+				string(formatMsgpack): map[string]any{"schema": items},
+				ndjsonContentType:     map[string]any{"schema": itemView},
+			},
+		},
+		"304": map[string]any{"description": "The items didn't change since the If-None-Match ETag."},
+		"400": errorResponse("Some parameters are invalid; the details list them."),
+		"401": errorResponse("The API key is missing or unknown, when the API keys are enabled."),
+		"403": errorResponse("The API key is disabled."),
+		"413": errorResponse("The request needs more memory than a single request may use."),
+		"429": errorResponse("The API key rate limit or the total memory budget is exceeded; see Retry-After."),
+		"500": errorResponse("The items couldn't be assembled."),
+		"502": errorResponse("The providers failed."),
+		"503": errorResponse("The server has too many requests in flight; see Retry-After."),
+		"504": errorResponse("The items couldn't be assembled within the timeout."),
+	}
+	feedResponses := maps.Clone(responses)
+	feedResponses["404"] = errorResponse("The feed isn't configured.")
+	feedParams := append([]map[string]any{{
+		"name":        "name",
+		"in":          "path",
+		"description": "Name of the configured feed.",
+		"required":    true,
+		"schema":      map[string]any{"type": "string", "pattern": "^[A-Za-z0-9_-]+$"},
+	}}, params...)
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "another-go-challange content API",
+			"version": "1.0.0",
+		},
+		"paths": map[string]any{
+			"/": map[string]any{
+				"get": map[string]any{
+					"operationId": "getContent",
+					"summary":     "Returns a list of content items",
+					"description": description,
+					"parameters":  params,
+					"responses":   responses,
+				},
+			},
+			"/stream": map[string]any{
+				"get": map[string]any{
+					"operationId": "getLiveStream",
+					"summary":     "Streams the new content items as Server-Sent Events",
+					"description": "Every new item found by the background refresher is an `item` event, with the item ID as the event ID. Comments are sent as heartbeats.",
+					"parameters": []map[string]any{
+						queryParam("providers", "Comma-separated providers; only their items are sent.", false, map[string]any{"type": "string"}),
+						queryParam("exclude", "Comma-separated providers whose items aren't sent.", false, map[string]any{"type": "string"}),
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The stream of the new items.",
+							"content":     map[string]any{liveContentType: map[string]any{"schema": itemView}},
+						},
+						"400": errorResponse("Some parameters are invalid; the details list them."),
+						"404": errorResponse("The background refresher, finding the new items, isn't enabled."),
+					},
+				},
+			},
+			"/feeds/{name}": map[string]any{
+				"get": map[string]any{
+					"operationId": "getFeed",
+					"summary":     "Returns a list of content items of a named feed",
+					"description": description + " The items come from the feed's own providers sequence.",
+					"parameters":  feedParams,
+					"responses":   feedResponses,
+				},
+			},
+		},
+		"components": map[string]any{"schemas": g.components},
+	}
+}
+
+func queryParam(name, description string, required bool, schema map[string]any) map[string]any {
+	return map[string]any{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"required":    required,
+		"schema":      schema,
+	}
+}
+
+// schemaGenerator generates the JSON schemas of Go types, following their json tags.
+// The structs are added to the components, and referenced from the other schemas.
+type schemaGenerator struct {
+	components map[string]any
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Interface:
+		// The only interface fields are the item expiries, rendered as RFC 3339 strings or Unix timestamps.
+		return map[string]any{"oneOf": []any{
+			map[string]any{"type": "string", "format": "date-time"},
+			map[string]any{"type": "integer"},
+		}}
+	case reflect.Struct:
+		ref := map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := g.components[t.Name()]; ok {
+			return ref
+		}
+		g.components[t.Name()] = nil // Reserved for the recursive types.
+		g.components[t.Name()] = g.structSchema(t)
+		return ref
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	s := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// GetOpenAPI returns the OpenAPI document of the content API.
+func (h *Handler) GetOpenAPI(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(h.openAPIDocument())
+}
+
+// openAPIDocument returns the encoded OpenAPI document, generated once for the handler settings.
+func (h *Handler) openAPIDocument() []byte {
+	h.openAPIOnce.Do(func() {
+		h.openAPI, _ = json.Marshal(openAPISpec(h.limits, h.cursors != nil, h.deprecations))
+	})
+	return h.openAPI
+}
+
+// GetSwaggerUI returns the Swagger UI page for the OpenAPI document. The UI is loaded from a CDN.
+func (h *Handler) GetSwaggerUI(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = fmt.Fprintf(w, swaggerUIPage, swaggerUIVersion)
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Content API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@%[1]s/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@%[1]s/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
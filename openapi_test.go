@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenAPI(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	cursors, err := NewCursorSigner([]byte("0123456789abcdef"), time.Hour)
+	if err != nil {
+		t.Fatalf("creating a cursor signer: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		handler      *Handler
+		wantMaxCount float64
+		wantParams   []string
+		wantNoParams []string
+	}{
+		"default": {
+			handler:      &Handler{service: service},
+			wantParams:   []string{"count", "offset", "since_etag", "expiry_format", "tz", "checksum", "seed", "ordering", "partial", "stream", "explain"},
+			wantNoParams: []string{"cursor"},
+		},
+		"limits and cursors": {
+			handler:      &Handler{service: service, limits: RequestLimits{MaxCount: 50, MaxItems: 500}, cursors: cursors},
+			wantMaxCount: 50,
+			wantParams:   []string{"count", "cursor"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.handler)
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/openapi.json")
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("got content type %q, want application/json", ct)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			var spec struct {
+				OpenAPI string `json:"openapi"`
+				Paths   map[string]struct {
+					Get struct {
+						Parameters []struct {
+							Name     string         `json:"name"`
+							Required bool           `json:"required"`
+							Schema   map[string]any `json:"schema"`
+						} `json:"parameters"`
+						Responses map[string]json.RawMessage `json:"responses"`
+					} `json:"get"`
+				} `json:"paths"`
+				Components struct {
+					Schemas map[string]struct {
+						Properties map[string]any `json:"properties"`
+						Required   []string       `json:"required"`
+					} `json:"schemas"`
+				} `json:"components"`
+			}
+			if err := json.Unmarshal(body, &spec); err != nil {
+				t.Fatalf("decoding the document: %v", err)
+			}
+			if !strings.HasPrefix(spec.OpenAPI, "3.") {
+				t.Errorf("got openapi version %q, want 3.x", spec.OpenAPI)
+			}
+
+			if _, ok := spec.Paths["/feeds/{name}"].Get.Responses["404"]; !ok {
+				t.Error("the feeds path has no 404 response")
+			}
+
+			op := spec.Paths["/"].Get
+			params := map[string]bool{}
+			for _, p := range op.Parameters {
+				params[p.Name] = true
+				if p.Name == "count" {
+					if !p.Required {
+						t.Error("the count parameter isn't required")
+					}
+					if maximum, _ := p.Schema["maximum"].(float64); maximum != tc.wantMaxCount {
+						t.Errorf("got count maximum %v, want %v", maximum, tc.wantMaxCount)
+					}
+				}
+			}
+			for _, p := range tc.wantParams {
+				if !params[p] {
+					t.Errorf("parameter %s is missing", p)
+				}
+			}
+			for _, p := range tc.wantNoParams {
+				if params[p] {
+					t.Errorf("got parameter %s, want it missing", p)
+				}
+			}
+			for _, code := range []string{"200", "400", "500", "504"} {
+				if _, ok := op.Responses[code]; !ok {
+					t.Errorf("response %s is missing", code)
+				}
+			}
+
+			item := spec.Components.Schemas["ItemView"]
+			for _, p := range []string{"id", "title", "source", "summary", "link", "media", "expiry", "checksum"} {
+				if _, ok := item.Properties[p]; !ok {
+					t.Errorf("ItemView property %s is missing", p)
+				}
+			}
+			if want := []string{"id", "title", "source", "summary", "link", "expiry"}; !slices.Equal(item.Required, want) {
+				t.Errorf("got required ItemView properties %v, want %v", item.Required, want)
+			}
+			for _, ref := range strings.Split(string(body), `"$ref":"#/components/schemas/`)[1:] {
+				name, _, _ := strings.Cut(ref, `"`)
+				if _, ok := spec.Components.Schemas[name]; !ok {
+					t.Errorf("schema %s is referenced, but missing", name)
+				}
+			}
+		})
+	}
+}
+
+func TestSwaggerUI(t *testing.T) {
+	for name, tc := range map[string]struct {
+		enabled    bool
+		wantStatus int
+	}{
+		"disabled": {wantStatus: http.StatusNotFound},
+		"enabled":  {enabled: true, wantStatus: http.StatusOK},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(&Handler{swaggerUI: tc.enabled})
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/swagger/")
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if tc.enabled && !strings.Contains(string(body), `url: "/openapi.json"`) {
+				t.Errorf("got page %s, want the UI for /openapi.json", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import "time"
+
+// ServiceOption configures optional Service features.
+type ServiceOption func(*Service)
+
+// WithCache makes the service store provider responses in the cache.
+func WithCache(cache Cache, settings CacheSettings) ServiceOption {
+	return func(s *Service) {
+		s.cache = cache
+		s.cacheSettings = settings
+	}
+}
+
+// WithFreshnessWindow makes the service report providers that don't return fresh content within the window.
+func WithFreshnessWindow(window time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.freshness.window = window
+	}
+}
+
+// WithDeviceConfigs makes the service use the items configurations for the requests from the device classes.
+func WithDeviceConfigs(configs map[DeviceClass][]ContentConfig) ServiceOption {
+	return func(s *Service) {
+		s.deviceConfigs = configs
+	}
+}
+
+// WithFeedConfigs makes the service serve the named feeds with their items configurations,
+// and deduplicate the batches of feeds by the priorities.
+func WithFeedConfigs(configs map[string][]ContentConfig, priorities map[string]int) ServiceOption {
+	return func(s *Service) {
+		s.feedConfigs = configs
+		s.feedPriorities = priorities
+	}
+}
+
+// WithBotPages makes the service serve bots the same non-personalized pages, cached for the TTL.
+func WithBotPages(ttl time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.botPages = newBotPages(ttl)
+	}
+}
+
+// WithEndpointTimeouts makes the service use the timeouts for the requests to the endpoints, instead of the default one.
+func WithEndpointTimeouts(timeouts map[Endpoint]time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.endpointTimeouts = timeouts
+	}
+}
+
+// WithOrdering makes the service order the providers' positions with the strategy, instead of the weighted round-robin.
+func WithOrdering(o OrderingStrategy) ServiceOption {
+	return func(s *Service) {
+		s.ordering = o
+	}
+}
+
+// WithHedgedFallbacks makes the service fetch the fallbacks of the providers that don't respond within the delay,
+// concurrently with the primary provider, and use whichever succeeds first.
+func WithHedgedFallbacks(delay time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.hedgeDelay = delay
+	}
+}
+
+// WithConfigHistory makes the service persist the active and the previous items configuration versions in the file.
+// When the file exists, its active version replaces the configuration the service was created with.
+func WithConfigHistory(path string) ServiceOption {
+	return func(s *Service) {
+		s.configHistoryPath = path
+	}
+}
+
+// WithAATesting makes the service duplicate `sampleRatio` of the provider calls and compare the latencies of both calls.
+// The last `window` pairs of every provider are kept for the report.
+func WithAATesting(sampleRatio float64, window int) ServiceOption {
+	return func(s *Service) {
+		s.aa = NewAATester(sampleRatio, window)
+	}
+}
+
+// WithAllowedCounts makes the service request only the allowed counts (sorted ascending) from the providers.
+// The counts are rounded up, and the surplus items are used for the next calls.
+func WithAllowedCounts(counts map[Provider][]int) ServiceOption {
+	return func(s *Service) {
+		s.allowedCounts = counts
+	}
+}
+
+// WithConcurrencyLimits limits the number of concurrent calls to the providers. The calls over the limit fail
+// immediately with ErrProviderBusy, and the fallbacks are used. Cached responses don't count, and coalesced calls count once.
+func WithConcurrencyLimits(limits map[Provider]int) ServiceOption {
+	return func(s *Service) {
+		s.concurrencyLimits = limits
+	}
+}
+
+// WithFallbackSurplus makes a provider that is also the fallback of other positions be asked for their items too,
+// in the call for its own positions, so their fallbacks are served without another call.
+// The calls ask for more items than the healthy requests use, and the unused ones are dropped.
+func WithFallbackSurplus() ServiceOption {
+	return func(s *Service) {
+		s.fallbackSurplus = true
+	}
+}
+
+// WithCallCoalescing makes concurrent identical provider calls (same count, user IP, locale, variant and device hints) share a single upstream call.
+func WithCallCoalescing() ServiceOption {
+	return func(s *Service) {
+		s.coalesce = true
+	}
+}
+
+// WithExpiredItemsFiltering makes the service drop the expired items, and ask the providers for more to replace them.
+func WithExpiredItemsFiltering() ServiceOption {
+	return func(s *Service) {
+		s.filterExpired = true
+	}
+}
+
+// WithExpirySkews sets the clock skew tolerance of the providers: their items that expired less than the skew ago
+// aren't dropped by the expired items filtering.
+func WithExpirySkews(skews map[Provider]time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.expirySkews = skews
+	}
+}
+
+// WithSandboxProviders puts the providers in the sandbox mode: their items are labeled as test data.
+func WithSandboxProviders(providers map[Provider]bool) ServiceOption {
+	return func(s *Service) {
+		s.sandboxProviders = providers
+	}
+}
+
+// WithUserIPPolicies makes the service send the user IP to the providers according to their policies.
+func WithUserIPPolicies(policies map[Provider]UserIPPolicy) ServiceOption {
+	return func(s *Service) {
+		s.userIPPolicies = policies
+	}
+}
+
+// WithItemValidation makes the service check the items returned by the providers, and drop the invalid ones
+// (asking the providers for more) or fail the provider calls, according to the providers policies.
+func WithItemValidation(settings ItemValidationSettings) ServiceOption {
+	return func(s *Service) {
+		s.itemValidation = settings
+	}
+}
+
+// WithCircuitBreakers makes the service skip calls to failing providers (using their fallbacks directly).
+func WithCircuitBreakers(settings CircuitBreakerSettings) ServiceOption {
+	return func(s *Service) {
+		s.breakerSettings = settings
+	}
+}
+
+// WithSharedBreakerState shares the circuit breaker states with the other replicas of the service through the store:
+// a circuit opened by one replica is opened on all of them (synced every interval by RunBreakerSync), and only one
+// of them makes the trial call after the cooldown. It needs WithCircuitBreakers.
+func WithSharedBreakerState(store BreakerStateStore, interval time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.sharedBreakers = store
+		s.breakerSyncInterval = interval
+	}
+}
+
+// WithSharedRateLimits makes the rate limits reported by the providers hold for all the replicas of the service together,
+// counting the calls in the store. The bulkheads (max_concurrent_calls) stay per instance.
+func WithSharedRateLimits(store RateBudgetStore) ServiceOption {
+	return func(s *Service) {
+		s.sharedRateLimits = store
+	}
+}
+
+// WithBackgroundRefresh makes the service keep the cached responses of the providers warm, fetching them in the background
+// (started with RunRefresher). It needs the cache, and skips the providers cached per user or requiring the user IP.
+func WithBackgroundRefresh(settings RefreshSettings) ServiceOption {
+	return func(s *Service) {
+		s.refresh = settings
+	}
+}
+
+// WithCapabilityDiscovery makes the service ask the CapabilityReporter clients for the capabilities of their providers
+// when it's created, waiting for them up to the timeout, and adapt the calls to them.
+func WithCapabilityDiscovery(timeout time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.discoveryTimeout = timeout
+	}
+}
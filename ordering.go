@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// OrderingStrategy decides the order of the providers' positions in one cycle of the items sequence.
+// Only the order within a cycle changes, so the provider counts of a request and the paging contract
+// (the same part of the sequence for the same count and offset) don't depend on the strategy.
+type OrderingStrategy string
+
+// Ordering strategies.
+const (
+	// OrderRoundRobin spreads the configs evenly by their weights, with smooth weighted round-robin. It's the default.
+	OrderRoundRobin OrderingStrategy = "round_robin"
+	// OrderPriority keeps the configured order: all the positions of the first config, then the ones of the next config.
+	OrderPriority OrderingStrategy = "priority"
+	// OrderShuffled shuffles the round-robin cycle for every request, with a random seed unless the request gives one.
+	OrderShuffled OrderingStrategy = "shuffled"
+	// OrderScore orders the configs by their scores, the highest first, like priority. Equal scores keep the configured order.
+	OrderScore OrderingStrategy = "score"
+)
+
+var orderingStrategies = []OrderingStrategy{OrderRoundRobin, OrderPriority, OrderShuffled, OrderScore}
+
+// validate returns an error for an unknown strategy. The empty strategy means the default one.
+func (o OrderingStrategy) validate() error {
+	if o != "" && !slices.Contains(orderingStrategies, o) {
+		names := make([]string, len(orderingStrategies))
+		for i, s := range orderingStrategies {
+			names[i] = string(s)
+		}
+		return fmt.Errorf("must be one of: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// sequence returns one cycle of the configs in the order of the strategy.
+// The shuffled strategy returns the round-robin cycle, which is shuffled per request.
+func (o OrderingStrategy) sequence(configs []ContentConfig) []ContentConfig {
+	switch o {
+	case OrderPriority:
+		return group(configs)
+	case OrderScore:
+		sorted := slices.Clone(configs)
+		slices.SortStableFunc(sorted, func(a, b ContentConfig) int {
+			switch {
+			case a.Score > b.Score:
+				return -1
+			case a.Score < b.Score:
+				return 1
+			}
+			return 0
+		})
+		return group(sorted)
+	default:
+		return interleave(configs)
+	}
+}
+
+// group returns the configs in order, every one repeated by its weight: weights 3:1:1 of A, B and C give A, A, A, B, C.
+func group(configs []ContentConfig) []ContentConfig {
+	sequence := make([]ContentConfig, 0, len(configs))
+	for _, c := range configs {
+		for range c.weight() {
+			sequence = append(sequence, c)
+		}
+	}
+	return sequence
+}
+
+type orderingKey struct{}
+
+// withOrdering returns the context of a request overriding the service's ordering strategy.
+func withOrdering(ctx context.Context, o OrderingStrategy) context.Context {
+	return context.WithValue(ctx, orderingKey{}, o)
+}
+
+// orderingFromContext returns the ordering strategy the request asked for, or the empty one.
+func orderingFromContext(ctx context.Context) OrderingStrategy {
+	o, _ := ctx.Value(orderingKey{}).(OrderingStrategy)
+	return o
+}
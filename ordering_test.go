@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOrderingSequence(t *testing.T) {
+	configs := []ContentConfig{{Type: "a", Weight: 3}, {Type: "b", Score: 2}, {Type: "c", Score: 5}}
+	for name, tc := range map[string]struct {
+		ordering OrderingStrategy
+		configs  []ContentConfig
+		want     string
+	}{
+		"default":              {configs: configs, want: "a,b,a,c,a"},
+		"round robin":          {ordering: OrderRoundRobin, configs: configs, want: "a,b,a,c,a"},
+		"shuffled":             {ordering: OrderShuffled, configs: configs, want: "a,b,a,c,a"},
+		"priority":             {ordering: OrderPriority, configs: configs, want: "a,a,a,b,c"},
+		"score":                {ordering: OrderScore, configs: configs, want: "c,b,a,a,a"},
+		"equal scores":         {ordering: OrderScore, configs: []ContentConfig{{Type: "a"}, {Type: "b", Weight: 2}}, want: "a,b,b"},
+		"priority, no weights": {ordering: OrderPriority, configs: []ContentConfig{{Type: "a"}, {Type: "b"}, {Type: "a"}}, want: "a,b,a"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := configsOrder(tc.ordering.sequence(tc.configs)); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOrdering(t *testing.T) {
+	cfg := &FileConfig{
+		Items: []ItemConfig{
+			{Provider: Provider1, Weight: 2},
+			{Provider: Provider2},
+			{Provider: Provider3, Score: 1},
+		},
+		Ordering: OrderPriority,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: &mockContentProvider{source: Provider2},
+		Provider3: &mockContentProvider{source: Provider3},
+	}
+	service, err := NewServiceFromConfig(cfg, clients)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+
+	get := func(query string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/?" + query)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		defer resp.Body.Close()
+		var items []ContentItem
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+		}
+		sources := make([]string, len(items))
+		for i, item := range items {
+			sources[i] = item.Source
+		}
+		return resp.StatusCode, strings.Join(sources, ",")
+	}
+
+	for name, tc := range map[string]struct {
+		query      string
+		wantStatus int
+		want       string
+	}{
+		"configured":  {query: "count=8", wantStatus: http.StatusOK, want: "1,1,2,3,1,1,2,3"},
+		"next page":   {query: "count=4&offset=4", wantStatus: http.StatusOK, want: "1,1,2,3"},
+		"round robin": {query: "count=4&ordering=round_robin", wantStatus: http.StatusOK, want: "1,2,3,1"},
+		"score":       {query: "count=4&ordering=score", wantStatus: http.StatusOK, want: "3,1,1,2"},
+		"seeded":      {query: "count=4&ordering=shuffled&seed=3", wantStatus: http.StatusOK, want: configsOrder(shuffleConfigs(interleave(service.contentConfigs), 3))},
+		"unknown":     {query: "count=4&ordering=random", wantStatus: http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			status, got := get(tc.query)
+			if status != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", status, tc.wantStatus)
+			}
+			if got != tc.want {
+				t.Errorf("got sources %s, want %s", got, tc.want)
+			}
+		})
+	}
+
+	// Every shuffled request without a seed has a random order of the same items.
+	if _, got := get("count=4&ordering=shuffled"); len(strings.Split(got, ",")) != 4 {
+		t.Errorf("got sources %s, want 4 items", got)
+	}
+	if o := service.Config().Ordering; o != OrderPriority {
+		t.Errorf("got ordering %q in the config, want %q", o, OrderPriority)
+	}
+	if err := (&FileConfig{Items: cfg.Items, Ordering: "random"}).Validate(); err == nil {
+		t.Error("got no error for an unknown ordering")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPartialResponse(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1, shouldFail: true},
+		Provider2: &mockContentProvider{source: Provider2, maxResults: 1},
+	}
+	configs := []ContentConfig{{Type: Provider2}, {Type: Provider1}, {Type: Provider2}}
+	service, err := NewService(configs, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		query        string
+		wantItems    int
+		wantFailures []PositionFailure
+	}{
+		"from the start": {
+			query:     "count=3",
+			wantItems: 1,
+			wantFailures: []PositionFailure{
+				{Position: 1, Provider: Provider1, Reason: "provider error"},
+				{Position: 2, Provider: Provider2, Reason: "not enough items"},
+			},
+		},
+		"with offset": {
+			query:     "count=2&offset=1",
+			wantItems: 0,
+			wantFailures: []PositionFailure{
+				{Position: 0, Provider: Provider1, Reason: "provider error"},
+				{Position: 1, Provider: Provider2, Reason: "not enough items"},
+			},
+		},
+		"complete": {
+			query:     "count=1",
+			wantItems: 1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/?partial=true&" + tc.query)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+
+			var envelope ContentEnvelope
+			if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if len(envelope.Items) != tc.wantItems {
+				t.Errorf("got %d items, want %d", len(envelope.Items), tc.wantItems)
+			}
+			if envelope.Status == nil {
+				t.Fatal("got no status")
+			}
+			if envelope.Status.Complete != (len(tc.wantFailures) == 0) {
+				t.Errorf("got complete %v with failures %+v", envelope.Status.Complete, envelope.Status.Failures)
+			}
+			if len(envelope.Status.Failures) != len(tc.wantFailures) {
+				t.Fatalf("got failures %+v, want %+v", envelope.Status.Failures, tc.wantFailures)
+			}
+			for i, f := range envelope.Status.Failures {
+				if f != tc.wantFailures[i] {
+					t.Errorf("failure %d: got %+v, want %+v", i, f, tc.wantFailures[i])
+				}
+			}
+		})
+	}
+
+	for name, query := range map[string]string{
+		"invalid value":   "partial=maybe",
+		"with since_etag": "partial=true&since_etag=abc",
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/?count=1&" + query)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakePostgres is a database/sql driver returning the rows for any query, limited by the first argument.
+// It's opened with sql.OpenDB, so every test has its own, without registering it.
+type fakePostgres struct {
+	rows     [][]driver.Value
+	prepares atomic.Int32
+	query    atomic.Value
+}
+
+func (d *fakePostgres) Open(string) (driver.Conn, error)             { return fakePostgresConn{d}, nil }
+func (d *fakePostgres) Connect(context.Context) (driver.Conn, error) { return fakePostgresConn{d}, nil }
+func (d *fakePostgres) Driver() driver.Driver                        { return d }
+
+type fakePostgresConn struct{ d *fakePostgres }
+
+func (c fakePostgresConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.prepares.Add(1)
+	c.d.query.Store(query)
+	return fakePostgresStmt(c), nil
+}
+func (c fakePostgresConn) Close() error              { return nil }
+func (c fakePostgresConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type fakePostgresStmt struct{ d *fakePostgres }
+
+func (s fakePostgresStmt) Close() error                               { return nil }
+func (s fakePostgresStmt) NumInput() int                              { return 1 }
+func (s fakePostgresStmt) Exec([]driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s fakePostgresStmt) Query(args []driver.Value) (driver.Rows, error) {
+	n := min(int(args[0].(int64)), len(s.d.rows))
+	return &fakePostgresRows{rows: s.d.rows[:n]}, nil
+}
+
+type fakePostgresRows struct{ rows [][]driver.Value }
+
+func (r *fakePostgresRows) Columns() []string {
+	return []string{"id", "title", "summary", "link", "media", "expiry"}
+}
+func (r *fakePostgresRows) Close() error { return nil }
+func (r *fakePostgresRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestPostgresClient(t *testing.T) {
+	expiry := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := &fakePostgres{rows: [][]driver.Value{
+		{"a", "First", "Summary", "https://example.com/a", []byte(`{a.jpg,b.jpg}`), expiry},
+		{"b", "Second", nil, nil, nil, nil},
+		{"c", "Third", nil, nil, nil, nil},
+	}}
+	client, err := NewPostgresClient("curated", sql.OpenDB(fake), "editorial.items")
+	if err != nil {
+		t.Fatalf("creating a client: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	items, err := client.GetContent(ctx, RequestMeta{}, 2)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	want := []*ContentItem{
+		{ID: "a", Title: "First", Source: "curated", Summary: "Summary", Link: "https://example.com/a", Media: []string{"a.jpg", "b.jpg"}, Expiry: expiry},
+		{ID: "b", Title: "Second", Source: "curated"},
+	}
+	if !slices.EqualFunc(items, want, func(a, b *ContentItem) bool {
+		return a.ID == b.ID && a.Title == b.Title && a.Source == b.Source && a.Summary == b.Summary &&
+			a.Link == b.Link && slices.Equal(a.Media, b.Media) && a.Expiry.Equal(b.Expiry)
+	}) {
+		got, _ := json.Marshal(items)
+		t.Errorf("got items %s", got)
+	}
+	if query := fake.query.Load().(string); !strings.Contains(query, `FROM "editorial"."items"`) || !strings.Contains(query, "ORDER BY published_at DESC") {
+		t.Errorf("got query %q, want the quoted table ordered by freshness", query)
+	}
+
+	// The query is prepared once.
+	if _, err := client.GetContent(ctx, RequestMeta{}, 5); err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if n := fake.prepares.Load(); n != 1 {
+		t.Errorf("got %d prepares, want 1", n)
+	}
+}
+
+func TestPostgresClientParams(t *testing.T) {
+	for name, tc := range map[string]struct {
+		params  string
+		wantErr string
+	}{
+		"valid":            {params: `{"dsn": "postgres://user@localhost/db", "table": "public.items", "max_conns": 4}`},
+		"no dsn":           {params: `{}`, wantErr: "dsn is required"},
+		"invalid dsn":      {params: `{"dsn": "postgres://[::1"}`, wantErr: "invalid dsn"},
+		"invalid table":    {params: `{"dsn": "postgres://localhost/db", "table": "items; DROP TABLE items"}`, wantErr: "invalid table"},
+		"negative conns":   {params: `{"dsn": "postgres://localhost/db", "max_conns": -1}`, wantErr: "must not be negative"},
+		"unknown param":    {params: `{"dsn": "postgres://localhost/db", "pool": 4}`, wantErr: "invalid params"},
+		"invalid lifetime": {params: `{"dsn": "postgres://localhost/db", "conn_max_lifetime": "soon"}`, wantErr: "invalid params"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			_, err := newPostgresClientFromParams(ctx, "curated", json.RawMessage(tc.params))
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("got error %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
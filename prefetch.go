@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// maxConcurrentPrefetches bounds the pages warmed at once, so the prefetch hints can't multiply the provider load.
+const maxConcurrentPrefetches = 16
+
+var prefetchRequests = newCounterVec(
+	"prefetch_requests_total",
+	"Number of next pages requested with the prefetch hint, by result (started, skipped, busy).",
+	"result",
+)
+
+// Prefetch fetches the page in the background, so its provider responses are cached before the client asks for it.
+// It does nothing without the cache, when too many pages are already being prefetched, and when the service is draining.
+// The context values (like the shuffle seed) are kept, so the prefetched calls are the ones of the real request.
+// The prefetch isn't cancelled with the request, but it is when the service drains.
+func (s *Service) Prefetch(ctx context.Context, meta RequestMeta, count int, offset int) {
+	if s.cache == nil || !s.fetches.begin() {
+		prefetchRequests.Inc("skipped")
+		return
+	}
+	select {
+	case s.prefetches <- struct{}{}:
+	default:
+		s.fetches.done()
+		prefetchRequests.Inc("busy")
+		return
+	}
+	prefetchRequests.Inc("started")
+
+	ctx, cancel := context.WithCancel(withoutClientTimeout(context.WithoutCancel(ctx)))
+	stop := context.AfterFunc(s.background, cancel)
+	go func() {
+		defer s.fetches.done()
+		defer cancel()
+		defer stop()
+		defer func() { <-s.prefetches }()
+		if _, err := s.StreamContent(ctx, meta, count, offset, nil); err != nil {
+			slog.DebugContext(ctx, "prefetching content", "count", count, "offset", offset, "error", err)
+		}
+	}()
+}
+
+// nextPageLink returns the URL of the next page, with the same parameters, for the Link rel=next header.
+func (h *Handler) nextPageLink(req *http.Request, params *contentRequest) string {
+	query := req.URL.Query()
+	query.Del("prefetch")
+	next := params.offset + params.count
+	if h.cursors != nil && query.Has("cursor") {
+		query.Set("cursor", h.cursors.Encode(next))
+	} else {
+		query.Set("offset", strconv.Itoa(next))
+	}
+	return fmt.Sprintf("<%s?%s>; rel=next", req.URL.Path, query.Encode())
+}
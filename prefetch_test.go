@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPrefetchNext(t *testing.T) {
+	provider := &mockContentProvider{source: Provider1}
+	service, err := NewService([]ContentConfig{{Type: Provider1}}, map[Provider]Client{Provider1: provider}, defaultTimeout,
+		WithCache(NewMemoryCache(100), CacheSettings{TTL: time.Minute}))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service, limits: RequestLimits{MaxItems: 5}})
+	defer srv.Close()
+
+	get := func(query string) *http.Response {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/?" + query)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	drain := func() {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := service.fetches.wait(ctx); err != nil {
+			t.Fatalf("waiting for the prefetch: %v", err)
+		}
+	}
+
+	resp := get("count=2&checksum=true&prefetch=next")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if link, want := resp.Header.Get("Link"), "</?checksum=true&count=2&offset=2>; rel=next"; link != want {
+		t.Errorf("got link %q, want %q", link, want)
+	}
+	drain()
+	calls := provider.calls
+
+	// The next page is served from the cache.
+	get("count=2&offset=2&checksum=true")
+	if provider.calls != calls {
+		t.Errorf("got %d provider calls for the prefetched page, want none", provider.calls-calls)
+	}
+
+	// There is no next page within the limits, so nothing is prefetched.
+	resp = get("count=2&offset=2&prefetch=next")
+	drain()
+	if link := resp.Header.Get("Link"); link != "" {
+		t.Errorf("got link %q beyond the limits", link)
+	}
+	if provider.calls != calls {
+		t.Errorf("got %d provider calls, want none", provider.calls-calls)
+	}
+
+	for name, query := range map[string]string{
+		"invalid value": "count=2&prefetch=all",
+		"with stream":   "count=2&stream=true&prefetch=next",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if resp := get(query); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Provider check statuses.
+const (
+	checkPass = "pass"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// ProviderCheckConfig is a candidate provider: its name, and its settings as in the `providers` of the configuration file.
+type ProviderCheckConfig struct {
+	Name Provider `json:"name"`
+	ProviderConfig
+}
+
+// LoadProviderCheckConfig reads the candidate provider from a JSON or YAML (.yaml, .yml) file.
+func LoadProviderCheckConfig(path string) (*ProviderCheckConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading provider file: %w", err)
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("parsing provider file '%s': %w", path, err)
+		}
+	}
+
+	var pc ProviderCheckConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&pc); err != nil {
+		return nil, fmt.Errorf("parsing provider file '%s': %w", path, err)
+	}
+	return &pc, nil
+}
+
+// ProviderCheckOptions configure the calls made by the provider check.
+type ProviderCheckOptions struct {
+	// Count is the number of items asked for in every call. The provider's allowed counts and capabilities may lower it.
+	Count int
+	// Samples is the number of calls made for measuring the latency.
+	Samples int
+	// MaxLatency is the slowest call the check accepts.
+	MaxLatency time.Duration
+	// Timeout limits every call.
+	Timeout time.Duration
+}
+
+// ProviderCheck is the outcome of one check of a candidate provider.
+type ProviderCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Details string `json:"details,omitempty"`
+}
+
+// ProviderCheckReport is the outcome of all the checks of a candidate provider.
+// The provider can be added to the configuration when it passed all of them (the skipped ones don't apply to it).
+type ProviderCheckReport struct {
+	Provider Provider        `json:"provider"`
+	Passed   bool            `json:"passed"`
+	Checks   []ProviderCheck `json:"checks"`
+}
+
+func (r *ProviderCheckReport) add(name, status, details string) {
+	r.Checks = append(r.Checks, ProviderCheck{Name: name, Status: status, Details: details})
+	if status == checkFail {
+		r.Passed = false
+	}
+}
+
+// skipRest marks the checks after the failed one as skipped.
+func (r *ProviderCheckReport) skipRest(names ...string) {
+	for _, name := range names {
+		r.add(name, checkSkip, "an earlier check failed")
+	}
+}
+
+// checkProvider runs the checks of the candidate provider, in order: the configuration validation, the client creation,
+// the capability discovery, a sample fetch, the validation of the fetched items, and the latency measurement.
+// The calls are made with the provider's own client, without the service's caching and resilience features.
+func checkProvider(ctx context.Context, pc ProviderCheckConfig, opts ProviderCheckOptions) ProviderCheckReport {
+	report := ProviderCheckReport{Provider: pc.Name, Passed: true}
+
+	cfg := &FileConfig{
+		Items:     []ItemConfig{{Provider: pc.Name}},
+		Providers: map[Provider]ProviderConfig{pc.Name: pc.ProviderConfig},
+	}
+	err := cfg.Validate()
+	if pc.Name == "" || pc.Name == ProviderStatic {
+		err = errors.New("the name must be given, and can't be the built-in static provider")
+	}
+	if err != nil {
+		report.add("config", checkFail, err.Error())
+		report.skipRest("client", "capabilities", "fetch", "schema", "latency")
+		return report
+	}
+	clientType := defaultClientType
+	if pc.Client != nil {
+		clientType = pc.Client.Type
+	}
+	report.add("config", checkPass, fmt.Sprintf("client type '%s'", clientType))
+
+	clients, err := NewClients(ctx, cfg)
+	if err != nil {
+		report.add("client", checkFail, err.Error())
+		report.skipRest("capabilities", "fetch", "schema", "latency")
+		return report
+	}
+	client := clients[pc.Name]
+	report.add("client", checkPass, "")
+
+	count := opts.Count
+	if len(pc.AllowedCounts) > 0 && !slices.Contains(pc.AllowedCounts, count) {
+		// The largest allowed count not over the asked one, or the smallest one.
+		allowed := pc.AllowedCounts[0]
+		for _, c := range pc.AllowedCounts {
+			if c <= count {
+				allowed = c
+			}
+		}
+		count = allowed
+	}
+	reporter, ok := client.(CapabilityReporter)
+	if !ok {
+		report.add("capabilities", checkSkip, "the client doesn't report capabilities")
+	} else {
+		callCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		caps, err := reporter.Capabilities(callCtx)
+		cancel()
+		switch {
+		case errors.Is(err, ErrCapabilitiesUnknown):
+			report.add("capabilities", checkSkip, err.Error())
+		case err != nil:
+			report.add("capabilities", checkFail, err.Error())
+		default:
+			data, _ := json.Marshal(caps)
+			report.add("capabilities", checkPass, string(data))
+			if caps.MaxCount > 0 {
+				count = min(count, caps.MaxCount)
+			}
+		}
+	}
+
+	fetch := func() ([]*ContentItem, time.Duration, error) {
+		callCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+		start := time.Now()
+		items, err := client.GetContent(callCtx, RequestMeta{}, count)
+		return items, time.Since(start), err
+	}
+	items, _, err := fetch()
+	switch {
+	case err != nil:
+		report.add("fetch", checkFail, err.Error())
+	case len(items) == 0:
+		report.add("fetch", checkFail, fmt.Sprintf("no items returned for count %d", count))
+	case len(items) > count:
+		report.add("fetch", checkFail, fmt.Sprintf("%d items returned for count %d", len(items), count))
+	default:
+		report.add("fetch", checkPass, fmt.Sprintf("%d items returned for count %d", len(items), count))
+	}
+	if report.Checks[len(report.Checks)-1].Status == checkFail {
+		report.skipRest("schema", "latency")
+		return report
+	}
+
+	status, details := checkItemsSchema(pc.Name, items)
+	report.add("schema", status, details)
+
+	var latencies []time.Duration
+	for range opts.Samples {
+		_, latency, err := fetch()
+		if err != nil {
+			report.add("latency", checkFail, fmt.Sprintf("call %d of %d failed: %v", len(latencies)+1, opts.Samples, err))
+			return report
+		}
+		latencies = append(latencies, latency)
+	}
+	slices.Sort(latencies)
+	p50, slowest := latencies[len(latencies)/2], latencies[len(latencies)-1]
+	details = fmt.Sprintf("p50 %s, max %s of %d calls (limit %s)", p50.Round(time.Millisecond), slowest.Round(time.Millisecond), len(latencies), opts.MaxLatency)
+	if slowest > opts.MaxLatency {
+		report.add("latency", checkFail, details)
+	} else {
+		report.add("latency", checkPass, details)
+	}
+
+	return report
+}
+
+// checkItemsSchema checks that the items map to valid content items, with the same validation as the invalid items policies,
+// and that their IDs are unique.
+func checkItemsSchema(p Provider, items []*ContentItem) (status, details string) {
+	reasons := make(map[string]int)
+	seen := make(map[string]bool, len(items))
+	invalid := 0
+	for _, item := range items {
+		item, reason := sanitizeItem(item, p)
+		if reason == "" && seen[item.ID] {
+			reason = "duplicate_id"
+		}
+		if reason != "" {
+			invalid++
+			reasons[reason]++
+			continue
+		}
+		seen[item.ID] = true
+	}
+	if invalid == 0 {
+		return checkPass, fmt.Sprintf("all %d items valid", len(items))
+	}
+
+	var counts []string
+	for _, reason := range slices.Sorted(maps.Keys(reasons)) {
+		counts = append(counts, fmt.Sprintf("%s (%d)", reason, reasons[reason]))
+	}
+	return checkFail, fmt.Sprintf("%d of %d items invalid: %s", invalid, len(items), strings.Join(counts, ", "))
+}
+
+func runProviderCommand(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: provider check -config provider.yaml [flags]")
+	}
+
+	fs := flag.NewFlagSet("provider check", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to the JSON or YAML file with the candidate provider: its name and its settings as in the config file `providers`")
+	count := fs.Int("count", 10, "number of items asked for in every call")
+	samples := fs.Int("samples", 5, "number of calls made for measuring the latency")
+	maxLatency := fs.Duration("max-latency", time.Second, "the slowest call accepted")
+	timeout := fs.Duration("timeout", defaultTimeout, "timeout of one call")
+	asJSON := fs.Bool("json", false, "write the report as JSON instead of a table")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *configPath == "" || *count <= 0 || *samples <= 0 {
+		return errors.New("usage: provider check -config provider.yaml [-count n] [-samples n] [-max-latency d] [-timeout d] [-json]")
+	}
+	pc, err := LoadProviderCheckConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	// The clients log every call, which would only obscure the report.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	report := checkProvider(ctx, *pc, ProviderCheckOptions{Count: *count, Samples: *samples, MaxLatency: *maxLatency, Timeout: *timeout})
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		writeProviderCheckReport(os.Stdout, report)
+	}
+	if !report.Passed {
+		return fmt.Errorf("provider '%s' failed the checks", pc.Name)
+	}
+	return nil
+}
+
+// writeProviderCheckReport writes the checks as a table, followed by the result.
+func writeProviderCheckReport(w io.Writer, report ProviderCheckReport) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAILS")
+	for _, c := range report.Checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, strings.ToUpper(c.Status), c.Details)
+	}
+	tw.Flush()
+	result := "PASS"
+	if !report.Passed {
+		result = "FAIL"
+	}
+	fmt.Fprintf(w, "\nprovider %s: %s\n", report.Provider, result)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckProvider(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+		case "/untitled":
+			_, _ = w.Write([]byte(`[{"id": "1", "title": "a"}, {"id": "2"}, {"id": "1", "title": "b"}]`))
+			return
+		case "/capabilities":
+			_, _ = w.Write([]byte(`{"max_count": 2}`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"id": "1", "title": "a"}, {"id": "2", "title": "b"}]`))
+	}))
+	defer api.Close()
+	httpClient := func(path, capabilities string) *ClientConfig {
+		params := `{"url": "` + api.URL + path + `"`
+		if capabilities != "" {
+			params += `, "capabilities_url": "` + api.URL + capabilities + `"`
+		}
+		return &ClientConfig{Type: "http", Params: []byte(params + "}")}
+	}
+
+	for name, tc := range map[string]struct {
+		config ProviderCheckConfig
+		want   string
+	}{
+		"sample": {
+			config: ProviderCheckConfig{Name: "candidate"},
+			want:   "config:pass client:pass capabilities:skip fetch:pass schema:pass latency:pass",
+		},
+		"http with capabilities": {
+			config: ProviderCheckConfig{Name: "candidate", ProviderConfig: ProviderConfig{Client: httpClient("/items", "/capabilities")}},
+			want:   "config:pass client:pass capabilities:pass fetch:pass schema:pass latency:pass",
+		},
+		"invalid config": {
+			config: ProviderCheckConfig{Name: "candidate", ProviderConfig: ProviderConfig{MaxConcurrentCalls: -1}},
+			want:   "config:fail client:skip capabilities:skip fetch:skip schema:skip latency:skip",
+		},
+		"static name": {
+			config: ProviderCheckConfig{Name: ProviderStatic},
+			want:   "config:fail client:skip capabilities:skip fetch:skip schema:skip latency:skip",
+		},
+		"invalid client params": {
+			config: ProviderCheckConfig{Name: "candidate", ProviderConfig: ProviderConfig{Client: &ClientConfig{Type: "http", Params: []byte(`{"url": "/items"}`)}}},
+			want:   "config:pass client:fail capabilities:skip fetch:skip schema:skip latency:skip",
+		},
+		"allowed counts": {
+			config: ProviderCheckConfig{Name: "candidate", ProviderConfig: ProviderConfig{Client: httpClient("/items", ""), AllowedCounts: []int{1, 5}}},
+			want:   "config:pass client:pass capabilities:skip fetch:pass schema:pass latency:pass",
+		},
+		"invalid items": {
+			config: ProviderCheckConfig{Name: "candidate", ProviderConfig: ProviderConfig{Client: httpClient("/untitled", "")}},
+			want:   "config:pass client:pass capabilities:skip fetch:pass schema:fail latency:pass",
+		},
+		"slow": {
+			config: ProviderCheckConfig{Name: "candidate", ProviderConfig: ProviderConfig{Client: httpClient("/slow", "")}},
+			want:   "config:pass client:pass capabilities:skip fetch:pass schema:pass latency:fail",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			report := checkProvider(context.Background(), tc.config, ProviderCheckOptions{Count: 3, Samples: 2, MaxLatency: 50 * time.Millisecond, Timeout: time.Second})
+			got := make([]string, len(report.Checks))
+			for i, c := range report.Checks {
+				got[i] = c.Name + ":" + c.Status
+			}
+			if strings.Join(got, " ") != tc.want {
+				t.Errorf("got checks %v, want %s", report.Checks, tc.want)
+			}
+			if passed := !strings.Contains(tc.want, "fail"); report.Passed != passed {
+				t.Errorf("got passed %v, want %v", report.Passed, passed)
+			}
+		})
+	}
+}
+
+func TestLoadProviderCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "provider.yaml")
+	content := "name: acme\nmax_concurrent_calls: 4\nclient:\n  type: http\n  params:\n    url: https://acme.example.com/items\n    timeout: 2s\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	pc, err := LoadProviderCheckConfig(path)
+	if err != nil {
+		t.Fatalf("loading provider: %v", err)
+	}
+	if pc.Name != "acme" || pc.MaxConcurrentCalls != 4 || pc.Client == nil || pc.Client.Type != "http" || !strings.Contains(string(pc.Client.Params), `"timeout":"2s"`) {
+		t.Errorf("got provider %+v", pc)
+	}
+
+	if err := os.WriteFile(path, []byte("name: acme\nunknown: 1\n"), 0o600); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+	if _, err := LoadProviderCheckConfig(path); err == nil {
+		t.Error("got no error for an unknown field")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// recentErrorsSize is the number of provider errors kept by the service.
+const recentErrorsSize = 50
+
+// ProviderError is a failed provider call.
+type ProviderError struct {
+	Time     time.Time `json:"time"`
+	Provider Provider  `json:"provider"`
+	Error    string    `json:"error"`
+}
+
+// ErrorLog keeps the most recent provider errors.
+type ErrorLog struct {
+	entries []ProviderError
+	next    int
+	full    bool
+	m       sync.Mutex
+}
+
+// NewErrorLog returns a log keeping up to `size` errors.
+func NewErrorLog(size int) *ErrorLog {
+	return &ErrorLog{entries: make([]ProviderError, size)}
+}
+
+// Record adds an error to the log, replacing the oldest one when the log is full.
+func (l *ErrorLog) Record(p Provider, t time.Time, err error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.entries[l.next] = ProviderError{Time: t, Provider: p, Error: err.Error()}
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns the logged errors, the newest first.
+func (l *ErrorLog) Recent() []ProviderError {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	errs := make([]ProviderError, 0, n)
+	for i := 1; i <= n; i++ {
+		errs = append(errs, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+
+	return errs
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+)
+
+var sharedRateLimitErrors = newCounterVec(
+	"provider_rate_limit_shared_errors_total",
+	"Number of failed calls to the provider rate limits shared by the replicas. The rate limits work locally meanwhile.",
+)
+
+// RateBudgetStore shares the budgets of the provider rate limits among the replicas of the service,
+// so the rate limit reported by a provider holds for the whole fleet, not for every replica.
+type RateBudgetStore interface {
+	// Take takes one call from the provider's budget of `rate` calls per second, and tells whether it was available.
+	Take(ctx context.Context, p Provider, rate float64) (bool, error)
+}
+
+// RedisRateBudgetStore is a RateBudgetStore in Redis. The calls are counted in fixed windows: one second long,
+// or long enough for one call for the rates below one call per second. A window's key expires after the window.
+type RedisRateBudgetStore struct {
+	redis *RedisCache
+	now   func() time.Time
+}
+
+// NewRedisRateBudgetStore returns a store using the Redis server. The keys get the ":ratelimit:" suffix of the prefix.
+func NewRedisRateBudgetStore(cfg RedisConfig) *RedisRateBudgetStore {
+	cfg.KeyPrefix += "ratelimit:"
+	return &RedisRateBudgetStore{redis: NewRedisCache(cfg), now: time.Now}
+}
+
+// Take implements RateBudgetStore.
+func (s *RedisRateBudgetStore) Take(ctx context.Context, p Provider, rate float64) (bool, error) {
+	window, budget := time.Second, int64(math.Floor(rate))
+	if rate < 1 {
+		window, budget = time.Duration(float64(time.Second)/rate), 1
+	}
+	key := s.redis.keyPrefix + string(p) + ":" + strconv.FormatInt(s.now().UnixNano()/int64(window), 10)
+
+	reply, err := s.redis.do(ctx, "INCR", key)
+	if err != nil {
+		return false, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return false, fmt.Errorf("unexpected redis INCR reply %v", reply)
+	}
+	if n == 1 {
+		if _, err := s.redis.do(ctx, "PEXPIRE", key, strconv.FormatInt(max(window.Milliseconds(), 1), 10)); err != nil {
+			return false, err
+		}
+	}
+
+	return n <= budget, nil
+}
+
+// allowShared tells whether the call fits the provider's rate limit shared by the replicas. When the shared budget
+// can't be reached, the local limiter decides.
+func (c *rateLimitedClient) allowShared(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, sharedBreakerTimeout)
+	defer cancel()
+	ok, err := c.shared.Take(ctx, c.provider, c.rate)
+	if err != nil {
+		sharedRateLimitErrors.Inc()
+		slog.WarnContext(ctx, "taking the shared provider rate budget failed", "provider", c.provider, "error", err)
+		ok, _ = c.limiter.allow(time.Now())
+	}
+	return ok
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSharedRateLimits(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	redis := newFakeRedis(t)
+	replicas := make([]*rateLimitedClient, 2)
+	for i := range replicas {
+		store := NewRedisRateBudgetStore(RedisConfig{Addr: redis.addr, KeyPrefix: "test:"})
+		store.now = func() time.Time { return now }
+		replicas[i] = &rateLimitedClient{
+			client:   &mockContentProvider{source: Provider1},
+			provider: Provider1,
+			limiter:  newRateLimiter(2, 2),
+			shared:   store,
+			rate:     2,
+		}
+	}
+
+	// The replicas share the budget of 2 calls per second.
+	var errs []error
+	for _, c := range []*rateLimitedClient{replicas[0], replicas[1], replicas[0]} {
+		_, err := c.GetContent(context.Background(), RequestMeta{}, 1)
+		errs = append(errs, err)
+	}
+	if errs[0] != nil || errs[1] != nil || !errors.Is(errs[2], ErrProviderRateLimited) {
+		t.Errorf("got errors %v, want the third call over the shared rate limit", errs)
+	}
+
+	now = now.Add(time.Second)
+	if _, err := replicas[1].GetContent(context.Background(), RequestMeta{}, 1); err != nil {
+		t.Errorf("got error %v in the next window, want none", err)
+	}
+}
+
+func TestSharedRateLimitsUnavailable(t *testing.T) {
+	c := &rateLimitedClient{
+		client:   &mockContentProvider{source: Provider1},
+		provider: Provider1,
+		limiter:  newRateLimiter(1, 1),
+		shared:   NewRedisRateBudgetStore(RedisConfig{Addr: "127.0.0.1:1"}),
+		rate:     1,
+	}
+
+	// The local limiter decides when the shared budget can't be reached.
+	if _, err := c.GetContent(context.Background(), RequestMeta{}, 1); err != nil {
+		t.Errorf("got error %v, want the call within the local limit", err)
+	}
+	if _, err := c.GetContent(context.Background(), RequestMeta{}, 1); !errors.Is(err, ErrProviderRateLimited) {
+		t.Errorf("got error %v, want the call over the local limit rejected", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+var httpPanics = newCounterVec(
+	"http_panics_total",
+	"Number of HTTP requests whose handler panicked, by the server (main, admin, grpc).",
+	"server",
+)
+
+var providerPanics = newCounterVec(
+	"provider_panics_total",
+	"Number of provider client calls that panicked, by the provider.",
+	"provider",
+)
+
+// ErrProviderPanic is the error of the provider calls that panicked.
+var ErrProviderPanic = errors.New("provider client panicked")
+
+// recoveringClient turns the panics of the client into errors. The provider calls run in the service goroutines,
+// out of reach of the handlers recovery, so a panic would crash the process.
+type recoveringClient struct {
+	client   Client
+	provider Provider
+}
+
+func (c *recoveringClient) GetContent(ctx context.Context, meta RequestMeta, count int) (items []*ContentItem, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			items, err = nil, providerPanicError(ctx, c.provider, v)
+		}
+	}()
+
+	return c.client.GetContent(ctx, meta, count)
+}
+
+// providerPanicError logs the recovered panic of a provider call with the stack trace, counts it, and returns it as an error.
+func providerPanicError(ctx context.Context, p Provider, v any) error {
+	providerPanics.Inc(string(p))
+	slog.ErrorContext(ctx, "provider call panicked",
+		"provider", p,
+		"panic", fmt.Sprint(v),
+		"stack", string(debug.Stack()),
+	)
+	return fmt.Errorf("%w: %v", ErrProviderPanic, v)
+}
+
+// withRecovery returns a handler turning the panics of the next one into 500 responses, so a bug fails the request
+// with an error the client understands. The panic is logged with the stack trace, and counted.
+// gRPC requests get the INTERNAL status, the others a JSON error, or the dropped connection when the response was already started.
+// http.ErrAbortHandler is passed on, as it's the way to abort a response on purpose.
+func withRecovery(next http.Handler, server string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			httpPanics.Inc(server)
+			slog.ErrorContext(req.Context(), "handler panicked",
+				"server", server,
+				"method", req.Method,
+				"path", req.URL.Path,
+				"panic", fmt.Sprint(v),
+				"stack", string(debug.Stack()),
+			)
+			switch {
+			case strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc"):
+				// gRPC clients read the status from the trailers, so it can be sent after a part of the response too.
+				if rec.status == 0 {
+					w.Header().Set("Content-Type", "application/grpc+proto")
+				}
+				writeGRPCStatus(w, grpcInternal, "internal server error")
+			case rec.status == 0:
+				writeError(w, req, http.StatusInternalServerError, ErrorCodeInternal, "internal server error")
+			default:
+				// The client would take the cut response for a complete one, so the connection is dropped.
+				panic(http.ErrAbortHandler)
+			}
+		}()
+
+		next.ServeHTTP(rec, req)
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	for name, tc := range map[string]struct {
+		handler     http.HandlerFunc
+		contentType string
+		wantStatus  int
+		wantCode    string
+		wantGRPC    string
+		wantAbort   bool
+	}{
+		"panic": {
+			handler:    func(w http.ResponseWriter, req *http.Request) { panic("bug") },
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   ErrorCodeInternal,
+		},
+		"grpc": {
+			handler:     func(w http.ResponseWriter, req *http.Request) { panic("bug") },
+			contentType: "application/grpc",
+			wantStatus:  http.StatusOK,
+			wantGRPC:    "13",
+		},
+		"started response": {
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				_, _ = w.Write([]byte("[{"))
+				panic("bug")
+			},
+			wantAbort: true,
+		},
+		"abort": {
+			handler:   func(w http.ResponseWriter, req *http.Request) { panic(http.ErrAbortHandler) },
+			wantAbort: true,
+		},
+		"no panic": {
+			handler:    func(w http.ResponseWriter, req *http.Request) { w.WriteHeader(http.StatusNoContent) },
+			wantStatus: http.StatusNoContent,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(withRequestID(withRecovery(tc.handler, "main")))
+			defer srv.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, srv.URL, nil)
+			req.Header.Set("Content-Type", tc.contentType)
+			resp, err := http.DefaultClient.Do(req)
+			if err == nil {
+				defer resp.Body.Close()
+				// The dropped connection fails the read of the body.
+				_, err = io.ReadAll(resp.Body)
+			}
+			if tc.wantAbort {
+				if err == nil {
+					t.Errorf("got status %d, want the connection dropped", resp.StatusCode)
+				}
+				return
+			}
+			if resp == nil {
+				t.Fatalf("request: %v", err)
+			}
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if got := resp.Trailer.Get("Grpc-Status"); got != tc.wantGRPC {
+				t.Errorf("got gRPC status %q, want %q", got, tc.wantGRPC)
+			}
+		})
+	}
+
+	// The error body has the code and the request ID.
+	srv := httptest.NewServer(withRequestID(withRecovery(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { panic("bug") }), "main")))
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set(requestIDHeader, "test-request")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	var body ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Code != ErrorCodeInternal || body.RequestID != "test-request" {
+		t.Errorf("got error %+v (%v), want the internal error with the request ID", body, err)
+	}
+}
+
+func TestMissingClient(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: &mockContentProvider{source: Provider2},
+	}
+	service, err := NewService([]ContentConfig{{Type: Provider1}, {Type: Provider2}}, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	// The configs are checked against the clients, so only a bug could remove one.
+	delete(service.clients, Provider2)
+
+	result, err := service.GetContentResult(context.Background(), RequestMeta{}, 3, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if len(result.Items) != 1 || len(result.Failures) == 0 || result.Failures[0].Provider != Provider2 {
+		t.Errorf("got %d items and failures %+v, want the item before the provider without a client", len(result.Items), result.Failures)
+	}
+}
+
+// panickingClient panics on every call, like a buggy provider client.
+type panickingClient struct{}
+
+func (panickingClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	panic("client bug")
+}
+
+func TestProviderPanics(t *testing.T) {
+	for name, tc := range map[string]struct {
+		configs []ContentConfig
+		// unwrapped replaces the wrapped client, for the panics of the decorators.
+		unwrapped  bool
+		wantItems  int
+		wantPanics float64
+	}{
+		"client":   {configs: []ContentConfig{{Type: Provider1}}, wantPanics: 1},
+		"fallback": {configs: []ContentConfig{{Type: Provider1, Fallback: &Provider2}}, wantItems: 1, wantPanics: 1},
+		"decorator": {
+			configs:    []ContentConfig{{Type: Provider1}},
+			unwrapped:  true,
+			wantPanics: 1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clients := map[Provider]Client{Provider1: panickingClient{}, Provider2: &mockContentProvider{source: Provider2}}
+			service, err := NewService(tc.configs, clients, defaultTimeout)
+			if err != nil {
+				t.Fatalf("creating a service: %v", err)
+			}
+			if tc.unwrapped {
+				service.clients[Provider1] = panickingClient{}
+			}
+			series := `provider_panics_total{provider="` + string(Provider1) + `"}`
+			before := metricValue(t, series)
+
+			result, err := service.GetContentResult(context.Background(), RequestMeta{}, 1, 0)
+			if err != nil {
+				t.Fatalf("getting content: %v", err)
+			}
+			if len(result.Items) != tc.wantItems {
+				t.Errorf("got %d items, want %d", len(result.Items), tc.wantItems)
+			}
+			if tc.wantItems == 0 && (len(result.Failures) != 1 || result.Failures[0].Reason != "provider error") {
+				t.Errorf("got failures %+v, want the position failed with the provider error", result.Failures)
+			}
+			if got := metricValue(t, series) - before; got != tc.wantPanics {
+				t.Errorf("got %v panics counted, want %v", got, tc.wantPanics)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+var cacheRefreshes = newCounterVec(
+	"cache_refreshes_total",
+	"Number of background refreshes of the cached provider responses, by result (ok, error, skipped).",
+	"provider", "result",
+)
+
+// RefreshSettings configure the background refresher, keeping the provider responses in the cache warm.
+type RefreshSettings struct {
+	// Items is the number of items fetched from each provider. Zero disables the refresher.
+	Items int
+	// Interval is the average time between the refreshes of a provider.
+	Interval time.Duration
+	// Jitter is the fraction of the interval the refreshes are randomly moved by, so the providers aren't called in lockstep.
+	Jitter float64
+	// MaxStaleness is how long the refreshed responses are served. It must be longer than the interval,
+	// so the responses are refreshed before they expire; when the refreshes fail, the requests call the providers again.
+	MaxStaleness time.Duration
+}
+
+// Validate checks the settings of an enabled refresher.
+func (s RefreshSettings) Validate() error {
+	if s.Items <= 0 {
+		return nil
+	}
+	if s.Interval <= 0 {
+		return errors.New("refresh interval must be positive")
+	}
+	if s.Jitter < 0 || s.Jitter >= 1 {
+		return errors.New("refresh jitter must be from 0 to less than 1")
+	}
+	if s.MaxStaleness <= time.Duration(float64(s.Interval)*(1+s.Jitter)) {
+		return errors.New("refresh max staleness must be longer than the interval with the jitter")
+	}
+	return nil
+}
+
+// nextDelay returns the time until the next refresh, the interval moved randomly by up to the jitter.
+func (s RefreshSettings) nextDelay() time.Duration {
+	return time.Duration(float64(s.Interval) * (1 + s.Jitter*(2*rand.Float64()-1)))
+}
+
+// RunRefresher refreshes the cached responses of the providers until the context is done, each provider on its own schedule.
+// It does nothing when the refresher isn't enabled with WithBackgroundRefresh.
+func (s *Service) RunRefresher(ctx context.Context) {
+	var wg sync.WaitGroup
+	for p, c := range s.refreshed {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The first refresh is spread over the interval too, so the providers aren't all called at the start.
+			timer := time.NewTimer(time.Duration(rand.Int64N(int64(s.refresh.Interval))))
+			defer timer.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C:
+					s.refreshProvider(ctx, p, c)
+					timer.Reset(s.refresh.nextDelay())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// refreshProvider fetches the items from the provider and caches them for all the counts up to the number of items.
+// The new items are passed to the live updates stream.
+func (s *Service) refreshProvider(ctx context.Context, p Provider, c *cachedClient) {
+	if s.isDisabled(p) || !s.fetches.begin() {
+		cacheRefreshes.Inc(string(p), "skipped")
+		return
+	}
+	defer s.fetches.done()
+	defer s.goroutines.Track(ctx, p, refreshGoroutine)()
+	_, _, timeout := s.itemsConfig("", "", EndpointContent, "")
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	items, err := c.refresh(ctx, s.refresh.Items, s.refresh.MaxStaleness)
+	if err != nil {
+		cacheRefreshes.Inc(string(p), "error")
+		slog.WarnContext(ctx, "refreshing cached content", "provider", p, "error", err)
+		return
+	}
+	cacheRefreshes.Inc(string(p), "ok")
+	s.live.publish(p, items)
+}
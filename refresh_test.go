@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// notifyingClient signals every finished call on `called`, without blocking.
+type notifyingClient struct {
+	client Client
+	called chan struct{}
+}
+
+func (c *notifyingClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	items, err := c.client.GetContent(ctx, meta, count)
+	select {
+	case c.called <- struct{}{}:
+	default:
+	}
+	return items, err
+}
+
+func TestBackgroundRefresh(t *testing.T) {
+	p1, p2 := &mockContentProvider{source: Provider1}, &mockContentProvider{source: Provider2}
+	calls := func() int {
+		p1.m.Lock()
+		defer p1.m.Unlock()
+		return p1.calls
+	}
+	refreshed := make(chan struct{}, 1)
+	clients := map[Provider]Client{Provider1: &notifyingClient{client: p1, called: refreshed}, Provider2: p2}
+	configs := []ContentConfig{{Type: Provider1}, {Type: Provider2}}
+	refresh := RefreshSettings{Items: 5, Interval: 10 * time.Millisecond, MaxStaleness: time.Minute}
+	service, err := NewService(configs, clients, defaultTimeout,
+		WithCache(NewMemoryCache(100), CacheSettings{TTL: time.Minute, Providers: map[Provider]ProviderCacheSettings{Provider2: {Disabled: true}}}),
+		WithBackgroundRefresh(refresh),
+	)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	if _, ok := service.refreshed[Provider2]; ok {
+		t.Error("the provider without the cache is refreshed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.RunRefresher(ctx)
+	}()
+	// The provider is refreshed on its schedule, again and again.
+	for i := range 2 {
+		select {
+		case <-refreshed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d refreshes, want 2", i)
+		}
+	}
+	cancel()
+	<-done
+	refreshes := calls()
+
+	// Any count up to the refreshed items is served from the cache.
+	for _, count := range []int{2, 6, 10} {
+		if _, err := service.GetContent(context.Background(), RequestMeta{IP: "10.0.0.1"}, count, 0); err != nil {
+			t.Fatalf("getting content: %v", err)
+		}
+	}
+	if n := calls(); n != refreshes {
+		t.Errorf("got %d provider calls for the requests, want none", n-refreshes)
+	}
+	if _, err := service.GetContent(context.Background(), RequestMeta{}, 12, 0); err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	if n := calls(); n != refreshes+1 {
+		t.Errorf("got %d provider calls for more than the refreshed items, want 1", n-refreshes)
+	}
+}
+
+func TestRefreshSettings(t *testing.T) {
+	for name, tc := range map[string]struct {
+		settings RefreshSettings
+		wantErr  bool
+	}{
+		"disabled":          {settings: RefreshSettings{}},
+		"valid":             {settings: RefreshSettings{Items: 10, Interval: time.Minute, Jitter: 0.2, MaxStaleness: 2 * time.Minute}},
+		"zero interval":     {settings: RefreshSettings{Items: 10, MaxStaleness: time.Minute}, wantErr: true},
+		"too large jitter":  {settings: RefreshSettings{Items: 10, Interval: time.Minute, Jitter: 1, MaxStaleness: 5 * time.Minute}, wantErr: true},
+		"short staleness":   {settings: RefreshSettings{Items: 10, Interval: time.Minute, Jitter: 0.2, MaxStaleness: time.Minute}, wantErr: true},
+		"jittered interval": {settings: RefreshSettings{Items: 10, Interval: time.Minute, Jitter: 0.5, MaxStaleness: 80 * time.Second}, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.settings.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	settings := RefreshSettings{Interval: time.Minute, Jitter: 0.2}
+	for range 100 {
+		if d := settings.nextDelay(); d < 48*time.Second || d > 72*time.Second {
+			t.Fatalf("got delay %v, want it within 20%% of the interval", d)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ClientFactory creates the client of the provider from the parameters in the configuration file.
+// The parameters are nil when the configuration has none. Background work of the client (like reloading
+// its data) must stop when the context is done.
+type ClientFactory func(ctx context.Context, p Provider, params json.RawMessage) (Client, error)
+
+// defaultClientType is the client type of the providers without a client configuration.
+const defaultClientType = "sample"
+
+var (
+	clientFactories  = make(map[string]ClientFactory)
+	clientFactoriesM sync.RWMutex
+)
+
+func init() {
+	RegisterClientFactory("sample", newSampleClient)
+	RegisterClientFactory("static", newStaticClientFromParams)
+	RegisterClientFactory("http", newHTTPProviderClientFromParams)
+	RegisterClientFactory("postgres", newPostgresClientFromParams)
+}
+
+// RegisterClientFactory makes the client type available for the configuration file.
+// It's meant to be called from init functions, and panics when the type is registered twice.
+func RegisterClientFactory(clientType string, f ClientFactory) {
+	clientFactoriesM.Lock()
+	defer clientFactoriesM.Unlock()
+
+	if _, ok := clientFactories[clientType]; ok {
+		panic(fmt.Sprintf("client type '%s' registered twice", clientType))
+	}
+	clientFactories[clientType] = f
+}
+
+// ClientTypes returns the registered client types, sorted.
+func ClientTypes() []string {
+	clientFactoriesM.RLock()
+	defer clientFactoriesM.RUnlock()
+
+	types := make([]string, 0, len(clientFactories))
+	for t := range clientFactories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+func clientFactory(clientType string) (ClientFactory, bool) {
+	clientFactoriesM.RLock()
+	defer clientFactoriesM.RUnlock()
+
+	f, ok := clientFactories[clientType]
+	return f, ok
+}
+
+// NewClients creates the clients of the providers used in the configuration, with the registered factories.
+// The built-in static provider isn't created, see withStaticClient.
+func NewClients(ctx context.Context, cfg *FileConfig) (map[Provider]Client, error) {
+	clients := make(map[Provider]Client)
+	for _, p := range cfg.UsedProviders() {
+		if p == ProviderStatic {
+			continue
+		}
+		cc := cfg.Providers[p].Client
+		if cc == nil {
+			cc = &ClientConfig{Type: defaultClientType}
+		}
+		f, ok := clientFactory(cc.Type)
+		if !ok {
+			return nil, fmt.Errorf("provider '%s': unknown client type '%s'", p, cc.Type)
+		}
+		c, err := f(ctx, p, cc.Params)
+		if err != nil {
+			return nil, fmt.Errorf("provider '%s': creating '%s' client: %w", p, cc.Type, err)
+		}
+		clients[p] = c
+	}
+
+	return clients, nil
+}
+
+// decodeClientParams decodes the client parameters into v, rejecting unknown fields.
+func decodeClientParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+
+	return nil
+}
+
+// sampleClientParams are the parameters of the "sample" clients.
+type sampleClientParams struct {
+	// IDs is the item ID generator: "uuid" (the default) or "sequential".
+	IDs string `json:"ids"`
+}
+
+func newSampleClient(_ context.Context, p Provider, params json.RawMessage) (Client, error) {
+	var sp sampleClientParams
+	if err := decodeClientParams(params, &sp); err != nil {
+		return nil, err
+	}
+	var ids IDGenerator
+	switch sp.IDs {
+	case "", "uuid":
+		ids = NewUUIDv7Generator(string(p) + "-")
+	case "sequential":
+		ids = NewSequentialIDGenerator(string(p) + "-")
+	default:
+		return nil, fmt.Errorf("invalid ids '%s', must be uuid or sequential", sp.IDs)
+	}
+
+	return AdaptSimpleClient(SampleContentProvider{Source: p, IDs: ids}), nil
+}
+
+// staticClientParams are the parameters of the "static" clients.
+type staticClientParams struct {
+	// Path is the JSON or YAML (.yaml, .yml) file with the items. Empty means the built-in items.
+	Path string `json:"path"`
+	// Selection is which items are served: first (the default), round_robin or random.
+	Selection StaticSelection `json:"selection,omitempty"`
+}
+
+func newStaticClientFromParams(ctx context.Context, p Provider, params json.RawMessage) (Client, error) {
+	var sp staticClientParams
+	if err := decodeClientParams(params, &sp); err != nil {
+		return nil, err
+	}
+	c, err := NewStaticClient(sp.Path, sp.Selection)
+	if err != nil {
+		return nil, err
+	}
+	c.provider = p
+	go c.Run(ctx, staticReloadInterval)
+
+	return c, nil
+}
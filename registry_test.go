@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewClients(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[{"id": "h1", "title": "from http"}]`))
+	}))
+	defer api.Close()
+	staticFile := filepath.Join(t.TempDir(), "static.json")
+	if err := os.WriteFile(staticFile, []byte(`[{"id": "s1"}]`), 0o600); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+
+	cfg := &FileConfig{
+		Items: []ItemConfig{{Provider: "default"}, {Provider: "sequential"}, {Provider: "file", Fallback: "api"}, {Provider: ProviderStatic}},
+		Providers: map[Provider]ProviderConfig{
+			"sequential": {Client: &ClientConfig{Type: "sample", Params: json.RawMessage(`{"ids": "sequential"}`)}},
+			"file":       {Client: &ClientConfig{Type: "static", Params: json.RawMessage(`{"path": "` + staticFile + `"}`)}},
+			"api":        {Client: &ClientConfig{Type: "http", Params: json.RawMessage(`{"url": "` + api.URL + `"}`)}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clients, err := NewClients(ctx, cfg)
+	if err != nil {
+		t.Fatalf("creating clients: %v", err)
+	}
+	if _, ok := clients[ProviderStatic]; ok {
+		t.Error("got a client for the built-in static provider")
+	}
+
+	for p, wantID := range map[Provider]string{"default": "default-", "sequential": "sequential-0", "file": "s1", "api": "h1"} {
+		items, err := clients[p].GetContent(ctx, RequestMeta{}, 1)
+		if err != nil {
+			t.Fatalf("provider %s: getting content: %v", p, err)
+		}
+		if len(items) != 1 || !strings.HasPrefix(items[0].ID, wantID) || items[0].Source != string(p) {
+			t.Errorf("provider %s: got items %+v, want an item of the provider with ID %s...", p, items, wantID)
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		client  ClientConfig
+		wantErr string
+	}{
+		"invalid params": {client: ClientConfig{Type: "sample", Params: json.RawMessage(`{"color": "red"}`)}, wantErr: "invalid params"},
+		"no url":         {client: ClientConfig{Type: "http"}, wantErr: "url is required"},
+		"relative url":   {client: ClientConfig{Type: "http", Params: json.RawMessage(`{"url": "/items"}`)}, wantErr: "invalid url"},
+		"bad selection":  {client: ClientConfig{Type: "static", Params: json.RawMessage(`{"selection": "newest"}`)}, wantErr: "unknown static selection"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := &FileConfig{
+				Items:     []ItemConfig{{Provider: Provider1}},
+				Providers: map[Provider]ProviderConfig{Provider1: {Client: &tc.client}},
+			}
+			_, err := NewClients(ctx, cfg)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPProviderClient(t *testing.T) {
+	var got *http.Request
+	status := http.StatusOK
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`[{"id": "1"}, {"id": "2", "source": "partner"}, {"id": "3"}]`))
+	}))
+	defer api.Close()
+
+	client, err := NewHTTPProviderClient(Provider1, api.URL+"/items?lang=any", 0, map[string]string{"X-Api-Key": "secret"})
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	meta := RequestMeta{IP: "203.0.113.7", Locale: "de", Variant: "b"}
+	items, err := client.GetContent(context.Background(), meta, 2)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+
+	if len(items) != 2 || items[0].Source != string(Provider1) || items[1].Source != "partner" {
+		t.Errorf("got items %+v, want the first 2 items, with the provider as the default source", items)
+	}
+	for k, want := range map[string]string{
+		"X-Api-Key":            "secret",
+		"X-Forwarded-For":      meta.IP,
+		"Accept-Language":      meta.Locale,
+		"X-Experiment-Variant": meta.Variant,
+	} {
+		if v := got.Header.Get(k); v != want {
+			t.Errorf("got header %s %q, want %q", k, v, want)
+		}
+	}
+	if q := got.URL.Query(); q.Get("count") != "2" || q.Get("lang") != "any" {
+		t.Errorf("got query %s, want the count added to the URL query", got.URL.RawQuery)
+	}
+
+	status = http.StatusServiceUnavailable
+	if _, err := client.GetContent(context.Background(), meta, 2); err == nil {
+		t.Error("expected error for an unsuccessful status")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	// Embedded time zone database, so the `tz` parameter works also in minimal containers.
+	_ "time/tzdata"
+)
+
+// ExpiryFormat defines how the item expiry is rendered in responses.
+type ExpiryFormat string
+
+// Supported expiry formats.
+const (
+	// ExpiryRFC3339 renders the expiry as an RFC 3339 string (the default).
+	ExpiryRFC3339 ExpiryFormat = "rfc3339"
+	// ExpiryUnix renders the expiry as a number of seconds since the Unix epoch.
+	ExpiryUnix ExpiryFormat = "unix"
+)
+
+// ItemView is the representation of ContentItem in responses.
+type ItemView struct {
+	ID      string   `json:"id" xml:"id"`
+	Title   string   `json:"title" xml:"title"`
+	Source  string   `json:"source" xml:"source"`
+	Summary string   `json:"summary" xml:"summary"`
+	Link    string   `json:"link" xml:"link"`
+	Media   []string `json:"media,omitempty" xml:"media,omitempty"`
+	// Expiry is a time.Time or a Unix timestamp (int64), depending on the requested format.
+	Expiry interface{} `json:"expiry" xml:"expiry"`
+	// Checksum is the hash of the item content, when requested.
+	Checksum string `json:"checksum,omitempty" xml:"checksum,omitempty"`
+}
+
+// renderOptions define the response representation requested by the client.
+type renderOptions struct {
+	expiryFormat ExpiryFormat
+	location     *time.Location // Nil keeps the provider's time zone.
+	checksum     bool
+	// policy hides the item fields from the client.
+	policy FieldPolicy
+}
+
+// parseRenderOptions parses the `expiry_format` and `tz` parameter values.
+func parseRenderOptions(expiryFormat, tz string) (renderOptions, ValidationErrors) {
+	var opts renderOptions
+	var errs ValidationErrors
+
+	switch f := ExpiryFormat(expiryFormat); f {
+	case "":
+		opts.expiryFormat = ExpiryRFC3339
+	case ExpiryRFC3339, ExpiryUnix:
+		opts.expiryFormat = f
+	default:
+		errs = append(errs, ParamError{
+			Param:   "expiry_format",
+			Message: fmt.Sprintf("must be one of: %s, %s", ExpiryRFC3339, ExpiryUnix),
+		})
+	}
+
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			errs = append(errs, ParamError{Param: "tz", Message: "unknown time zone"})
+		}
+		opts.location = loc
+	}
+
+	return opts, errs
+}
+
+// renderItems returns the views of the items.
+func (o renderOptions) renderItems(items []*ContentItem) []*ItemView {
+	views := make([]*ItemView, len(items))
+	for i, item := range items {
+		views[i] = o.renderItem(item)
+	}
+
+	return views
+}
+
+func (o renderOptions) renderItem(item *ContentItem) *ItemView {
+	// The hidden fields are dropped first, so nothing derived from them (like the checksum) is sent either.
+	item = o.policy.redact(item)
+	expiry := item.Expiry
+	if o.location != nil {
+		expiry = expiry.In(o.location)
+	}
+
+	v := &ItemView{
+		ID:      item.ID,
+		Title:   item.Title,
+		Source:  item.Source,
+		Summary: item.Summary,
+		Link:    item.Link,
+		Media:   item.Media,
+		Expiry:  expiry,
+	}
+	switch {
+	case o.policy.hides("expiry"):
+		v.Expiry = nil
+	case o.expiryFormat == ExpiryUnix:
+		v.Expiry = expiry.Unix()
+	}
+	if o.checksum && !o.policy.hides("checksum") {
+		v.Checksum = itemChecksum(item)
+	}
+
+	return v
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExpiryRendering(t *testing.T) {
+	expiry := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	item := &ContentItem{ID: "1", Expiry: expiry}
+
+	for name, tc := range map[string]struct {
+		format ExpiryFormat
+		tz     string
+		want   string
+	}{
+		"default": {
+			want: `"2021-06-01T12:00:00Z"`,
+		},
+		"rfc3339 with tz": {
+			format: ExpiryRFC3339,
+			tz:     "Europe/Warsaw",
+			want:   `"2021-06-01T14:00:00+02:00"`,
+		},
+		"unix": {
+			format: ExpiryUnix,
+			tz:     "America/New_York",
+			want:   "1622548800",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts, errs := parseRenderOptions(string(tc.format), tc.tz)
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			data, err := json.Marshal(opts.renderItem(item).Expiry)
+			if err != nil {
+				t.Fatalf("encoding: %v", err)
+			}
+			if string(data) != tc.want {
+				t.Errorf("got %s, want %s", data, tc.want)
+			}
+		})
+	}
+}
+
+func TestExpiryRenderingValidation(t *testing.T) {
+	service, err := NewDefaultService()
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+
+	for query, wantStatus := range map[string]int{
+		"expiry_format=unix":               http.StatusOK,
+		"expiry_format=rfc3339&tz=UTC":     http.StatusOK,
+		"expiry_format=iso":                http.StatusBadRequest,
+		"tz=Mars/Olympus_Mons":             http.StatusBadRequest,
+		"expiry_format=unix&tz=Asia/Tokyo": http.StatusOK,
+	} {
+		resp, err := http.Get(srv.URL + "/?count=1&" + query)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			t.Errorf("%s: got status %d, want %d", query, resp.StatusCode, wantStatus)
+		}
+	}
+}
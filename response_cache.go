@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	cacheRequests = newCounterVec(
+		"cache_requests_total",
+		"Number of provider response cache lookups by result (hit, miss).",
+		"provider", "result",
+	)
+	cacheExpiredItems = newCounterVec(
+		"cache_expired_items_total",
+		"Number of cached items that expired before they were served, by result (served, refetched, refetch_failed).",
+		"provider", "result",
+	)
+)
+
+// CacheSettings configures caching of provider responses.
+type CacheSettings struct {
+	// TTL is how long the responses are cached.
+	TTL time.Duration
+	// PerUser adds the user IP to the cache keys, for providers personalizing the content.
+	PerUser bool
+	// RefetchExpired makes the cached items that already expired be fetched again from the provider, instead of served.
+	RefetchExpired bool
+	// Providers override the settings for individual providers.
+	Providers map[Provider]ProviderCacheSettings
+}
+
+// ProviderCacheSettings override the cache settings for one provider.
+type ProviderCacheSettings struct {
+	// Disabled turns off caching for the provider.
+	Disabled bool `json:"disabled,omitempty"`
+	// TTL overrides the cache TTL.
+	TTL Duration `json:"ttl,omitempty"`
+	// PerUser overrides adding the user IP to the cache keys.
+	PerUser *bool `json:"per_user,omitempty"`
+}
+
+// forProvider returns the effective settings for the provider.
+func (s CacheSettings) forProvider(p Provider) (enabled bool, ttl time.Duration, perUser bool) {
+	ttl, perUser = s.TTL, s.PerUser
+	ps, ok := s.Providers[p]
+	if !ok {
+		return true, ttl, perUser
+	}
+	if ps.TTL > 0 {
+		ttl = time.Duration(ps.TTL)
+	}
+	if ps.PerUser != nil {
+		perUser = *ps.PerUser
+	}
+
+	return !ps.Disabled, ttl, perUser
+}
+
+// CacheCounters are the cache lookup statistics for one provider.
+type CacheCounters struct {
+	Provider Provider `json:"provider"`
+	Hits     uint64   `json:"hits"`
+	Misses   uint64   `json:"misses"`
+}
+
+// cachedClient is a Client decorator storing provider responses in a cache.
+type cachedClient struct {
+	client   Client
+	provider Provider
+	cache    Cache
+	ttl      time.Duration
+	perUser  bool
+	// refetchExpired enables replacing the expired cached items with new ones.
+	refetchExpired bool
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// GetContent implements Client.
+func (c *cachedClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	key := c.key(meta, count)
+	if data, ok, err := c.cache.Get(ctx, key); err != nil {
+		slog.WarnContext(ctx, "cache get failed", "key", key, "error", err)
+	} else if ok {
+		var items []*ContentItem
+		err := json.Unmarshal(data, &items)
+		if err == nil {
+			c.hits.Add(1)
+			recordCacheResult(ctx, "hit")
+			cacheRequests.Inc(string(c.provider), "hit")
+			return c.replaceExpired(ctx, key, meta, items), nil
+		}
+		slog.WarnContext(ctx, "cache decode failed", "key", key, "error", err)
+	}
+	c.misses.Add(1)
+	recordCacheResult(ctx, "miss")
+	cacheRequests.Inc(string(c.provider), "miss")
+
+	items, err := c.client.GetContent(ctx, meta, count)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store(ctx, key, items)
+
+	return items, nil
+}
+
+// key returns the cache key of the call. The responses differ by the personalization fields of the request,
+// so a response for one locale or variant isn't served to another.
+func (c *cachedClient) key(meta RequestMeta, count int) string {
+	key := fmt.Sprintf("content:%s:%d", c.provider, count)
+	if c.perUser {
+		key += ":" + meta.IP
+	}
+	if p := meta.personalization(); p != "" {
+		key += ":" + p
+	}
+	return key
+}
+
+// store writes the items to the cache. Errors are only logged.
+func (c *cachedClient) store(ctx context.Context, key string, items []*ContentItem) {
+	c.storeFor(ctx, key, items, c.ttl)
+}
+
+func (c *cachedClient) storeFor(ctx context.Context, key string, items []*ContentItem, ttl time.Duration) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		slog.ErrorContext(ctx, "cache encode failed", "key", key, "error", err)
+		return
+	}
+	if err := c.cache.Set(ctx, key, data, ttl); err != nil {
+		slog.WarnContext(ctx, "cache set failed", "key", key, "error", err)
+	}
+}
+
+// refresh fetches `count` items from the provider, and caches them for the TTL as the responses of all the counts up to `count`:
+// the first item for count 1, the first two for count 2, and so on. It's used only for the clients that aren't cached per user.
+// It returns the fetched items.
+func (c *cachedClient) refresh(ctx context.Context, count int, ttl time.Duration) ([]*ContentItem, error) {
+	items, err := c.client.GetContent(ctx, RequestMeta{}, count)
+	if err != nil {
+		return nil, err
+	}
+	for n := 1; n <= len(items); n++ {
+		c.storeFor(ctx, c.key(RequestMeta{}, n), items[:n], ttl)
+	}
+	return items, nil
+}
+
+// replaceExpired replaces the expired cached items with items fetched from the provider, within the request deadline.
+// When it's disabled or the fetch fails, the items are returned as they are.
+func (c *cachedClient) replaceExpired(ctx context.Context, key string, meta RequestMeta, items []*ContentItem) []*ContentItem {
+	now := time.Now()
+	var expired []int
+	for i, item := range items {
+		if !item.Expiry.IsZero() && item.Expiry.Before(now) {
+			expired = append(expired, i)
+		}
+	}
+	if len(expired) == 0 {
+		return items
+	}
+	if !c.refetchExpired {
+		cacheExpiredItems.Add(float64(len(expired)), string(c.provider), "served")
+		return items
+	}
+
+	fetched, err := c.client.GetContent(ctx, meta, len(expired))
+	if err != nil {
+		slog.WarnContext(ctx, "refetching expired cached items failed", "key", key, "error", err)
+		cacheExpiredItems.Add(float64(len(expired)), string(c.provider), "refetch_failed")
+		return items
+	}
+	refetched := min(len(expired), len(fetched))
+	cacheExpiredItems.Add(float64(refetched), string(c.provider), "refetched")
+	if refetched < len(expired) {
+		cacheExpiredItems.Add(float64(len(expired)-refetched), string(c.provider), "refetch_failed")
+	}
+
+	replaced := make([]*ContentItem, len(items))
+	copy(replaced, items)
+	for i, idx := range expired[:refetched] {
+		replaced[idx] = fetched[i]
+	}
+	c.store(ctx, key, replaced)
+
+	return replaced
+}
+
+// cacheCounters returns the lookup statistics of the cached clients, sorted by provider.
+func cacheCounters(clients map[Provider]*cachedClient) []CacheCounters {
+	var counters []CacheCounters
+	for p, cc := range clients {
+		counters = append(counters, CacheCounters{
+			Provider: p,
+			Hits:     cc.hits.Load(),
+			Misses:   cc.misses.Load(),
+		})
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		return counters[i].Provider < counters[j].Provider
+	})
+
+	return counters
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+)
+
+// Labels of the items of the sandbox providers.
+const (
+	sandboxTitlePrefix  = "[SANDBOX] "
+	sandboxSourceSuffix = "-sandbox"
+)
+
+var sandboxItems = newCounterVec(
+	"sandbox_items_total",
+	"Number of items returned by the providers in the sandbox mode, by provider.",
+	"provider",
+)
+
+// sandboxClient labels the items of a provider in the sandbox mode as test data: the title gets the
+// sandboxTitlePrefix, and the source the sandboxSourceSuffix. The provider is still called the usual way,
+// so a new integration can be validated in production, while the users (and the clients filtering on the source)
+// can tell its items apart.
+type sandboxClient struct {
+	client   Client
+	provider Provider
+}
+
+// GetContent implements Client.
+func (c *sandboxClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	items, err := c.client.GetContent(ctx, meta, count)
+	if err != nil {
+		return nil, err
+	}
+
+	labeled := make([]*ContentItem, len(items))
+	for i, item := range items {
+		if item == nil {
+			continue
+		}
+		copied := *item
+		copied.Title = sandboxTitlePrefix + copied.Title
+		copied.Source += sandboxSourceSuffix
+		labeled[i] = &copied
+	}
+	sandboxItems.Add(float64(len(items)), string(c.provider))
+
+	return labeled, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSandboxProviders(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &scriptedClient{responses: [][]*ContentItem{{{ID: "a", Title: "New integration", Source: string(Provider1)}}}},
+		Provider2: &scriptedClient{responses: [][]*ContentItem{{{ID: "b", Title: "Regular", Source: string(Provider2)}}}},
+	}
+	service, err := NewService([]ContentConfig{{Type: Provider1}, {Type: Provider2}}, clients, defaultTimeout,
+		WithItemValidation(ItemValidationSettings{Policy: InvalidItemsDrop}), WithSandboxProviders(map[Provider]bool{Provider1: true}))
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+
+	items, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 2, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	// The sandbox items pass the validation, and are labeled after it.
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	if items[0].Title != "[SANDBOX] New integration" || items[0].Source != "1-sandbox" {
+		t.Errorf("got sandbox item %+v, want the labels", items[0])
+	}
+	if items[1].Title != "Regular" || items[1].Source != string(Provider2) {
+		t.Errorf("got regular item %+v, want it unchanged", items[1])
+	}
+}
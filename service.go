@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -12,117 +16,818 @@ const (
 	defaultTimeout = time.Second * 5
 )
 
+// ErrProviderDisabled is returned for calls to providers disabled with the admin API.
+var ErrProviderDisabled = errors.New("provider is disabled")
+
+// ErrNoClient is returned for calls to providers without a client.
+var ErrNoClient = errors.New("no client configured for provider")
+
+// errNotEnoughItems is the error of positions for which the provider returned no item.
+var errNotEnoughItems = errors.New("not enough items")
+
+var providerDisabled = newGaugeVec(
+	"provider_disabled",
+	"Whether the provider is disabled with the admin API (1) or not (0).",
+	"provider",
+)
+
 // Service is the main application service object.
 type Service struct {
 	clients        map[Provider]Client
 	contentConfigs []ContentConfig
-	timeout        time.Duration
+	deviceConfigs  map[DeviceClass][]ContentConfig
+	feedConfigs    map[string][]ContentConfig
+	feedPriorities map[string]int
+	// ordering is the strategy ordering the configs in the sequences.
+	ordering OrderingStrategy
+	// sequences are the interleaved configs, by device class. The default configs have the empty class.
+	sequences map[DeviceClass][]ContentConfig
+	// feedSequences are the interleaved configs of the named feeds.
+	feedSequences    map[string][]ContentConfig
+	timeout          time.Duration
+	endpointTimeouts map[Endpoint]time.Duration
+	freshness        *FreshnessTracker
+	breakers         map[Provider]*CircuitBreaker
+	errors           *ErrorLog
+
+	disabled map[Provider]bool
+	blocked  map[string]bool
+	m        sync.RWMutex
+
+	// fetches tracks the running provider calls, for draining.
+	fetches fetchGroup
+	// background is cancelled when the service drains, stopping the prefetches.
+	background     context.Context
+	stopBackground context.CancelFunc
+	// goroutines tracks the provider goroutines, for finding leaks.
+	goroutines *GoroutineTracker
+	itemSizes  *ItemSizeStats
+	// prefetches bound the pages prefetched at once.
+	prefetches chan struct{}
+
+	// Optional features, set with ServiceOptions.
+	cache           Cache
+	cacheSettings   CacheSettings
+	breakerSettings CircuitBreakerSettings
+	// sharedBreakers is the circuit breaker state shared with the other replicas, synced every breakerSyncInterval,
+	// and sharedRateLimits the budget of the provider rate limits shared with them (nil keeps the limits per instance).
+	sharedBreakers      BreakerStateStore
+	breakerSyncInterval time.Duration
+	sharedRateLimits    RateBudgetStore
+	configHistoryPath   string
+	configs             *ConfigHistory
+	aa                  *AATester
+	allowedCounts       map[Provider][]int
+	coalesce            bool
+	fallbackSurplus     bool
+	filterExpired       bool
+	expirySkews         map[Provider]time.Duration
+	userIPPolicies      map[Provider]UserIPPolicy
+	itemValidation      ItemValidationSettings
+	sandboxProviders    map[Provider]bool
+	botPages            *botPages
+	hedgeDelay          time.Duration
+	concurrencyLimits   map[Provider]int
+	refresh             RefreshSettings
+	discoveryTimeout    time.Duration
+	// capabilities are the capabilities reported by the providers at startup.
+	capabilities map[Provider]Capabilities
+	// cached are the clients with enabled response caching, by provider.
+	cached map[Provider]*cachedClient
+	// refreshed are the cached clients refreshed in the background, by provider.
+	refreshed map[Provider]*cachedClient
+	// live passes the new items found by the refresher to the live updates stream.
+	live *liveUpdates
 }
 
 // NewDefaultService returns a service with default configuration.
-func NewDefaultService() (*Service, error) {
+func NewDefaultService(opts ...ServiceOption) (*Service, error) {
 	return NewService(
 		DefaultConfig,
-		map[Provider]Client{
-			Provider1: SampleContentProvider{Source: Provider1},
-			Provider2: SampleContentProvider{Source: Provider2},
-			Provider3: SampleContentProvider{Source: Provider3},
-		},
+		SampleClients(Provider1, Provider2, Provider3),
 		defaultTimeout,
+		opts...,
 	)
 }
 
+// SampleClients returns sample clients for the providers.
+func SampleClients(providers ...Provider) map[Provider]Client {
+	clients := make(map[Provider]Client, len(providers))
+	for _, p := range providers {
+		clients[p] = AdaptSimpleClient(SampleContentProvider{Source: p, IDs: NewUUIDv7Generator(string(p) + "-")})
+	}
+
+	return clients
+}
+
+// NewServiceFromConfig returns a service configured with the file configuration and the clients.
+func NewServiceFromConfig(cfg *FileConfig, clients map[Provider]Client, opts ...ServiceOption) (*Service, error) {
+	opts = append([]ServiceOption{
+		WithDeviceConfigs(cfg.DeviceContentConfigs()),
+		WithFeedConfigs(cfg.FeedContentConfigs(), cfg.FeedPriorities),
+		WithEndpointTimeouts(cfg.EndpointTimeoutOverrides()),
+		WithOrdering(cfg.Ordering),
+	}, opts...)
+	return NewService(cfg.ContentConfigs(), clients, time.Duration(cfg.Timeout), opts...)
+}
+
 // NewService returns a service configured with the given configs and clients.
-func NewService(configs []ContentConfig, clients map[Provider]Client, timeout time.Duration) (*Service, error) {
+func NewService(configs []ContentConfig, clients map[Provider]Client, timeout time.Duration, opts ...ServiceOption) (*Service, error) {
+	if err := checkClients(configs, clients); err != nil {
+		return nil, err
+	}
+
+	s := &Service{
+		contentConfigs: configs,
+		timeout:        timeout,
+		freshness:      NewFreshnessTracker(0),
+		breakers:       make(map[Provider]*CircuitBreaker),
+		errors:         NewErrorLog(recentErrorsSize),
+		goroutines:     NewGoroutineTracker(),
+		itemSizes:      &ItemSizeStats{},
+		prefetches:     make(chan struct{}, maxConcurrentPrefetches),
+		disabled:       make(map[Provider]bool),
+		blocked:        make(map[string]bool),
+		cached:         make(map[Provider]*cachedClient),
+		refreshed:      make(map[Provider]*cachedClient),
+		live:           newLiveUpdates(),
+	}
+	s.background, s.stopBackground = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := s.ordering.validate(); err != nil {
+		return nil, fmt.Errorf("ordering: %w", err)
+	}
+	for class, configs := range s.deviceConfigs {
+		if err := checkClients(configs, clients); err != nil {
+			return nil, fmt.Errorf("device '%s': %w", class, err)
+		}
+	}
+	for name, configs := range s.feedConfigs {
+		if err := checkClients(configs, clients); err != nil {
+			return nil, fmt.Errorf("feed '%s': %w", name, err)
+		}
+	}
+	s.updateSequences()
+	if s.discoveryTimeout > 0 {
+		s.capabilities = discoverCapabilities(clients, s.discoveryTimeout)
+	}
+
+	s.clients = make(map[Provider]Client, len(clients))
+	for p, c := range clients {
+		s.clients[p] = s.wrapClient(p, c)
+		providerDisabled.Set(0, string(p))
+	}
+
+	history, err := newConfigHistory(s, s.configHistoryPath)
+	if err != nil {
+		return nil, err
+	}
+	s.configs = history
+
+	return s, nil
+}
+
+// checkClients verifies there are clients for all the providers used in the configs.
+func checkClients(configs []ContentConfig, clients map[Provider]Client) error {
 	for _, cfg := range configs {
 		if _, ok := clients[cfg.Type]; !ok {
-			return nil, fmt.Errorf("no client provided for provider '%s'", cfg.Type)
+			return fmt.Errorf("no client provided for provider '%s'", cfg.Type)
+		}
+		if cfg.Fallback != nil {
+			if _, ok := clients[*cfg.Fallback]; !ok {
+				return fmt.Errorf("no client provided for fallback provider '%s'", *cfg.Fallback)
+			}
 		}
 	}
 
-	return &Service{
-		clients:        clients,
-		contentConfigs: configs,
-		timeout:        timeout,
-	}, nil
+	return nil
+}
+
+// wrapClient decorates the provider client with the enabled features.
+// From the innermost: panic recovery, user IP, A/A testing, metrics, max count, item validation, sandbox labels,
+// count rounding, circuit breaker, concurrency limit (bulkhead), rate limit, cache, coalescing, dropping the locale.
+func (s *Service) wrapClient(p Provider, c Client) Client {
+	c = &recoveringClient{client: c, provider: p}
+	if policy := s.userIPPolicies[p]; policy != "" {
+		c = &userIPClient{client: c, policy: policy}
+	}
+	if s.aa != nil {
+		c = &aaClient{client: c, provider: p, tester: s.aa, fetches: &s.fetches}
+	}
+	c = &instrumentedClient{client: c, provider: p, freshness: s.freshness, errors: s.errors, sizes: s.itemSizes}
+	caps, discovered := s.capabilities[p]
+	if caps.MaxCount > 0 {
+		c = &maxCountClient{client: c, maxCount: caps.MaxCount}
+	}
+	if policy := s.itemValidation.forProvider(p); policy != InvalidItemsOff {
+		c = &validatingClient{client: c, provider: p, policy: policy}
+	}
+	if s.sandboxProviders[p] {
+		c = &sandboxClient{client: c, provider: p}
+	}
+
+	if allowed := s.allowedCounts[p]; len(allowed) > 0 {
+		// The items fetched with the user IP are for that user only, so they aren't buffered.
+		_, _, perUser := s.cacheSettings.forProvider(p)
+		perUser = perUser || s.userIPPolicies[p] == UserIPAlways
+		c = &countRoundingClient{client: c, provider: p, allowed: allowed, perUser: perUser}
+	}
+
+	if failures, cooldown := s.breakerSettings.forProvider(p); failures > 0 {
+		breaker := NewCircuitBreaker(p, failures, cooldown)
+		breaker.shared = s.sharedBreakers
+		s.breakers[p] = breaker
+		c = &breakerClient{client: c, breaker: breaker}
+	}
+
+	if limit := s.concurrencyLimits[p]; limit > 0 {
+		c = newBulkheadClient(c, p, limit)
+	}
+	if caps.RateLimit > 0 {
+		c = &rateLimitedClient{client: c, provider: p, limiter: newRateLimiter(caps.RateLimit, max(caps.RateBurst, 1)), shared: s.sharedRateLimits, rate: caps.RateLimit}
+	}
+
+	if s.cache != nil {
+		if enabled, ttl, perUser := s.cacheSettings.forProvider(p); enabled && ttl > 0 {
+			cc := &cachedClient{
+				client:         c,
+				provider:       p,
+				cache:          s.cache,
+				ttl:            ttl,
+				perUser:        perUser,
+				refetchExpired: s.cacheSettings.RefetchExpired,
+			}
+			s.cached[p] = cc
+			// The responses cached per user, or of the providers requiring the user IP, can't be fetched ahead.
+			if s.refresh.Items > 0 && !perUser && s.userIPPolicies[p] != UserIPAlways {
+				s.refreshed[p] = cc
+			}
+			c = cc
+		}
+	}
+
+	if s.coalesce {
+		c = newCoalescingClient(c, p, &s.fetches)
+	}
+	if discovered && !caps.Locale {
+		c = &noLocaleClient{client: c}
+	}
+
+	return c
+}
+
+// ContentResult is the result of a content request, with the details of the positions that couldn't be filled.
+type ContentResult struct {
+	// Items are the items up to the first failed position.
+	Items []*ContentItem
+	// Failures lists the requested positions (relative to the offset) without items.
+	Failures []PositionFailure
+}
+
+// PositionFailure describes why a position couldn't be filled.
+type PositionFailure struct {
+	Position int      `json:"position"`
+	Provider Provider `json:"provider"`
+	Reason   string   `json:"reason"`
+}
+
+// GetContent returns `count` number of content items, fetched from the configured providers for the request described by meta.
+// When an item can't be fetched, the items before it are returned.
+// A context from withShuffleSeed makes the providers sequence shuffled in the order given by the seed,
+// one from withOrdering overrides the ordering strategy of the providers sequence,
+// and one from withSources limits the sequence to the given providers.
+// A context from withFeed makes the items come from the named feed's sequence instead of the default one.
+func (s *Service) GetContent(ctx context.Context, meta RequestMeta, count int, offset int) ([]*ContentItem, error) {
+	result, err := s.GetContentResult(ctx, meta, count, offset)
+	if err != nil {
+		return nil, err
+	}
+	return result.Items, nil
 }
 
-// GetContent returns `count` number of content items, fetched from the configured providers.
-func (s *Service) GetContent(ctx context.Context, userIP string, count int, offset int) ([]*ContentItem, error) {
+// GetContentResult is like GetContent, but it also reports the positions that couldn't be filled.
+func (s *Service) GetContentResult(ctx context.Context, meta RequestMeta, count int, offset int) (*ContentResult, error) {
+	return s.StreamContent(ctx, meta, count, offset, nil)
+}
+
+// StreamContent is like GetContentResult, but it also passes the items to `emit` as soon as they are ready, in order.
+// The emitted items are the same as the returned ones.
+// Bots get the cached non-personalized pages, when enabled with WithBotPages; those are never shuffled with the request seed
+// or ordered with the request's ordering strategy.
+// The requests for only some providers (with withSources) and for the named feeds aren't served from the bot pages.
+func (s *Service) StreamContent(ctx context.Context, meta RequestMeta, count int, offset int, emit func(*ContentItem)) (*ContentResult, error) {
 	if count <= 0 || offset < 0 {
 		return nil, fmt.Errorf("invalid count or offset parameters")
 	}
+	if s.botPages == nil || meta.Device.Class != DeviceBot || sourcesFromContext(ctx) != nil || feedFromContext(ctx) != "" {
+		return s.streamContent(ctx, meta, count, offset, emit)
+	}
+
+	// Bots get the same page, not personalized and not part of the experiments.
+	botMeta := RequestMeta{Device: DeviceHints{Class: DeviceBot}, TraceParent: meta.TraceParent}
+	result, err := s.botPages.get(ctx, count, offset, func(ctx context.Context) (*ContentResult, error) {
+		return s.streamContent(withoutClientTimeout(withOrdering(withoutShuffleSeed(ctx), "")), botMeta, count, offset, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if emit != nil {
+		for _, item := range result.Items {
+			emit(item)
+		}
+	}
+
+	return result, nil
+}
 
-	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+func (s *Service) streamContent(ctx context.Context, meta RequestMeta, count int, offset int, emit func(*ContentItem)) (*ContentResult, error) {
+	ctx, span := startSpan(ctx, "Service.GetContent", spanKindInternal)
+	defer span.End()
+	span.SetAttr("content.count", count)
+	span.SetAttr("content.offset", offset)
+	if meta.Device.Class != "" {
+		span.SetAttr("device.class", string(meta.Device.Class))
+	}
+
+	endpoint := endpointFromContext(ctx)
+	feed := feedFromContext(ctx)
+	configs, ordering, timeout := s.itemsConfig(feed, meta.Device.Class, endpoint, orderingFromContext(ctx))
+	if feed != "" {
+		if len(configs) == 0 {
+			// The feed was removed from the configuration after the request was accepted.
+			return nil, fmt.Errorf("unknown feed '%s'", feed)
+		}
+		span.SetAttr("content.feed", feed)
+	}
+	if ordering != "" {
+		span.SetAttr("content.ordering", string(ordering))
+	}
+	seed, ok := shuffleSeedFromContext(ctx)
+	if !ok && ordering == OrderShuffled {
+		seed, ok = rand.Uint32(), true
+	}
+	if ok {
+		configs = shuffleConfigs(configs, seed)
+		span.SetAttr("content.seed", int64(seed))
+	}
+	if sources := sourcesFromContext(ctx); sources != nil {
+		configs = filterConfigs(configs, sources)
+		if len(configs) == 0 {
+			return &ContentResult{}, nil
+		}
+	}
+	// A shorter client timeout cuts the response at the positions ready by then, instead of failing it.
+	clientTimeout, ok := clientTimeoutFromContext(ctx)
+	cut := ok && clientTimeout < timeout
+	if cut {
+		timeout = clientTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
+	span.SetAttr("content.timeout_ms", timeout.Milliseconds())
+	slog.InfoContext(ctx, "assembling content", "endpoint", endpoint, "count", count, "offset", offset, "timeout", timeout, "client_timeout", cut)
 
-	responses, err := s.getConfigResponses(ctx, userIP, count, offset)
-	if err != nil {
+	var ready func(int, *ContentItem)
+	if emit != nil {
+		ready = func(pos int, item *ContentItem) {
+			if pos >= offset {
+				emit(item)
+			}
+		}
+	}
+	responses, err := s.getConfigResponses(ctx, configs, meta, count, offset, ready)
+	if err != nil && !(cut && errors.Is(err, context.DeadlineExceeded)) {
+		span.RecordError(err)
 		return nil, err
 	}
 
+	result := &ContentResult{}
 	var items []*ContentItem
-	for _, v := range responses {
+	failed := false
+	for i, v := range responses {
 		if v.err != nil {
-			// There was an error for this item, so return with what we collected so far.
-			break
+			// There was an error for this item, so we return only what we collected so far.
+			failed = true
+			if i >= offset {
+				result.Failures = append(result.Failures, PositionFailure{
+					Position: i - offset,
+					Provider: v.provider,
+					Reason:   failureReason(v.err),
+				})
+			}
+			continue
+		}
+		if !failed {
+			items = append(items, v.item)
 		}
-		items = append(items, v.item)
 	}
 
-	if offset >= len(items) {
-		return nil, nil
+	if offset < len(items) {
+		result.Items = items[offset:]
 	}
-	return items[offset:], nil
+	return result, nil
+}
+
+// failureReason returns the reason of a position failure that is safe to show to the clients.
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, errNotEnoughItems):
+		return "not enough items"
+	case errors.Is(err, ErrProviderDisabled):
+		return "provider disabled"
+	case errors.Is(err, ErrCircuitOpen):
+		return "provider unavailable"
+	case errors.Is(err, ErrProviderBusy):
+		return "provider busy"
+	case errors.Is(err, ErrProviderRateLimited):
+		return "provider rate limited"
+	case errors.Is(err, ErrInvalidItems):
+		return "invalid provider response"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, ErrDraining):
+		return "service draining"
+	default:
+		return "provider error"
+	}
+}
+
+// Freshness returns the tracker of the providers content freshness.
+func (s *Service) Freshness() *FreshnessTracker {
+	return s.freshness
+}
+
+// CacheCounters returns the response cache statistics for the providers with enabled caching.
+func (s *Service) CacheCounters() []CacheCounters {
+	return cacheCounters(s.cached)
+}
+
+// CircuitStatuses returns the circuit breaker statuses of the providers with enabled breakers.
+func (s *Service) CircuitStatuses() map[Provider]CircuitStatus {
+	statuses := make(map[Provider]CircuitStatus, len(s.breakers))
+	for p, b := range s.breakers {
+		statuses[p] = b.Status()
+	}
+
+	return statuses
+}
+
+// ProviderStatus describes the health of a provider.
+type ProviderStatus struct {
+	Provider  Provider           `json:"provider"`
+	Disabled  bool               `json:"disabled"`
+	Breaker   *CircuitStatus     `json:"circuit_breaker,omitempty"`
+	Freshness *ProviderFreshness `json:"freshness,omitempty"`
+	// Capabilities are the capabilities the provider reported at startup.
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+}
+
+// ProviderStatuses returns the statuses of all providers, sorted by provider.
+func (s *Service) ProviderStatuses() []ProviderStatus {
+	freshness := make(map[Provider]*ProviderFreshness)
+	for _, f := range s.freshness.Report().Providers {
+		freshness[f.Provider] = f
+	}
+
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	statuses := make([]ProviderStatus, 0, len(s.clients))
+	for p := range s.clients {
+		status := ProviderStatus{
+			Provider:  p,
+			Disabled:  s.disabled[p],
+			Freshness: freshness[p],
+		}
+		if b, ok := s.breakers[p]; ok {
+			bs := b.Status()
+			status.Breaker = &bs
+		}
+		if caps, ok := s.capabilities[p]; ok {
+			status.Capabilities = &caps
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Provider < statuses[j].Provider
+	})
+
+	return statuses
+}
+
+// SetProviderDisabled disables or enables calls to the provider. Items of a disabled provider are taken from its fallback.
+func (s *Service) SetProviderDisabled(p Provider, disabled bool) error {
+	if _, ok := s.clients[p]; !ok {
+		return fmt.Errorf("unknown provider '%s'", p)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.disabled[p] != disabled {
+		slog.Info("provider switched", "provider", p, "disabled", disabled)
+	}
+	s.disabled[p] = disabled
+	if disabled {
+		providerDisabled.Set(1, string(p))
+	} else {
+		providerDisabled.Set(0, string(p))
+	}
+
+	return nil
+}
+
+// ResetCircuitBreaker closes the circuit breaker of the provider.
+func (s *Service) ResetCircuitBreaker(p Provider) error {
+	if _, ok := s.clients[p]; !ok {
+		return fmt.Errorf("unknown provider '%s'", p)
+	}
+	b, ok := s.breakers[p]
+	if !ok {
+		return fmt.Errorf("provider '%s' has no circuit breaker", p)
+	}
+
+	b.Reset()
+	slog.Info("circuit breaker reset", "provider", p)
+
+	return nil
+}
+
+// Drain waits until the running provider calls finish, or the context is done.
+// The prefetches are cancelled, and the new provider calls fail with ErrDraining from then on,
+// so the background refresher must be stopped before.
+// It's meant for the shutdown, after the servers stop accepting requests.
+func (s *Service) Drain(ctx context.Context) error {
+	s.stopBackground()
+	return s.fetches.drain(ctx)
+}
+
+// ItemSizes returns the statistics of the sizes of the items returned by the providers.
+func (s *Service) ItemSizes() *ItemSizeStats {
+	return s.itemSizes
+}
+
+// MaxTimeout returns the longest content timeout, including the endpoint overrides.
+func (s *Service) MaxTimeout() time.Duration {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	timeout := s.timeout
+	for _, t := range s.endpointTimeouts {
+		timeout = max(timeout, t)
+	}
+
+	return timeout
+}
+
+// WatchGoroutines logs the provider goroutines running for longer than the content timeout, until the context is done.
+func (s *Service) WatchGoroutines(ctx context.Context, interval time.Duration) {
+	s.goroutines.Watch(ctx, interval, s.MaxTimeout)
+}
+
+// AAReport returns the A/A latency comparison of the providers, or nil when A/A testing is disabled.
+func (s *Service) AAReport() []AAReport {
+	if s.aa == nil {
+		return nil
+	}
+	return s.aa.Report()
+}
+
+// RecentErrors returns the most recent provider errors, the newest first.
+func (s *Service) RecentErrors() []ProviderError {
+	return s.errors.Recent()
+}
+
+// Config returns the items configuration and the timeout used by the service.
+func (s *Service) Config() *FileConfig {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	cfg := &FileConfig{
+		Timeout: Duration(s.timeout),
+		Items:   itemConfigs(s.contentConfigs),
+	}
+	if len(s.endpointTimeouts) > 0 {
+		cfg.EndpointTimeouts = make(map[Endpoint]Duration, len(s.endpointTimeouts))
+		for e, t := range s.endpointTimeouts {
+			cfg.EndpointTimeouts[e] = Duration(t)
+		}
+	}
+	if len(s.deviceConfigs) > 0 {
+		cfg.DeviceItems = make(map[DeviceClass][]ItemConfig, len(s.deviceConfigs))
+		for class, configs := range s.deviceConfigs {
+			cfg.DeviceItems[class] = itemConfigs(configs)
+		}
+	}
+	if len(s.feedConfigs) > 0 {
+		cfg.Feeds = make(map[string][]ItemConfig, len(s.feedConfigs))
+		for name, configs := range s.feedConfigs {
+			cfg.Feeds[name] = itemConfigs(configs)
+		}
+	}
+	if len(s.feedPriorities) > 0 {
+		cfg.FeedPriorities = maps.Clone(s.feedPriorities)
+	}
+	cfg.Ordering = s.ordering
+
+	return cfg
+}
+
+// setItemsConfig replaces the items configurations and the timeouts with the ones from the configuration.
+func (s *Service) setItemsConfig(cfg *FileConfig) error {
+	configs, deviceConfigs, feedConfigs := cfg.ContentConfigs(), cfg.DeviceContentConfigs(), cfg.FeedContentConfigs()
+	if err := checkClients(configs, s.clients); err != nil {
+		return err
+	}
+	for class, configs := range deviceConfigs {
+		if err := checkClients(configs, s.clients); err != nil {
+			return fmt.Errorf("device '%s': %w", class, err)
+		}
+	}
+	for name, configs := range feedConfigs {
+		if err := checkClients(configs, s.clients); err != nil {
+			return fmt.Errorf("feed '%s': %w", name, err)
+		}
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.contentConfigs = configs
+	s.deviceConfigs = deviceConfigs
+	s.feedConfigs = feedConfigs
+	s.feedPriorities = cfg.FeedPriorities
+	s.ordering = cfg.Ordering
+	s.timeout = time.Duration(cfg.Timeout)
+	s.endpointTimeouts = cfg.EndpointTimeoutOverrides()
+	s.updateSequences()
+
+	return nil
+}
+
+// updateSequences orders the configs with the ordering strategy. It must be called with the lock held.
+func (s *Service) updateSequences() {
+	s.sequences = map[DeviceClass][]ContentConfig{"": s.ordering.sequence(s.contentConfigs)}
+	for class, configs := range s.deviceConfigs {
+		s.sequences[class] = s.ordering.sequence(configs)
+	}
+	s.feedSequences = make(map[string][]ContentConfig, len(s.feedConfigs))
+	for name, configs := range s.feedConfigs {
+		s.feedSequences[name] = s.ordering.sequence(configs)
+	}
+}
+
+// itemsConfig returns the ordered items configuration for the feed or the device class, the ordering strategy,
+// and the timeout for the endpoint. The configs are ordered with the given strategy, or the service's one when it's empty.
+// A named feed has the same configuration for all the device classes.
+// Device classes and endpoints without their own configuration get the default one.
+func (s *Service) itemsConfig(feed string, class DeviceClass, endpoint Endpoint, ordering OrderingStrategy) ([]ContentConfig, OrderingStrategy, time.Duration) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	timeout := s.timeout
+	if t, ok := s.endpointTimeouts[endpoint]; ok {
+		timeout = t
+	}
+	if ordering == "" || ordering == s.ordering {
+		if feed != "" {
+			return s.feedSequences[feed], s.ordering, timeout
+		}
+		if configs, ok := s.sequences[class]; ok {
+			return configs, s.ordering, timeout
+		}
+		return s.sequences[""], s.ordering, timeout
+	}
+
+	configs := s.contentConfigs
+	if feed != "" {
+		configs = s.feedConfigs[feed]
+	} else if c, ok := s.deviceConfigs[class]; ok {
+		configs = c
+	}
+	return ordering.sequence(configs), ordering, timeout
+}
+
+func (s *Service) isDisabled(p Provider) bool {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return s.disabled[p]
 }
 
 // configResponse is a helper type for storing the result of fetching data for given config element.
 type configResponse struct {
-	item *ContentItem
-	err  error
+	item     *ContentItem
+	provider Provider
+	err      error
 }
 
-func (s *Service) getConfigResponses(ctx context.Context, userIP string, count int, offset int) ([]*configResponse, error) {
-	requestConfigs := s.prepareConfigsForRequest(count, offset)
+// getConfigResponses returns the responses for all positions up to `count+offset`.
+// When `ready` isn't nil, it's called with the items of the positions that are final, in order, until the first failed position.
+// When the context is done, it returns the context error, with the responses collected by then
+// (the other positions fail with the context error).
+func (s *Service) getConfigResponses(ctx context.Context, configs []ContentConfig, meta RequestMeta, count int, offset int, ready func(int, *ContentItem)) ([]*configResponse, error) {
+	requestConfigs := prepareConfigsForRequest(configs, count, offset)
 
 	// Check how many items do we need from each provider.
 	providerCounts := make(map[Provider]int)
 	for _, cfg := range requestConfigs {
 		providerCounts[cfg.Type]++
 	}
+	if s.hedgeDelay > 0 {
+		return s.getHedgedConfigResponses(ctx, requestConfigs, meta, providerCounts, ready)
+	}
 
+	// With the fallback surplus, a provider that is also the fallback of other positions is asked for their items too,
+	// in the same call. The surplus left after its own positions then serves the fallbacks without another call.
+	fetchCounts := providerCounts
+	if s.fallbackSurplus {
+		fetchCounts = maps.Clone(providerCounts)
+		for _, cfg := range requestConfigs {
+			if cfg.Fallback != nil && providerCounts[*cfg.Fallback] > 0 {
+				fetchCounts[*cfg.Fallback]++
+			}
+		}
+	}
+
+	// The fallbacks are fetched as soon as the primary providers fail, while the others are still awaited.
+	responses, err := newCollector(ctx, s, meta, requestConfigs, fetchCounts).collect(ready)
+	if err != nil {
+		return responses, err
+	}
+	explainFromContext(ctx).setPlan(requestConfigs, responses)
+
+	return responses, nil
+}
+
+// getHedgedConfigResponses is getConfigResponses with hedging: the fallbacks of the primary providers that don't respond
+// within the hedge delay are fetched concurrently with them. The fallbacks of the failed positions that weren't hedged
+// are fetched after all the primary providers respond.
+func (s *Service) getHedgedConfigResponses(ctx context.Context, requestConfigs []ContentConfig, meta RequestMeta, providerCounts map[Provider]int, ready func(int, *ContentItem)) ([]*configResponse, error) {
 	// Collect response promises from each provider.
 	responsePromises := make(map[Provider]<-chan *configResponse)
 	for provider, count := range providerCounts {
-		responsePromises[provider] = s.getPromiseForProvider(ctx, provider, userIP, count)
+		responsePromises[provider] = s.getPromiseForProvider(ctx, provider, meta, count, false)
 	}
 
-	// First pass: fetch data from providers without any fallbacks.
+	hedges := newHedger(s, meta, requestConfigs, s.hedgeDelay)
+	defer hedges.stop()
+
+	// First pass: fetch data from the primary providers.
 	responses := make([]*configResponse, len(requestConfigs))
+	done := func(err error) ([]*configResponse, error) {
+		for i, v := range responses {
+			if v == nil {
+				responses[i] = &configResponse{err: err, provider: requestConfigs[i].Type}
+			}
+		}
+		return responses, err
+	}
+	next := 0
+	flush := func() {
+		// The positions before the first failed one won't change, so they can be passed on.
+		for ; ready != nil && next < len(responses) && responses[next] != nil && responses[next].err == nil; next++ {
+			ready(next, responses[next].item)
+		}
+	}
 	for i, cfg := range requestConfigs {
+		if cfg.Fallback != nil {
+			v, err := hedges.await(ctx, i, cfg, responsePromises[cfg.Type])
+			if err != nil {
+				return done(err)
+			}
+			responses[i] = v
+			flush()
+			continue
+		}
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return done(ctx.Err())
 		case v, ok := <-responsePromises[cfg.Type]:
 			if !ok {
-				responses[i] = &configResponse{err: errors.New("not enough items")}
+				responses[i] = &configResponse{err: errNotEnoughItems, provider: cfg.Type}
 				continue
 			}
 			responses[i] = v
 		}
+		flush()
 	}
 
 	// Second pass: check responses and use fallback if there were any errors.
-	err := s.applyConfigFallbacks(ctx, requestConfigs, responses, userIP, count)
+	err := s.applyConfigFallbacks(ctx, requestConfigs, responses, meta, hedges.tried)
 	if err != nil {
-		return nil, err
+		return responses, err
 	}
+	explainFromContext(ctx).setPlan(requestConfigs, responses)
+	flush()
 
 	return responses, nil
 }
 
 // applyConfigFallbacks updates `responses` slice in case there are errors and it is possible to apply a fallback.
-func (s *Service) applyConfigFallbacks(ctx context.Context, requestConfigs []ContentConfig, responses []*configResponse, userIP string, count int) error {
+// The positions marked in `tried` (if not nil) already had their fallback fetched, and are skipped.
+func (s *Service) applyConfigFallbacks(ctx context.Context, requestConfigs []ContentConfig, responses []*configResponse, meta RequestMeta, tried []bool) error {
 	fallbackProviderCounts := make(map[Provider]int)
 	for i, cfg := range requestConfigs {
 		if responses[i].err == nil {
@@ -132,7 +837,11 @@ func (s *Service) applyConfigFallbacks(ctx context.Context, requestConfigs []Con
 			// Error and no fallback - we won't return response for this and any of the next items, so we can stop here.
 			break
 		}
+		if tried != nil && tried[i] {
+			continue
+		}
 		fallbackProviderCounts[*cfg.Fallback]++
+		contentFallbacks.Inc(string(cfg.Type), string(*cfg.Fallback))
 	}
 	if len(fallbackProviderCounts) == 0 {
 		// No errors or no fallbacks to apply - nothing to do.
@@ -142,7 +851,7 @@ func (s *Service) applyConfigFallbacks(ctx context.Context, requestConfigs []Con
 	// Collect response promises for fallbacks.
 	responsePromises := make(map[Provider]<-chan *configResponse)
 	for provider, count := range fallbackProviderCounts {
-		responsePromises[provider] = s.getPromiseForProvider(ctx, provider, userIP, count)
+		responsePromises[provider] = s.getPromiseForProvider(ctx, provider, meta, count, true)
 	}
 
 	// Fill the requestConfigs with fallback responses.
@@ -153,13 +862,15 @@ func (s *Service) applyConfigFallbacks(ctx context.Context, requestConfigs []Con
 		if cfg.Fallback == nil {
 			break
 		}
-		provider := *cfg.Fallback
+		if tried != nil && tried[i] {
+			continue
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case v, ok := <-responsePromises[provider]:
+		case v, ok := <-responsePromises[*cfg.Fallback]:
 			if !ok {
-				responses[i] = &configResponse{err: errors.New("not enough items")}
+				responses[i] = &configResponse{err: errNotEnoughItems, provider: *cfg.Fallback}
 				continue
 			}
 			responses[i] = v
@@ -171,36 +882,73 @@ func (s *Service) applyConfigFallbacks(ctx context.Context, requestConfigs []Con
 
 // prepareConfigsForRequest returns a list of configs that configure each item that is used for generating response.
 // It takes configured "configs" and repeats them to make a slice of len `count+offset`.
-func (s *Service) prepareConfigsForRequest(count int, offset int) []ContentConfig {
-	var configs []ContentConfig
+func prepareConfigsForRequest(configs []ContentConfig, count int, offset int) []ContentConfig {
+	var requestConfigs []ContentConfig
 	for i := 0; i < count+offset; i++ {
-		idx := i % len(s.contentConfigs)
-		cfg := s.contentConfigs[idx]
-		configs = append(configs, cfg)
+		idx := i % len(configs)
+		requestConfigs = append(requestConfigs, configs[idx])
 	}
 
-	return configs
+	return requestConfigs
 }
 
 // getResponseForConfig returns a "promise" with response data for given config and count.
-func (s *Service) getPromiseForProvider(ctx context.Context, p Provider, userIP string, count int) <-chan *configResponse {
+// The `fallback` flag marks fetches of fallback items.
+func (s *Service) getPromiseForProvider(ctx context.Context, p Provider, meta RequestMeta, count int, fallback bool) <-chan *configResponse {
+	out := make(chan *configResponse, count)
 	client, ok := s.clients[p]
 	if !ok {
-		panic(fmt.Sprintf("no client configured for provider %s", p))
+		// The configs are checked against the clients, so it's a bug, but it fails only the provider's positions.
+		out <- &configResponse{err: fmt.Errorf("%w '%s'", ErrNoClient, p), provider: p}
+		close(out)
+		return out
+	}
+	if s.isDisabled(p) {
+		out <- &configResponse{err: ErrProviderDisabled, provider: p}
+		close(out)
+		return out
 	}
 
-	out := make(chan *configResponse, count)
+	if !s.fetches.begin() {
+		out <- &configResponse{err: ErrDraining, provider: p}
+		close(out)
+		return out
+	}
+
+	// The channel is buffered for all the items, so the goroutine finishes even if the promise is abandoned.
 	go func() {
+		defer s.fetches.done()
+		defer s.goroutines.Track(ctx, p, fetchGoroutine)()
 		defer close(out)
 
-		items, err := client.GetContent(userIP, count)
+		ctx, span := startSpan(ctx, "provider.fetch", spanKindInternal)
+		defer span.End()
+		span.SetAttr("content.provider", string(p))
+		span.SetAttr("content.count", count)
+		span.SetAttr("content.fallback", fallback)
+		ctx, explainFetch := explainFromContext(ctx).startFetch(ctx, p, count, fallback)
+		// The client panics are errors already, this covers the decorators. Nothing is sent before the panic can happen.
+		defer func() {
+			if v := recover(); v != nil {
+				out <- &configResponse{err: providerPanicError(ctx, p, v), provider: p}
+			}
+		}()
+
+		items, err := client.GetContent(ctx, meta, count)
+		span.SetAttr("content.items", len(items))
+		explainFetch(len(items), err)
 		if err != nil {
-			log.Printf("fetch data failed (provider:'%s' count:%d)", p, count)
-			out <- &configResponse{err: err}
+			span.RecordError(err)
+			slog.WarnContext(ctx, "fetch data failed", "provider", p, "count", count, "error", err)
+			out <- &configResponse{err: err, provider: p}
 			return
 		}
 
-		log.Printf("fetched data (provider:'%s' count:%d)", p, count)
+		slog.InfoContext(ctx, "fetched data", "provider", p, "count", count, "items", len(items))
+		if s.filterExpired {
+			items = s.dropExpired(ctx, client, p, meta, count, items)
+		}
+		items = s.filterBlocked(items)
 
 		// We want to be sure that we don't have more items than the channel buffer size.
 		// Otherwise this goroutine won't be able to finish.
@@ -209,7 +957,7 @@ func (s *Service) getPromiseForProvider(ctx context.Context, p Provider, userIP
 		}
 
 		for _, item := range items {
-			out <- &configResponse{item: item}
+			out <- &configResponse{item: item, provider: p}
 		}
 	}()
 
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSessionFetches is the number of service calls for one page of a session, when the items were already seen.
+	maxSessionFetches = 3
+	// maxSessionSeen is the number of the latest item IDs remembered by a session for skipping the repeated items.
+	maxSessionSeen = 1000
+	// sessionLocks is the number of locks serializing the requests to the same session.
+	sessionLocks = 64
+)
+
+// FeedSession is a short-lived feed, paged through with POST /sessions/{id}/next.
+type FeedSession struct {
+	ID string `json:"id"`
+	// Seed shuffles the mix of the session, like the `seed` parameter.
+	Seed    uint32    `json:"seed"`
+	Variant string    `json:"variant,omitempty"`
+	Expires time.Time `json:"expires_at"`
+}
+
+// SessionPage is the next page of a session feed.
+type SessionPage struct {
+	Items []*ItemView `json:"items"`
+	// End is true when the feed can't go further, because of the request limits.
+	End     bool      `json:"end,omitempty"`
+	Expires time.Time `json:"expires_at"`
+}
+
+// sessionState is what's stored for a session.
+type sessionState struct {
+	Seed    uint32 `json:"seed"`
+	Variant string `json:"variant,omitempty"`
+	// Offset is the position of the next page in the feed.
+	Offset int `json:"offset"`
+	// Seen are the IDs of the latest returned items, oldest first.
+	Seen []string `json:"seen,omitempty"`
+}
+
+// sessionStore keeps the feed sessions. Every use of a session extends it by the TTL.
+type sessionStore struct {
+	cache *MemoryCache
+	ttl   time.Duration
+	locks [sessionLocks]sync.Mutex
+	now   func() time.Time
+}
+
+// newSessionStore returns a store keeping up to `size` sessions, each for `ttl` since it was last used.
+// The sessions take up to about `maxBytes` of memory in total (zero means no limit); the least recently used
+// ones are dropped beyond it, so the sessions created by anyone can't take more.
+func newSessionStore(size int, maxBytes int64, ttl time.Duration) *sessionStore {
+	cache := NewMemoryCache(size)
+	cache.SetMaxBytes(maxBytes)
+	return &sessionStore{
+		cache: cache,
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+// lock locks the session, and returns the function unlocking it.
+func (s *sessionStore) lock(id string) func() {
+	h := fnv.New32a()
+	_, _ = io.WriteString(h, id)
+	m := &s.locks[h.Sum32()%sessionLocks]
+	m.Lock()
+	return m.Unlock
+}
+
+func (s *sessionStore) get(ctx context.Context, id string) (*sessionState, bool) {
+	data, ok, _ := s.cache.Get(ctx, id)
+	if !ok {
+		return nil, false
+	}
+	var state sessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		slog.ErrorContext(ctx, "decoding session", "error", err)
+		return nil, false
+	}
+	return &state, true
+}
+
+// put stores the session, and returns its new expiry time.
+func (s *sessionStore) put(ctx context.Context, id string, state *sessionState) (time.Time, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := s.cache.Set(ctx, id, data, s.ttl); err != nil {
+		return time.Time{}, err
+	}
+	return s.now().Add(s.ttl).UTC().Truncate(time.Second), nil
+}
+
+// seen tells whether the item was already returned in the session.
+func (st *sessionState) seen(id string) bool {
+	for _, v := range st.Seen {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *sessionState) markSeen(id string) {
+	st.Seen = append(st.Seen, id)
+	if n := len(st.Seen) - maxSessionSeen; n > 0 {
+		st.Seen = append(st.Seen[:0], st.Seen[n:]...)
+	}
+}
+
+// sessionRequest is the optional body of POST /sessions.
+type sessionRequest struct {
+	// Seed is the shuffle seed of the session; a random one is used when it's not set.
+	Seed *uint32 `json:"seed"`
+}
+
+// CreateSession handles POST /sessions. The session gets the experiment variant of the request.
+func (h *Handler) CreateSession(w http.ResponseWriter, req *http.Request) {
+	var sr sessionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<10)).Decode(&sr); err != nil && !errors.Is(err, io.EOF) {
+		h.handleValidationErr(w, req, ValidationErrors{{Param: "body", Message: "must be a JSON object with an optional seed from 0 to 4294967295"}})
+		return
+	}
+	state := &sessionState{Variant: requestMeta(req).Variant}
+	if sr.Seed != nil {
+		state.Seed = *sr.Seed
+	} else {
+		var b [4]byte
+		_, _ = rand.Read(b[:])
+		state.Seed = binary.BigEndian.Uint32(b[:])
+	}
+
+	session := FeedSession{ID: rand.Text(), Seed: state.Seed, Variant: state.Variant}
+	expires, err := h.sessions.put(req.Context(), session.ID, state)
+	if err != nil {
+		writeServerErr(w, req, err)
+		return
+	}
+	session.Expires = expires
+
+	w.Header().Set("Location", "/sessions/"+session.ID+"/next")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(session); err != nil {
+		slog.WarnContext(req.Context(), "encoding response to http writer", "error", err)
+	}
+}
+
+// NextSessionPage handles POST /sessions/{id}/next?count=N. It returns the next `count` items of the session feed,
+// skipping the items the session already returned. It's a POST, as it advances the session: a replayed request
+// (by a cache, a prefetcher or the mirror) would skip a page. The `expiry_format`, `tz` and `checksum` parameters
+// work like for GET /.
+func (h *Handler) NextSessionPage(w http.ResponseWriter, req *http.Request, id string) {
+	var errs ValidationErrors
+	count, err := h.getIntParam("count", true, false, req)
+	if err != nil {
+		errs = append(errs, ParamError{Param: "count", Message: err.Error()})
+	}
+	errs = append(errs, h.limits.check(count, 0)...)
+	query := req.URL.Query()
+	render, renderErrs := parseRenderOptions(query.Get("expiry_format"), query.Get("tz"))
+	render.policy = fieldPolicyFromContext(req.Context())
+	errs = append(errs, renderErrs...)
+	if v := query.Get("checksum"); v != "" {
+		if render.checksum, err = strconv.ParseBool(v); err != nil {
+			errs = append(errs, ParamError{Param: "checksum", Message: "must be a boolean"})
+		}
+	}
+	if len(errs) > 0 {
+		h.handleValidationErr(w, req, errs)
+		return
+	}
+
+	defer h.sessions.lock(id)()
+	state, ok := h.sessions.get(req.Context(), id)
+	if !ok {
+		writeError(w, req, http.StatusNotFound, ErrorCodeNotFound, "session not found")
+		return
+	}
+
+	ctx := withShuffleSeed(withEndpoint(req.Context(), EndpointContent), state.Seed)
+	meta := requestMeta(req)
+	meta.Variant = state.Variant
+	page := &SessionPage{Items: []*ItemView{}}
+	for range maxSessionFetches {
+		n := count - len(page.Items)
+		if h.limits.MaxItems > 0 && state.Offset+n > h.limits.MaxItems {
+			n = h.limits.MaxItems - state.Offset
+			page.End = true
+		}
+		if n <= 0 {
+			break
+		}
+
+		release, err := h.memory.acquire(n, state.Offset)
+		if err != nil {
+			writeMemoryErr(w, req, err)
+			return
+		}
+		result, err := h.service.GetContentResult(ctx, meta, n, state.Offset)
+		release()
+		if err != nil {
+			writeServerErr(w, req, err)
+			return
+		}
+		state.Offset += len(result.Items)
+		for _, item := range result.Items {
+			if state.seen(item.ID) {
+				continue
+			}
+			state.markSeen(item.ID)
+			page.Items = append(page.Items, render.renderItem(item))
+		}
+		if len(result.Items) < n || len(page.Items) == count {
+			break
+		}
+	}
+
+	if page.Expires, err = h.sessions.put(req.Context(), id, state); err != nil {
+		writeServerErr(w, req, err)
+		return
+	}
+	h.writeJSON(w, req, page)
+}
+
+// routeSessions routes the session requests, and tells whether the path is a session path.
+func (h *Handler) routeSessions(w http.ResponseWriter, req *http.Request) bool {
+	if h.sessions == nil {
+		return false
+	}
+	if req.URL.Path == "/sessions" {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeMethodNotAllowed(w, req)
+			return true
+		}
+		h.CreateSession(w, req)
+		return true
+	}
+
+	id, ok := strings.CutPrefix(req.URL.Path, "/sessions/")
+	if !ok {
+		return false
+	}
+	id, ok = strings.CutSuffix(id, "/next")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return false
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeMethodNotAllowed(w, req)
+		return true
+	}
+	h.NextSessionPage(w, req, id)
+	return true
+}
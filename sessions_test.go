@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	recorder := &metaRecordingClient{}
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: recorder,
+		Provider3: &mockContentProvider{source: Provider3, itemID: "repeated"},
+	}
+	service, err := NewService([]ContentConfig{{Type: Provider1}, {Type: Provider2}, {Type: Provider3}}, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{
+		service:  service,
+		limits:   RequestLimits{MaxItems: 10},
+		sessions: newSessionStore(10, 0, time.Minute),
+	})
+	defer srv.Close()
+
+	create := func(body string) (*http.Response, FeedSession) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/sessions", strings.NewReader(body))
+		req.Header.Set("X-Experiment-Variant", "b")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		defer resp.Body.Close()
+		var session FeedSession
+		_ = json.NewDecoder(resp.Body).Decode(&session)
+		return resp, session
+	}
+	next := func(path string) (int, SessionPage) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+path, "", nil)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		defer resp.Body.Close()
+		var page SessionPage
+		_ = json.NewDecoder(resp.Body).Decode(&page)
+		return resp.StatusCode, page
+	}
+
+	resp, session := create(`{"seed": 7}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+	if session.Seed != 7 || session.Variant != "b" || session.ID == "" || session.Expires.IsZero() {
+		t.Errorf("got session %+v, want the seed and the variant of the request", session)
+	}
+	location := resp.Header.Get("Location")
+	if location != "/sessions/"+session.ID+"/next" {
+		t.Errorf("got location %q", location)
+	}
+
+	// The pages follow the shuffled sequence of the seed, skip the repeated item, and end at the request limits.
+	order := shuffleConfigs([]ContentConfig{{Type: Provider1}, {Type: Provider2}, {Type: Provider3}}, 7)
+	var sources []string
+	seen := map[string]bool{}
+	for range 4 {
+		status, page := next(location + "?count=3")
+		if status != http.StatusOK {
+			t.Fatalf("got status %d, want %d", status, http.StatusOK)
+		}
+		for _, item := range page.Items {
+			if seen[item.ID] {
+				t.Errorf("got item %s again", item.ID)
+			}
+			seen[item.ID] = true
+			sources = append(sources, item.Source)
+		}
+		if page.End {
+			break
+		}
+	}
+	var want []string
+	repeated := false
+	for i := range 10 {
+		p := string(order[i%len(order)].Type)
+		if p == string(Provider3) {
+			if repeated {
+				continue
+			}
+			repeated = true
+		}
+		if p == string(Provider2) {
+			p = "" // The recording client items have no source.
+		}
+		want = append(want, p)
+	}
+	if strings.Join(sources, ",") != strings.Join(want, ",") {
+		t.Errorf("got sources %v, want %v", sources, want)
+	}
+	if recorder.meta.Variant != "b" {
+		t.Errorf("provider got variant %q, want the session variant", recorder.meta.Variant)
+	}
+	if _, page := next(location + "?count=3"); !page.End || len(page.Items) != 0 {
+		t.Errorf("got page %+v at the end of the feed, want no items", page)
+	}
+
+	for name, tc := range map[string]struct {
+		path       string
+		wantStatus int
+	}{
+		"unknown session": {path: "/sessions/unknown/next?count=1", wantStatus: http.StatusNotFound},
+		"no count":        {path: location, wantStatus: http.StatusBadRequest},
+		"invalid count":   {path: location + "?count=-1", wantStatus: http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if status, _ := next(tc.path); status != tc.wantStatus {
+				t.Errorf("got status %d, want %d", status, tc.wantStatus)
+			}
+		})
+	}
+
+	resp, err = http.Get(srv.URL + location + "?count=1")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != http.MethodPost {
+		t.Errorf("got status %d and Allow %q for a GET of the next page, want %d and POST", resp.StatusCode, resp.Header.Get("Allow"), http.StatusMethodNotAllowed)
+	}
+
+	if resp, session := create(""); resp.StatusCode != http.StatusCreated || session.ID == "" {
+		t.Errorf("got status %d and session %+v without a body, want a session with a random seed", resp.StatusCode, session)
+	}
+	if resp, _ := create(`{"seed": -1}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for an invalid seed, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestSessionStoreMemory(t *testing.T) {
+	ctx := context.Background()
+	store := newSessionStore(100, 64<<10, time.Minute)
+	state := &sessionState{}
+	for i := range maxSessionSeen {
+		state.markSeen(fmt.Sprintf("item-%d", i))
+	}
+	for i := range 10 {
+		if _, err := store.put(ctx, fmt.Sprintf("session-%d", i), state); err != nil {
+			t.Fatalf("storing a session: %v", err)
+		}
+	}
+
+	if stats := store.cache.Stats(); stats.Bytes > 64<<10 {
+		t.Errorf("sessions take %d bytes, want at most %d", stats.Bytes, 64<<10)
+	}
+	if _, ok := store.get(ctx, "session-0"); ok {
+		t.Error("the least recently used session is kept over the memory limit")
+	}
+	if _, ok := store.get(ctx, "session-9"); !ok {
+		t.Error("the latest session is dropped")
+	}
+}
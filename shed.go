@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// shedRetryAfter is the Retry-After (in seconds) of the requests shed by the in-flight limit.
+const shedRetryAfter = "1"
+
+var (
+	httpRequestsInFlight = newGaugeVec(
+		"http_requests_in_flight",
+		"Number of requests being handled by the main server, counting only the servers with the in-flight limit.",
+	)
+	httpRequestsShed = newCounterVec(
+		"http_requests_shed_total",
+		"Number of requests rejected with 503, because the main server had the maximum number of requests in flight.",
+	)
+)
+
+// withInFlightLimit returns a handler serving at most `limit` requests at once. The requests over the limit get
+// 503 with Retry-After immediately, so a saturated server degrades gracefully instead of queueing requests
+// until their timeouts cascade.
+// The live updates streams last until the clients disconnect, so they aren't counted; they have their own limit.
+func withInFlightLimit(next http.Handler, limit int) http.Handler {
+	var inFlight atomic.Int64
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/stream" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if inFlight.Add(1) > int64(limit) {
+			inFlight.Add(-1)
+			httpRequestsShed.Inc()
+			w.Header().Set("Retry-After", shedRetryAfter)
+			writeError(w, req, http.StatusServiceUnavailable, ErrorCodeOverloaded, "the server has too many requests in flight, try again later")
+			return
+		}
+		httpRequestsInFlight.Add(1)
+		defer func() {
+			inFlight.Add(-1)
+			httpRequestsInFlight.Add(-1)
+		}()
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestInFlightLimit(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := withInFlightLimit(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}), 2)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	// Two slow requests take the whole limit.
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			get("/slow")
+		}()
+		<-started
+	}
+
+	rec := get("/")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d over the limit, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != shedRetryAfter {
+		t.Errorf("got Retry-After %q, want %q", retryAfter, shedRetryAfter)
+	}
+	var body ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Code != ErrorCodeOverloaded {
+		t.Errorf("got error %+v (%v), want the %s code", body, err, ErrorCodeOverloaded)
+	}
+
+	// The slots are released when the requests finish.
+	close(release)
+	wg.Wait()
+	if rec := get("/"); rec.Code != http.StatusOK {
+		t.Errorf("got status %d after the slow requests finished, want %d", rec.Code, http.StatusOK)
+	}
+}
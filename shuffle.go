@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+)
+
+// shuffleSeedSalt is the second half of the PCG state, so the seeds don't map to the plain PCG streams.
+const shuffleSeedSalt = 0x6d69782d73656564
+
+type shuffleSeedKey struct{}
+
+// withShuffleSeed returns the context of a request for a shuffled mix.
+func withShuffleSeed(ctx context.Context, seed uint32) context.Context {
+	return context.WithValue(ctx, shuffleSeedKey{}, seed)
+}
+
+// withoutShuffleSeed returns the context for the requests which aren't shuffled, even if the parent one is.
+func withoutShuffleSeed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, shuffleSeedKey{}, nil)
+}
+
+// shuffleSeedFromContext returns the seed of the shuffled mix, if the request asked for one.
+func shuffleSeedFromContext(ctx context.Context) (uint32, bool) {
+	seed, ok := ctx.Value(shuffleSeedKey{}).(uint32)
+	return seed, ok
+}
+
+// shuffleConfigs returns a copy of the sequence in the order given by the seed.
+// Only the order of one cycle of the sequence changes, so the pages requested with the same seed still fit together.
+// The shuffle is implemented here, not with rand.Shuffle, so the order for a seed doesn't change between Go releases.
+func shuffleConfigs(configs []ContentConfig, seed uint32) []ContentConfig {
+	shuffled := make([]ContentConfig, len(configs))
+	copy(shuffled, configs)
+	r := rand.NewPCG(uint64(seed), shuffleSeedSalt)
+	for i := len(shuffled) - 1; i > 0; i-- {
+		j := int(r.Uint64() % uint64(i+1))
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	return shuffled
+}
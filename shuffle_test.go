@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestShuffleConfigs(t *testing.T) {
+	fallback := Provider2
+	configs := []ContentConfig{{Type: Provider1}, {Type: Provider2}, {Type: Provider3}, {Type: Provider1, Fallback: &fallback}}
+	original := slices.Clone(configs)
+
+	orders := map[string]bool{}
+	for seed := uint32(0); seed < 20; seed++ {
+		shuffled := shuffleConfigs(configs, seed)
+		if again := shuffleConfigs(configs, seed); !slices.Equal(shuffled, again) {
+			t.Fatalf("seed %d: got orders %v and %v, want the same order", seed, shuffled, again)
+		}
+		if len(shuffled) != len(configs) {
+			t.Fatalf("seed %d: got %d configs, want %d", seed, len(shuffled), len(configs))
+		}
+		for _, c := range configs {
+			if !slices.Contains(shuffled, c) {
+				t.Fatalf("seed %d: config %v is missing in %v", seed, c, shuffled)
+			}
+		}
+		orders[configsOrder(shuffled)] = true
+	}
+	if len(orders) < 5 {
+		t.Errorf("got %d different orders for 20 seeds, want the seeds to change the order", len(orders))
+	}
+	if !slices.Equal(configs, original) {
+		t.Errorf("the original sequence was changed to %v", configs)
+	}
+}
+
+func TestSeedParam(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: &mockContentProvider{source: Provider2},
+		Provider3: &mockContentProvider{source: Provider3},
+	}
+	service, err := NewService([]ContentConfig{{Type: Provider1}, {Type: Provider2}, {Type: Provider3}}, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+
+	get := func(query string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/?" + query)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		defer resp.Body.Close()
+		var items []ContentItem
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+		}
+		sources := make([]string, len(items))
+		for i, item := range items {
+			sources[i] = item.Source
+		}
+		return resp.StatusCode, strings.Join(sources, ",")
+	}
+
+	if _, got := get("count=6"); got != "1,2,3,1,2,3" {
+		t.Errorf("got sources %s without a seed, want the configured order", got)
+	}
+	for seed := range 5 {
+		query := "count=6&seed=" + strconv.Itoa(seed)
+		_, first := get(query)
+		_, second := get(query)
+		if first != second {
+			t.Errorf("seed %d: got orders %s and %s, want the same order", seed, first, second)
+		}
+		order := configsOrder(shuffleConfigs([]ContentConfig{{Type: Provider1}, {Type: Provider2}, {Type: Provider3}}, uint32(seed)))
+		if want := order + "," + order; first != want {
+			t.Errorf("seed %d: got sources %s, want %s", seed, first, want)
+		}
+		if _, next := get("count=3&offset=3&seed=" + strconv.Itoa(seed)); next != order {
+			t.Errorf("seed %d: got next page %s, want %s", seed, next, order)
+		}
+	}
+
+	for name, query := range map[string]string{
+		"not a number": "count=2&seed=abc",
+		"negative":     "count=2&seed=-1",
+		"too big":      "count=2&seed=4294967296",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if status, _ := get(query); status != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", status, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func configsOrder(configs []ContentConfig) string {
+	types := make([]string, len(configs))
+	for i, c := range configs {
+		types[i] = string(c.Type)
+	}
+	return strings.Join(types, ",")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"sort"
+)
+
+type sourcesKey struct{}
+
+// withSources returns the context of a request for the items of only some providers.
+func withSources(ctx context.Context, providers []Provider) context.Context {
+	allowed := make(map[Provider]bool, len(providers))
+	for _, p := range providers {
+		allowed[p] = true
+	}
+	return context.WithValue(ctx, sourcesKey{}, allowed)
+}
+
+// sourcesFromContext returns the providers the request asked for, or nil if it didn't restrict them.
+func sourcesFromContext(ctx context.Context) map[Provider]bool {
+	allowed, _ := ctx.Value(sourcesKey{}).(map[Provider]bool)
+	return allowed
+}
+
+// filterConfigs returns the sequence without the positions of the providers that aren't allowed.
+// The fallbacks that aren't allowed are dropped too.
+func filterConfigs(configs []ContentConfig, allowed map[Provider]bool) []ContentConfig {
+	var filtered []ContentConfig
+	for _, c := range configs {
+		if !allowed[c.Type] {
+			continue
+		}
+		if c.Fallback != nil && !allowed[*c.Fallback] {
+			c.Fallback = nil
+		}
+		filtered = append(filtered, c)
+	}
+	return filtered
+}
+
+// HasProvider tells whether the provider is configured.
+func (s *Service) HasProvider(p Provider) bool {
+	_, ok := s.clients[p]
+	return ok
+}
+
+// Providers returns the configured providers, sorted by name.
+func (s *Service) Providers() []Provider {
+	providers := make([]Provider, 0, len(s.clients))
+	for p := range s.clients {
+		providers = append(providers, p)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i] < providers[j] })
+	return providers
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFilterConfigs(t *testing.T) {
+	p1, p2 := Provider1, Provider2
+	configs := []ContentConfig{{Type: Provider1, Fallback: &p2}, {Type: Provider2, Fallback: &p1}, {Type: Provider3}}
+
+	got := filterConfigs(configs, map[Provider]bool{Provider1: true, Provider3: true})
+	if len(got) != 2 || got[0].Type != Provider1 || got[0].Fallback != nil || got[1].Type != Provider3 {
+		t.Errorf("got configs %+v, want provider 1 without the fallback, and provider 3", got)
+	}
+	if configs[0].Fallback == nil {
+		t.Error("the original sequence was changed")
+	}
+}
+
+func TestProvidersParams(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: &mockContentProvider{source: Provider2},
+		Provider3: &mockContentProvider{source: Provider3},
+	}
+	service, err := NewService([]ContentConfig{{Type: Provider1}, {Type: Provider2}, {Type: Provider3}}, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		query       string
+		wantStatus  int
+		wantSources string
+	}{
+		"all":                   {query: "count=4", wantStatus: http.StatusOK, wantSources: "1,2,3,1"},
+		"selected":              {query: "count=4&providers=3,1", wantStatus: http.StatusOK, wantSources: "1,3,1,3"},
+		"excluded":              {query: "count=4&exclude=2", wantStatus: http.StatusOK, wantSources: "1,3,1,3"},
+		"selected and excluded": {query: "count=2&providers=1,2&exclude=1", wantStatus: http.StatusOK, wantSources: "2,2"},
+		"unknown provider":      {query: "count=2&providers=1,4", wantStatus: http.StatusBadRequest},
+		"unknown excluded":      {query: "count=2&exclude=4", wantStatus: http.StatusBadRequest},
+		"all excluded":          {query: "count=2&providers=1&exclude=1", wantStatus: http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/?" + tc.query)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var items []ContentItem
+			if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			sources := make([]string, len(items))
+			for i, item := range items {
+				sources[i] = item.Source
+			}
+			if got := strings.Join(sources, ","); got != tc.wantSources {
+				t.Errorf("got sources %s, want %s", got, tc.wantSources)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// RuntimeState is the operational state of the service, changeable at runtime with the admin API.
+// It is declarative: applying a state replaces the whole previous state.
+type RuntimeState struct {
+	// Providers holds the per-provider state. Providers not listed are enabled.
+	Providers map[Provider]ProviderState `json:"providers"`
+	// BlockedItems lists IDs of content items that must never be returned.
+	// Their positions are filled from the fallback providers.
+	BlockedItems []string `json:"blocked_items"`
+}
+
+// ProviderState is the runtime state of one provider.
+type ProviderState struct {
+	Disabled bool `json:"disabled"`
+}
+
+// State returns the current runtime state. Only the disabled providers are listed.
+func (s *Service) State() RuntimeState {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	state := RuntimeState{
+		Providers:    make(map[Provider]ProviderState),
+		BlockedItems: make([]string, 0, len(s.blocked)),
+	}
+	for p, disabled := range s.disabled {
+		if disabled {
+			state.Providers[p] = ProviderState{Disabled: true}
+		}
+	}
+	for id := range s.blocked {
+		state.BlockedItems = append(state.BlockedItems, id)
+	}
+	sort.Strings(state.BlockedItems)
+
+	return state
+}
+
+// ApplyState reconciles the service to the desired state. Nothing is changed when the state is invalid.
+func (s *Service) ApplyState(state RuntimeState) error {
+	for p := range state.Providers {
+		if _, ok := s.clients[p]; !ok {
+			return fmt.Errorf("unknown provider '%s'", p)
+		}
+	}
+	blocked := make(map[string]bool, len(state.BlockedItems))
+	for _, id := range state.BlockedItems {
+		if id == "" {
+			return fmt.Errorf("blocked item ID is empty")
+		}
+		blocked[id] = true
+	}
+
+	for p := range s.clients {
+		if err := s.SetProviderDisabled(p, state.Providers[p].Disabled); err != nil {
+			return err
+		}
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if len(blocked) != len(s.blocked) {
+		slog.Info("blocked items changed", "count", len(blocked))
+	}
+	s.blocked = blocked
+	if s.botPages != nil {
+		// The cached pages may have the newly blocked items.
+		s.botPages.purge()
+	}
+
+	return nil
+}
+
+// filterBlocked removes the blocked items from the provider response.
+func (s *Service) filterBlocked(items []*ContentItem) []*ContentItem {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	if len(s.blocked) == 0 {
+		return items
+	}
+	filtered := items[:0:0]
+	for _, item := range items {
+		if !s.blocked[item.ID] {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return filtered
+}
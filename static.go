@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProviderStatic is the provider of the static emergency content.
+var ProviderStatic = Provider("static")
+
+// staticExpiry is the expiry of the static items that don't have one.
+const staticExpiry = time.Hour
+
+//go:embed static_content.json
+var defaultStaticContent []byte
+
+// StaticSelection tells which items of the list a static client serves.
+type StaticSelection string
+
+// Static selections. The empty selection means StaticSelectionFirst.
+const (
+	// StaticSelectionFirst serves the first items of the list every time.
+	StaticSelectionFirst StaticSelection = "first"
+	// StaticSelectionRoundRobin serves the next items of the list on every call, wrapping around at the end.
+	StaticSelectionRoundRobin StaticSelection = "round_robin"
+	// StaticSelectionRandom serves random items of the list, without repeating them in a call.
+	StaticSelectionRandom StaticSelection = "random"
+)
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *StaticSelection) UnmarshalText(text []byte) error {
+	switch v := StaticSelection(text); v {
+	case "", StaticSelectionFirst, StaticSelectionRoundRobin, StaticSelectionRandom:
+		*s = v
+		return nil
+	default:
+		return fmt.Errorf("unknown static selection '%s', must be first, round_robin or random", v)
+	}
+}
+
+// StaticClient serves items from a static list. It doesn't depend on anything external, so it's meant
+// as the last resort fallback, and as a fixture for demos and local development.
+// The list is read from a JSON or YAML file (a list of content items), or the built-in list is used.
+type StaticClient struct {
+	// provider is the source of the items without one.
+	provider  Provider
+	path      string
+	selection StaticSelection
+	items     []*ContentItem
+	modTime   time.Time
+	// next is the position of the next round robin call.
+	next atomic.Uint64
+	m    sync.RWMutex
+}
+
+// NewStaticClient returns a client serving the items from the file, selected with the selection.
+// When the path is empty, it serves the built-in list.
+func NewStaticClient(path string, selection StaticSelection) (*StaticClient, error) {
+	c := &StaticClient{provider: ProviderStatic, path: path, selection: selection}
+	if path == "" {
+		items, err := parseStaticContent(defaultStaticContent)
+		if err != nil {
+			return nil, fmt.Errorf("parsing built-in static content: %w", err)
+		}
+		c.items = items
+		return c, nil
+	}
+
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetContent implements Client. It returns up to `count` items from the list, never repeating an item in a call.
+func (c *StaticClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	selected := c.selectItems(count)
+
+	items := make([]*ContentItem, len(selected))
+	expiry := time.Now().Add(staticExpiry)
+	for i, item := range selected {
+		copied := *item
+		if copied.Expiry.IsZero() {
+			copied.Expiry = expiry
+		}
+		if copied.Source == "" {
+			copied.Source = string(c.provider)
+		}
+		items[i] = &copied
+	}
+
+	return items, nil
+}
+
+// selectItems returns up to `count` items of the list, according to the selection.
+func (c *StaticClient) selectItems(count int) []*ContentItem {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	n := min(count, len(c.items))
+	switch c.selection {
+	case StaticSelectionRoundRobin:
+		start := (c.next.Add(uint64(n)) - uint64(n)) % uint64(len(c.items))
+		items := make([]*ContentItem, n)
+		for i := range items {
+			items[i] = c.items[(start+uint64(i))%uint64(len(c.items))]
+		}
+		return items
+	case StaticSelectionRandom:
+		items := make([]*ContentItem, n)
+		for i, j := range rand.Perm(len(c.items))[:n] {
+			items[i] = c.items[j]
+		}
+		return items
+	default:
+		return c.items[:n]
+	}
+}
+
+// Run reloads the file when it changes, until the context is done.
+// An invalid file is logged, and the previous list is kept.
+func (c *StaticClient) Run(ctx context.Context, interval time.Duration) {
+	if c.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := c.reload()
+			if err != nil {
+				slog.WarnContext(ctx, "reloading static content failed", "path", c.path, "error", err)
+				continue
+			}
+			if reloaded {
+				slog.InfoContext(ctx, "static content reloaded", "path", c.path, "items", c.len())
+			}
+		}
+	}
+}
+
+// reload reads the file if it was modified since the last read.
+func (c *StaticClient) reload() (bool, error) {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return false, fmt.Errorf("reading static content: %w", err)
+	}
+	c.m.RLock()
+	unchanged := info.ModTime().Equal(c.modTime)
+	c.m.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return false, fmt.Errorf("reading static content: %w", err)
+	}
+	if ext := strings.ToLower(filepath.Ext(c.path)); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return false, fmt.Errorf("parsing static content file '%s': %w", c.path, err)
+		}
+	}
+	items, err := parseStaticContent(data)
+	if err != nil {
+		return false, fmt.Errorf("parsing static content file '%s': %w", c.path, err)
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.items = items
+	c.modTime = info.ModTime()
+
+	return true, nil
+}
+
+func (c *StaticClient) len() int {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return len(c.items)
+}
+
+// parseStaticContent parses and validates a JSON list of items.
+func parseStaticContent(data []byte) ([]*ContentItem, error) {
+	var items []*ContentItem
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&items); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.New("the list is empty")
+	}
+	for i, item := range items {
+		if item == nil || item.ID == "" {
+			return nil, fmt.Errorf("item %d: id is empty", i)
+		}
+	}
+
+	return items, nil
+}
+
+// yamlToJSON converts a YAML document to JSON, so the YAML files are parsed and validated like the JSON ones.
+// The keys of the mappings become strings, so `1:` is the key "1", like a provider name in JSON.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(stringKeys(v))
+}
+
+// stringKeys returns the YAML value with the mappings with non-string keys converted to ones with string keys,
+// which JSON requires.
+func stringKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = stringKeys(e)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = stringKeys(e)
+		}
+		return m
+	case []any:
+		for i, e := range v {
+			v[i] = stringKeys(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
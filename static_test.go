@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStaticClient(t *testing.T) {
+	ctx := context.Background()
+
+	builtIn, err := NewStaticClient("", "")
+	if err != nil {
+		t.Fatalf("creating a client with the built-in content: %v", err)
+	}
+	items, _ := builtIn.GetContent(ctx, RequestMeta{IP: "127.0.0.1"}, 100)
+	if len(items) == 0 {
+		t.Fatal("got no built-in items")
+	}
+	for _, item := range items {
+		if item.Source != string(ProviderStatic) || !item.Expiry.After(time.Now()) {
+			t.Errorf("got item %+v, want the static source and an expiry in the future", item)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "static.json")
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("writing file: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("setting file time: %v", err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write(`[{"id": "a"}, {"id": "b"}, {"id": "c"}]`, start)
+
+	client, err := NewStaticClient(path, "")
+	if err != nil {
+		t.Fatalf("creating a client: %v", err)
+	}
+	if items, _ := client.GetContent(ctx, RequestMeta{IP: "127.0.0.1"}, 2); len(items) != 2 || items[0].ID != "a" {
+		t.Errorf("got %d items, want the first 2", len(items))
+	}
+
+	write(`[{"id": "d"}]`, start.Add(time.Minute))
+	if reloaded, err := client.reload(); !reloaded || err != nil {
+		t.Fatalf("got reloaded %v, error %v, want the file reloaded", reloaded, err)
+	}
+	if items, _ := client.GetContent(ctx, RequestMeta{IP: "127.0.0.1"}, 2); len(items) != 1 || items[0].ID != "d" {
+		t.Errorf("got items %+v, want the reloaded one", items)
+	}
+
+	for name, content := range map[string]string{
+		"invalid json":  `[{"id": `,
+		"empty list":    `[]`,
+		"empty id":      `[{"title": "no id"}]`,
+		"unknown field": `[{"id": "e", "weight": 2}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			write(content, start.Add(2*time.Minute))
+			if _, err := client.reload(); err == nil {
+				t.Error("expected an error")
+			}
+			if items, _ := client.GetContent(ctx, RequestMeta{IP: "127.0.0.1"}, 2); len(items) != 1 || items[0].ID != "d" {
+				t.Errorf("got items %+v, want the previous ones", items)
+			}
+		})
+	}
+}
+
+func TestStaticClientSelection(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "fixture.yaml")
+	content := `
+- id: a
+  title: First
+  expiry: 2030-01-01T00:00:00Z
+- id: b
+  media: [b.jpg]
+- id: c
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing file: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		selection StaticSelection
+		want      []string
+	}{
+		"first":       {selection: StaticSelectionFirst, want: []string{"ab", "ab", "ab"}},
+		"round robin": {selection: StaticSelectionRoundRobin, want: []string{"ab", "ca", "bc"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client, err := NewStaticClient(path, tc.selection)
+			if err != nil {
+				t.Fatalf("creating a client: %v", err)
+			}
+			var got []string
+			for range tc.want {
+				items, _ := client.GetContent(ctx, RequestMeta{}, 2)
+				ids := ""
+				for _, item := range items {
+					ids += item.ID
+				}
+				got = append(got, ids)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("got calls %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	client, err := NewStaticClient(path, StaticSelectionRandom)
+	if err != nil {
+		t.Fatalf("creating a client: %v", err)
+	}
+	items, _ := client.GetContent(ctx, RequestMeta{}, 5)
+	seen := make(map[string]bool)
+	for _, item := range items {
+		seen[item.ID] = true
+	}
+	if len(items) != 3 || len(seen) != 3 {
+		t.Errorf("got %d random items, %d unique, want all 3", len(items), len(seen))
+	}
+	first, _ := NewStaticClient(path, "")
+	if items, _ := first.GetContent(ctx, RequestMeta{}, 2); items[0].Title != "First" || items[0].Expiry.Year() != 2030 || items[1].Media[0] != "b.jpg" {
+		t.Errorf("got items %+v, want the fields from the YAML file", items)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ndjsonContentType is the media type of newline-delimited JSON responses.
+const ndjsonContentType = "application/x-ndjson"
+
+// acceptsNDJSON tells whether the request's Accept header asks for newline-delimited JSON.
+func acceptsNDJSON(req *http.Request) bool {
+	for _, v := range strings.Split(req.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(v); err == nil && mediaType == ndjsonContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// streamContent writes the items as newline-delimited JSON, each one as soon as it's ready.
+// Once the first item is written, errors can't change the response status anymore, so the stream just ends.
+// The items go through the send buffer of the stream (see StreamBufferSettings), and the fetching stops when the client
+// is gone or too slow.
+func (h *Handler) streamContent(w http.ResponseWriter, req *http.Request, params *contentRequest) {
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	buf := newStreamBuffer(h.streamBuffer, func(items []*ContentItem) error {
+		if h.streamBuffer.MaxLag > 0 {
+			_ = rc.SetWriteDeadline(time.Now().Add(h.streamBuffer.MaxLag))
+		}
+		for _, item := range items {
+			if err := enc.Encode(params.render.renderItem(item)); err != nil {
+				return err
+			}
+		}
+		return rc.Flush()
+	})
+	started := false
+	emit := func(item *ContentItem) {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", ndjsonContentType)
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(http.StatusOK)
+		}
+		if !buf.push(item) && !buf.cut {
+			cancel()
+		}
+	}
+
+	_, err := h.service.StreamContent(params.context(ctx, EndpointStream), requestMeta(req), params.count, params.offset, emit)
+	if writeErr := buf.close(); writeErr != nil {
+		if errors.Is(writeErr, errSlowConsumer) {
+			slog.InfoContext(req.Context(), "disconnected a slow stream consumer", "max_lag", h.streamBuffer.MaxLag)
+		} else {
+			slog.DebugContext(req.Context(), "writing streamed items", "error", writeErr)
+		}
+		return
+	}
+	if h.streamBuffer.MaxLag > 0 {
+		_ = rc.SetWriteDeadline(time.Time{})
+	}
+	switch {
+	case err != nil && !started:
+		writeServerErr(w, req, err)
+	case err != nil:
+		slog.WarnContext(req.Context(), "streaming content", "error", err)
+	case !started:
+		// No items - an empty stream.
+		w.Header().Set("Content-Type", ndjsonContentType)
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// StreamBufferPolicy tells what happens when the send buffer of a stream is full, because the client reads slower
+// than the items are fetched.
+type StreamBufferPolicy string
+
+// Stream buffer policies. The empty policy means StreamBufferWait.
+const (
+	// StreamBufferWait makes the fetching wait until the client reads the buffered items.
+	StreamBufferWait StreamBufferPolicy = "wait"
+	// StreamBufferDrop cuts the stream at the first item that doesn't fit, so the buffered items are the last ones sent.
+	// The items are never skipped in the middle, so the stream keeps the order of the page.
+	StreamBufferDrop StreamBufferPolicy = "drop"
+	// StreamBufferMerge waits like StreamBufferWait, but writes all the buffered items at once, with a single flush,
+	// so a lagging client catches up with fewer writes.
+	StreamBufferMerge StreamBufferPolicy = "merge"
+)
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *StreamBufferPolicy) UnmarshalText(text []byte) error {
+	switch v := StreamBufferPolicy(text); v {
+	case "", StreamBufferWait, StreamBufferDrop, StreamBufferMerge:
+		*p = v
+		return nil
+	default:
+		return fmt.Errorf("unknown stream buffer policy '%s', must be wait, drop or merge", v)
+	}
+}
+
+// StreamBufferSettings configure the send buffers of the streamed responses.
+type StreamBufferSettings struct {
+	// Size is the number of items buffered per stream. Zero writes the items as they're fetched, without a buffer.
+	Size int
+	// Policy tells what happens when the buffer is full.
+	Policy StreamBufferPolicy
+	// MaxLag is how long a write to the client may take. A client that doesn't read for longer is disconnected.
+	// Zero disables it.
+	MaxLag time.Duration
+}
+
+var (
+	streamDroppedItems = newCounterVec(
+		"stream_dropped_items_total",
+		"Number of items not sent in streamed responses, because the send buffer was full and the stream was cut.",
+	)
+	streamSlowConsumers = newCounterVec(
+		"stream_slow_consumers_total",
+		"Number of streams disconnected, because the client didn't read for longer than the maximum lag.",
+	)
+)
+
+// errSlowConsumer is the error of the streams to the clients that didn't read for longer than the maximum lag.
+var errSlowConsumer = errors.New("slow stream consumer disconnected")
+
+// streamBuffer decouples fetching the items of a stream from writing them to the client, so a stalled client
+// holds at most Size items in memory (besides the connection buffers), and can't stall the fetching for longer
+// than the maximum lag.
+// push is called by a single producer. The writes happen in a separate goroutine, or in push without a buffer.
+type streamBuffer struct {
+	settings StreamBufferSettings
+	write    func([]*ContentItem) error
+	items    chan *ContentItem
+	// done is closed when the writer stops, and err is its error. Without a buffer, done is nil.
+	done chan struct{}
+	err  error
+	// cut is set when the stream was cut by the drop policy.
+	cut bool
+}
+
+// newStreamBuffer returns a buffer writing the items with the write function. The writer, if any, runs until close.
+func newStreamBuffer(settings StreamBufferSettings, write func([]*ContentItem) error) *streamBuffer {
+	b := &streamBuffer{settings: settings, write: write}
+	if settings.Size > 0 {
+		b.items = make(chan *ContentItem, settings.Size)
+		b.done = make(chan struct{})
+		go b.run()
+	}
+
+	return b
+}
+
+func (b *streamBuffer) run() {
+	defer close(b.done)
+
+	for item := range b.items {
+		batch := []*ContentItem{item}
+		if b.settings.Policy == StreamBufferMerge {
+		merge:
+			for {
+				select {
+				case item, ok := <-b.items:
+					if !ok {
+						break merge
+					}
+					batch = append(batch, item)
+				default:
+					break merge
+				}
+			}
+		}
+		if err := b.write(batch); err != nil {
+			b.err = writeErr(err)
+			return
+		}
+	}
+}
+
+// push passes the item to the writer, and returns false when the stream won't take more items:
+// the write failed, the client is too slow, or the stream was cut.
+func (b *streamBuffer) push(item *ContentItem) bool {
+	if b.cut {
+		streamDroppedItems.Inc()
+		return false
+	}
+	if b.done == nil {
+		if b.err != nil {
+			return false
+		}
+		if err := b.write([]*ContentItem{item}); err != nil {
+			b.err = writeErr(err)
+			return false
+		}
+		return true
+	}
+
+	select {
+	case b.items <- item:
+		return true
+	case <-b.done:
+		return false
+	default:
+	}
+	if b.settings.Policy == StreamBufferDrop {
+		b.cut = true
+		streamDroppedItems.Inc()
+		return false
+	}
+	select {
+	case b.items <- item:
+		return true
+	case <-b.done:
+		return false
+	}
+}
+
+// close stops the writer, after it writes the buffered items, and returns the write error.
+func (b *streamBuffer) close() error {
+	if b.done != nil {
+		close(b.items)
+		<-b.done
+	}
+
+	return b.err
+}
+
+// writeErr reports the timed out writes as errSlowConsumer.
+func writeErr(err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		streamSlowConsumers.Inc()
+		return fmt.Errorf("%w: %w", errSlowConsumer, err)
+	}
+
+	return err
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestStreamBuffer(t *testing.T) {
+	for name, tc := range map[string]struct {
+		settings StreamBufferSettings
+		// blockFirst blocks the first write until all the items are pushed.
+		blockFirst bool
+		failWrite  error
+		wantPushed int
+		wantWrites [][]string
+		wantErr    error
+	}{
+		"unbuffered": {
+			wantPushed: 4,
+			wantWrites: [][]string{{"0"}, {"1"}, {"2"}, {"3"}},
+		},
+		"wait": {
+			settings:   StreamBufferSettings{Size: 2, Policy: StreamBufferWait},
+			wantPushed: 4,
+			wantWrites: [][]string{{"0"}, {"1"}, {"2"}, {"3"}},
+		},
+		"drop": {
+			settings:   StreamBufferSettings{Size: 2, Policy: StreamBufferDrop},
+			blockFirst: true,
+			wantPushed: 3,
+			wantWrites: [][]string{{"0"}, {"1"}, {"2"}},
+		},
+		"merge": {
+			settings:   StreamBufferSettings{Size: 3, Policy: StreamBufferMerge},
+			blockFirst: true,
+			wantPushed: 4,
+			wantWrites: [][]string{{"0"}, {"1", "2", "3"}},
+		},
+		"slow consumer": {
+			settings:  StreamBufferSettings{Size: 2},
+			failWrite: os.ErrDeadlineExceeded,
+			wantErr:   errSlowConsumer,
+		},
+		"unbuffered slow consumer": {
+			failWrite: os.ErrDeadlineExceeded,
+			wantErr:   errSlowConsumer,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			unblock := make(chan struct{})
+			writing := make(chan struct{}, 1)
+			var writes [][]string
+			buf := newStreamBuffer(tc.settings, func(items []*ContentItem) error {
+				if tc.failWrite != nil {
+					return tc.failWrite
+				}
+				if tc.blockFirst && len(writes) == 0 {
+					writing <- struct{}{}
+					<-unblock
+				}
+				var ids []string
+				for _, item := range items {
+					ids = append(ids, item.ID)
+				}
+				writes = append(writes, ids)
+				return nil
+			})
+
+			pushed := 0
+			for i := range 4 {
+				if buf.push(&ContentItem{ID: fmt.Sprint(i)}) {
+					pushed++
+				} else if tc.failWrite != nil {
+					// The writer failed, so the next pushes are rejected.
+					break
+				}
+				if tc.blockFirst && i == 0 {
+					<-writing
+				}
+			}
+			close(unblock)
+			err := buf.close()
+
+			if tc.failWrite == nil && pushed != tc.wantPushed {
+				t.Errorf("got %d pushed items, want %d", pushed, tc.wantPushed)
+			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("got error %v, want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(writes, tc.wantWrites) {
+				t.Errorf("got writes %v, want %v", writes, tc.wantWrites)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamContent(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: &mockContentProvider{source: Provider2, responseDelay: 200 * time.Millisecond},
+	}
+	configs := []ContentConfig{{Type: Provider1}, {Type: Provider1}, {Type: Provider2}}
+	service, err := NewService(configs, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+	buffered := httptest.NewServer(&Handler{service: service, streamBuffer: StreamBufferSettings{Size: 2, Policy: StreamBufferMerge, MaxLag: time.Second}})
+	defer buffered.Close()
+
+	for name, tc := range map[string]struct {
+		query    string
+		accept   string
+		buffered bool
+	}{
+		"stream parameter": {query: "stream=true"},
+		"accept header":    {accept: "application/json;q=0.9, application/x-ndjson"},
+		"send buffer":      {query: "stream=true", buffered: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			url := srv.URL
+			if tc.buffered {
+				url = buffered.URL
+			}
+			req, _ := http.NewRequest(http.MethodGet, url+"/?count=3&"+tc.query, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			start := time.Now()
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if ct := resp.Header.Get("Content-Type"); ct != ndjsonContentType {
+				t.Errorf("got content type %q, want %q", ct, ndjsonContentType)
+			}
+
+			var sources []string
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				if len(sources) == 0 && time.Since(start) > 100*time.Millisecond {
+					t.Errorf("got the first item after %v, want it before the slow provider returns", time.Since(start))
+				}
+				var item ItemView
+				if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+					t.Fatalf("decoding item: %v", err)
+				}
+				sources = append(sources, item.Source)
+			}
+			if len(sources) != 3 || sources[0] != "1" || sources[1] != "1" || sources[2] != "2" {
+				t.Errorf("got items from %v, want from [1 1 2]", sources)
+			}
+		})
+	}
+
+	resp, err := http.Get(srv.URL + "/?count=1&stream=true&partial=true")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for stream with partial, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
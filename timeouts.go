@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Endpoint is the API serving the content, for the per-endpoint content timeouts.
+type Endpoint string
+
+// Endpoints serving the content.
+const (
+	// EndpointContent is the JSON content page.
+	EndpointContent Endpoint = "content"
+	// EndpointStream is the NDJSON stream of the content.
+	EndpointStream Endpoint = "stream"
+	// EndpointGRPC is the gRPC API.
+	EndpointGRPC Endpoint = "grpc"
+	// EndpointGraphQL is the GraphQL API.
+	EndpointGraphQL Endpoint = "graphql"
+)
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (e *Endpoint) UnmarshalText(text []byte) error {
+	switch v := Endpoint(text); v {
+	case EndpointContent, EndpointStream, EndpointGRPC, EndpointGraphQL:
+		*e = v
+		return nil
+	default:
+		return fmt.Errorf("invalid endpoint '%s', must be content, stream, grpc or graphql", v)
+	}
+}
+
+type endpointKey struct{}
+
+// withEndpoint returns the context of a request to the endpoint.
+func withEndpoint(ctx context.Context, e Endpoint) context.Context {
+	return context.WithValue(ctx, endpointKey{}, e)
+}
+
+// endpointFromContext returns the endpoint of the request, or an empty string if it isn't known.
+func endpointFromContext(ctx context.Context) Endpoint {
+	e, _ := ctx.Value(endpointKey{}).(Endpoint)
+	return e
+}
+
+// requestTimeoutHeader is the header with the client timeout of a content request, in milliseconds, like the timeout_ms parameter.
+const requestTimeoutHeader = "X-Request-Timeout"
+
+type clientTimeoutKey struct{}
+
+// withClientTimeout returns the context of a request whose client asked for a shorter timeout. When the timeout
+// is over, the request returns the items ready by then, instead of failing.
+func withClientTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, clientTimeoutKey{}, timeout)
+}
+
+// withoutClientTimeout returns the context without the client timeout, for the work shared with other requests.
+func withoutClientTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, clientTimeoutKey{}, nil)
+}
+
+// clientTimeoutFromContext returns the client timeout of the request, if the client asked for one.
+func clientTimeoutFromContext(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(clientTimeoutKey{}).(time.Duration)
+	return timeout, ok
+}
+
+// ServerTimeouts protects the servers from slow clients (like slowloris), which would otherwise hold the connections forever.
+// Zero values disable the limits, except MaxHeaderBytes, where zero means the net/http default (1MiB).
+type ServerTimeouts struct {
+	// ReadHeader is the maximum time for reading the request headers.
+	ReadHeader time.Duration
+	// Read is the maximum time for reading the whole request, including the body.
+	Read time.Duration
+	// Write is the maximum time from the end of reading the request headers to the end of writing the response.
+	// It must be longer than the content timeout, or slow responses are cut off.
+	Write time.Duration
+	// Idle is how long a keep-alive connection waits for the next request.
+	Idle time.Duration
+	// MaxHeaderBytes limits the size of the request headers.
+	MaxHeaderBytes int
+}
+
+// configureTimeouts sets the timeouts and limits of the server.
+func configureTimeouts(srv *http.Server, t ServerTimeouts) {
+	srv.ReadHeaderTimeout = t.ReadHeader
+	srv.ReadTimeout = t.Read
+	srv.WriteTimeout = t.Write
+	srv.IdleTimeout = t.Idle
+	srv.MaxHeaderBytes = t.MaxHeaderBytes
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerTimeouts(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	configureTimeouts(srv.Config, ServerTimeouts{ReadHeader: 50 * time.Millisecond, MaxHeaderBytes: 1 << 10})
+	srv.Start()
+	defer srv.Close()
+
+	t.Run("slow headers", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("dialing: %v", err)
+		}
+		defer conn.Close()
+		if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\n"); err != nil {
+			t.Fatalf("writing: %v", err)
+		}
+
+		// The server closes the connection without waiting for the rest of the headers.
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadAll(conn); err != nil {
+			t.Errorf("got error %v, want the connection closed by the server", err)
+		}
+	})
+
+	t.Run("large headers", func(t *testing.T) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("dialing: %v", err)
+		}
+		defer conn.Close()
+		req := "GET / HTTP/1.1\r\nHost: test\r\nX-Large: " + strings.Repeat("a", 8<<10) + "\r\n\r\n"
+		if _, err := io.WriteString(conn, req); err != nil {
+			t.Fatalf("writing: %v", err)
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("reading response: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+			t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusRequestHeaderFieldsTooLarge)
+		}
+	})
+}
+
+func TestEndpointTimeouts(t *testing.T) {
+	cfg := &FileConfig{
+		Timeout:          Duration(20 * time.Millisecond),
+		EndpointTimeouts: map[Endpoint]Duration{EndpointStream: Duration(time.Second)},
+		Items:            []ItemConfig{{Provider: Provider1}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	clients := map[Provider]Client{Provider1: &mockContentProvider{source: Provider1, responseDelay: 100 * time.Millisecond}}
+	service, err := NewServiceFromConfig(cfg, clients)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		endpoint Endpoint
+		wantErr  bool
+	}{
+		"default timeout":  {endpoint: EndpointContent, wantErr: true},
+		"unknown endpoint": {wantErr: true},
+		"longer timeout":   {endpoint: EndpointStream},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.endpoint != "" {
+				ctx = withEndpoint(ctx, tc.endpoint)
+			}
+			items, err := service.GetContent(ctx, RequestMeta{}, 1, 0)
+			if tc.wantErr {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("got error %v, want the deadline exceeded", err)
+				}
+				return
+			}
+			if err != nil || len(items) != 1 {
+				t.Errorf("got %d items and error %v, want 1 item", len(items), err)
+			}
+		})
+	}
+
+	if got := service.Config().EndpointTimeouts[EndpointStream]; got != Duration(time.Second) {
+		t.Errorf("got stream timeout %v in the config, want 1s", time.Duration(got))
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: &mockContentProvider{source: Provider2, responseDelay: time.Second},
+	}
+	configs := []ContentConfig{{Type: Provider1}, {Type: Provider1}, {Type: Provider2}, {Type: Provider1}}
+	service, err := NewService(configs, clients, 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(&Handler{service: service})
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		query       string
+		header      string
+		wantStatus  int
+		wantItems   int
+		wantElapsed time.Duration
+	}{
+		"timeout_ms":        {query: "timeout_ms=50", wantStatus: http.StatusOK, wantItems: 2, wantElapsed: 250 * time.Millisecond},
+		"header":            {header: "50", wantStatus: http.StatusOK, wantItems: 2, wantElapsed: 250 * time.Millisecond},
+		"the shorter wins":  {query: "timeout_ms=5000", header: "50", wantStatus: http.StatusOK, wantItems: 2, wantElapsed: 250 * time.Millisecond},
+		"capped by server":  {query: "timeout_ms=5000", wantStatus: http.StatusGatewayTimeout, wantElapsed: time.Second},
+		"no client timeout": {wantStatus: http.StatusGatewayTimeout, wantElapsed: time.Second},
+		"invalid param":     {query: "timeout_ms=0", wantStatus: http.StatusBadRequest},
+		"invalid header":    {header: "1s", wantStatus: http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?count=4&"+tc.query, nil)
+			if tc.header != "" {
+				req.Header.Set(requestTimeoutHeader, tc.header)
+			}
+			start := time.Now()
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+			if elapsed := time.Since(start); tc.wantElapsed > 0 && elapsed > tc.wantElapsed {
+				t.Errorf("got response after %v, want before %v", elapsed, tc.wantElapsed)
+			}
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			var items []ItemView
+			if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if len(items) != tc.wantItems {
+				t.Errorf("got %d items, want the %d ready before the timeout", len(items), tc.wantItems)
+			}
+		})
+	}
+
+	// The partial envelope tells the positions cut by the client timeout.
+	resp, err := http.Get(srv.URL + "/?count=4&partial=true&timeout_ms=50")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	var envelope ContentEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if envelope.Status == nil || envelope.Status.Complete || len(envelope.Status.Failures) == 0 ||
+		envelope.Status.Failures[0].Position != 2 || envelope.Status.Failures[0].Reason != "timeout" {
+		t.Errorf("got envelope %+v, want the positions from 2 failed with the timeout", envelope)
+	}
+}
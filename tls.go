@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSSettings configures HTTPS for the main server.
+// Either a certificate and key pair, or the autocert hosts can be set, not both.
+type TLSSettings struct {
+	// CertFile and KeyFile are the paths to the PEM encoded certificate and its private key.
+	CertFile string
+	KeyFile  string
+	// AutocertHosts are the host names for which the certificates are obtained from Let's Encrypt.
+	AutocertHosts []string
+	// AutocertCacheDir is the directory where the obtained certificates are kept between restarts.
+	AutocertCacheDir string
+	// AutocertEmail is the optional contact address of the Let's Encrypt account.
+	AutocertEmail string
+	// ClientCAFile is the optional path to the PEM encoded CA certificates the client certificates are verified with.
+	// The certificates are optional in the handshake; the ClientCertAuthenticator requires them.
+	ClientCAFile string
+}
+
+// Enabled tells if the server should use TLS.
+func (s TLSSettings) Enabled() bool {
+	return s.CertFile != "" || s.KeyFile != "" || len(s.AutocertHosts) > 0
+}
+
+// Validate checks that the settings don't contradict each other.
+func (s TLSSettings) Validate() error {
+	if (s.CertFile == "") != (s.KeyFile == "") {
+		return errors.New("the certificate and the key must be set together")
+	}
+	if s.CertFile != "" && len(s.AutocertHosts) > 0 {
+		return errors.New("the certificate can't be set when it's obtained automatically")
+	}
+	if len(s.AutocertHosts) > 0 && s.AutocertCacheDir == "" {
+		return errors.New("the autocert cache directory must be set, otherwise a new certificate is requested on every restart")
+	}
+
+	return nil
+}
+
+// configureTLS sets up the server for serving HTTPS, and returns the handler for the HTTP-01 ACME challenges.
+// The handler is nil when the certificates aren't obtained automatically.
+// The server is then started with ListenAndServeTLS(s.CertFile, s.KeyFile); the names are empty with autocert.
+func configureTLS(srv *http.Server, s TLSSettings) (http.Handler, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	var clientCAs *x509.CertPool
+	if s.ClientCAFile != "" {
+		pem, err := os.ReadFile(s.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CAs: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no client CA certificates found")
+		}
+	}
+	if len(s.AutocertHosts) == 0 {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		setClientCAs(srv.TLSConfig, clientCAs)
+		return nil, nil
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(s.AutocertHosts...),
+		Cache:      autocert.DirCache(s.AutocertCacheDir),
+		Email:      s.AutocertEmail,
+	}
+	// The manager's config answers the TLS-ALPN-01 challenges on the TLS port itself.
+	srv.TLSConfig = m.TLSConfig()
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+	setClientCAs(srv.TLSConfig, clientCAs)
+
+	return m.HTTPHandler(nil), nil
+}
+
+// setClientCAs makes the config verify the client certificates with the CAs, when there are any.
+// The clients without certificates can still connect, and authenticate with the other methods.
+func setClientCAs(cfg *tls.Config, cas *x509.CertPool) {
+	if cas == nil {
+		return
+	}
+	cfg.ClientCAs = cas
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+}
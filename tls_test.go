@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLSSettingsValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		settings TLSSettings
+		wantErr  bool
+	}{
+		"disabled":               {settings: TLSSettings{}},
+		"cert and key":           {settings: TLSSettings{CertFile: "cert.pem", KeyFile: "key.pem"}},
+		"autocert":               {settings: TLSSettings{AutocertHosts: []string{"example.com"}, AutocertCacheDir: "certs"}},
+		"cert without key":       {settings: TLSSettings{CertFile: "cert.pem"}, wantErr: true},
+		"key without cert":       {settings: TLSSettings{KeyFile: "key.pem"}, wantErr: true},
+		"cert and autocert":      {settings: TLSSettings{CertFile: "cert.pem", KeyFile: "key.pem", AutocertHosts: []string{"example.com"}, AutocertCacheDir: "certs"}, wantErr: true},
+		"autocert without cache": {settings: TLSSettings{AutocertHosts: []string{"example.com"}}, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := tc.settings.Validate()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t)
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	})}
+	configureHTTP2(srv, HTTP2Settings{})
+	challenge, err := configureTLS(srv, TLSSettings{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("configuring TLS: %v", err)
+	}
+	if challenge != nil {
+		t.Error("got the ACME challenge handler without autocert")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	go func() { _ = srv.ServeTLS(ln, certFile, keyFile) }()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("got protocol %s, want HTTP/2 negotiated over TLS", body)
+	}
+}
+
+// writeSelfSignedCert writes a certificate for 127.0.0.1 and its key, and returns the file paths.
+func writeSelfSignedCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("writing certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+
+	return certFile, keyFile
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	traceparentHeader = "traceparent"
+
+	traceBatchSize     = 512
+	traceQueueSize     = 2048
+	traceFlushInterval = 5 * time.Second
+	traceExportTimeout = 10 * time.Second
+
+	defaultServiceName = "another-go-challange"
+)
+
+// OTLP span kinds and status codes.
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+
+	spanStatusError = 2
+)
+
+var tracesDropped = newCounterVec(
+	"traces_dropped_spans_total",
+	"Number of spans dropped because the export queue was full or the export failed.",
+)
+
+// tracer is the process-wide tracer. When nil, tracing is disabled and spans are no-ops.
+// It's atomic, as the spans are started by the provider goroutines, which may outlive the requests.
+var tracer atomic.Pointer[Tracer]
+
+// TracingConfig configures the span exporter.
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP traces endpoint, like "http://localhost:4318/v1/traces".
+	Endpoint string
+	// Headers are sent with every export request (e.g., authentication).
+	Headers map[string]string
+	// ServiceName is reported as the "service.name" resource attribute.
+	ServiceName string
+	// SampleRatio is the fraction of new traces that are recorded. Traces started by callers follow their sampling decision.
+	SampleRatio float64
+}
+
+// TracingConfigFromEnv returns the exporter configuration from the standard OpenTelemetry environment variables.
+func TracingConfigFromEnv() TracingConfig {
+	cfg := TracingConfig{
+		Endpoint:    os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"),
+		Headers:     parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+		SampleRatio: 1,
+	}
+	if cfg.Endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			cfg.Endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = defaultServiceName
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("OTEL_TRACES_SAMPLER_ARG"), 64); err == nil {
+		cfg.SampleRatio = v
+	}
+
+	return cfg
+}
+
+// parseOTLPHeaders parses the "key1=value1,key2=value2" headers format.
+func parseOTLPHeaders(s string) map[string]string {
+	headers := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if ok && strings.TrimSpace(k) != "" {
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return headers
+}
+
+// Tracer records spans and exports them in batches with the OTLP/HTTP JSON protocol.
+type Tracer struct {
+	cfg     TracingConfig
+	client  *http.Client
+	queue   chan *Span
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewTracer returns a tracer exporting to the configured endpoint. Call Run to start exporting.
+func NewTracer(cfg TracingConfig) *Tracer {
+	return &Tracer{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: traceExportTimeout},
+		queue:   make(chan *Span, traceQueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Run exports the finished spans until Shutdown is called.
+func (t *Tracer) Run() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(context.Background(), batch); err != nil {
+			tracesDropped.Add(float64(len(batch)))
+			slog.Warn("exporting spans failed", "spans", len(batch), "error", err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= traceBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.done:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown stops Run and waits until the queued spans are exported, or the context is done.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() { close(t.done) })
+
+	select {
+	case <-t.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+		tracesDropped.Inc()
+	}
+}
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// Span is a timed operation within a trace. A nil span is valid, and does nothing.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent [8]byte
+	name   string
+	kind   int
+	start  time.Time
+	end    time.Time
+	attrs  []spanAttr
+	errMsg string
+	m      sync.Mutex
+}
+
+type spanAttr struct {
+	key   string
+	value interface{}
+}
+
+type spanKey struct{}
+
+// startSpan starts a span as a child of the span in the context (or as a new trace), and returns the context with it.
+// When tracing is disabled or the trace isn't sampled, the returned span is nil.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	parent, ok := ctx.Value(spanKey{}).(SpanContext)
+	return startSpanWithParent(ctx, name, kind, parent, ok)
+}
+
+func startSpanWithParent(ctx context.Context, name string, kind int, parent SpanContext, hasParent bool) (context.Context, *Span) {
+	t := tracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	sc := SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled}
+	if !hasParent {
+		_, _ = rand.Read(sc.TraceID[:])
+		sc.Sampled = sampled(sc.TraceID, t.cfg.SampleRatio)
+	}
+	_, _ = rand.Read(sc.SpanID[:])
+	ctx = context.WithValue(ctx, spanKey{}, sc)
+	if !sc.Sampled {
+		return ctx, nil
+	}
+
+	return ctx, &Span{
+		tracer: t,
+		sc:     sc,
+		parent: parent.SpanID,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+	}
+}
+
+// sampled makes the sampling decision from the trace ID, so all the spans of a trace get the same decision.
+func sampled(traceID [16]byte, ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 {
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>11)/(1<<53) < ratio
+}
+
+// SetAttr adds an attribute to the span. Supported values are strings, bools, ints and floats.
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.attrs = append(s.attrs, spanAttr{key: key, value: value})
+}
+
+// RecordError marks the span as failed.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.errMsg = err.Error()
+}
+
+// End finishes the span and queues it for export.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.m.Lock()
+	s.end = time.Now()
+	s.m.Unlock()
+	s.tracer.enqueue(s)
+}
+
+// withTracing starts a server span for every request, continuing the trace from the "traceparent" header.
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		parent, ok := parseTraceparent(req.Header.Get(traceparentHeader))
+		ctx, span := startSpanWithParent(req.Context(), req.Method, spanKindServer, parent, ok)
+		if span == nil {
+			next.ServeHTTP(w, req.WithContext(ctx))
+			return
+		}
+		defer span.End()
+
+		span.SetAttr("http.request.method", req.Method)
+		span.SetAttr("url.path", req.URL.Path)
+		if id := requestIDFromContext(ctx); id != "" {
+			span.SetAttr("request_id", id)
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req.WithContext(ctx))
+
+		span.SetAttr("http.response.status_code", rec.Status())
+		if rec.Status() >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("status %d", rec.Status()))
+		}
+	})
+}
+
+// parseTraceparent parses the W3C trace context header, like "00-<trace id>-<parent id>-<flags>".
+func parseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil || sc.TraceID == [16]byte{} {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil || sc.SpanID == [8]byte{} {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+
+	return sc, true
+}
+
+// traceparentFromContext formats the span context in the context as the "traceparent" header.
+// It returns an empty string when there is no span context.
+func traceparentFromContext(ctx context.Context) string {
+	sc, ok := ctx.Value(spanKey{}).(SpanContext)
+	if !ok {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// export sends the spans with the OTLP/HTTP JSON protocol.
+func (t *Tracer) export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(t.otlpRequest(spans))
+	if err != nil {
+		return fmt.Errorf("encoding spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+type otlpValue map[string]interface{}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpValue  `json:"status,omitempty"`
+}
+
+func (t *Tracer) otlpRequest(spans []*Span) interface{} {
+	out := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		s.m.Lock()
+		out[i] = otlpSpan{
+			TraceID:           hex.EncodeToString(s.sc.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.sc.SpanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent != [8]byte{} {
+			out[i].ParentSpanID = hex.EncodeToString(s.parent[:])
+		}
+		for _, a := range s.attrs {
+			out[i].Attributes = append(out[i].Attributes, otlpAttr{Key: a.key, Value: otlpAttrValue(a.value)})
+		}
+		if s.errMsg != "" {
+			out[i].Status = otlpValue{"code": spanStatusError, "message": s.errMsg}
+		}
+		s.m.Unlock()
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttr{{Key: "service.name", Value: otlpValue{"stringValue": t.cfg.ServiceName}}},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": defaultServiceName},
+				"spans": out,
+			}},
+		}},
+	}
+}
+
+func otlpAttrValue(v interface{}) otlpValue {
+	switch v := v.(type) {
+	case string:
+		return otlpValue{"stringValue": v}
+	case bool:
+		return otlpValue{"boolValue": v}
+	case int:
+		return otlpValue{"intValue": strconv.Itoa(v)}
+	case int64:
+		return otlpValue{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return otlpValue{"doubleValue": v}
+	default:
+		return otlpValue{"stringValue": fmt.Sprint(v)}
+	}
+}
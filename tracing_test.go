@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	var (
+		spans []otlpSpan
+		m     sync.Mutex
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("decoding export request: %v", err)
+		}
+		m.Lock()
+		defer m.Unlock()
+		for _, rs := range body.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	tr := NewTracer(TracingConfig{Endpoint: collector.URL, ServiceName: "test", SampleRatio: 1})
+	tracer.Store(tr)
+	defer tracer.Store(nil)
+	go tr.Run()
+
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1, shouldFail: true},
+		Provider2: &mockContentProvider{source: Provider2},
+	}
+	service, err := NewService([]ContentConfig{{Type: Provider1, Fallback: &Provider2}}, clients, defaultTimeout)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+	srv := httptest.NewServer(withTracing(&Handler{service: service}))
+	defer srv.Close()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?count=1", nil)
+	req.Header.Set(traceparentHeader, "00-"+traceID+"-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := tr.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	names := make(map[string]int)
+	fallbacks := 0
+	for _, s := range spans {
+		names[s.Name]++
+		if s.TraceID != traceID {
+			t.Errorf("span %s: got trace ID %s, want %s", s.Name, s.TraceID, traceID)
+		}
+		for _, a := range s.Attributes {
+			if a.Key == "content.fallback" && a.Value["boolValue"] == true {
+				fallbacks++
+			}
+		}
+	}
+	if names[http.MethodGet] != 1 || names["Service.GetContent"] != 1 || names["provider.fetch"] != 2 {
+		t.Errorf("got spans %v, want a server span, a service span and 2 provider fetches", names)
+	}
+	if fallbacks != 1 {
+		t.Errorf("got %d fallback fetch spans, want 1", fallbacks)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for name, tc := range map[string]struct {
+		header      string
+		wantOK      bool
+		wantSampled bool
+	}{
+		"sampled":       {header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantOK: true, wantSampled: true},
+		"not sampled":   {header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", wantOK: true},
+		"empty":         {header: ""},
+		"zero trace ID": {header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		"invalid hex":   {header: "00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01"},
+		"bad version":   {header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sc, ok := parseTraceparent(tc.header)
+			if ok != tc.wantOK || sc.Sampled != tc.wantSampled {
+				t.Errorf("got %v, sampled %v, want %v, sampled %v", ok, sc.Sampled, tc.wantOK, tc.wantSampled)
+			}
+		})
+	}
+}
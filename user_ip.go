@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUserIPRequired is returned for calls to providers requiring the user IP, when it isn't known.
+var ErrUserIPRequired = errors.New("provider requires the user IP")
+
+// UserIPPolicy tells what a provider gets as the user IP.
+type UserIPPolicy string
+
+// User IP policies. The empty policy passes the user IP as it is, but doesn't require it.
+const (
+	// UserIPNever never sends the user IP to the provider.
+	UserIPNever UserIPPolicy = "never"
+	// UserIPAnonymized sends the user IP with the host part zeroed, like in "203.0.113.0".
+	UserIPAnonymized UserIPPolicy = "anonymized"
+	// UserIPAlways sends the user IP, and skips the calls when it isn't known.
+	UserIPAlways UserIPPolicy = "always"
+)
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *UserIPPolicy) UnmarshalText(text []byte) error {
+	switch v := UserIPPolicy(text); v {
+	case "", UserIPNever, UserIPAnonymized, UserIPAlways:
+		*p = v
+		return nil
+	default:
+		return fmt.Errorf("invalid user IP policy '%s', must be never, anonymized or always", v)
+	}
+}
+
+// userIPClient is a Client decorator enforcing the provider's user IP policy.
+type userIPClient struct {
+	client Client
+	policy UserIPPolicy
+}
+
+// GetContent implements Client.
+func (c *userIPClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	switch c.policy {
+	case UserIPNever:
+		meta.IP = ""
+	case UserIPAnonymized:
+		meta.IP = anonymizeIP(meta.IP)
+	case UserIPAlways:
+		if meta.IP == "" {
+			return nil, ErrUserIPRequired
+		}
+	}
+
+	return c.client.GetContent(ctx, meta, count)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// ipRecordingClient remembers the user IP of the last call.
+type ipRecordingClient struct {
+	userIP string
+}
+
+func (c *ipRecordingClient) GetContent(ctx context.Context, userIP string, count int) ([]*ContentItem, error) {
+	c.userIP = userIP
+	items := make([]*ContentItem, count)
+	for i := range items {
+		items[i] = &ContentItem{ID: testIDs.NewID()}
+	}
+	return items, nil
+}
+
+func TestUserIPPolicy(t *testing.T) {
+	for name, tc := range map[string]struct {
+		policy  UserIPPolicy
+		userIP  string
+		wantIP  string
+		wantErr error
+	}{
+		"default":            {userIP: "203.0.113.7", wantIP: "203.0.113.7"},
+		"default without IP": {wantIP: ""},
+		"never":              {policy: UserIPNever, userIP: "203.0.113.7", wantIP: ""},
+		"anonymized":         {policy: UserIPAnonymized, userIP: "203.0.113.7", wantIP: "203.0.113.0"},
+		"always":             {policy: UserIPAlways, userIP: "203.0.113.7", wantIP: "203.0.113.7"},
+		"always without IP":  {policy: UserIPAlways, wantErr: ErrUserIPRequired},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := &ipRecordingClient{userIP: "not called"}
+			service, err := NewService([]ContentConfig{{Type: Provider1}}, map[Provider]Client{Provider1: AdaptSimpleClient(client)}, defaultTimeout,
+				WithUserIPPolicies(map[Provider]UserIPPolicy{Provider1: tc.policy}))
+			if err != nil {
+				t.Fatalf("creating a service: %v", err)
+			}
+
+			result, err := service.GetContentResult(context.Background(), RequestMeta{IP: tc.userIP}, 1, 0)
+			if err != nil {
+				t.Fatalf("getting content: %v", err)
+			}
+			if tc.wantErr != nil {
+				if len(result.Failures) != 1 || client.userIP != "not called" {
+					t.Errorf("got failures %+v, want the provider skipped", result.Failures)
+				}
+				return
+			}
+			if client.userIP != tc.wantIP {
+				t.Errorf("provider got user IP %q, want %q", client.userIP, tc.wantIP)
+			}
+		})
+	}
+
+	var policy UserIPPolicy
+	if err := policy.UnmarshalText([]byte("sometimes")); err == nil {
+		t.Error("expected an error for an invalid policy")
+	}
+}
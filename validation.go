@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ErrInvalidItems is returned for the provider responses with invalid items, when the provider's invalid items fail the call.
+var ErrInvalidItems = errors.New("provider returned invalid items")
+
+// invalidItemsBackfillAttempts is the maximum number of extra provider calls made to replace the dropped invalid items.
+const invalidItemsBackfillAttempts = 1
+
+var (
+	invalidItems = newCounterVec(
+		"invalid_items_total",
+		"Number of invalid provider items, by reason (null, missing_id, missing_title, invalid_expiry, source_mismatch).",
+		"provider", "reason",
+	)
+	invalidItemsBackfills = newCounterVec(
+		"invalid_items_backfill_calls_total",
+		"Number of extra provider calls made to replace the dropped invalid items, by result (ok, error).",
+		"provider", "result",
+	)
+)
+
+// InvalidItemsPolicy tells what happens to the invalid items of a provider.
+type InvalidItemsPolicy string
+
+// Invalid items policies. The empty policy of a provider means the default one.
+const (
+	// InvalidItemsOff passes the items on without validation.
+	InvalidItemsOff InvalidItemsPolicy = "off"
+	// InvalidItemsDrop drops the invalid items, and asks the provider for more to replace them.
+	InvalidItemsDrop InvalidItemsPolicy = "drop"
+	// InvalidItemsFail fails the whole provider call, so the fallbacks are used.
+	InvalidItemsFail InvalidItemsPolicy = "fail"
+)
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *InvalidItemsPolicy) UnmarshalText(text []byte) error {
+	switch v := InvalidItemsPolicy(text); v {
+	case "", InvalidItemsOff, InvalidItemsDrop, InvalidItemsFail:
+		*p = v
+		return nil
+	default:
+		return fmt.Errorf("unknown invalid items policy '%s', must be off, drop or fail", v)
+	}
+}
+
+// ItemValidationSettings configure the validation of the provider items.
+type ItemValidationSettings struct {
+	// Policy is the policy of the providers without their own. Empty means off.
+	Policy InvalidItemsPolicy
+	// Providers override the policy for individual providers.
+	Providers map[Provider]InvalidItemsPolicy
+}
+
+// forProvider returns the effective policy for the provider.
+func (s ItemValidationSettings) forProvider(p Provider) InvalidItemsPolicy {
+	if policy := s.Providers[p]; policy != "" {
+		return policy
+	}
+	if s.Policy == "" {
+		return InvalidItemsOff
+	}
+	return s.Policy
+}
+
+// sanitizeItem returns the item with the surrounding whitespace trimmed from the ID and the title,
+// or the reason why it's invalid. The item isn't modified; a copy is returned when anything is trimmed.
+func sanitizeItem(item *ContentItem, p Provider) (*ContentItem, string) {
+	if item == nil {
+		return nil, "null"
+	}
+	id, title := strings.TrimSpace(item.ID), strings.TrimSpace(item.Title)
+	switch {
+	case id == "":
+		return nil, "missing_id"
+	case title == "":
+		return nil, "missing_title"
+	case !item.Expiry.IsZero() && !item.Expiry.After(time.Unix(0, 0)):
+		// Items without an expiry never expire, but an expiry at (or before) the Unix epoch is an unset timestamp.
+		return nil, "invalid_expiry"
+	case item.Source != string(p):
+		return nil, "source_mismatch"
+	}
+	if id != item.ID || title != item.Title {
+		sanitized := *item
+		sanitized.ID, sanitized.Title = id, title
+		item = &sanitized
+	}
+	return item, ""
+}
+
+// validatingClient is a Client decorator checking the items returned by the provider, so malformed upstream data
+// doesn't reach the clients (or the cache). Depending on the policy, the invalid items are dropped and replaced
+// with more items of the provider, or the call fails with ErrInvalidItems.
+type validatingClient struct {
+	client   Client
+	provider Provider
+	policy   InvalidItemsPolicy
+}
+
+// GetContent implements Client.
+func (c *validatingClient) GetContent(ctx context.Context, meta RequestMeta, count int) ([]*ContentItem, error) {
+	items, err := c.client.GetContent(ctx, meta, count)
+	if err != nil {
+		return nil, err
+	}
+	valid, reason := c.validate(items)
+	if reason != "" && c.policy == InvalidItemsFail {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidItems, reason)
+	}
+
+	// A provider returning fewer items than asked for has no more, so there's nothing to replace the dropped ones with.
+	asked := count
+	for attempt := 0; len(valid) < count && len(items) == asked && attempt < invalidItemsBackfillAttempts; attempt++ {
+		asked = count - len(valid)
+		more, err := c.client.GetContent(ctx, meta, asked)
+		if err != nil {
+			slog.WarnContext(ctx, "backfilling invalid items failed", "provider", c.provider, "error", err)
+			invalidItemsBackfills.Inc(string(c.provider), "error")
+			break
+		}
+		invalidItemsBackfills.Inc(string(c.provider), "ok")
+
+		seen := make(map[string]bool, len(valid))
+		for _, item := range valid {
+			seen[item.ID] = true
+		}
+		moreValid, _ := c.validate(more)
+		for _, item := range moreValid {
+			if !seen[item.ID] && len(valid) < count {
+				seen[item.ID] = true
+				valid = append(valid, item)
+			}
+		}
+		items = more
+	}
+
+	return valid, nil
+}
+
+// validate returns the sanitized valid items, and the reason of the first invalid item, if there was any.
+// The expiry of the valid items already expired is recorded as the provider's clock skew.
+func (c *validatingClient) validate(items []*ContentItem) ([]*ContentItem, string) {
+	valid := make([]*ContentItem, 0, len(items))
+	var firstReason string
+	for _, item := range items {
+		sanitized, reason := sanitizeItem(item, c.provider)
+		if reason != "" {
+			invalidItems.Inc(string(c.provider), reason)
+			if firstReason == "" {
+				firstReason = reason
+			}
+			continue
+		}
+		valid = append(valid, sanitized)
+	}
+	observeExpirySkew(valid, c.provider, time.Now())
+	return valid, firstReason
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSanitizeItem(t *testing.T) {
+	expiry := time.Now().Add(time.Hour)
+	for name, tc := range map[string]struct {
+		item       *ContentItem
+		want       *ContentItem
+		wantReason string
+	}{
+		"valid": {
+			item: &ContentItem{ID: "a", Title: "title", Source: "1", Expiry: expiry},
+			want: &ContentItem{ID: "a", Title: "title", Source: "1", Expiry: expiry},
+		},
+		"without expiry": {
+			item: &ContentItem{ID: "a", Title: "title", Source: "1"},
+			want: &ContentItem{ID: "a", Title: "title", Source: "1"},
+		},
+		"trimmed": {
+			item: &ContentItem{ID: " a\n", Title: "\ttitle ", Source: "1"},
+			want: &ContentItem{ID: "a", Title: "title", Source: "1"},
+		},
+		"null":            {item: nil, wantReason: "null"},
+		"missing id":      {item: &ContentItem{ID: " ", Title: "title", Source: "1"}, wantReason: "missing_id"},
+		"missing title":   {item: &ContentItem{ID: "a", Source: "1"}, wantReason: "missing_title"},
+		"epoch expiry":    {item: &ContentItem{ID: "a", Title: "title", Source: "1", Expiry: time.Unix(0, 0)}, wantReason: "invalid_expiry"},
+		"source mismatch": {item: &ContentItem{ID: "a", Title: "title", Source: "2"}, wantReason: "source_mismatch"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var original ContentItem
+			if tc.item != nil {
+				original = *tc.item
+			}
+			got, reason := sanitizeItem(tc.item, Provider1)
+			if reason != tc.wantReason {
+				t.Errorf("got reason %q, want %q", reason, tc.wantReason)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got item %+v, want %+v", got, tc.want)
+			}
+			if tc.item != nil && !reflect.DeepEqual(*tc.item, original) {
+				t.Errorf("the item was modified: %+v", tc.item)
+			}
+		})
+	}
+}
+
+func TestItemValidation(t *testing.T) {
+	item := func(id, title string) *ContentItem {
+		return &ContentItem{ID: id, Title: title, Source: string(Provider1)}
+	}
+	p2 := Provider2
+
+	for name, tc := range map[string]struct {
+		policy     InvalidItemsPolicy
+		responses  [][]*ContentItem
+		wantIDs    []string
+		wantCounts []int
+	}{
+		"off": {
+			policy:     InvalidItemsOff,
+			responses:  [][]*ContentItem{{item("a", "A"), item("b", ""), item("c", "C")}},
+			wantIDs:    []string{"a", "b", "c"},
+			wantCounts: []int{3},
+		},
+		"dropped and backfilled": {
+			policy: InvalidItemsDrop,
+			responses: [][]*ContentItem{
+				{item("a", "A"), item("b", ""), item("c", "C")},
+				{item("a", "A"), item("d", "D")},
+			},
+			wantIDs:    []string{"a", "c", "d"},
+			wantCounts: []int{3, 1},
+		},
+		"short response left to the fallback": {
+			policy:     InvalidItemsDrop,
+			responses:  [][]*ContentItem{{item("a", "A"), item("b", "")}},
+			wantIDs:    []string{"a", "2", "2"},
+			wantCounts: []int{3},
+		},
+		"failed": {
+			policy:     InvalidItemsFail,
+			responses:  [][]*ContentItem{{item("a", "A"), item("b", ""), item("c", "C")}},
+			wantIDs:    []string{"2", "2", "2"},
+			wantCounts: []int{3},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := &scriptedClient{responses: tc.responses}
+			clients := map[Provider]Client{
+				Provider1: client,
+				Provider2: &mockContentProvider{source: Provider2, itemID: "2"},
+			}
+			service, err := NewService([]ContentConfig{{Type: Provider1, Fallback: &p2}}, clients, defaultTimeout,
+				WithItemValidation(ItemValidationSettings{Policy: InvalidItemsOff, Providers: map[Provider]InvalidItemsPolicy{Provider1: tc.policy}}))
+			if err != nil {
+				t.Fatalf("creating a service: %v", err)
+			}
+
+			items, err := service.GetContent(context.Background(), RequestMeta{IP: "127.0.0.1"}, 3, 0)
+			if err != nil {
+				t.Fatalf("getting content: %v", err)
+			}
+			var ids []string
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			if !reflect.DeepEqual(ids, tc.wantIDs) {
+				t.Errorf("got items %v, want %v", ids, tc.wantIDs)
+			}
+			if !reflect.DeepEqual(client.counts, tc.wantCounts) {
+				t.Errorf("got provider calls for counts %v, want %v", client.counts, tc.wantCounts)
+			}
+		})
+	}
+	if reason := failureReason(ErrInvalidItems); reason != "invalid provider response" {
+		t.Errorf("got failure reason %q", reason)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxWarmRequests is the maximum number of combinations in one warm request.
+const maxWarmRequests = 100
+
+// WarmRequest is a content request to make ahead of the traffic, so the provider responses get cached.
+type WarmRequest struct {
+	Count  int `json:"count"`
+	Offset int `json:"offset"`
+	// UserIP is needed only for providers cached per user.
+	UserIP string `json:"user_ip,omitempty"`
+}
+
+// WarmResult is the outcome of a WarmRequest.
+type WarmResult struct {
+	WarmRequest
+	// Status is "ok" or "error".
+	Status     string  `json:"status"`
+	Items      int     `json:"items"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// validateWarmRequests checks the list of requests to warm the cache with.
+func validateWarmRequests(reqs []WarmRequest) error {
+	if len(reqs) == 0 {
+		return errors.New("no requests given")
+	}
+	if len(reqs) > maxWarmRequests {
+		return fmt.Errorf("at most %d requests can be given", maxWarmRequests)
+	}
+	for i, r := range reqs {
+		if r.Count <= 0 || r.Offset < 0 {
+			return fmt.Errorf("request %d: count must be positive and offset must be positive or zero", i)
+		}
+	}
+
+	return nil
+}
+
+// Warm makes the requests one by one, filling the cache with the provider responses.
+func (s *Service) Warm(ctx context.Context, reqs []WarmRequest) []WarmResult {
+	results := make([]WarmResult, len(reqs))
+	for i, r := range reqs {
+		start := time.Now()
+		items, err := s.GetContent(ctx, RequestMeta{IP: r.UserIP}, r.Count, r.Offset)
+		results[i] = WarmResult{
+			WarmRequest: r,
+			Status:      "ok",
+			Items:       len(items),
+			DurationMS:  float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			results[i].Status = "error"
+			results[i].Error = err.Error()
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,41 @@
+package main
+
+// maxTotalWeight limits the length of the interleaved items sequence.
+const maxTotalWeight = 1000
+
+// interleave returns the sequence of the configs used for the response positions, repeated when more items are needed.
+// Every config appears in the sequence as many times as its weight (at least once), spread evenly
+// with smooth weighted round-robin: weights 3:1:1 of A, B and C give A, B, A, C, A.
+// Configs without weights are returned as they are.
+func interleave(configs []ContentConfig) []ContentConfig {
+	total := 0
+	weighted := false
+	for _, c := range configs {
+		total += c.weight()
+		weighted = weighted || c.Weight > 1
+	}
+	if !weighted {
+		return configs
+	}
+
+	sequence := make([]ContentConfig, 0, total)
+	current := make([]int, len(configs))
+	for range total {
+		best := 0
+		for i, c := range configs {
+			current[i] += c.weight()
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		sequence = append(sequence, configs[best])
+	}
+
+	return sequence
+}
+
+// weight returns the effective weight of the config; zero means 1.
+func (c ContentConfig) weight() int {
+	return max(c.Weight, 1)
+}
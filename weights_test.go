@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestInterleave(t *testing.T) {
+	for name, tc := range map[string]struct {
+		configs []ContentConfig
+		want    string
+	}{
+		"no weights":      {configs: []ContentConfig{{Type: "a"}, {Type: "b"}, {Type: "a"}}, want: "aba"},
+		"3:1:1":           {configs: []ContentConfig{{Type: "a", Weight: 3}, {Type: "b", Weight: 1}, {Type: "c", Weight: 1}}, want: "abaca"},
+		"zero is one":     {configs: []ContentConfig{{Type: "a", Weight: 2}, {Type: "b"}}, want: "aba"},
+		"2:2":             {configs: []ContentConfig{{Type: "a", Weight: 2}, {Type: "b", Weight: 2}}, want: "abab"},
+		"single weighted": {configs: []ContentConfig{{Type: "a", Weight: 3}}, want: "aaa"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var got strings.Builder
+			for _, c := range interleave(tc.configs) {
+				got.WriteString(string(c.Type))
+			}
+			if got.String() != tc.want {
+				t.Errorf("got %s, want %s", got.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestWeightedItems(t *testing.T) {
+	cfg := &FileConfig{Items: []ItemConfig{
+		{Provider: Provider1, Weight: 3},
+		{Provider: Provider2, Weight: 1},
+		{Provider: Provider3, Weight: 1},
+	}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	clients := map[Provider]Client{
+		Provider1: &mockContentProvider{source: Provider1},
+		Provider2: &mockContentProvider{source: Provider2},
+		Provider3: &mockContentProvider{source: Provider3},
+	}
+	service, err := NewServiceFromConfig(cfg, clients)
+	if err != nil {
+		t.Fatalf("creating a service: %v", err)
+	}
+
+	items, err := service.GetContent(context.Background(), RequestMeta{}, 10, 0)
+	if err != nil {
+		t.Fatalf("getting content: %v", err)
+	}
+	var got strings.Builder
+	for _, item := range items {
+		got.WriteString(item.Source)
+	}
+	if want := "1213112131"; got.String() != want {
+		t.Errorf("got sources %s, want %s", got.String(), want)
+	}
+	if w := service.Config().Items[0].Weight; w != 3 {
+		t.Errorf("got weight %d in the config, want 3", w)
+	}
+}